@@ -2,9 +2,10 @@ package ai
 
 import (
 	"alfa-hack-backend/internal/models"
-	"archive/zip"
+	"alfa-hack-backend/internal/storage"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,170 +14,140 @@ import (
 	"time"
 )
 
-// GenerateResponse генерирует ответ на основе сообщения пользователя, категории, username, названия бизнеса, специализации и загруженных файлов
-func GenerateResponse(message, category, username, businessName, specialization string, files []models.File) (string, error) {
+// fileStore - хранилище, из которого читаются загруженные файлы
+var fileStore storage.Storage
+
+// SetStorage задает хранилище файлов; вызывается один раз при старте
+func SetStorage(s storage.Storage) {
+	fileStore = s
+}
+
+// Result - ответ AI вместе с информацией о том, какая модель его сгенерировала
+type Result struct {
+	Text             string
+	Provider         string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Latency          time.Duration
+	FallbackAttempts int    // сколько моделей не сработало до успешной
+	IsFallback       bool   // ответ сгенерирован шаблоном, а не моделью
+	DegradedReason   string // почему пришлось перейти на шаблон (пусто, если ответила модель)
+	Sources          []models.Source
+	PromptVersion    string // версия шаблонов, по которым собран промпт
+}
+
+// Source возвращает источник ответа: SourceLLM или SourceTemplate
+func (r *Result) Source() string {
+	if r.IsFallback {
+		return SourceTemplate
+	}
+	return SourceLLM
+}
+
+// Провайдеры ответа
+const (
+	ProviderOpenRouter = "openrouter"
+	ProviderTemplate   = "template"
+)
+
+// Источники ответа
+const (
+	SourceLLM      = "llm"
+	SourceTemplate = "template"
+)
+
+// Причины перехода в деградированный режим
+const (
+	DegradedNoAPIKey      = "no_api_key"
+	DegradedProviderError = "provider_error"
+	DegradedEmptyResponse = "empty_response"
+)
+
+// ErrAIUnavailable возвращается вместо шаблонного ответа, если AI_FALLBACK_MODE=error
+var ErrAIUnavailable = errors.New("AI временно недоступен")
+
+// templateFallbackEnabled - разрешено ли отдавать шаблонный ответ, когда модель недоступна.
+// AI_FALLBACK_MODE=error отключает шаблон, и тогда API возвращает 503.
+func templateFallbackEnabled() bool {
+	return strings.ToLower(os.Getenv("AI_FALLBACK_MODE")) != "error"
+}
+
+// GenerateResponse генерирует ответ на основе сообщения пользователя, категории, username, названия бизнеса, специализации,
+// загруженных файлов и показателей по банковским выпискам (metrics может быть nil)
+func GenerateResponse(message, category, username, businessName, specialization string, files []models.File, metrics *FinancialMetrics) (*Result, error) {
 	// Используем бесплатный API (например, Hugging Face Inference API или локальное решение)
 	// Для демо используем простую логику с возможностью подключения реального API
 
-	// Чтение содержимого файлов
-	fileContents := make([]string, 0)
-	for _, file := range files {
-		content, err := readFileContent(file.FilePath)
-		if err != nil {
-			// Логируем ошибку, но продолжаем работу
-			fmt.Printf("Ошибка чтения файла %s: %v\n", file.FilePath, err)
-			continue
-		}
-		if len(content) > 0 {
-			fileContents = append(fileContents, fmt.Sprintf("Файл: %s\n%s", file.Filename, content))
-		}
-	}
+	// Чтение содержимого файлов с разбивкой на фрагменты для цитирования
+	chunks := buildChunks(files)
+	fileContents := fileContentsFromChunks(chunks)
 
-	fmt.Printf("Загружено файлов: %d, Прочитано содержимого: %d\n", len(files), len(fileContents))
+	fmt.Printf("Загружено файлов: %d, Прочитано содержимого: %d, фрагментов: %d\n", len(files), len(fileContents), len(chunks))
 
 	// Формирование промпта
-	prompt := buildPrompt(message, category, username, businessName, specialization, fileContents)
+	prompt, promptVersion, err := buildPrompt(message, category, username, businessName, specialization, chunks, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
 
 	// Используем ТОЛЬКО OpenRouter API
 	openRouterKey := os.Getenv("OPENROUTER_API_KEY")
 	if openRouterKey == "" {
 		fmt.Println("❌ OPENROUTER_API_KEY не найден! AI не будет работать.")
 		fmt.Println("💡 Добавьте OPENROUTER_API_KEY в файл .env")
-		return generateSimpleResponse(message, category, username, businessName, specialization, fileContents), nil
+		return fallbackResult(DegradedNoAPIKey, 0, start, promptVersion, func() string {
+			return generateSimpleResponse(message, category, username, businessName, specialization, fileContents, metrics)
+		})
 	}
 
 	fmt.Println("🤖 Использую OpenRouter API...")
-	orResponse, err := callOpenRouter(prompt, openRouterKey)
-	if err == nil && orResponse != "" {
-		cleaned := cleanAIResponse(orResponse)
+	orResult, err := callOpenRouter(prompt, openRouterKey)
+	if err == nil && orResult.Text != "" {
+		cleaned := cleanAIResponse(orResult.Text)
 		if cleaned != "" {
 			fmt.Println("✅ Успешно использован: OpenRouter API")
-			return cleaned, nil
+			orResult.Text = cleaned
+			orResult.Sources = resolveCitations(cleaned, chunks)
+			orResult.PromptVersion = promptVersion
+			orResult.Latency = time.Since(start)
+			return orResult, nil
 		}
 	}
 
+	reason := DegradedEmptyResponse
 	if err != nil {
 		fmt.Printf("❌ OpenRouter API не сработал: %v\n", err)
+		reason = DegradedProviderError
 	}
 
 	// Fallback -- шаблонный ответ если API не сработал
 	fmt.Println("⚠️  OpenRouter API не сработал, использую шаблонный fallback-ответ")
-	return generateSimpleResponse(message, category, username, businessName, specialization, fileContents), nil
+	return fallbackResult(reason, orResult.FallbackAttempts, start, promptVersion, func() string {
+		return generateSimpleResponse(message, category, username, businessName, specialization, fileContents, metrics)
+	})
 }
 
-func buildPrompt(message, category, username, businessName, specialization string, fileContents []string) string {
-	var prompt strings.Builder
-
-	// Улучшенный промпт для качественного анализа
-	prompt.WriteString("Ты - профессиональный бизнес-консультант с опытом работы с малым бизнесом. Твоя задача - давать конкретные, практические и полезные советы на основе реальных данных.\n\n")
-
-	// Используем информацию о владельце и бизнесе
-	if username != "" {
-		prompt.WriteString(fmt.Sprintf("ВЛАДЕЛЕЦ БИЗНЕСА: %s\n", username))
-	}
-	if businessName != "" {
-		prompt.WriteString(fmt.Sprintf("НАЗВАНИЕ БИЗНЕСА: %s\n", businessName))
-	}
-	if specialization != "" {
-		prompt.WriteString(fmt.Sprintf("СПЕЦИАЛИЗАЦИЯ БИЗНЕСА: %s\n", specialization))
-	}
-	if username != "" || businessName != "" || specialization != "" {
-		prompt.WriteString("\n")
-	}
-
-	if len(fileContents) > 0 {
-		prompt.WriteString("═══════════════════════════════════════════════════════\n")
-		prompt.WriteString("ДОСТУПНЫЕ ДАННЫЕ О БИЗНЕСЕ:\n")
-		prompt.WriteString("═══════════════════════════════════════════════════════\n")
-		for i, content := range fileContents {
-			prompt.WriteString(fmt.Sprintf("\n[Файл %d]\n", i+1))
-			prompt.WriteString(content)
-			prompt.WriteString("\n" + strings.Repeat("-", 55) + "\n")
-		}
-		prompt.WriteString("\n⚠️ КРИТИЧЕСКИ ВАЖНО: Внимательно изучи ВСЕ данные из файлов выше перед формированием ответа!\n\n")
-	} else {
-		prompt.WriteString("⚠️ ВНИМАНИЕ: Файлы с данными о бизнесе не загружены.\n")
-		prompt.WriteString("Если вопрос требует данных из файлов, вежливо попроси пользователя загрузить их.\n\n")
-	}
-
-	if category != "" {
-		categoryNames := map[string]string{
-			"financial": "💰 Финансовый анализ",
-			"legal":     "⚖️ Юридические вопросы",
-			"hr":        "👥 Управление персоналом",
-			"marketing": "📢 Маркетинг и продвижение",
-			"growth":    "📈 Рост и развитие бизнеса",
-			"reports":   "📊 Анализ отчетов и данных",
-		}
-		if name, ok := categoryNames[category]; ok {
-			prompt.WriteString(fmt.Sprintf("КАТЕГОРИЯ ВОПРОСА: %s\n\n", name))
-		}
-	}
-
-	prompt.WriteString(fmt.Sprintf("ВОПРОС ВЛАДЕЛЬЦА БИЗНЕСА:\n%s\n\n", message))
-
-	prompt.WriteString("═══════════════════════════════════════════════════════\n")
-	prompt.WriteString("ТРЕБОВАНИЯ К ОТВЕТУ:\n")
-	prompt.WriteString("═══════════════════════════════════════════════════════\n\n")
-
-	prompt.WriteString("1. КОНКРЕТНОСТЬ:\n")
-	prompt.WriteString("   - Используй ТОЧНЫЕ цифры, имена, даты из файлов\n")
-	prompt.WriteString("   - Приводи примеры из загруженных данных\n")
-	prompt.WriteString("   - Избегай общих фраз без привязки к данным\n\n")
-
-	prompt.WriteString("2. СТРУКТУРИРОВАННОСТЬ:\n")
-	prompt.WriteString("   - Начни с краткого вывода/резюме\n")
-	prompt.WriteString("   - Используй списки и пункты для читаемости\n")
-	prompt.WriteString("   - Выделяй ключевые моменты\n\n")
-
-	prompt.WriteString("3. ПРАКТИЧНОСТЬ:\n")
-	prompt.WriteString("   - Давай конкретные рекомендации, которые можно применить\n")
-	prompt.WriteString("   - Предлагай шаги для решения проблемы\n")
-	if username != "" || businessName != "" || specialization != "" {
-		prompt.WriteString("   - Учитывай специфику ")
-		if username != "" {
-			prompt.WriteString(fmt.Sprintf("бизнеса владельца %s", username))
-		}
-		if businessName != "" {
-			if username != "" {
-				prompt.WriteString(fmt.Sprintf(" (\"%s\")", businessName))
-			} else {
-				prompt.WriteString(fmt.Sprintf("бизнеса \"%s\"", businessName))
-			}
-		}
-		if specialization != "" {
-			if username != "" || businessName != "" {
-				prompt.WriteString(fmt.Sprintf(" в сфере %s", specialization))
-			} else {
-				prompt.WriteString(fmt.Sprintf("бизнеса в сфере %s", specialization))
-			}
-		}
-		prompt.WriteString("\n\n")
-	} else {
-		prompt.WriteString("   - Учитывай специфику малого бизнеса\n\n")
-	}
-
-	prompt.WriteString("4. АНАЛИТИЧНОСТЬ:\n")
-	prompt.WriteString("   - Сравнивай данные между периодами/категориями\n")
-	prompt.WriteString("   - Выявляй тренды и закономерности\n")
-	prompt.WriteString("   - Указывай на проблемы и возможности\n\n")
-
-	prompt.WriteString("5. ПРОФЕССИОНАЛИЗМ:\n")
-	prompt.WriteString("   - Пиши деловым, но понятным языком\n")
-	prompt.WriteString("   - Избегай шаблонных фраз\n")
-	prompt.WriteString("   - Будь честным: если данных недостаточно, скажи об этом\n\n")
-
-	prompt.WriteString("6. ФОРМАТ:\n")
-	prompt.WriteString("   - Отвечай ТОЛЬКО на русском языке\n")
-	prompt.WriteString("   - Используй абзацы для структуры\n")
-	prompt.WriteString("   - НЕ повторяй вопрос в начале ответа\n")
-	prompt.WriteString("   - Начинай сразу с сути\n\n")
-
-	prompt.WriteString("═══════════════════════════════════════════════════════\n")
-	prompt.WriteString("НАЧНИ СВОЙ ОТВЕТ:\n")
-	prompt.WriteString("═══════════════════════════════════════════════════════\n")
-
-	return prompt.String()
+// fallbackResult формирует шаблонный ответ с указанием причины деградации.
+// Если шаблон отключен через AI_FALLBACK_MODE, возвращает ErrAIUnavailable и Result без текста.
+func fallbackResult(reason string, attempts int, start time.Time, promptVersion string, generate func() string) (*Result, error) {
+	result := &Result{
+		Provider:         ProviderTemplate,
+		FallbackAttempts: attempts,
+		IsFallback:       true,
+		DegradedReason:   reason,
+		Sources:          []models.Source{},
+		PromptVersion:    promptVersion,
+	}
+	if !templateFallbackEnabled() {
+		result.Latency = time.Since(start)
+		return result, ErrAIUnavailable
+	}
+	result.Text = generate()
+	result.Latency = time.Since(start)
+	return result, nil
 }
 
 func cleanAIResponse(text string) string {
@@ -433,7 +404,7 @@ func min(a, b int) int {
 	return b
 }
 
-func generateSimpleResponse(message, category, username, businessName, specialization string, fileContents []string) string {
+func generateSimpleResponse(message, category, username, businessName, specialization string, fileContents []string, metrics *FinancialMetrics) string {
 	var response strings.Builder
 	messageLower := strings.ToLower(message)
 
@@ -443,8 +414,10 @@ func generateSimpleResponse(message, category, username, businessName, specializ
 
 	fmt.Printf("DEBUG: message='%s', category='%s', files=%d, textLength=%d\n", message, category, len(fileContents), len(allFileText))
 
+	// Категория уже определена классификатором (ClassifyQuestion), если пользователь ее не выбрал
+
 	// Финансовые вопросы
-	if category == "financial" || strings.Contains(messageLower, "прибыль") || strings.Contains(messageLower, "выручка") || strings.Contains(messageLower, "доход") || strings.Contains(messageLower, "расход") {
+	if category == "financial" {
 		response.WriteString("📊 **Финансовый анализ:**\n\n")
 
 		if len(fileContents) > 0 {
@@ -501,18 +474,16 @@ func generateSimpleResponse(message, category, username, businessName, specializ
 	}
 
 	// Вопросы по персоналу
-	if category == "hr" || strings.Contains(messageLower, "сотрудник") || strings.Contains(messageLower, "работник") || strings.Contains(messageLower, "персонал") {
+	if category == "hr" {
 		response.WriteString("👥 **Информация о персонале:**\n\n")
 
-		if len(fileContents) > 0 {
+		// Расчет зарплаты по списку сотрудников, если он есть в файлах
+		if info := employeeInfo(metrics, allFileText); info != "" {
+			response.WriteString(info)
+		} else if len(fileContents) > 0 {
 			if strings.Contains(allFileTextLower, "сотрудник") || strings.Contains(allFileTextLower, "работник") {
-				// Поиск информации о сотрудниках
-				employeeInfo := extractEmployeeInfo(allFileText)
-				if len(employeeInfo) > 0 {
-					response.WriteString(employeeInfo)
-				} else {
-					response.WriteString("В загруженных файлах найдена информация о сотрудниках, но требуется более детальный анализ.\n\n")
-				}
+				response.WriteString("В загруженных файлах есть упоминания сотрудников, но нет таблицы с ФИО и окладами.\n")
+				response.WriteString("Загрузите список сотрудников или штатное расписание (ФИО, должность, оклад, дата приема), чтобы посчитать зарплату, НДФЛ и взносы.\n\n")
 			} else {
 				response.WriteString("В загруженных файлах не найдена информация о сотрудниках.\n")
 				response.WriteString("Загрузите файл с данными о персонале для получения подробной информации.\n\n")
@@ -525,12 +496,22 @@ func generateSimpleResponse(message, category, username, businessName, specializ
 	// Юридические вопросы
 	if category == "legal" {
 		response.WriteString("⚖️ **Юридический вопрос:**\n\n")
+		// Расчет налогов по системе налогообложения из профиля, если вопрос о налогах
+		if strings.Contains(messageLower, "налог") || strings.Contains(messageLower, "усн") ||
+			strings.Contains(messageLower, "взнос") || strings.Contains(messageLower, "патент") ||
+			strings.Contains(messageLower, "ндс") || strings.Contains(messageLower, "ндфл") {
+			if info := taxInfo(metrics); info != "" {
+				response.WriteString(info)
+			} else {
+				response.WriteString("Чтобы посчитать налоги, укажите систему налогообложения в профиле бизнеса и загрузите банковские выписки.\n\n")
+			}
+		}
 		response.WriteString("Для точных ответов на юридические вопросы рекомендую проконсультироваться с юристом.\n")
 		response.WriteString("Я могу помочь с общими вопросами, но не могу давать юридические консультации.\n\n")
 	}
 
 	// Общие вопросы или если категория не определена
-	if category == "" || category == "marketing" {
+	if category == "" || category == "marketing" || category == "growth" || category == "reports" {
 		// Проверяем наличие файлов
 		if len(fileContents) > 0 {
 			// Анализируем вопрос пользователя
@@ -544,8 +525,8 @@ func generateSimpleResponse(message, category, username, businessName, specializ
 				strings.Contains(messageLower, "работник") ||
 				strings.Contains(messageLower, "персонал")
 
-			hasGrowthQuestion := strings.Contains(messageLower, "как") &&
-				(strings.Contains(messageLower, "вырос") || strings.Contains(messageLower, "рост"))
+			hasGrowthQuestion := category == "growth" || (strings.Contains(messageLower, "как") &&
+				(strings.Contains(messageLower, "вырос") || strings.Contains(messageLower, "рост")))
 
 			// Если есть конкретный вопрос, пытаемся найти ответ
 			if hasFinancialQuestion {
@@ -560,9 +541,9 @@ func generateSimpleResponse(message, category, username, businessName, specializ
 					response.WriteString("- Сколько выручки в декабре?\n\n")
 				}
 			} else if hasEmployeeQuestion {
-				employeeInfo := extractEmployeeInfo(allFileText)
-				if employeeInfo != "" {
-					response.WriteString(employeeInfo)
+				if info := employeeInfo(metrics, allFileText); info != "" {
+					response.WriteString("👥 **Информация о персонале:**\n\n")
+					response.WriteString(info)
 				} else {
 					response.WriteString("👥 **Информация о персонале:**\n\n")
 					response.WriteString("В ваших файлах найдена информация о сотрудниках.\n")
@@ -667,47 +648,6 @@ func extractLinesContaining(text string, keywords []string) []string {
 	return result
 }
 
-func extractEmployeeInfo(text string) string {
-	var result strings.Builder
-	lines := strings.Split(text, "\n")
-
-	employeeCount := 0
-	var employees []string
-
-	for i, line := range lines {
-		lineLower := strings.ToLower(line)
-		if strings.Contains(lineLower, "сотрудник") || strings.Contains(lineLower, "работник") {
-			employeeCount++
-			// Берем следующие несколько строк как информацию о сотруднике
-			employeeInfo := ""
-			for j := i; j < len(lines) && j < i+5; j++ {
-				if strings.TrimSpace(lines[j]) != "" {
-					employeeInfo += lines[j] + "\n"
-				}
-			}
-			if len(employeeInfo) < 300 {
-				employees = append(employees, employeeInfo)
-			}
-			if len(employees) >= 3 {
-				break
-			}
-		}
-	}
-
-	if employeeCount > 0 {
-		result.WriteString("**Найдено информации о сотрудниках:**\n")
-		result.WriteString("- Всего сотрудников: найдено упоминаний\n")
-		for i, emp := range employees {
-			if i < 2 {
-				result.WriteString(fmt.Sprintf("\n**Сотрудник %d:**\n%s", i+1, emp))
-			}
-		}
-		result.WriteString("\n")
-	}
-
-	return result.String()
-}
-
 func extractGrowthInfo(text string) string {
 	var result strings.Builder
 	textLower := strings.ToLower(text)
@@ -875,239 +815,6 @@ func extractFinancialInfo(text string, messageLower string) string {
 	return result.String()
 }
 
-func readFileContent(filePath string) (string, error) {
-	// Определяем тип файла по расширению
-	lowerPath := strings.ToLower(filePath)
-
-	// Word документы (.docx)
-	if strings.HasSuffix(lowerPath, ".docx") {
-		return readDocxFile(filePath)
-	}
-
-	// Excel файлы (.xlsx, .xls)
-	if strings.HasSuffix(lowerPath, ".xlsx") || strings.HasSuffix(lowerPath, ".xls") {
-		return readExcelFile(filePath)
-	}
-
-	// Текстовые файлы (.txt, .csv, и т.д.)
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return "", err
-	}
-
-	// Ограничиваем размер для API (увеличиваем лимит для больших файлов)
-	maxSize := 10000 // Увеличили лимит для лучшего анализа
-	if len(content) > maxSize {
-		return string(content[:maxSize]) + "\n\n[Файл обрезан, показаны первые " + fmt.Sprintf("%d", maxSize) + " символов]", nil
-	}
-
-	return string(content), nil
-}
-
-func readDocxFile(filePath string) (string, error) {
-	// .docx это ZIP архив, открываем его
-	r, err := zip.OpenReader(filePath)
-	if err != nil {
-		return "", fmt.Errorf("ошибка открытия Word файла как ZIP: %v", err)
-	}
-	defer r.Close()
-
-	var result strings.Builder
-
-	// Ищем файл word/document.xml внутри ZIP
-	for _, f := range r.File {
-		if f.Name == "word/document.xml" {
-			rc, err := f.Open()
-			if err != nil {
-				continue
-			}
-
-			content, err := io.ReadAll(rc)
-			rc.Close()
-			if err != nil {
-				continue
-			}
-
-			// Парсим XML и извлекаем текст
-			text := extractTextFromDocxXML(content)
-			if text != "" {
-				result.WriteString(text)
-			}
-			break
-		}
-	}
-
-	text := result.String()
-	if text == "" {
-		return fmt.Sprintf("[Word документ: %s. Не удалось извлечь текст. Попробуйте сохранить файл как .txt]", filePath), nil
-	}
-
-	if len(text) > 15000 {
-		return text[:15000] + "\n\n[Текст обрезан, показаны первые 15000 символов]", nil
-	}
-
-	return text, nil
-}
-
-func extractTextFromDocxXML(xmlContent []byte) string {
-	// Простой парсинг XML - ищем текст между тегами <w:t>
-	var result strings.Builder
-	content := string(xmlContent)
-
-	// Ищем все вхождения <w:t>...</w:t>
-	startTag := "<w:t"
-	endTag := "</w:t>"
-
-	pos := 0
-	for {
-		startIdx := strings.Index(content[pos:], startTag)
-		if startIdx == -1 {
-			break
-		}
-		startIdx += pos
-
-		// Находим закрывающий тег >
-		closeIdx := strings.Index(content[startIdx:], ">")
-		if closeIdx == -1 {
-			break
-		}
-		closeIdx += startIdx + 1
-
-		// Находим закрывающий тег </w:t>
-		endIdx := strings.Index(content[closeIdx:], endTag)
-		if endIdx == -1 {
-			break
-		}
-		endIdx += closeIdx
-
-		// Извлекаем текст между тегами
-		text := content[closeIdx:endIdx]
-		// Декодируем XML entities
-		text = strings.ReplaceAll(text, "&lt;", "<")
-		text = strings.ReplaceAll(text, "&gt;", ">")
-		text = strings.ReplaceAll(text, "&amp;", "&")
-		text = strings.ReplaceAll(text, "&quot;", "\"")
-		text = strings.ReplaceAll(text, "&apos;", "'")
-
-		if strings.TrimSpace(text) != "" {
-			result.WriteString(strings.TrimSpace(text))
-			result.WriteString(" ")
-		}
-
-		pos = endIdx + len(endTag)
-	}
-
-	return result.String()
-}
-
-func readExcelFile(filePath string) (string, error) {
-	// .xlsx это ZIP архив, открываем его
-	r, err := zip.OpenReader(filePath)
-	if err != nil {
-		return "", fmt.Errorf("ошибка открытия Excel файла как ZIP: %v", err)
-	}
-	defer r.Close()
-
-	var result strings.Builder
-
-	// Ищем файлы xl/sharedStrings.xml и xl/worksheets/sheet*.xml
-	for _, f := range r.File {
-		if strings.HasPrefix(f.Name, "xl/sharedStrings.xml") || strings.HasPrefix(f.Name, "xl/worksheets/sheet") {
-			rc, err := f.Open()
-			if err != nil {
-				continue
-			}
-
-			content, err := io.ReadAll(rc)
-			rc.Close()
-			if err != nil {
-				continue
-			}
-
-			// Парсим XML и извлекаем текст
-			text := extractTextFromExcelXML(content)
-			if text != "" {
-				result.WriteString(text)
-				result.WriteString("\n")
-			}
-		}
-	}
-
-	text := result.String()
-	if text == "" {
-		return fmt.Sprintf("[Excel файл: %s. Не удалось извлечь данные. Попробуйте экспортировать в .csv или .txt]", filePath), nil
-	}
-
-	if len(text) > 15000 {
-		return text[:15000] + "\n\n[Данные обрезаны, показаны первые 15000 символов]", nil
-	}
-
-	return text, nil
-}
-
-func extractTextFromExcelXML(xmlContent []byte) string {
-	// Парсим XML Excel - ищем текст в тегах <t> или <v>
-	var result strings.Builder
-	content := string(xmlContent)
-
-	// Ищем все вхождения <t>...</t> (текст) и <v>...</v> (значения)
-	patterns := []string{"<t>", "</t>", "<v>", "</v>"}
-
-	pos := 0
-	for pos < len(content) {
-		// Ищем следующий тег
-		nextTag := -1
-		tagType := -1
-
-		for i, pattern := range patterns {
-			idx := strings.Index(content[pos:], pattern)
-			if idx != -1 && (nextTag == -1 || idx < nextTag) {
-				nextTag = idx
-				tagType = i
-			}
-		}
-
-		if nextTag == -1 {
-			break
-		}
-
-		nextTag += pos
-
-		// Если это открывающий тег <t> или <v>
-		if tagType == 0 || tagType == 2 {
-			closeTag := patterns[tagType+1]
-			closeIdx := strings.Index(content[nextTag+len(patterns[tagType]):], closeTag)
-			if closeIdx != -1 {
-				closeIdx += nextTag + len(patterns[tagType])
-				text := content[nextTag+len(patterns[tagType]) : closeIdx]
-
-				// Декодируем XML entities
-				text = strings.ReplaceAll(text, "&lt;", "<")
-				text = strings.ReplaceAll(text, "&gt;", ">")
-				text = strings.ReplaceAll(text, "&amp;", "&")
-				text = strings.ReplaceAll(text, "&quot;", "\"")
-				text = strings.ReplaceAll(text, "&apos;", "'")
-
-				if strings.TrimSpace(text) != "" {
-					result.WriteString(strings.TrimSpace(text))
-					result.WriteString(" | ")
-				}
-
-				pos = closeIdx + len(closeTag)
-				continue
-			}
-		}
-
-		pos = nextTag + len(patterns[tagType])
-	}
-
-	text := result.String()
-	// Убираем последний разделитель
-	text = strings.TrimSuffix(text, " | ")
-
-	return text
-}
-
 func callAioNet(prompt, apiKey string) (string, error) {
 	url := "https://api.ai.io.net/v1/chat/completions"
 	payload := map[string]interface{}{
@@ -1157,19 +864,19 @@ func callAioNet(prompt, apiKey string) (string, error) {
 	return "", fmt.Errorf("no choices in ai.io.net response: %s", string(body))
 }
 
-func callOpenRouter(prompt, apiKey string) (string, error) {
-	url := "https://openrouter.ai/api/v1/chat/completions"
+// Используем ТОЛЬКО полностью бесплатные модели OpenRouter (max_price=0)
+// Обновленный список на основе реально работающих моделей (проверено на практике)
+var freeModels = []string{
+	"mistralai/mistral-7b-instruct:free",    // Mistral 7B Instruct (free) - ОСНОВНАЯ, работает стабильно
+	"google/gemini-2.0-flash-exp:free",      // Gemini 2.0 Flash - работает отлично, быстрая
+	"meta-llama/llama-3.2-3b-instruct:free", // Llama 3.2 3B - fallback (может быть rate-limited)
+}
 
-	// Используем ТОЛЬКО полностью бесплатные модели OpenRouter (max_price=0)
-	// Обновленный список на основе реально работающих моделей (проверено на практике)
-	freeModels := []string{
-		"mistralai/mistral-7b-instruct:free",    // Mistral 7B Instruct (free) - ОСНОВНАЯ, работает стабильно
-		"google/gemini-2.0-flash-exp:free",      // Gemini 2.0 Flash - работает отлично, быстрая
-		"meta-llama/llama-3.2-3b-instruct:free", // Llama 3.2 3B - fallback (может быть rate-limited)
-	}
+func callOpenRouter(prompt, apiKey string) (*Result, error) {
+	url := "https://openrouter.ai/api/v1/chat/completions"
 
 	var lastErr error
-	for _, modelName := range freeModels {
+	for i, modelName := range freeModels {
 		payload := map[string]interface{}{
 			"model": modelName,
 			"messages": []map[string]string{
@@ -1180,27 +887,42 @@ func callOpenRouter(prompt, apiKey string) (string, error) {
 			"top_p":       0.9,
 		}
 
-		result, err := tryOpenRouterModel(url, payload, apiKey, modelName)
-		if err == nil && result != "" {
-			fmt.Printf("DEBUG: Успешно использована модель OpenRouter: %s\n", modelName)
-			return result, nil
+		completion, err := tryOpenRouterModel(url, payload, apiKey, modelName)
+		if err == nil && completion.Content != "" {
+			fmt.Printf("DEBUG: Успешно использована модель OpenRouter: %s\n", completion.Model)
+			return &Result{
+				Text:             completion.Content,
+				Provider:         ProviderOpenRouter,
+				Model:            completion.Model,
+				PromptTokens:     completion.PromptTokens,
+				CompletionTokens: completion.CompletionTokens,
+				FallbackAttempts: i,
+			}, nil
 		}
 		lastErr = err
 		fmt.Printf("DEBUG: Модель OpenRouter %s не сработала: %v\n", modelName, err)
 	}
 
-	return "", fmt.Errorf("все модели OpenRouter не сработали: %v", lastErr)
+	return &Result{Provider: ProviderOpenRouter, FallbackAttempts: len(freeModels)}, fmt.Errorf("все модели OpenRouter не сработали: %v", lastErr)
+}
+
+// openRouterCompletion - распарсенный ответ одной модели OpenRouter
+type openRouterCompletion struct {
+	Content          string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
 }
 
-func tryOpenRouterModel(url string, payload map[string]interface{}, apiKey, modelName string) (string, error) {
+func tryOpenRouterModel(url string, payload map[string]interface{}, apiKey, modelName string) (*openRouterCompletion, error) {
 	fmt.Printf("DEBUG: Пробую модель OpenRouter: %s\n", modelName)
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	req.Header.Set("Authorization", "Bearer "+apiKey)
 	req.Header.Set("Content-Type", "application/json")
@@ -1210,13 +932,13 @@ func tryOpenRouterModel(url string, payload map[string]interface{}, apiKey, mode
 	client := &http.Client{Timeout: 60 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Проверяем статус код
@@ -1226,15 +948,20 @@ func tryOpenRouterModel(url string, payload map[string]interface{}, apiKey, mode
 			errorMsg = errorMsg[:200]
 		}
 		fmt.Printf("ERROR: OpenRouter API вернул ошибку: %d, тело: %s\n", resp.StatusCode, errorMsg)
-		return "", fmt.Errorf("OpenRouter API вернул статус %d: %s", resp.StatusCode, errorMsg)
+		return nil, fmt.Errorf("OpenRouter API вернул статус %d: %s", resp.StatusCode, errorMsg)
 	}
 
 	type aiResp struct {
+		Model   string `json:"model"`
 		Choices []struct {
 			Message struct {
 				Content string `json:"content"`
 			} `json:"message"`
 		} `json:"choices"`
+		Usage *struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
 		Error *struct {
 			Message string `json:"message"`
 			Type    string `json:"type"`
@@ -1242,17 +969,29 @@ func tryOpenRouterModel(url string, payload map[string]interface{}, apiKey, mode
 	}
 	var result aiResp
 	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("ошибка парсинга ответа OpenRouter: %v, тело: %s", err, string(body))
+		return nil, fmt.Errorf("ошибка парсинга ответа OpenRouter: %v, тело: %s", err, string(body))
 	}
 
 	if result.Error != nil {
-		return "", fmt.Errorf("OpenRouter API ошибка: %s (тип: %s)", result.Error.Message, result.Error.Type)
+		return nil, fmt.Errorf("OpenRouter API ошибка: %s (тип: %s)", result.Error.Message, result.Error.Type)
 	}
 
 	if len(result.Choices) > 0 {
-		return strings.TrimSpace(result.Choices[0].Message.Content), nil
+		completion := &openRouterCompletion{
+			Content: strings.TrimSpace(result.Choices[0].Message.Content),
+			Model:   result.Model,
+		}
+		// OpenRouter возвращает фактическую модель, но на всякий случай подставляем запрошенную
+		if completion.Model == "" {
+			completion.Model = modelName
+		}
+		if result.Usage != nil {
+			completion.PromptTokens = result.Usage.PromptTokens
+			completion.CompletionTokens = result.Usage.CompletionTokens
+		}
+		return completion, nil
 	}
-	return "", fmt.Errorf("no choices in OpenRouter response: %s", string(body))
+	return nil, fmt.Errorf("no choices in OpenRouter response: %s", string(body))
 }
 
 func callGroq(prompt, apiKey string) (string, error) {
@@ -0,0 +1,119 @@
+package ai
+
+import (
+	"alfa-hack-backend/internal/models"
+	"alfa-hack-backend/internal/storage"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+	"sync/atomic"
+)
+
+// ParserVersion - версия разбора файлов. Ее нужно менять при любом изменении парсера,
+// которое меняет результат: разобранные старой версией документы перестают браться из кеша.
+const ParserVersion = "8"
+
+// DocumentCache - хранилище разобранных документов по хешу содержимого, расширению файла
+// (по нему выбирается парсер) и версии парсера
+type DocumentCache interface {
+	// ContentHash возвращает SHA-256 содержимого по ключу файла в хранилище; "" - неизвестен
+	ContentHash(key string) string
+	GetDocument(hash, ext, parserVersion string) (*Document, bool)
+	PutDocument(hash, ext, parserVersion string, doc *Document) error
+}
+
+var documentCache DocumentCache
+
+// SetDocumentCache задает кеш разобранных документов, чтобы не разбирать файлы при каждом сообщении
+func SetDocumentCache(cache DocumentCache) {
+	documentCache = cache
+}
+
+// Счетчики кеша с момента запуска сервера
+var (
+	cacheHits   atomic.Int64
+	cacheMisses atomic.Int64
+	cacheErrors atomic.Int64 // не удалось сохранить документ в кеш
+)
+
+// CacheStats - попадания и промахи кеша разобранных документов с момента запуска
+type CacheStats struct {
+	ParserVersion string  `json:"parser_version"`
+	Hits          int64   `json:"hits"`
+	Misses        int64   `json:"misses"`
+	HitRate       float64 `json:"hit_rate"` // доля попаданий от 0 до 1
+	StoreErrors   int64   `json:"store_errors"`
+}
+
+// GetCacheStats возвращает текущие счетчики кеша
+func GetCacheStats() CacheStats {
+	stats := CacheStats{
+		ParserVersion: ParserVersion,
+		Hits:          cacheHits.Load(),
+		Misses:        cacheMisses.Load(),
+		StoreErrors:   cacheErrors.Load(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// LoadDocument возвращает разобранный документ: из кеша, а если его там нет - читает файл
+// из хранилища, разбирает и сохраняет результат в кеш
+func LoadDocument(file models.File) (*Document, error) {
+	return loadDocument(file)
+}
+
+func loadDocument(file models.File) (*Document, error) {
+	hash, ext := "", documentExt(file.FilePath)
+	if documentCache != nil {
+		if hash = documentCache.ContentHash(file.FilePath); hash != "" {
+			if doc, ok := documentCache.GetDocument(hash, ext, ParserVersion); ok {
+				cacheHits.Add(1)
+				return doc, nil
+			}
+		}
+	}
+
+	if fileStore == nil {
+		return nil, fmt.Errorf("хранилище файлов не настроено")
+	}
+	data, err := storage.ReadAll(context.Background(), fileStore, file.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if documentCache != nil && hash == "" {
+		// Хеш неизвестен (файл загружен до появления хешей) - считаем по содержимому
+		sum := sha256.Sum256(data)
+		hash = hex.EncodeToString(sum[:])
+		if doc, ok := documentCache.GetDocument(hash, ext, ParserVersion); ok {
+			cacheHits.Add(1)
+			return doc, nil
+		}
+	}
+	cacheMisses.Add(1)
+
+	// Тип определяем по имени ключа: в нем сохраняется исходное расширение
+	doc, err := readDocument(file.FilePath, data)
+	if err != nil {
+		return nil, err
+	}
+	if documentCache != nil {
+		if err := documentCache.PutDocument(hash, ext, ParserVersion, doc); err != nil {
+			cacheErrors.Add(1)
+			fmt.Printf("Не удалось сохранить разобранный файл %s в кеш: %v\n", file.FilePath, err)
+		}
+	}
+	return doc, nil
+}
+
+// documentExt - расширение ключа файла в нижнем регистре без точки: одинаковое содержимое с разными
+// расширениями разбирается разными парсерами
+func documentExt(key string) string {
+	return strings.TrimPrefix(strings.ToLower(path.Ext(key)), ".")
+}
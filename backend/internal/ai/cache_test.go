@@ -0,0 +1,102 @@
+package ai
+
+import (
+	"alfa-hack-backend/internal/models"
+	"alfa-hack-backend/internal/storage"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+type cacheKey struct{ hash, ext, version string }
+
+// testCache - кеш документов в памяти; hashes - известные хеши по ключу файла
+type testCache struct {
+	hashes map[string]string
+	docs   map[cacheKey]*Document
+}
+
+func (c *testCache) ContentHash(key string) string { return c.hashes[key] }
+
+func (c *testCache) GetDocument(hash, ext, parserVersion string) (*Document, bool) {
+	doc, ok := c.docs[cacheKey{hash, ext, parserVersion}]
+	return doc, ok
+}
+
+func (c *testCache) PutDocument(hash, ext, parserVersion string, doc *Document) error {
+	c.docs[cacheKey{hash, ext, parserVersion}] = doc
+	return nil
+}
+
+// Документ берется из кеша по SHA-256 содержимого, расширению и версии парсера
+func TestLoadDocumentCache(t *testing.T) {
+	store, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const content = "Месяц;Выручка\nМарт;100\n"
+	sum := sha256.Sum256([]byte(content))
+	hash := hex.EncodeToString(sum[:])
+	for _, key := range []string{"u1/a.txt", "u1/b.csv", "u2/c.txt", "u2/d.md"} {
+		if err := store.Put(context.Background(), key, strings.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cache := &testCache{
+		hashes: map[string]string{"u1/a.txt": hash, "u1/b.csv": hash, "u2/d.md": hash},
+		docs:   map[cacheKey]*Document{},
+	}
+	// Документ, разобранный прошлой версией парсера, не используется
+	stale := &Document{Warnings: []string{"старый разбор"}}
+	cache.docs[cacheKey{hash, "md", "0"}] = stale
+
+	SetStorage(store)
+	SetDocumentCache(cache)
+	t.Cleanup(func() {
+		SetStorage(nil)
+		SetDocumentCache(nil)
+	})
+
+	steps := []struct {
+		name string
+		key  string
+		hit  bool
+	}{
+		{"первый разбор", "u1/a.txt", false},
+		{"повторное чтение", "u1/a.txt", true},
+		{"то же содержимое с другим расширением", "u1/b.csv", false},
+		{"хеш неизвестен - считается по содержимому", "u2/c.txt", true},
+		{"другая версия парсера", "u2/d.md", false},
+	}
+	for _, step := range steps {
+		before := GetCacheStats()
+		doc, err := LoadDocument(models.File{FilePath: step.key})
+		if err != nil {
+			t.Fatalf("%s: LoadDocument: %v", step.name, err)
+		}
+		after := GetCacheStats()
+		if hit := after.Hits-before.Hits == 1; hit != step.hit || after.Hits+after.Misses != before.Hits+before.Misses+1 {
+			t.Errorf("%s: hits %d -> %d, misses %d -> %d, want hit %v", step.name, before.Hits, after.Hits, before.Misses, after.Misses, step.hit)
+		}
+		if doc == stale {
+			t.Errorf("%s: got a document parsed by another parser version", step.name)
+		}
+		ext := documentExt(step.key)
+		if cache.docs[cacheKey{hash, ext, ParserVersion}] != doc {
+			t.Errorf("%s: document is not cached under %s/%s/%s", step.name, hash[:8], ext, ParserVersion)
+		}
+	}
+	if len(cache.docs) != 4 {
+		t.Errorf("cache has %d documents, want txt, csv, md and the stale md", len(cache.docs))
+	}
+
+	// Попадание в кеш не читает хранилище
+	if err := store.Delete(context.Background(), "u1/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDocument(models.File{FilePath: "u1/a.txt"}); err != nil {
+		t.Errorf("cached document read the deleted file: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package ai
+
+import (
+	"alfa-hack-backend/internal/bank"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// llmCategorizeBatch - сколько операций отправлять модели в одном запросе
+const llmCategorizeBatch = 40
+
+// UncategorizedTransaction - операция, для которой правила не нашли категорию
+type UncategorizedTransaction struct {
+	ID           int64
+	Direction    string
+	Amount       int64 // копейки
+	Currency     string
+	Counterparty string
+	Purpose      string
+	MCC          string
+}
+
+// CategorizerLLMEnabled - разрешено ли отправлять модели операции без категории (CATEGORIZER_LLM=true)
+func CategorizerLLMEnabled() bool {
+	value := strings.ToLower(os.Getenv("CATEGORIZER_LLM"))
+	return (value == "true" || value == "1") && os.Getenv("OPENROUTER_API_KEY") != ""
+}
+
+// llmAnswerRe - строка ответа модели "12: suppliers"
+var llmAnswerRe = regexp.MustCompile(`(?m)^\s*(\d+)\s*[:.)\-]\s*([a-z_]+)`)
+
+// CategorizeWithLLM просит модель выбрать категории для операций. Возвращает категории по id операции;
+// операции, для которых модель не дала известную категорию, в результат не попадают.
+func CategorizeWithLLM(transactions []UncategorizedTransaction) (map[int64]string, error) {
+	result := make(map[int64]string)
+	for start := 0; start < len(transactions); start += llmCategorizeBatch {
+		end := start + llmCategorizeBatch
+		if end > len(transactions) {
+			end = len(transactions)
+		}
+		if err := categorizeBatchWithLLM(transactions[start:end], result); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func categorizeBatchWithLLM(batch []UncategorizedTransaction, result map[int64]string) error {
+	var prompt strings.Builder
+	prompt.WriteString("Определи категорию каждой операции по расчетному счету малого бизнеса. Категории:\n")
+	for _, category := range bank.CategoryOrder {
+		if category != bank.CategoryTransfer {
+			prompt.WriteString(fmt.Sprintf("- %s: %s\n", category, bank.CategoryNames[category]))
+		}
+	}
+	prompt.WriteString("\nОтветь по одной строке на операцию в виде \"номер: код категории\", без пояснений.\n\nОперации:\n")
+	for i, t := range batch {
+		kind := "поступление"
+		if t.Direction == bank.DirectionOut {
+			kind = "списание"
+		}
+		line := fmt.Sprintf("%d. %s %s | %s | %s", i+1, kind, bank.FormatAmount(t.Amount, t.Currency), t.Counterparty, t.Purpose)
+		if t.MCC != "" {
+			line += " | MCC " + t.MCC
+		}
+		prompt.WriteString(line + "\n")
+	}
+
+	modelName := "mistralai/mistral-7b-instruct:free"
+	payload := map[string]interface{}{
+		"model": modelName,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt.String()},
+		},
+		"max_tokens":  12 * len(batch),
+		"temperature": 0,
+	}
+	completion, err := tryOpenRouterModel("https://openrouter.ai/api/v1/chat/completions", payload, os.Getenv("OPENROUTER_API_KEY"), modelName)
+	if err != nil {
+		return err
+	}
+
+	for _, match := range llmAnswerRe.FindAllStringSubmatch(strings.ToLower(completion.Content), -1) {
+		number, _ := strconv.Atoi(match[1])
+		category := match[2]
+		if number < 1 || number > len(batch) || category == bank.CategoryTransfer {
+			continue
+		}
+		if _, ok := bank.CategoryNames[category]; ok {
+			result[batch[number-1].ID] = category
+		}
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package ai
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Classification - категория вопроса и уверенность в ней
+type Classification struct {
+	Category   string  // код категории из categoryNames; пусто, если вопрос общий
+	Confidence float64 // от 0 до 1
+	Method     string  // как определена категория: ClassifyExplicit, ClassifyKeywords, ...
+}
+
+// Способы определения категории
+const (
+	ClassifyExplicit  = "explicit"
+	ClassifyKeywords  = "keywords"
+	ClassifyEmbedding = "embedding"
+	ClassifyLLM       = "llm"
+	ClassifyNone      = "none"
+)
+
+const (
+	keywordConfidentScore = 0.5  // при такой уверенности по ключевым словам дальше не проверяем
+	llmThreshold          = 0.4  // ниже этой уверенности (если включено) спрашиваем модель
+	generalThreshold      = 0.25 // ниже этой уверенности считаем вопрос общим
+)
+
+// categoryKeywords - основы слов, характерные для каждой категории
+var categoryKeywords = map[string][]string{
+	"financial": {"прибыл", "выручк", "доход", "расход", "затрат", "маржин", "рентабельн", "себестоимост", "деньг", "денег", "бюджет", "кредит", "касс", "оборот", "финанс", "платеж", "убыт", "чек"},
+	"legal":     {"договор", "закон", "налог", "юрист", "юридич", "штраф", "лиценз", "усн", "ндс", "ндфл", "патент", "суд", "претензи", "регистрац", "ип ", "ооо", "оквэд", "проверк", "декларац"},
+	"hr":        {"сотрудник", "работник", "персонал", "зарплат", "оклад", "найм", "нанять", "увол", "отпуск", "больничн", "график смен", "кадр", "мотивац", "преми", "стажер", "бариста", "вакан"},
+	"marketing": {"реклам", "маркетинг", "продвижен", "клиент", "соцсет", "инстаграм", "вконтакт", "акци", "скидк", "бренд", "smm", "таргет", "отзыв", "сайт", "привлеч", "аудитори", "конкурент"},
+	"growth":    {"рост", "вырос", "развит", "масштаб", "расшир", "открыть", "франшиз", "инвестиц", "увеличить", "стратег", "новую точку", "новый филиал", "перспектив"},
+	"reports":   {"отчет", "отчёт", "таблиц", "сравни", "показател", "статистик", "динамик", "итог", "сводк", "данные", "файл"},
+}
+
+// keywordPatterns - ключевые слова категорий как регулярные выражения: слово должно начинаться
+// с ключевого слова ("рост" не находится в "просто", "суд" - в "посуда")
+var keywordPatterns = compileKeywords(categoryKeywords)
+
+// compileKeywords компилирует ключевые слова. Go regexp не считает кириллицу буквами в \b,
+// поэтому начало слова задано явно, как в правилах категорий операций (bank/category.go).
+func compileKeywords(keywords map[string][]string) map[string][]*regexp.Regexp {
+	patterns := make(map[string][]*regexp.Regexp, len(keywords))
+	for category, list := range keywords {
+		for _, keyword := range list {
+			patterns[category] = append(patterns[category], regexp.MustCompile(`(^|[^а-яёa-z0-9])`+regexp.QuoteMeta(keyword)))
+		}
+	}
+	return patterns
+}
+
+// categoryExamples - типичные вопросы по категориям, с которыми сравнивается вопрос пользователя
+var categoryExamples = map[string][]string{
+	"financial": {
+		"Какая у меня прибыль за месяц?",
+		"Почему выросли расходы?",
+		"Как посчитать маржинальность товаров?",
+		"Хватит ли денег на оплату поставщикам?",
+	},
+	"legal": {
+		"Какой налог платить на упрощенке?",
+		"Что должно быть в договоре аренды?",
+		"Какие штрафы грозят за просрочку отчетности?",
+		"Нужна ли лицензия для продажи алкоголя?",
+	},
+	"hr": {
+		"Сколько у меня сотрудников?",
+		"Какая зарплата у бариста?",
+		"Как правильно уволить работника?",
+		"Как составить график смен для персонала?",
+	},
+	"marketing": {
+		"Как привлечь больше клиентов?",
+		"Какую рекламу запустить в соцсетях?",
+		"Стоит ли делать скидки и акции?",
+		"Как увеличить количество отзывов?",
+	},
+	"growth": {
+		"Как вырос мой бизнес за год?",
+		"Стоит ли открывать вторую точку?",
+		"Как масштабировать бизнес?",
+		"Куда инвестировать для развития?",
+	},
+	"reports": {
+		"Проанализируй загруженные отчеты",
+		"Сравни показатели за ноябрь и декабрь",
+		"Что видно из таблицы продаж?",
+		"Сделай сводку по данным из файлов",
+	},
+}
+
+// ClassifyQuestion определяет категорию вопроса.
+// Явно выбранная пользователем категория всегда имеет приоритет.
+func ClassifyQuestion(message, explicit string) Classification {
+	if _, ok := categoryNames[explicit]; ok {
+		return Classification{Category: explicit, Confidence: 1, Method: ClassifyExplicit}
+	}
+
+	best := classifyByKeywords(message)
+	if best.Confidence < keywordConfidentScore {
+		byEmbedding := classifyByEmbedding(message)
+		switch {
+		case byEmbedding.Category == best.Category && best.Category != "":
+			// Оба способа согласны - уверенность выше, чем у каждого по отдельности
+			best.Confidence = math.Min(1, math.Max(best.Confidence, byEmbedding.Confidence)+0.1)
+		case byEmbedding.Confidence > best.Confidence:
+			best = byEmbedding
+		}
+	}
+
+	if best.Confidence < llmThreshold && llmClassifierEnabled() {
+		if byLLM, err := classifyByLLM(message); err == nil {
+			best = byLLM
+		} else {
+			fmt.Printf("DEBUG: LLM-классификатор не сработал: %v\n", err)
+		}
+	}
+
+	if best.Confidence < generalThreshold {
+		return Classification{Category: "", Confidence: best.Confidence, Method: ClassifyNone}
+	}
+	return best
+}
+
+// classifyByKeywords считает совпадения с ключевыми словами категорий.
+// Уверенность = доля лучшей категории среди всех совпадений, сниженная при малом числе совпадений.
+func classifyByKeywords(message string) Classification {
+	text := " " + strings.ToLower(message) + " "
+
+	total := 0
+	bestCategory, bestScore := "", 0
+	for _, category := range categoryOrder {
+		score := 0
+		for _, keyword := range keywordPatterns[category] {
+			if keyword.MatchString(text) {
+				score++
+			}
+		}
+		total += score
+		if score > bestScore {
+			bestCategory, bestScore = category, score
+		}
+	}
+	if bestScore == 0 {
+		return Classification{Method: ClassifyKeywords}
+	}
+
+	share := float64(bestScore) / float64(total)
+	saturation := float64(bestScore) / float64(bestScore+1)
+	return Classification{Category: bestCategory, Confidence: share * saturation, Method: ClassifyKeywords}
+}
+
+// classifyByEmbedding сравнивает вопрос с примерами категорий по косинусной близости
+// векторов из хешированных символьных триграмм (работает без внешних сервисов).
+func classifyByEmbedding(message string) Classification {
+	query := embedText(message)
+
+	bestCategory, best, second := "", 0.0, 0.0
+	for _, category := range categoryOrder {
+		score := 0.0
+		for _, example := range categoryExamples[category] {
+			score = math.Max(score, cosine(query, embedText(example)))
+		}
+		if score > best {
+			bestCategory, best, second = category, score, best
+		} else if score > second {
+			second = score
+		}
+	}
+	if bestCategory == "" {
+		return Classification{Method: ClassifyEmbedding}
+	}
+
+	// Если соседняя категория почти так же близка, уверенность ниже
+	confidence := best * (1 - 0.5*second/best)
+	return Classification{Category: bestCategory, Confidence: confidence, Method: ClassifyEmbedding}
+}
+
+const embeddingDims = 512
+
+// embedText строит нормированный вектор из символьных триграмм слов
+func embedText(text string) []float64 {
+	vector := make([]float64, embeddingDims)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r == '-' || (r >= 'a' && r <= 'z') || (r >= 'а' && r <= 'я') || r == 'ё' || (r >= '0' && r <= '9'))
+	}) {
+		runes := []rune("^" + word + "$")
+		for i := 0; i+3 <= len(runes); i++ {
+			h := fnv.New32a()
+			h.Write([]byte(string(runes[i : i+3])))
+			vector[h.Sum32()%embeddingDims]++
+		}
+	}
+
+	norm := 0.0
+	for _, v := range vector {
+		norm += v * v
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vector {
+			vector[i] /= norm
+		}
+	}
+	return vector
+}
+
+func cosine(a, b []float64) float64 {
+	dot := 0.0
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return dot
+}
+
+// llmClassifierEnabled - разрешено ли спрашивать модель, когда правила не уверены (CLASSIFIER_LLM=true)
+func llmClassifierEnabled() bool {
+	value := strings.ToLower(os.Getenv("CLASSIFIER_LLM"))
+	return (value == "true" || value == "1") && os.Getenv("OPENROUTER_API_KEY") != ""
+}
+
+// classifierModel - модель OpenRouter для определения категории: CLASSIFIER_MODEL или основная из freeModels
+func classifierModel() string {
+	if model := strings.TrimSpace(os.Getenv("CLASSIFIER_MODEL")); model != "" {
+		return model
+	}
+	return freeModels[0]
+}
+
+// classifyByLLM просит модель выбрать одну категорию из списка
+func classifyByLLM(message string) (Classification, error) {
+	var prompt strings.Builder
+	prompt.WriteString("Определи категорию вопроса владельца малого бизнеса. Ответь ОДНИМ словом - кодом категории из списка:\n")
+	for _, category := range categoryOrder {
+		prompt.WriteString(fmt.Sprintf("- %s: %s\n", category, categoryNames[category]))
+	}
+	prompt.WriteString("- general: общий вопрос, не подходит ни одна категория\n\n")
+	prompt.WriteString(fmt.Sprintf("Вопрос: %s\nКатегория:", message))
+
+	modelName := classifierModel()
+	payload := map[string]interface{}{
+		"model": modelName,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt.String()},
+		},
+		"max_tokens":  10,
+		"temperature": 0,
+	}
+	completion, err := tryOpenRouterModel("https://openrouter.ai/api/v1/chat/completions", payload, os.Getenv("OPENROUTER_API_KEY"), modelName)
+	if err != nil {
+		return Classification{}, err
+	}
+
+	answer := strings.ToLower(completion.Content)
+	for _, category := range categoryOrder {
+		if strings.Contains(answer, category) {
+			return Classification{Category: category, Confidence: 0.8, Method: ClassifyLLM}, nil
+		}
+	}
+	if strings.Contains(answer, "general") {
+		return Classification{Category: "", Confidence: 0.8, Method: ClassifyLLM}, nil
+	}
+	return Classification{}, fmt.Errorf("модель вернула неизвестную категорию: %q", completion.Content)
+}
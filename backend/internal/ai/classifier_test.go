@@ -0,0 +1,49 @@
+package ai
+
+import "testing"
+
+func TestClassifyByKeywordsWordStart(t *testing.T) {
+	tests := []struct {
+		message  string
+		category string
+	}{
+		// Ключевое слово внутри другого слова не считается
+		{"Просто скажи, что ты умеешь", ""},
+		{"Почему транзакция не прошла?", ""},
+		{"Купил посуду и стулья", ""},
+		{"Напиши пересайтовое описание", ""},
+		// Ключевое слово в начале слова находится, в том числе с окончанием
+		{"Как обеспечить рост бизнеса?", "growth"},
+		{"Стоит ли подавать в суд на арендодателя?", "legal"},
+		{"Какую акцию запустить в выходные?", "marketing"},
+		{"Нужен ли нам сайт?", "marketing"},
+		{"Рост, развитие и масштабирование", "growth"},
+	}
+	for _, tt := range tests {
+		got := classifyByKeywords(tt.message)
+		if got.Category != tt.category {
+			t.Errorf("classifyByKeywords(%q) = %q, want %q", tt.message, got.Category, tt.category)
+		}
+		if got.Method != ClassifyKeywords {
+			t.Errorf("classifyByKeywords(%q) method = %q, want %q", tt.message, got.Method, ClassifyKeywords)
+		}
+	}
+}
+
+func TestClassifyQuestionExplicit(t *testing.T) {
+	got := ClassifyQuestion("Просто вопрос", "legal")
+	if got.Category != "legal" || got.Method != ClassifyExplicit || got.Confidence != 1 {
+		t.Errorf("ClassifyQuestion with explicit category = %+v", got)
+	}
+}
+
+func TestClassifierModel(t *testing.T) {
+	t.Setenv("CLASSIFIER_MODEL", "")
+	if got := classifierModel(); got != freeModels[0] {
+		t.Errorf("default classifier model = %q, want %q", got, freeModels[0])
+	}
+	t.Setenv("CLASSIFIER_MODEL", " google/gemini-2.0-flash-exp:free ")
+	if got := classifierModel(); got != "google/gemini-2.0-flash-exp:free" {
+		t.Errorf("classifier model = %q", got)
+	}
+}
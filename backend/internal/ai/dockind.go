@@ -0,0 +1,207 @@
+package ai
+
+import (
+	"alfa-hack-backend/internal/models"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Виды документов
+const (
+	DocKindSalesReport   = "sales_report"
+	DocKindPayroll       = "payroll"
+	DocKindContract      = "contract"
+	DocKindBankStatement = "bank_statement"
+	DocKindInvoice       = "invoice"
+	DocKindOther         = "other"
+)
+
+// DocKindNames - названия видов документов для интерфейса и промпта
+var DocKindNames = map[string]string{
+	DocKindSalesReport:   "Отчет о продажах",
+	DocKindPayroll:       "Зарплата и персонал",
+	DocKindContract:      "Договор",
+	DocKindBankStatement: "Банковская выписка",
+	DocKindInvoice:       "Счет, накладная, УПД",
+	DocKindOther:         "Другое",
+}
+
+var docKindOrder = []string{DocKindBankStatement, DocKindPayroll, DocKindContract, DocKindInvoice, DocKindSalesReport}
+
+// docKindKeywords - основы слов, по которым узнается вид документа
+var docKindKeywords = map[string][]string{
+	DocKindBankStatement: {"выписк", "расчетный счет", "расчётный счет", "р/с", "бик", "остаток на начало", "входящий остаток", "clientbankexchange", "платежное поручение", "списано", "зачислено"},
+	DocKindPayroll:       {"зарплат", "заработн", "ведомост", "оклад", "ндфл", "табель", "начислено", "к выплате", "фот", "аванс"},
+	DocKindContract:      {"договор", "стороны", "предмет договора", "обязанности сторон", "арендатор", "арендодатель", "исполнитель", "заказчик", "срок действия"},
+	DocKindInvoice:       {"счет-фактур", "счёт-фактур", "упд", "накладн", "счет на оплату", "счёт на оплату", "грузополучатель", "грузоотправитель"},
+	DocKindSalesReport:   {"продаж", "выручк", "реализац", "средний чек", "количество чеков", "оборот", "касс"},
+}
+
+const (
+	docKindFilenameWeight = 2  // совпадение в имени файла весит больше, чем в тексте
+	docKindMinScore       = 2  // меньше - вид не определен
+	docKindScanRows       = 50 // сколько первых строк документа просматривать
+)
+
+// DetectDocument определяет вид документа и период, к которому он относится, по имени и содержимому файла.
+// Пустые значения - определить не удалось.
+func DetectDocument(file models.File, uploadedAt time.Time) (kind, period string) {
+	name := strings.ToLower(file.Filename)
+	var text strings.Builder
+	if doc, err := loadDocument(file); err == nil {
+		rows := 0
+	scan:
+		for _, section := range doc.Sections {
+			text.WriteString(section.Sheet + "\n")
+			for _, row := range section.Rows {
+				if rows >= docKindScanRows {
+					break scan
+				}
+				text.WriteString(row.Text + "\n")
+				rows++
+			}
+		}
+	}
+	content := strings.ToLower(text.String())
+
+	bestScore := 0
+	for _, k := range docKindOrder {
+		score := 0
+		for _, keyword := range docKindKeywords[k] {
+			if strings.Contains(name, keyword) {
+				score += docKindFilenameWeight
+			}
+			if strings.Contains(content, keyword) {
+				score++
+			}
+		}
+		if score > bestScore {
+			kind, bestScore = k, score
+		}
+	}
+	if bestScore < docKindMinScore {
+		kind = ""
+	}
+
+	// Период ищем сначала в имени файла, потом в тексте
+	period = DetectPeriod(name, uploadedAt)
+	if period == "" {
+		period = DetectPeriod(content, uploadedAt)
+	}
+	return kind, period
+}
+
+// monthStems - основы названий месяцев (именительный и родительный падеж, сокращения)
+var monthStems = []string{"январ", "феврал", "март", "апрел", "ма[йя]", "июн", "июл", "август", "сентябр", "октябр", "ноябр", "декабр"}
+
+var (
+	monthNameRe = regexp.MustCompile(`(?:^|[^\p{L}])(` + strings.Join(monthStems, "|") + `)\p{L}*(?:[^\p{L}\d]{1,3}(\d{4}))?`)
+	monthNumRe  = regexp.MustCompile(`(?:^|\D)(0?[1-9]|1[0-2])[.\-_/](20\d{2})(?:\D|$)`)
+	isoMonthRe  = regexp.MustCompile(`(?:^|\D)(20\d{2})[.\-_/](0[1-9]|1[0-2])(?:\D|$)`)
+	quarterRe   = regexp.MustCompile(`(?:^|[^\p{L}\d])([1-4]|i{1,3}|iv)[\s\-_]*(?:кв\.?|квартал\p{L}*)[^\d]{0,5}(20\d{2})`)
+	quarterQRe  = regexp.MustCompile(`(?:^|[^\p{L}\d])q([1-4])[\s\-_]*(20\d{2})`)
+	yearRe      = regexp.MustCompile(`(?:^|[^\d])(20\d{2})\s*(?:г\.?|год\p{L}*)(?:[^\p{L}]|$)`)
+
+	monthStemRes = func() []*regexp.Regexp {
+		res := make([]*regexp.Regexp, len(monthStems))
+		for i, stem := range monthStems {
+			res[i] = regexp.MustCompile(`^` + stem + `$`)
+		}
+		return res
+	}()
+)
+
+// DetectPeriod ищет в тексте указание периода и возвращает его в виде "2024-12", "2024-Q4" или "2024".
+// Месяц без года относится к последнему такому месяцу, не позже даты загрузки.
+func DetectPeriod(text string, uploadedAt time.Time) string {
+	text = strings.ToLower(text)
+
+	if m := isoMonthRe.FindStringSubmatch(text); m != nil {
+		return m[1] + "-" + m[2]
+	}
+	if m := monthNumRe.FindStringSubmatch(text); m != nil {
+		month, _ := strconv.Atoi(m[1])
+		return fmt.Sprintf("%s-%02d", m[2], month)
+	}
+	if m := quarterQRe.FindStringSubmatch(text); m != nil {
+		return m[2] + "-Q" + m[1]
+	}
+	if m := quarterRe.FindStringSubmatch(text); m != nil {
+		quarter := map[string]string{"i": "1", "ii": "2", "iii": "3", "iv": "4"}[m[1]]
+		if quarter == "" {
+			quarter = m[1]
+		}
+		return m[2] + "-Q" + quarter
+	}
+	if m := monthNameRe.FindStringSubmatch(text); m != nil {
+		month := 0
+		for i, stemRe := range monthStemRes {
+			if stemRe.MatchString(m[1]) {
+				month = i + 1
+				break
+			}
+		}
+		year := uploadedAt.Year()
+		if m[2] != "" {
+			year, _ = strconv.Atoi(m[2])
+		} else if month > int(uploadedAt.Month()) {
+			year--
+		}
+		return fmt.Sprintf("%d-%02d", year, month)
+	}
+	if m := yearRe.FindStringSubmatch(text); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+var (
+	periodMonthRe   = regexp.MustCompile(`^(\d{4})-(0[1-9]|1[0-2])$`)
+	periodQuarterRe = regexp.MustCompile(`^(\d{4})-Q([1-4])$`)
+	periodYearRe    = regexp.MustCompile(`^(\d{4})$`)
+)
+
+// ParsePeriod проверяет период ("2024-12", "2024-Q4", "2024") и возвращает его границы
+// в виде дат "2006-01-02" (последний день включительно)
+func ParsePeriod(period string) (start, end string, err error) {
+	period = strings.ToUpper(strings.TrimSpace(period))
+	var from time.Time
+	var months int
+	switch {
+	case periodMonthRe.MatchString(period):
+		m := periodMonthRe.FindStringSubmatch(period)
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		from, months = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC), 1
+	case periodQuarterRe.MatchString(period):
+		m := periodQuarterRe.FindStringSubmatch(period)
+		year, _ := strconv.Atoi(m[1])
+		quarter, _ := strconv.Atoi(m[2])
+		from, months = time.Date(year, time.Month(quarter*3-2), 1, 0, 0, 0, 0, time.UTC), 3
+	case periodYearRe.MatchString(period):
+		year, _ := strconv.Atoi(period)
+		from, months = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC), 12
+	default:
+		return "", "", fmt.Errorf("invalid period %q: expected YYYY-MM, YYYY-Qn or YYYY", period)
+	}
+	to := from.AddDate(0, months, -1)
+	return from.Format("2006-01-02"), to.Format("2006-01-02"), nil
+}
+
+// PeriodForRange возвращает самый узкий период ("2024-12", "2024-Q4" или "2024"), в который
+// целиком входят даты from и to; пусто, если они в разных годах
+func PeriodForRange(from, to time.Time) string {
+	switch {
+	case from.IsZero() || to.IsZero() || from.Year() != to.Year():
+		return ""
+	case from.Month() == to.Month():
+		return from.Format("2006-01")
+	case (from.Month()-1)/3 == (to.Month()-1)/3:
+		return fmt.Sprintf("%d-Q%d", from.Year(), (from.Month()-1)/3+1)
+	default:
+		return strconv.Itoa(from.Year())
+	}
+}
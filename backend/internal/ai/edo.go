@@ -0,0 +1,144 @@
+package ai
+
+import (
+	"alfa-hack-backend/internal/bank"
+	"alfa-hack-backend/internal/edo"
+	"fmt"
+	"strings"
+)
+
+const (
+	// edoDocumentItems - сколько строк табличной части показывать в разобранном документе
+	edoDocumentItems = 300
+	// edoPromptOpen - сколько неоплаченных документов попадает в промпт
+	edoPromptOpen = 15
+	// edoPromptPaid - сколько последних оплаченных документов попадает в промпт
+	edoPromptPaid = 5
+)
+
+// edoDocument представляет УПД или счет-фактуру для AI: реквизиты сторон, итоги по ставкам НДС
+// и строки товаров одной строкой каждая вместо XML-разметки
+func edoDocument(doc *edo.Document) *Document {
+	details := Section{Sheet: "Реквизиты"}
+	add := func(format string, args ...interface{}) {
+		details.Rows = append(details.Rows, Row{Num: len(details.Rows) + 1, Text: fmt.Sprintf(format, args...)})
+	}
+	add("%s № %s от %s (функция %s)", edo.KindNames[doc.Kind], doc.Number, formatDate(doc.Date), doc.Function)
+	if doc.Title != "" {
+		add("Наименование документа: %s", doc.Title)
+	}
+	add("Продавец: %s", partyLine(doc.Seller))
+	add("Покупатель: %s", partyLine(doc.Buyer))
+	add("Всего: %s, в том числе НДС %s, без НДС %s", bank.FormatAmount(doc.Total, doc.Currency),
+		bank.FormatAmount(doc.VAT, doc.Currency), bank.FormatAmount(doc.Amount, doc.Currency))
+	for _, group := range doc.VATGroups() {
+		add("Ставка %s: стоимость без НДС %s, НДС %s", group.Rate, bank.FormatAmount(group.Amount, doc.Currency),
+			bank.FormatAmount(group.VAT, doc.Currency))
+	}
+
+	items := Section{Sheet: "Товары и услуги"}
+	for i, item := range doc.Items {
+		if i == edoDocumentItems {
+			items.Rows = append(items.Rows, Row{Num: item.Num, Text: fmt.Sprintf("Еще строк: %d", len(doc.Items)-i)})
+			break
+		}
+		text := fmt.Sprintf("%s | %s %s x %s | без НДС %s | НДС %s %s | всего %s", item.Name,
+			formatQuantity(item.Quantity), item.Unit, bank.FormatAmount(item.Price, doc.Currency), bank.FormatAmount(item.Amount, doc.Currency),
+			item.VATRate, bank.FormatAmount(item.VAT, doc.Currency), bank.FormatAmount(item.Total, doc.Currency))
+		items.Rows = append(items.Rows, Row{Num: item.Num, Text: text})
+	}
+
+	result := &Document{Sections: []Section{details, items}}
+	for _, warning := range doc.Warnings {
+		result.Warnings = append(result.Warnings, "Документ ЭДО: "+warning)
+	}
+	return result
+}
+
+func partyLine(p edo.Party) string {
+	parts := []string{p.Name}
+	if p.Name == "" {
+		parts[0] = "не указан"
+	}
+	if p.INN != "" {
+		parts = append(parts, "ИНН "+p.INN)
+	}
+	if p.KPP != "" {
+		parts = append(parts, "КПП "+p.KPP)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// EDODocument - документ ЭДО вместе с найденной по выпискам оплатой
+type EDODocument struct {
+	Document *edo.Document
+	Match    edo.Match
+}
+
+// EDOMetrics - УПД и счета-фактуры пользователя со статусом оплаты для промпта
+type EDOMetrics struct {
+	Documents []EDODocument // по убыванию даты
+}
+
+// PromptEDO - документы ЭДО в том виде, в котором они попадают в шаблон
+type PromptEDO struct {
+	Summary []string
+	Open    []string // неоплаченные и оплаченные частично
+	Paid    []string // последние оплаченные
+}
+
+// promptEDO форматирует документы ЭДО для шаблона; nil, если документов нет
+func promptEDO(metrics *EDOMetrics) *PromptEDO {
+	if metrics == nil || len(metrics.Documents) == 0 {
+		return nil
+	}
+	result := &PromptEDO{}
+	counts := make(map[string]int)
+	var open int64
+	for _, d := range metrics.Documents {
+		counts[d.Match.Status]++
+		if d.Match.Status != edo.StatusPaid {
+			open += d.Document.Total - d.Match.Paid
+			if len(result.Open) < edoPromptOpen {
+				result.Open = append(result.Open, edoLine(d))
+			}
+		} else if len(result.Paid) < edoPromptPaid {
+			result.Paid = append(result.Paid, edoLine(d))
+		}
+	}
+	result.Summary = append(result.Summary, fmt.Sprintf("Документов: %d, оплачено: %d, частично: %d, не оплачено: %d",
+		len(metrics.Documents), counts[edo.StatusPaid], counts[edo.StatusPartial], counts[edo.StatusUnpaid]))
+	if open > 0 {
+		result.Summary = append(result.Summary, fmt.Sprintf("Остаток к оплате по неоплаченным документам: %s", rub(open)))
+	}
+	return result
+}
+
+// edoLine - документ и его оплата одной строкой
+func edoLine(d EDODocument) string {
+	doc := d.Document
+	parts := []string{
+		fmt.Sprintf("%s № %s от %s", edo.KindNames[doc.Kind], doc.Number, formatDate(doc.Date)),
+		"продавец " + partyLine(doc.Seller),
+		"покупатель " + partyLine(doc.Buyer),
+		fmt.Sprintf("сумма %s (НДС %s)", bank.FormatAmount(doc.Total, doc.Currency), bank.FormatAmount(doc.VAT, doc.Currency)),
+		edo.StatusNames[d.Match.Status],
+	}
+	switch d.Match.Role {
+	case edo.RoleBuyer:
+		parts[len(parts)-1] += " (мы покупатель)"
+	case edo.RoleSeller:
+		parts[len(parts)-1] += " (мы продавец)"
+	}
+	if len(d.Match.Payments) > 0 {
+		payments := make([]string, len(d.Match.Payments))
+		for i, p := range d.Match.Payments {
+			payments[i] = fmt.Sprintf("%s %s", formatDate(p.Date), bank.FormatAmount(p.Amount, doc.Currency))
+		}
+		parts = append(parts, "платежи: "+strings.Join(payments, ", "))
+		if d.Match.Status == edo.StatusPartial {
+			parts = append(parts, "осталось "+bank.FormatAmount(doc.Total-d.Match.Paid, doc.Currency))
+		}
+	}
+	return strings.Join(parts, " | ")
+}
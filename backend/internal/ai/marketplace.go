@@ -0,0 +1,149 @@
+package ai
+
+import (
+	"alfa-hack-backend/internal/marketplace"
+	"fmt"
+	"strings"
+)
+
+const (
+	// marketplaceDocumentSKUs - сколько артикулов показывать в разобранном отчете
+	marketplaceDocumentSKUs = 300
+	// marketplacePromptSKUs - сколько артикулов с наибольшей выплатой попадает в промпт
+	marketplacePromptSKUs = 10
+	// marketplacePromptIssues - сколько проблемных артикулов попадает в промпт
+	marketplacePromptIssues = 10
+	// marketplaceMaxWarnings - сколько предупреждений разбора отчета показывать в статусе обработки
+	marketplaceMaxWarnings = 5
+)
+
+// marketplaceDocument представляет отчет маркетплейса для AI: итоги выплаты и юнит-экономика
+// по артикулам вместо тысяч строк детализации
+func marketplaceDocument(report *marketplace.Report) *Document {
+	s := marketplace.Summarize(report.SKUs())
+	summary := Section{Sheet: "Итоги отчета " + marketplace.Names[report.Marketplace]}
+	add := func(format string, args ...interface{}) {
+		summary.Rows = append(summary.Rows, Row{Num: len(summary.Rows) + 1, Text: fmt.Sprintf(format, args...)})
+	}
+	add("Отчет о реализации %s, лист %q, период %s - %s, строк: %d", marketplace.Names[report.Marketplace],
+		report.Sheet, formatDate(report.DateFrom), formatDate(report.DateTo), len(report.Operations))
+	for _, line := range marketplaceSummaryLines(s) {
+		add("%s", line)
+	}
+	add("Себестоимости товара в отчете нет: выплата - это деньги до вычета закупки")
+
+	skus := Section{Sheet: "Юнит-экономика по артикулам"}
+	for i, sku := range s.SKUs {
+		if i == marketplaceDocumentSKUs {
+			skus.Rows = append(skus.Rows, Row{Num: i + 1, Text: fmt.Sprintf("Еще артикулов: %d", len(s.SKUs)-i)})
+			break
+		}
+		skus.Rows = append(skus.Rows, Row{Num: i + 1, Text: skuLine(sku)})
+	}
+
+	doc := &Document{Sections: []Section{summary, skus}}
+	for i, warning := range report.Warnings {
+		if i == marketplaceMaxWarnings {
+			doc.Warnings = append(doc.Warnings, fmt.Sprintf("Отчет маркетплейса: еще предупреждений - %d", len(report.Warnings)-i))
+			break
+		}
+		doc.Warnings = append(doc.Warnings, "Отчет маркетплейса: "+warning)
+	}
+	return doc
+}
+
+// marketplaceSummaryLines - выручка, удержания, выплата и возвраты
+func marketplaceSummaryLines(s marketplace.Summary) []string {
+	lines := []string{
+		fmt.Sprintf("Продано: %d шт., возвратов: %d шт. (%.1f%%), артикулов: %d", s.Sold, s.Returned, s.ReturnRate()*100, len(s.SKUs)),
+		fmt.Sprintf("Выручка по цене для покупателя за вычетом возвратов: %s", rub(s.Revenue)),
+		fmt.Sprintf("Удержания: комиссия и эквайринг %s (%.1f%%), логистика %s (%.1f%%), штрафы %s, хранение %s, прочее %s",
+			rub(s.Commission), percent(s.Commission, s.Revenue), rub(s.Logistics), percent(s.Logistics, s.Revenue),
+			rub(s.Penalties), rub(s.Storage), rub(s.Other)),
+		fmt.Sprintf("Чистая выплата продавцу: %s (%.1f%% выручки)", rub(s.Payout), percent(s.Payout, s.Revenue)),
+	}
+	if s.Unallocated != 0 {
+		lines = append(lines, fmt.Sprintf("Из них удержания без привязки к товару (хранение, продвижение, подписка): %s", rub(s.Unallocated)))
+	}
+	return lines
+}
+
+// skuLine - юнит-экономика артикула одной строкой
+func skuLine(sku marketplace.SKU) string {
+	parts := []string{skuName(sku),
+		fmt.Sprintf("продано %d, возвратов %d (%.0f%%)", sku.Sold, sku.Returned, sku.ReturnRate()*100),
+		"выручка " + rub(sku.Revenue),
+		"комиссия " + rub(sku.Commission),
+		"логистика " + rub(sku.Logistics),
+	}
+	if other := sku.Penalties + sku.Storage + sku.Other; other != 0 {
+		parts = append(parts, "прочие удержания "+rub(other))
+	}
+	parts = append(parts, "к выплате "+rub(sku.Payout))
+	if sku.Units() > 0 {
+		parts = append(parts, "на единицу "+rub(sku.PayoutPerUnit()))
+	}
+	if issues := sku.Issues(); len(issues) > 0 {
+		parts = append(parts, "внимание: "+strings.Join(issues, "; "))
+	}
+	return strings.Join(parts, " | ")
+}
+
+func skuName(sku marketplace.SKU) string {
+	name := sku.Article
+	if name == "" {
+		name = sku.SKU
+	}
+	if sku.Name != "" {
+		name += " " + sku.Name
+	}
+	if sku.SKU != "" && sku.SKU != sku.Article {
+		name += fmt.Sprintf(" (%s %s)", marketplace.Names[sku.Marketplace], sku.SKU)
+	}
+	return name
+}
+
+// MarketplaceMetrics - итоги отчетов маркетплейсов для промпта
+type MarketplaceMetrics struct {
+	Summary marketplace.Summary
+}
+
+// PromptMarketplace - итоги отчетов маркетплейсов в том виде, в котором они попадают в шаблон
+type PromptMarketplace struct {
+	Marketplaces string
+	Period       string
+	Summary      []string
+	Top          []string // артикулы с наибольшей выплатой
+	Issues       []string // артикулы с возвратами, дорогой логистикой или убытком
+}
+
+// promptMarketplace форматирует итоги маркетплейсов для шаблона; nil, если отчетов нет
+func promptMarketplace(metrics *MarketplaceMetrics) *PromptMarketplace {
+	if metrics == nil || len(metrics.Summary.Marketplaces) == 0 {
+		return nil
+	}
+	s := metrics.Summary
+	names := make([]string, len(s.Marketplaces))
+	for i, name := range s.Marketplaces {
+		names[i] = marketplace.Names[name]
+	}
+	result := &PromptMarketplace{
+		Marketplaces: strings.Join(names, ", "),
+		Period:       fmt.Sprintf("%s - %s", formatDate(s.DateFrom), formatDate(s.DateTo)),
+		Summary:      marketplaceSummaryLines(s),
+	}
+	for i, sku := range s.SKUs {
+		if i == marketplacePromptSKUs {
+			break
+		}
+		result.Top = append(result.Top, skuLine(sku))
+	}
+	for i := len(s.SKUs) - 1; i >= 0 && len(result.Issues) < marketplacePromptIssues; i-- {
+		// С конца списка - начиная с наименьшей выплаты; артикулы из первой десятки уже показаны
+		if i < marketplacePromptSKUs || len(s.SKUs[i].Issues()) == 0 {
+			continue
+		}
+		result.Issues = append(result.Issues, skuLine(s.SKUs[i]))
+	}
+	return result
+}
@@ -0,0 +1,222 @@
+package ai
+
+import (
+	"alfa-hack-backend/internal/bank"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// FinancialMetrics - показатели для промпта: по операциям из банковских выписок - поступления
+// и списания по категориям за последние месяцы в одной валюте и прогноз остатка, по кассовым чекам - продажи,
+// по отчетам маркетплейсов - выплата и юнит-экономика артикулов, по документам ЭДО - статус оплаты,
+// по кадровым файлам - зарплата сотрудников с налогами и взносами, по системе налогообложения из профиля - налоги
+type FinancialMetrics struct {
+	Currency    string
+	Months      []MonthMetrics      // по возрастанию
+	Forecast    *bank.CashForecast  // nil, если прогноз не строился
+	Sales       *SalesMetrics       // nil, если чеков нет
+	Marketplace *MarketplaceMetrics // nil, если отчетов маркетплейсов нет
+	Documents   *EDOMetrics         // nil, если документов ЭДО нет
+	Payroll     *PayrollMetrics     // nil, если сотрудников нет
+	Tax         *TaxMetrics         // nil, если система налогообложения не указана или операций нет
+}
+
+// MonthMetrics - итоги месяца ("2025-03")
+type MonthMetrics struct {
+	Month      string
+	Income     int64
+	Expenses   int64
+	Categories []CategoryAmount
+}
+
+// CategoryAmount - сумма операций категории за месяц; пустая категория - операции без категории
+type CategoryAmount struct {
+	Category  string
+	Direction string
+	Amount    int64
+}
+
+// PromptMetrics - финансовые показатели в том виде, в котором они попадают в шаблон
+type PromptMetrics struct {
+	Currency    string
+	Months      []PromptMonth
+	Forecast    *PromptForecast
+	Sales       *PromptSales
+	Marketplace *PromptMarketplace
+	Documents   *PromptEDO
+	Payroll     *PromptPayroll
+	Tax         *PromptTax
+}
+
+// PromptMonth - итоги месяца для шаблона, суммы уже отформатированы
+type PromptMonth struct {
+	Label    string
+	Income   string
+	Expenses string
+	Net      string
+	Incomes  []PromptCategory // поступления по категориям
+	Outgoing []PromptCategory // списания по категориям
+}
+
+// PromptCategory - строка категории: название, сумма и доля в поступлениях или списаниях месяца
+type PromptCategory struct {
+	Name   string
+	Amount string
+	Share  string
+}
+
+// PromptForecast - прогноз остатка для шаблона, суммы и даты уже отформатированы
+type PromptForecast struct {
+	Days       int
+	AsOf       string
+	Balance    string // пустой, если остаток неизвестен
+	EndDate    string
+	EndBalance string
+	Lowest     string
+	LowestDate string
+	DailyIn    string
+	DailyOut   string
+	Seasonal   bool
+	Payments   []PromptPayment
+	Gaps       []PromptGap
+}
+
+// PromptPayment - ожидаемый регулярный платеж
+type PromptPayment struct {
+	Date         string
+	Name         string
+	Category     string
+	Amount       string // со знаком: списания отрицательные
+	BalanceAfter string
+}
+
+// PromptGap - кассовый разрыв
+type PromptGap struct {
+	From      string
+	To        string
+	Lowest    string
+	Shortfall string
+	Payments  []PromptPayment
+}
+
+// forecastMaxPayments - сколько регулярных платежей из прогноза попадает в промпт
+const forecastMaxPayments = 15
+
+// promptMetrics форматирует показатели для шаблона; nil, если нет ни операций, ни чеков, ни отчетов маркетплейсов,
+// ни документов ЭДО, ни сотрудников, ни расчета налогов
+func promptMetrics(metrics *FinancialMetrics) *PromptMetrics {
+	if metrics == nil {
+		return nil
+	}
+	result := &PromptMetrics{
+		Currency:    metrics.Currency,
+		Sales:       promptSales(metrics.Sales),
+		Marketplace: promptMarketplace(metrics.Marketplace),
+		Documents:   promptEDO(metrics.Documents),
+		Payroll:     promptPayroll(metrics.Payroll),
+		Tax:         promptTax(metrics.Tax),
+	}
+	if len(metrics.Months) == 0 && result.Sales == nil && result.Marketplace == nil && result.Documents == nil &&
+		result.Payroll == nil && result.Tax == nil {
+		return nil
+	}
+	for _, month := range metrics.Months {
+		label := month.Month
+		if date, err := time.Parse("2006-01", month.Month); err == nil {
+			label = fmt.Sprintf("%s %d", monthNamesRu[date.Month()], date.Year())
+		}
+		pm := PromptMonth{
+			Label:    label,
+			Income:   bank.FormatAmount(month.Income, metrics.Currency),
+			Expenses: bank.FormatAmount(month.Expenses, metrics.Currency),
+			Net:      bank.FormatAmount(month.Income-month.Expenses, metrics.Currency),
+		}
+
+		categories := append([]CategoryAmount(nil), month.Categories...)
+		sort.SliceStable(categories, func(i, j int) bool { return categories[i].Amount > categories[j].Amount })
+		for _, c := range categories {
+			total := month.Expenses
+			if c.Direction == bank.DirectionIn {
+				total = month.Income
+			}
+			name := bank.CategoryNames[c.Category]
+			if name == "" {
+				name = "Без категории"
+			}
+			line := PromptCategory{Name: name, Amount: bank.FormatAmount(c.Amount, metrics.Currency)}
+			if total > 0 {
+				line.Share = fmt.Sprintf("%.0f%%", float64(c.Amount)*100/float64(total))
+			}
+			if c.Direction == bank.DirectionIn {
+				pm.Incomes = append(pm.Incomes, line)
+			} else {
+				pm.Outgoing = append(pm.Outgoing, line)
+			}
+		}
+		result.Months = append(result.Months, pm)
+	}
+	result.Forecast = promptForecast(metrics.Forecast)
+	return result
+}
+
+// promptForecast форматирует прогноз для шаблона; без известного остатка суммы - изменение
+// остатка относительно последней выписки
+func promptForecast(f *bank.CashForecast) *PromptForecast {
+	if f == nil || len(f.Days) == 0 {
+		return nil
+	}
+	amount := func(value int64) string { return bank.FormatAmount(value, f.Currency) }
+	relative := func(value int64) string {
+		if f.HasBalance {
+			return amount(value)
+		}
+		change := amount(value - f.Balance)
+		if value >= f.Balance {
+			change = "+" + change
+		}
+		return change
+	}
+	payment := func(p bank.ScheduledPayment) PromptPayment {
+		signed := p.Amount
+		if p.Direction == bank.DirectionOut {
+			signed = -signed
+		}
+		return PromptPayment{
+			Date: p.Date.Format("02.01.2006"), Name: p.Name, Category: bank.CategoryNames[p.Category],
+			Amount: amount(signed), BalanceAfter: relative(p.BalanceAfter),
+		}
+	}
+
+	result := &PromptForecast{
+		Days:       len(f.Days),
+		AsOf:       f.AsOf.Format("02.01.2006"),
+		EndDate:    f.Days[len(f.Days)-1].Date.Format("02.01.2006"),
+		EndBalance: relative(f.EndBalance),
+		Lowest:     relative(f.Lowest),
+		LowestDate: f.LowestDate.Format("02.01.2006"),
+		DailyIn:    amount(f.DailyIn),
+		DailyOut:   amount(f.DailyOut),
+		Seasonal:   f.Seasonal,
+	}
+	if f.HasBalance {
+		result.Balance = amount(f.Balance)
+	}
+	for i, p := range f.Payments {
+		if i == forecastMaxPayments {
+			break
+		}
+		result.Payments = append(result.Payments, payment(p))
+	}
+	for _, gap := range f.Gaps {
+		pg := PromptGap{
+			From: gap.From.Format("02.01.2006"), To: gap.To.Format("02.01.2006"),
+			Lowest: amount(gap.Lowest), Shortfall: amount(gap.Shortfall),
+		}
+		for _, p := range gap.Payments {
+			pg.Payments = append(pg.Payments, payment(p))
+		}
+		result.Gaps = append(result.Gaps, pg)
+	}
+	return result
+}
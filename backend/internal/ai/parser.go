@@ -0,0 +1,269 @@
+package ai
+
+import (
+	"alfa-hack-backend/internal/bank"
+	"alfa-hack-backend/internal/edo"
+	"alfa-hack-backend/internal/marketplace"
+	"alfa-hack-backend/internal/receipts"
+	"alfa-hack-backend/internal/xlsx"
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Document - структурированное содержимое файла: листы или страницы со строками.
+// Номера строк сохраняются, чтобы AI мог ссылаться на конкретное место в файле.
+type Document struct {
+	Sections []Section `json:"sections"`
+	Warnings []string  `json:"warnings"` // части файла, которые не удалось прочитать
+}
+
+// Section - лист Excel, страница Word или весь текстовый файл
+type Section struct {
+	Sheet string `json:"sheet,omitempty"` // имя листа Excel
+	Page  int    `json:"page,omitempty"`  // номер страницы Word (0, если страниц нет)
+	Rows  []Row  `json:"rows"`
+}
+
+// Row - строка таблицы, абзац документа или строка текста
+type Row struct {
+	Num  int    `json:"num"` // номер строки в листе / абзаца на странице / строки в файле (с 1)
+	Text string `json:"text"`
+}
+
+// readDocument разбирает содержимое файла; тип определяется по расширению имени
+func readDocument(name string, data []byte) (*Document, error) {
+	lowerName := strings.ToLower(name)
+
+	// Word документы (.docx)
+	if strings.HasSuffix(lowerName, ".docx") {
+		return readDocxFile(data)
+	}
+
+	// Excel файлы (.xlsx, .xls)
+	if strings.HasSuffix(lowerName, ".xlsx") || strings.HasSuffix(lowerName, ".xls") {
+		return readExcelFile(data)
+	}
+
+	// Банковские выписки - итоги и список операций вместо исходного файла обмена
+	if bank.IsStatementType(strings.TrimPrefix(path.Ext(lowerName), ".")) {
+		if st, err := bank.Parse(data); err == nil {
+			return statementDocument(st), nil
+		}
+	}
+
+	// УПД и счета-фактуры из ЭДО - реквизиты и строки товаров вместо XML
+	if edo.IsDocumentType(strings.TrimPrefix(path.Ext(lowerName), ".")) {
+		if doc, err := edo.Parse(data); err == nil {
+			return edoDocument(doc), nil
+		}
+	}
+
+	// Выгрузки чеков ОФД - итоги продаж вместо строк чеков
+	if receipts.IsExportType(strings.TrimPrefix(path.Ext(lowerName), ".")) {
+		if export, err := receipts.Parse(data); err == nil {
+			return receiptsDocument(export), nil
+		}
+	}
+
+	// Текстовые файлы (.txt, .csv, и т.д.)
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		// Выгрузки из 1С и банков обычно в windows-1251
+		if decoded, err := charmap.Windows1251.NewDecoder().Bytes(data); err == nil {
+			doc := readTextContent(string(decoded))
+			doc.Warnings = append(doc.Warnings, "Текст не в кодировке UTF-8, прочитан как windows-1251")
+			return doc, nil
+		}
+		doc := readTextContent(string(data))
+		doc.Warnings = append(doc.Warnings, "Текст не в кодировке UTF-8: часть символов может быть прочитана неверно")
+		return doc, nil
+	}
+	return readTextContent(string(data)), nil
+}
+
+// readTextContent разбивает текст на строки с номерами
+func readTextContent(content string) *Document {
+	var section Section
+	for i, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		section.Rows = append(section.Rows, Row{Num: i + 1, Text: line})
+	}
+	return &Document{Sections: []Section{section}}
+}
+
+func readDocxFile(data []byte) (*Document, error) {
+	// .docx это ZIP архив, открываем его
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия Word файла как ZIP: %v", err)
+	}
+
+	// Ищем файл word/document.xml внутри ZIP
+	for _, f := range r.File {
+		if f.Name == "word/document.xml" {
+			content, err := readZipEntry(f)
+			if err != nil {
+				return nil, fmt.Errorf("ошибка чтения word/document.xml: %v", err)
+			}
+			return parseDocxXML(content)
+		}
+	}
+
+	return nil, fmt.Errorf("в Word файле нет word/document.xml")
+}
+
+// parseDocxXML извлекает абзацы из word/document.xml и раскладывает их по страницам.
+// Границы страниц берутся из явных разрывов и из отметок, которые Word сохраняет при последней отрисовке.
+func parseDocxXML(content []byte) (*Document, error) {
+	decoder := xml.NewDecoder(strings.NewReader(string(content)))
+
+	page := Section{Page: 1}
+	var pages []Section
+	var paragraph strings.Builder
+	paragraphNum := 0
+	inText := false
+	tableRowDepth := 0 // внутри строки таблицы абзацы ячеек собираются в одну строку
+	warning := ""
+
+	flushParagraph := func() {
+		text := strings.Join(strings.Fields(paragraph.String()), " ")
+		text = strings.TrimSpace(strings.TrimSuffix(text, "|"))
+		paragraph.Reset()
+		if text != "" {
+			paragraphNum++
+			page.Rows = append(page.Rows, Row{Num: paragraphNum, Text: text})
+		}
+	}
+	newPage := func() {
+		flushParagraph()
+		if len(page.Rows) == 0 {
+			return
+		}
+		pages = append(pages, page)
+		page = Section{Page: page.Page + 1}
+		paragraphNum = 0
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if len(pages) == 0 && len(page.Rows) == 0 {
+				return nil, fmt.Errorf("ошибка разбора XML документа: %v", err)
+			}
+			// Оставляем то, что успели прочитать до ошибки
+			warning = fmt.Sprintf("Документ прочитан не полностью: ошибка разбора XML после страницы %d: %v", page.Page, err)
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				paragraph.WriteString(" ")
+			case "tr":
+				flushParagraph()
+				tableRowDepth++
+			case "lastRenderedPageBreak":
+				newPage()
+			case "br":
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "type" && attr.Value == "page" {
+						newPage()
+					}
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if tableRowDepth > 0 {
+					paragraph.WriteString(" ")
+				} else {
+					flushParagraph()
+				}
+			case "tc":
+				// Ячейки таблиц Word разделяем так же, как ячейки Excel
+				paragraph.WriteString(" | ")
+			case "tr":
+				tableRowDepth--
+				flushParagraph()
+			}
+		case xml.CharData:
+			if inText {
+				paragraph.Write(t)
+			}
+		}
+	}
+	flushParagraph()
+	pages = append(pages, page)
+
+	// Пустые страницы не нужны
+	doc := &Document{}
+	if warning != "" {
+		doc.Warnings = append(doc.Warnings, warning)
+	}
+	for _, p := range pages {
+		if len(p.Rows) > 0 {
+			doc.Sections = append(doc.Sections, p)
+		}
+	}
+	return doc, nil
+}
+
+func readExcelFile(data []byte) (*Document, error) {
+	wb, err := xlsx.Read(data)
+	if err != nil {
+		return nil, err
+	}
+	// Отчеты маркетплейсов - итоги и юнит-экономика вместо строк детализации
+	if report, err := marketplace.Parse(wb); err == nil {
+		doc := marketplaceDocument(report)
+		doc.Warnings = append(wb.Warnings, doc.Warnings...)
+		return doc, nil
+	}
+	doc := &Document{Warnings: wb.Warnings}
+	for _, sheet := range wb.Sheets {
+		doc.Sections = append(doc.Sections, Section{Sheet: sheet.Name, Rows: sheetRows(sheet)})
+	}
+	return doc, nil
+}
+
+// sheetRows - строки листа, непустые ячейки объединяются через " | "
+func sheetRows(sheet xlsx.Sheet) []Row {
+	rows := make([]Row, 0, len(sheet.Rows))
+	for _, row := range sheet.Rows {
+		var cells []string
+		for _, cell := range row.Cells {
+			if cell != "" {
+				cells = append(cells, cell)
+			}
+		}
+		rows = append(rows, Row{Num: row.Num, Text: strings.Join(cells, " | ")})
+	}
+	return rows
+}
+
+func readZipEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
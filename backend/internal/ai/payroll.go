@@ -0,0 +1,131 @@
+package ai
+
+import (
+	"alfa-hack-backend/internal/payroll"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// payrollPromptEmployees - сколько сотрудников с наибольшей стоимостью попадает в промпт
+const payrollPromptEmployees = 30
+
+// PayrollMetrics - зарплата сотрудников из кадровых файлов за месяц для промпта
+type PayrollMetrics struct {
+	Payroll payroll.Payroll
+}
+
+// PromptPayroll - расчет зарплаты в том виде, в котором он попадает в шаблон
+type PromptPayroll struct {
+	Month     string
+	Summary   []string
+	Employees []string
+	Notes     string // допущения расчета
+}
+
+// promptPayroll форматирует расчет зарплаты для шаблона; nil, если сотрудников нет
+func promptPayroll(metrics *PayrollMetrics) *PromptPayroll {
+	if metrics == nil || len(metrics.Payroll.Employees) == 0 {
+		return nil
+	}
+	p := metrics.Payroll
+	result := &PromptPayroll{
+		Month:   monthLabel(p.Month),
+		Summary: payrollSummaryLines(p),
+		Notes:   payrollNotes(p),
+	}
+	for i, cost := range p.Employees {
+		if i == payrollPromptEmployees {
+			result.Employees = append(result.Employees, fmt.Sprintf("Еще сотрудников: %d", len(p.Employees)-i))
+			break
+		}
+		result.Employees = append(result.Employees, employeeCostLine(cost))
+	}
+	return result
+}
+
+// payrollSummaryLines - итоги по фонду оплаты труда за месяц
+func payrollSummaryLines(p payroll.Payroll) []string {
+	return []string{
+		fmt.Sprintf("Сотрудников: %d, начислено (ФОТ): %s, НДФЛ: %s, на руки: %s",
+			len(p.Employees), rub(p.Gross), rub(p.NDFL), rub(p.Net)),
+		fmt.Sprintf("Страховые взносы: %s, на травматизм: %s, всего расходы работодателя: %s (%.1f%% сверх начисленного)",
+			rub(p.Contributions), rub(p.Injury), rub(p.Cost), percent(p.Cost-p.Gross, p.Gross)),
+	}
+}
+
+// employeeCostLine - зарплата сотрудника за месяц одной строкой
+func employeeCostLine(cost payroll.MonthCost) string {
+	e := cost.Employee
+	name := e.Name
+	if e.Position != "" {
+		name += ", " + e.Position
+	}
+	parts := []string{name, "оклад " + rub(e.Salary)}
+	if cost.Days < cost.MonthDays {
+		parts = append(parts, fmt.Sprintf("отработано %d из %d дней", cost.Days, cost.MonthDays))
+	}
+	parts = append(parts,
+		"начислено "+rub(cost.Gross), "НДФЛ "+rub(cost.NDFL), "на руки "+rub(cost.Net),
+		"взносы "+rub(cost.Contributions+cost.Injury), "стоимость для работодателя "+rub(cost.Cost),
+	)
+	if !e.HireDate.IsZero() {
+		parts = append(parts, "принят "+formatDate(e.HireDate))
+	}
+	if !e.FireDate.IsZero() {
+		parts = append(parts, "уволен "+formatDate(e.FireDate))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// payrollNotes - допущения, на которых построен расчет
+func payrollNotes(p payroll.Payroll) string {
+	var notes []string
+	switch {
+	case p.Settings.Reduced(p.Rates):
+		notes = append(notes, fmt.Sprintf("взносы по тарифу МСП: 30%% с части зарплаты до %s в месяц и 15%% сверх нее",
+			rub(int64(float64(p.Rates.MROT)*p.Rates.SMEThreshold))))
+	case p.Settings.SME:
+		notes = append(notes, fmt.Sprintf("взносы по общему тарифу 30%%: в %d году пониженный тариф МСП только у приоритетных отраслей", p.Rates.Year))
+	default:
+		notes = append(notes, "взносы по общему тарифу 30%")
+	}
+	notes = append(notes, fmt.Sprintf("предельная база взносов %s, сверх нее 15,1%%", rub(p.Rates.BaseLimit)),
+		fmt.Sprintf("травматизм %s%%", formatQuantity(p.Settings.InjuryPct)),
+		"НДФЛ по прогрессивной шкале нарастающим итогом с начала года, сотрудники - резиденты без вычетов",
+		"учтен только оклад, без премий, отпускных и больничных")
+	if !p.ExactRates {
+		notes = append(notes, fmt.Sprintf("параметры %d года неизвестны, использованы параметры %d года", p.Month.Year(), p.Rates.Year))
+	}
+	return strings.Join(notes, "; ")
+}
+
+func monthLabel(month time.Time) string {
+	return fmt.Sprintf("%s %d", monthNamesRu[month.Month()], month.Year())
+}
+
+// employeeInfo - ответ о персонале для шаблонного ответа: расчет зарплаты по списку сотрудников
+// из показателей, а если их нет - по таблице сотрудников в тексте файлов. Пустая строка - сотрудников нет.
+func employeeInfo(metrics *FinancialMetrics, text string) string {
+	var p payroll.Payroll
+	if metrics != nil && metrics.Payroll != nil {
+		p = metrics.Payroll.Payroll
+	} else if staff, err := payroll.ParseText([]byte(text)); err == nil && len(staff.Employees) > 0 {
+		p = payroll.Month(staff.Employees, time.Now(), payroll.DefaultSettings)
+	}
+	if len(p.Employees) == 0 {
+		return ""
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("**Зарплата сотрудников за %s:**\n", strings.ToLower(monthLabel(p.Month))))
+	for _, line := range payrollSummaryLines(p) {
+		result.WriteString("- " + line + "\n")
+	}
+	result.WriteString("\n")
+	for _, cost := range p.Employees {
+		result.WriteString("- " + employeeCostLine(cost) + "\n")
+	}
+	result.WriteString("\n_Расчет: " + payrollNotes(p) + "._\n\n")
+	return result.String()
+}
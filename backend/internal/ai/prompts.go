@@ -0,0 +1,191 @@
+package ai
+
+import (
+	"alfa-hack-backend/internal/models"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Шаблоны промптов по умолчанию вшиты в бинарник.
+// Любой файл можно переопределить, положив файл с тем же именем в PROMPTS_DIR.
+//
+//go:embed prompts/*
+var embeddedPrompts embed.FS
+
+const basePromptFile = "base.tmpl"
+
+// categoryOrder - коды категорий в фиксированном порядке (важен для хеша версии шаблонов)
+var categoryOrder = []string{"financial", "legal", "hr", "marketing", "growth", "reports"}
+
+// categoryNames - категории вопросов и их названия в промпте
+var categoryNames = map[string]string{
+	"financial": "💰 Финансовый анализ",
+	"legal":     "⚖️ Юридические вопросы",
+	"hr":        "👥 Управление персоналом",
+	"marketing": "📢 Маркетинг и продвижение",
+	"growth":    "📈 Рост и развитие бизнеса",
+	"reports":   "📊 Анализ отчетов и данных",
+}
+
+// PromptData - данные, доступные в шаблонах промпта
+type PromptData struct {
+	Username       string
+	BusinessName   string
+	Specialization string
+	Category       string
+	CategoryName   string
+	Message        string
+	Chunks         []PromptChunk
+	Metrics        *PromptMetrics // показатели по банковским выпискам; nil, если выписок нет
+}
+
+// PromptChunk - фрагмент файла в том виде, в котором он попадает в шаблон
+type PromptChunk struct {
+	Tag   string
+	Label string
+	Text  string
+}
+
+// promptSet - разобранные шаблоны: базовый и по одному на каждую категорию
+type promptSet struct {
+	version    string
+	base       *template.Template
+	categories map[string]*template.Template
+}
+
+var (
+	embeddedSetOnce sync.Once
+	embeddedSet     *promptSet
+	embeddedSetErr  error
+)
+
+// loadPrompts возвращает актуальный набор шаблонов.
+// Без PROMPTS_DIR шаблоны разбираются один раз; с PROMPTS_DIR - при каждом вызове,
+// чтобы правки файлов применялись без перезапуска.
+func loadPrompts() (*promptSet, error) {
+	dir := os.Getenv("PROMPTS_DIR")
+	if dir == "" {
+		embeddedSetOnce.Do(func() {
+			embeddedSet, embeddedSetErr = parsePrompts("")
+		})
+		return embeddedSet, embeddedSetErr
+	}
+	return parsePrompts(dir)
+}
+
+// parsePrompts разбирает шаблоны, беря файлы из dir (если они там есть) или из встроенных
+func parsePrompts(dir string) (*promptSet, error) {
+	readPrompt := func(name string) ([]byte, error) {
+		if dir != "" {
+			content, err := os.ReadFile(filepath.Join(dir, name))
+			if err == nil {
+				return content, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+		}
+		return fs.ReadFile(embeddedPrompts, "prompts/"+name)
+	}
+
+	hash := sha256.New()
+
+	baseContent, err := readPrompt(basePromptFile)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения шаблона %s: %v", basePromptFile, err)
+	}
+	hash.Write(baseContent)
+	base, err := template.New(basePromptFile).Parse(string(baseContent))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора шаблона %s: %v", basePromptFile, err)
+	}
+
+	set := &promptSet{base: base, categories: make(map[string]*template.Template)}
+	for _, category := range categoryOrder {
+		name := category + ".tmpl"
+		content, err := readPrompt(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения шаблона %s: %v", name, err)
+		}
+		hash.Write(content)
+
+		variant, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := variant.Parse(string(content)); err != nil {
+			return nil, fmt.Errorf("ошибка разбора шаблона %s: %v", name, err)
+		}
+		set.categories[category] = variant
+	}
+
+	// Версия = объявленная в VERSION + хеш содержимого, чтобы любая правка шаблона давала новую версию
+	declared := "v0"
+	if content, err := readPrompt("VERSION"); err == nil && strings.TrimSpace(string(content)) != "" {
+		declared = strings.TrimSpace(string(content))
+	}
+	set.version = fmt.Sprintf("%s-%s", declared, hex.EncodeToString(hash.Sum(nil))[:8])
+
+	return set, nil
+}
+
+// render подставляет данные в шаблон нужной категории
+func (s *promptSet) render(data PromptData) (string, error) {
+	tmpl := s.base
+	if variant, ok := s.categories[data.Category]; ok {
+		tmpl = variant
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("ошибка заполнения шаблона промпта: %v", err)
+	}
+	return out.String(), nil
+}
+
+// buildPrompt формирует промпт по шаблонам и возвращает его вместе с версией шаблонов
+func buildPrompt(message, category, username, businessName, specialization string, chunks []Chunk, metrics *FinancialMetrics) (string, string, error) {
+	set, err := loadPrompts()
+	if err != nil {
+		return "", "", err
+	}
+
+	data := PromptData{
+		Username:       username,
+		BusinessName:   businessName,
+		Specialization: specialization,
+		Category:       category,
+		CategoryName:   categoryNames[category],
+		Message:        message,
+		Metrics:        promptMetrics(metrics),
+	}
+	for _, chunk := range chunks {
+		data.Chunks = append(data.Chunks, PromptChunk{
+			Tag:   chunk.Source.Tag,
+			Label: chunkLabel(chunk.Source),
+			Text:  chunk.Text,
+		})
+	}
+
+	prompt, err := set.render(data)
+	if err != nil {
+		return "", "", err
+	}
+	return prompt, set.version, nil
+}
+
+// PreviewPrompt возвращает итоговый промпт и версию шаблонов без обращения к модели
+func PreviewPrompt(message, category, username, businessName, specialization string, files []models.File, metrics *FinancialMetrics) (string, string, error) {
+	return buildPrompt(message, category, username, businessName, specialization, buildChunks(files), metrics)
+}
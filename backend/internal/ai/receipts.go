@@ -0,0 +1,183 @@
+package ai
+
+import (
+	"alfa-hack-backend/internal/bank"
+	"alfa-hack-backend/internal/receipts"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// receiptsTopItems - сколько самых продаваемых позиций показывать в итогах чеков
+	receiptsTopItems = 20
+	// receiptsPromptItems - сколько позиций попадает в промпт
+	receiptsPromptItems = 10
+	// receiptsMaxWarnings - сколько предупреждений разбора чеков показывать в статусе обработки
+	receiptsMaxWarnings = 5
+)
+
+var weekdayNamesRu = []string{"", "Пн", "Вт", "Ср", "Чт", "Пт", "Сб", "Вс"}
+
+// receiptsDocument представляет выгрузку чеков для AI: итоги продаж по часам, дням недели
+// и позициям и выручка по дням вместо тысяч строк чеков
+func receiptsDocument(export *receipts.Export) *Document {
+	s := receipts.Summarize(export.Receipts)
+	summary := Section{Sheet: "Итоги чеков"}
+	add := func(format string, args ...interface{}) {
+		summary.Rows = append(summary.Rows, Row{Num: len(summary.Rows) + 1, Text: fmt.Sprintf(format, args...)})
+	}
+
+	add("Выгрузка кассовых чеков ОФД, формат %s, период %s - %s, чеков прихода: %d, возвратов: %d",
+		receipts.FormatNames[export.Format], formatDate(s.DateFrom), formatDate(s.DateTo), s.Checks, s.RefundChecks)
+	if len(export.FiscalDrives) > 0 {
+		add("Фискальные накопители: %s", strings.Join(export.FiscalDrives, ", "))
+	}
+	for _, line := range salesSummaryLines(s) {
+		add("%s", line)
+	}
+	if len(s.ByWeekday) > 0 {
+		add("По дням недели: %s", weekdaySales(s))
+	}
+	if len(s.ByHour) > 0 {
+		add("По часам: %s", hourSales(s))
+	}
+	if len(s.ByItem) > 0 {
+		add("Самые продаваемые позиции:")
+	}
+	for i, item := range s.ByItem {
+		if i == receiptsTopItems {
+			add("Еще позиций: %d", len(s.ByItem)-i)
+			break
+		}
+		add("%d. %s - %s, продано %s, в чеках: %d", i+1, item.Key, rub(item.Revenue), formatQuantity(item.Quantity), item.Checks)
+	}
+
+	days := Section{Sheet: "Выручка по дням"}
+	for i, day := range s.ByDay {
+		text := fmt.Sprintf("%s | выручка %s | чеков %d", formatDate(parseDay(day.Key)), rub(day.Revenue), day.Checks)
+		if day.Checks > 0 {
+			text += " | средний чек " + rub(day.Revenue/int64(day.Checks))
+		}
+		days.Rows = append(days.Rows, Row{Num: i + 1, Text: text})
+	}
+
+	doc := &Document{Sections: []Section{summary, days}}
+	for i, warning := range export.Warnings {
+		if i == receiptsMaxWarnings {
+			doc.Warnings = append(doc.Warnings, fmt.Sprintf("Чеки: еще предупреждений - %d", len(export.Warnings)-i))
+			break
+		}
+		doc.Warnings = append(doc.Warnings, "Чеки: "+warning)
+	}
+	return doc
+}
+
+// salesSummaryLines - выручка, средний чек и способы оплаты
+func salesSummaryLines(s receipts.Summary) []string {
+	lines := []string{fmt.Sprintf("Выручка: %s (приход %s, возвраты %s), дней с продажами: %d",
+		rub(s.Revenue), rub(s.Sales), rub(s.Refunds), s.Days)}
+	if s.Checks > 0 {
+		lines = append(lines, fmt.Sprintf("Средний чек: %s, позиций в чеке: %s", rub(s.AverageCheck),
+			strings.Replace(strconv.FormatFloat(s.ItemsPerCheck, 'f', 1, 64), ".", ",", 1)))
+	}
+	if s.Revenue > 0 {
+		lines = append(lines, fmt.Sprintf("Оплата: наличными %s (%.0f%%), безналичными %s (%.0f%%)",
+			rub(s.Cash), percent(s.Cash, s.Revenue), rub(s.Card), percent(s.Card, s.Revenue)))
+	}
+	return lines
+}
+
+func weekdaySales(s receipts.Summary) string {
+	parts := make([]string, 0, len(s.ByWeekday))
+	for _, group := range s.ByWeekday {
+		weekday, _ := strconv.Atoi(group.Key)
+		if weekday < 1 || weekday > 7 {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s %s (%d)", weekdayNamesRu[weekday], rub(group.Revenue), group.Checks))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func hourSales(s receipts.Summary) string {
+	parts := make([]string, 0, len(s.ByHour))
+	for _, group := range s.ByHour {
+		parts = append(parts, fmt.Sprintf("%s:00 %s (%d)", group.Key, rub(group.Revenue), group.Checks))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SalesMetrics - показатели продаж по кассовым чекам для промпта
+type SalesMetrics struct {
+	Summary  receipts.Summary
+	Previous *receipts.Summary // тот же по длине период перед Summary, для сравнения; nil, если чеков нет
+}
+
+// PromptSales - показатели продаж в том виде, в котором они попадают в шаблон
+type PromptSales struct {
+	Period   string
+	Summary  []string // выручка, средний чек, способы оплаты
+	Previous string   // сравнение с предыдущим периодом
+	Weekdays string
+	Hours    string
+	Items    []PromptItem
+}
+
+// PromptItem - позиция среди самых продаваемых
+type PromptItem struct {
+	Name     string
+	Revenue  string
+	Quantity string
+	Checks   int
+}
+
+// promptSales форматирует показатели продаж для шаблона; nil, если чеков нет
+func promptSales(sales *SalesMetrics) *PromptSales {
+	if sales == nil || sales.Summary.Checks+sales.Summary.RefundChecks == 0 {
+		return nil
+	}
+	s := sales.Summary
+	result := &PromptSales{
+		Period:   fmt.Sprintf("%s - %s", formatDate(s.DateFrom), formatDate(s.DateTo)),
+		Summary:  salesSummaryLines(s),
+		Weekdays: weekdaySales(s),
+		Hours:    hourSales(s),
+	}
+	if p := sales.Previous; p != nil && p.Checks > 0 {
+		result.Previous = fmt.Sprintf("%s - %s: выручка %s, чеков %d, средний чек %s",
+			formatDate(p.DateFrom), formatDate(p.DateTo), rub(p.Revenue), p.Checks, rub(p.AverageCheck))
+	}
+	for i, item := range s.ByItem {
+		if i == receiptsPromptItems {
+			break
+		}
+		result.Items = append(result.Items, PromptItem{
+			Name: item.Key, Revenue: rub(item.Revenue), Quantity: formatQuantity(item.Quantity), Checks: item.Checks,
+		})
+	}
+	return result
+}
+
+func rub(amount int64) string {
+	return bank.FormatAmount(amount, "RUB")
+}
+
+func percent(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(total)
+}
+
+// formatQuantity - количество без лишних нулей: "12", "3,5"
+func formatQuantity(quantity float64) string {
+	return strings.ReplaceAll(strconv.FormatFloat(math.Round(quantity*1000)/1000, 'f', -1, 64), ".", ",")
+}
+
+func parseDay(value string) time.Time {
+	date, _ := time.Parse("2006-01-02", value)
+	return date
+}
@@ -0,0 +1,269 @@
+package ai
+
+import (
+	"alfa-hack-backend/internal/models"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Chunk - фрагмент файла, который попадает в промпт под тегом [S<n>].
+// Модель ссылается на теги в ответе, а мы превращаем их в models.Source.
+type Chunk struct {
+	Source models.Source
+	Text   string
+}
+
+const (
+	chunkMaxRows  = 40    // строк в одном фрагменте
+	chunkMaxChars = 3000  // символов в одном фрагменте
+	fileMaxChars  = 15000 // символов из одного файла на весь промпт
+)
+
+// buildChunks читает файлы и нарезает их на фрагменты с тегами для цитирования
+func buildChunks(files []models.File) []Chunk {
+	var chunks []Chunk
+	for _, file := range files {
+		doc, err := loadDocument(file)
+		if err != nil {
+			// Логируем ошибку, но продолжаем работу
+			fmt.Printf("Ошибка чтения файла %s: %v\n", file.FilePath, err)
+			continue
+		}
+		for _, warning := range doc.Warnings {
+			fmt.Printf("Файл %s: %s\n", file.Filename, warning)
+		}
+		fileChunks, truncated := chunkDocument(file, doc)
+		if truncated {
+			fmt.Printf("Файл %s обрезан до %d символов\n", file.Filename, fileMaxChars)
+		}
+		chunks = append(chunks, fileChunks...)
+	}
+
+	for i := range chunks {
+		chunks[i].Source.Tag = fmt.Sprintf("S%d", i+1)
+	}
+	return chunks
+}
+
+// TextLine - строка текста файла с указанием места, откуда она взята
+type TextLine struct {
+	Section string `json:"section"` // лист Excel или страница Word; пусто для текстовых файлов
+	Num     int    `json:"num"`
+	Text    string `json:"text"`
+}
+
+// ExtractLines читает файл из хранилища и возвращает его текст построчно
+func ExtractLines(file models.File) ([]TextLine, error) {
+	doc, err := loadDocument(file)
+	if err != nil {
+		return nil, err
+	}
+	var lines []TextLine
+	for _, section := range doc.Sections {
+		name := section.Sheet
+		if section.Page > 0 {
+			name = fmt.Sprintf("стр. %d", section.Page)
+		}
+		for _, row := range section.Rows {
+			lines = append(lines, TextLine{Section: name, Num: row.Num, Text: row.Text})
+		}
+	}
+	return lines, nil
+}
+
+// Extraction - текст, извлеченный парсером из файла, и то, какая его часть попадает в промпт
+type Extraction struct {
+	Sections      []Section `json:"sections"`
+	Warnings      []string  `json:"warnings"`
+	Truncated     bool      `json:"truncated"`
+	TotalChars    int       `json:"total_chars"`
+	IncludedChars int       `json:"included_chars"` // сколько символов видит AI (не больше fileMaxChars)
+	Chunks        int       `json:"chunks"`         // на сколько фрагментов делится текст в промпте
+}
+
+// ExtractFile читает файл так же, как при подготовке промпта, и сообщает об обрезке и нечитаемых частях
+func ExtractFile(file models.File) (*Extraction, error) {
+	doc, err := loadDocument(file)
+	if err != nil {
+		return nil, err
+	}
+	return NewExtraction(file, doc), nil
+}
+
+// NewExtraction описывает уже разобранный документ: размер текста, обрезку и предупреждения
+func NewExtraction(file models.File, doc *Document) *Extraction {
+	extraction := &Extraction{Sections: doc.Sections, Warnings: append([]string{}, doc.Warnings...)}
+	if extraction.Sections == nil {
+		extraction.Sections = []Section{}
+	}
+	for _, section := range doc.Sections {
+		for _, row := range section.Rows {
+			extraction.TotalChars += len(row.Text) + 1
+		}
+	}
+
+	chunks, truncated := chunkDocument(file, doc)
+	for _, chunk := range chunks {
+		extraction.IncludedChars += len(chunk.Text) + 1
+	}
+	extraction.Chunks = len(chunks)
+	extraction.Truncated = truncated
+	if truncated {
+		last := "ничего"
+		if len(chunks) > 0 {
+			last = chunkLabel(chunks[len(chunks)-1].Source)
+		}
+		extraction.Warnings = append(extraction.Warnings, fmt.Sprintf(
+			"Файл слишком большой: AI видит только первые %d из %d символов (последний учтенный фрагмент: %s)",
+			extraction.IncludedChars, extraction.TotalChars, last))
+	}
+	if extraction.TotalChars == 0 {
+		extraction.Warnings = append(extraction.Warnings, "Из файла не удалось извлечь текст")
+	}
+	return extraction
+}
+
+// chunkDocument делит листы/страницы документа на фрагменты по chunkMaxRows строк
+func chunkDocument(file models.File, doc *Document) ([]Chunk, bool) {
+	var chunks []Chunk
+	total := 0
+
+	for _, section := range doc.Sections {
+		var text strings.Builder
+		var current models.Source
+
+		flush := func() {
+			if text.Len() == 0 {
+				return
+			}
+			chunks = append(chunks, Chunk{Source: current, Text: strings.TrimRight(text.String(), "\n")})
+			text.Reset()
+		}
+
+		rowsInChunk := 0
+		for _, row := range section.Rows {
+			if total+len(row.Text) > fileMaxChars {
+				flush()
+				// Строку, которая не влезает целиком (абзац DOCX или текст без переводов строк),
+				// обрезаем, чтобы AI видел хотя бы ее начало
+				if cut := cutUTF8(row.Text, fileMaxChars-total-1); cut != "" {
+					current = models.Source{
+						FileID:   file.ID,
+						Filename: file.Filename,
+						Sheet:    section.Sheet,
+						Page:     section.Page,
+						RowStart: row.Num,
+						RowEnd:   row.Num,
+					}
+					text.WriteString(cut)
+					flush()
+				}
+				return chunks, true
+			}
+			if rowsInChunk >= chunkMaxRows || text.Len()+len(row.Text) > chunkMaxChars {
+				flush()
+				rowsInChunk = 0
+			}
+			if rowsInChunk == 0 {
+				current = models.Source{
+					FileID:   file.ID,
+					Filename: file.Filename,
+					Sheet:    section.Sheet,
+					Page:     section.Page,
+					RowStart: row.Num,
+				}
+			}
+			current.RowEnd = row.Num
+			text.WriteString(row.Text)
+			text.WriteString("\n")
+			total += len(row.Text) + 1
+			rowsInChunk++
+		}
+		flush()
+	}
+	return chunks, false
+}
+
+// cutUTF8 обрезает строку до maxBytes байт, не разрывая символ UTF-8
+func cutUTF8(s string, maxBytes int) string {
+	if maxBytes <= 0 {
+		return ""
+	}
+	if len(s) <= maxBytes {
+		return s
+	}
+	for maxBytes > 0 && !utf8.RuneStart(s[maxBytes]) {
+		maxBytes--
+	}
+	return s[:maxBytes]
+}
+
+// chunkLabel описывает место фрагмента в файле, например: Файл: отчет.xlsx, лист "Продажи", строки 2-41
+func chunkLabel(src models.Source) string {
+	label := fmt.Sprintf("Файл: %s", src.Filename)
+	if src.Sheet != "" {
+		label += fmt.Sprintf(", лист \"%s\"", src.Sheet)
+	}
+	row, rows := "строка", "строки"
+	if src.Page > 0 {
+		label += fmt.Sprintf(", стр. %d", src.Page)
+		row, rows = "абзац", "абзацы"
+	}
+	if src.RowStart == src.RowEnd {
+		return fmt.Sprintf("%s, %s %d", label, row, src.RowStart)
+	}
+	return fmt.Sprintf("%s, %s %d-%d", label, rows, src.RowStart, src.RowEnd)
+}
+
+// fileContentsFromChunks собирает фрагменты обратно в текст по файлам (для шаблонного ответа)
+func fileContentsFromChunks(chunks []Chunk) []string {
+	var contents []string
+	var current strings.Builder
+	currentFileID := ""
+	for _, chunk := range chunks {
+		if chunk.Source.FileID != currentFileID {
+			if current.Len() > 0 {
+				contents = append(contents, current.String())
+				current.Reset()
+			}
+			currentFileID = chunk.Source.FileID
+			current.WriteString(fmt.Sprintf("Файл: %s\n", chunk.Source.Filename))
+		}
+		current.WriteString(chunk.Text)
+		current.WriteString("\n")
+	}
+	if current.Len() > 0 {
+		contents = append(contents, current.String())
+	}
+	return contents
+}
+
+var (
+	citationGroupRe = regexp.MustCompile(`\[([^\[\]]{1,60})\]`)
+	citationTagRe   = regexp.MustCompile(`\bS\d+\b`)
+)
+
+// resolveCitations находит в ответе теги вида [S3] или [S1, S4] и возвращает соответствующие источники
+// в порядке первого упоминания. Теги, которых не было в промпте, игнорируются.
+func resolveCitations(text string, chunks []Chunk) []models.Source {
+	byTag := make(map[string]models.Source, len(chunks))
+	for _, chunk := range chunks {
+		byTag[chunk.Source.Tag] = chunk.Source
+	}
+
+	seen := make(map[string]bool)
+	sources := []models.Source{}
+	for _, group := range citationGroupRe.FindAllStringSubmatch(text, -1) {
+		for _, tag := range citationTagRe.FindAllString(group[1], -1) {
+			src, ok := byTag[tag]
+			if !ok || seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			sources = append(sources, src)
+		}
+	}
+	return sources
+}
@@ -0,0 +1,67 @@
+package ai
+
+import (
+	"alfa-hack-backend/internal/models"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunkDocumentTruncatesLongRow(t *testing.T) {
+	file := models.File{ID: "f1", Filename: "договор.docx"}
+	long := strings.Repeat("Арендатор обязуется ", 1500) // ~30000 байт без переводов строк
+
+	tests := []struct {
+		name   string
+		rows   []Row
+		chunks int
+	}{
+		{"первый абзац больше лимита", []Row{{Num: 1, Text: long}}, 1},
+		{"длинный абзац после короткого", []Row{{Num: 1, Text: "Договор аренды"}, {Num: 2, Text: long}}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := &Document{Sections: []Section{{Page: 1, Rows: tt.rows}}}
+			chunks, truncated := chunkDocument(file, doc)
+			if !truncated {
+				t.Error("truncated = false")
+			}
+			if len(chunks) != tt.chunks {
+				t.Fatalf("chunks = %d, want %d", len(chunks), tt.chunks)
+			}
+			last := chunks[len(chunks)-1]
+			if !strings.HasPrefix(long, last.Text) || !utf8.ValidString(last.Text) {
+				t.Errorf("last chunk is not a valid prefix of the long row")
+			}
+			if last.Source.RowStart != len(tt.rows) || last.Source.RowEnd != len(tt.rows) {
+				t.Errorf("last chunk rows %d-%d", last.Source.RowStart, last.Source.RowEnd)
+			}
+			included := 0
+			for _, c := range chunks {
+				included += len(c.Text) + 1
+			}
+			if included > fileMaxChars || included < fileMaxChars-utf8.UTFMax {
+				t.Errorf("included %d chars, want close to %d", included, fileMaxChars)
+			}
+		})
+	}
+}
+
+func TestCutUTF8(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"привет", 20, "привет"},
+		{"привет", 5, "пр"}, // 5 байт - середина третьей буквы
+		{"привет", 4, "пр"},
+		{"abc", 0, ""},
+		{"абв", 1, ""},
+	}
+	for _, tt := range tests {
+		if got := cutUTF8(tt.s, tt.max); got != tt.want {
+			t.Errorf("cutUTF8(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+		}
+	}
+}
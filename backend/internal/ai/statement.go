@@ -0,0 +1,184 @@
+package ai
+
+import (
+	"alfa-hack-backend/internal/bank"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// statementTopCounterparties - сколько крупнейших контрагентов показывать в итогах выписки
+const statementTopCounterparties = 10
+
+// statementMaxWarnings - сколько предупреждений разбора выписки показывать в статусе обработки
+const statementMaxWarnings = 5
+
+var monthNamesRu = []string{"", "Январь", "Февраль", "Март", "Апрель", "Май", "Июнь",
+	"Июль", "Август", "Сентябрь", "Октябрь", "Ноябрь", "Декабрь"}
+
+// statementDocument представляет выписку для AI: вместо исходного файла обмена - итоги
+// по месяцам и контрагентам и список операций по одной в строке
+func statementDocument(st *bank.Statement) *Document {
+	summary := Section{Sheet: "Итоги выписки"}
+	add := func(format string, args ...interface{}) {
+		summary.Rows = append(summary.Rows, Row{Num: len(summary.Rows) + 1, Text: fmt.Sprintf(format, args...)})
+	}
+
+	add("Банковская выписка, формат %s, период %s - %s, операций: %d",
+		bank.FormatNames[st.Format], formatDate(st.DateFrom), formatDate(st.DateTo), len(st.Transactions))
+	for _, account := range st.Accounts {
+		if account.HasBalance {
+			add("Счет %s (%s): остаток на начало %s, на конец %s", account.Number, account.Currency,
+				bank.FormatAmount(account.Opening, account.Currency), bank.FormatAmount(account.Closing, account.Currency))
+		} else {
+			add("Счет %s (%s)", account.Number, account.Currency)
+		}
+	}
+
+	// Итоги считаются отдельно по каждой валюте
+	currencies := make(map[string]bool)
+	for _, t := range st.Transactions {
+		currencies[t.Currency] = true
+	}
+	multiCurrency := len(currencies) > 1
+
+	type total struct {
+		in, out           int64
+		inCount, outCount int
+	}
+	months := make(map[string]*total)
+	var monthKeys []string
+	type counterparty struct {
+		name     string
+		currency string
+		amount   int64
+		count    int
+	}
+	byCounterparty := map[string]map[string]*counterparty{bank.DirectionIn: {}, bank.DirectionOut: {}}
+	internal := 0
+	for _, t := range st.Transactions {
+		if t.Internal {
+			internal++
+			continue
+		}
+		key := t.Date.Format("2006-01") + "|" + t.Currency
+		if months[key] == nil {
+			months[key] = &total{}
+			monthKeys = append(monthKeys, key)
+		}
+		if t.Direction == bank.DirectionIn {
+			months[key].in += t.Amount
+			months[key].inCount++
+		} else {
+			months[key].out += t.Amount
+			months[key].outCount++
+		}
+
+		name := counterpartyLabel(t)
+		c := byCounterparty[t.Direction][name+"|"+t.Currency]
+		if c == nil {
+			c = &counterparty{name: name, currency: t.Currency}
+			byCounterparty[t.Direction][name+"|"+t.Currency] = c
+		}
+		c.amount += t.Amount
+		c.count++
+	}
+
+	sort.Strings(monthKeys)
+	for _, key := range monthKeys {
+		m := months[key]
+		monthKey, currency, _ := strings.Cut(key, "|")
+		month, _ := time.Parse("2006-01", monthKey)
+		label := fmt.Sprintf("%s %d", monthNamesRu[month.Month()], month.Year())
+		if multiCurrency {
+			label += ", " + currency
+		}
+		add("%s: поступления %s (%d), списания %s (%d)", label,
+			bank.FormatAmount(m.in, currency), m.inCount, bank.FormatAmount(m.out, currency), m.outCount)
+	}
+	if internal > 0 {
+		add("Переводы между собственными счетами (не учтены в итогах): %d", internal)
+	}
+	for _, direction := range []string{bank.DirectionOut, bank.DirectionIn} {
+		var list []*counterparty
+		for _, c := range byCounterparty[direction] {
+			list = append(list, c)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].currency != list[j].currency {
+				return list[i].currency < list[j].currency
+			}
+			if list[i].amount != list[j].amount {
+				return list[i].amount > list[j].amount
+			}
+			return list[i].name < list[j].name
+		})
+		var top []*counterparty
+		perCurrency := make(map[string]int)
+		for _, c := range list {
+			if perCurrency[c.currency] < statementTopCounterparties {
+				top = append(top, c)
+				perCurrency[c.currency]++
+			}
+		}
+		title := "Крупнейшие получатели платежей"
+		if direction == bank.DirectionIn {
+			title = "Крупнейшие плательщики"
+		}
+		if len(top) > 0 {
+			add("%s:", title)
+		}
+		for i, c := range top {
+			add("%d. %s - %s, операций: %d", i+1, c.name, bank.FormatAmount(c.amount, c.currency), c.count)
+		}
+	}
+	for _, warning := range st.Warnings {
+		add("Предупреждение: %s", warning)
+	}
+
+	operations := Section{Sheet: "Операции"}
+	for i, t := range st.Transactions {
+		kind := "поступление"
+		if t.Direction == bank.DirectionOut {
+			kind = "списание"
+		}
+		if t.Internal {
+			kind += " (между своими счетами)"
+		}
+		text := fmt.Sprintf("%s | %s | %s | %s", formatDate(t.Date), kind, bank.FormatAmount(t.Amount, t.Currency), counterpartyLabel(t))
+		if t.Purpose != "" {
+			text += " | " + t.Purpose
+		}
+		operations.Rows = append(operations.Rows, Row{Num: i + 1, Text: text})
+	}
+
+	doc := &Document{Sections: []Section{summary, operations}}
+	for i, warning := range st.Warnings {
+		if i == statementMaxWarnings {
+			doc.Warnings = append(doc.Warnings, fmt.Sprintf("Выписка: еще предупреждений - %d", len(st.Warnings)-i))
+			break
+		}
+		doc.Warnings = append(doc.Warnings, "Выписка: "+warning)
+	}
+	return doc
+}
+
+// counterpartyLabel - контрагент с ИНН, например "ООО Ромашка (ИНН 7701234567)"
+func counterpartyLabel(t bank.Transaction) string {
+	name := strings.TrimSpace(t.Counterparty)
+	if name == "" {
+		name = "Контрагент не указан"
+	}
+	if t.CounterpartyINN != "" {
+		name += " (ИНН " + t.CounterpartyINN + ")"
+	}
+	return name
+}
+
+func formatDate(date time.Time) string {
+	if date.IsZero() {
+		return "?"
+	}
+	return date.Format("02.01.2006")
+}
@@ -0,0 +1,147 @@
+package ai
+
+import (
+	"alfa-hack-backend/internal/tax"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TaxMetrics - расчет налогов по системе налогообложения из профиля
+type TaxMetrics struct {
+	Result *tax.Result
+}
+
+// PromptTax - расчет налогов в том виде, в котором он попадает в шаблон
+type PromptTax struct {
+	Year       int
+	Regime     string
+	Summary    []string
+	Periods    []string
+	Deductions []string
+	Allowed    []string
+	Payments   []string
+	Warnings   []string
+	Notes      []string // допущения расчета и источники данных
+}
+
+// promptTax форматирует расчет налогов для шаблона; nil, если расчета нет
+func promptTax(metrics *TaxMetrics) *PromptTax {
+	if metrics == nil || metrics.Result == nil {
+		return nil
+	}
+	r := metrics.Result
+	return &PromptTax{
+		Year:       r.Year,
+		Regime:     taxRegimeLabel(r),
+		Summary:    taxSummaryLines(r),
+		Periods:    taxPeriodLines(r),
+		Deductions: taxDeductionLines(r),
+		Allowed:    r.Allowed,
+		Payments:   taxPaymentLines(r, time.Now()),
+		Warnings:   r.Warnings,
+		Notes:      r.Notes,
+	}
+}
+
+// taxRegimeLabel - система налогообложения, форма бизнеса и ставка
+func taxRegimeLabel(r *tax.Result) string {
+	label := tax.RegimeNames[r.Regime] + ", " + tax.FormNames[r.Form]
+	if r.Rate > 0 {
+		label += fmt.Sprintf(", ставка %s%%", formatQuantity(r.Rate))
+	}
+	return label
+}
+
+// taxSummaryLines - доходы, расходы, налог и взносы с начала года
+func taxSummaryLines(r *tax.Result) []string {
+	lines := []string{fmt.Sprintf("Данные за %d мес. %d года: доходы %s, расходы %s", r.Months, r.Year, rub(r.Revenue), rub(r.Expenses))}
+	lines = append(lines, "Налог с начала года после вычетов: "+rub(r.Tax))
+	if c := r.Contributions; c != nil {
+		lines = append(lines, fmt.Sprintf("Взносы ИП за себя: фиксированные %s, 1%% с дохода сверх 300 000 ₽ - %s (доход для расчета %s)",
+			rub(c.Fixed), rub(c.Additional), rub(c.Income)))
+	}
+	if v := r.VAT; v != nil {
+		lines = append(lines, fmt.Sprintf("НДС %s%% (оценка): начислен %s, к вычету %s, к уплате %s",
+			formatQuantity(v.Rate), rub(v.Output), rub(v.Input), rub(v.Tax)))
+	}
+	return lines
+}
+
+// taxPeriodLines - отчетные периоды одной строкой
+func taxPeriodLines(r *tax.Result) []string {
+	var lines []string
+	for _, p := range r.Periods {
+		parts := []string{"доходы " + rub(p.Revenue)}
+		if p.Expenses > 0 {
+			parts = append(parts, "расходы "+rub(p.Expenses))
+		}
+		parts = append(parts, "база "+rub(p.Base), "налог "+rub(p.Accrued))
+		if p.Deduction > 0 {
+			parts = append(parts, "вычеты "+rub(p.Deduction))
+		}
+		parts = append(parts, "после вычетов "+rub(p.Tax), fmt.Sprintf("к уплате %s до %s", rub(p.Due), formatDate(p.DueDate)))
+		name := p.Name
+		if p.Partial {
+			name += " (данные не за все месяцы)"
+		}
+		lines = append(lines, name+": "+strings.Join(parts, ", "))
+	}
+	return lines
+}
+
+func taxDeductionLines(r *tax.Result) []string {
+	var lines []string
+	for _, d := range r.Deductions {
+		lines = append(lines, d.Name+": "+rub(d.Amount))
+	}
+	return lines
+}
+
+// taxPaymentLines - платежи со сроками; прошедшие сроки помечены
+func taxPaymentLines(r *tax.Result, now time.Time) []string {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var lines []string
+	for _, p := range r.Payments {
+		line := fmt.Sprintf("до %s - %s: %s", formatDate(p.Due), p.Name, rub(p.Amount))
+		if p.Due.Before(today) {
+			line += " (срок прошел)"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// taxInfo - ответ о налогах для шаблонного ответа; пустая строка, если расчета нет
+func taxInfo(metrics *FinancialMetrics) string {
+	if metrics == nil || metrics.Tax == nil || metrics.Tax.Result == nil {
+		return ""
+	}
+	r := metrics.Tax.Result
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("**Налоги за %d год (%s):**\n", r.Year, taxRegimeLabel(r)))
+	for _, line := range taxSummaryLines(r) {
+		result.WriteString("- " + line + "\n")
+	}
+	if lines := taxPeriodLines(r); len(lines) > 0 {
+		result.WriteString("\n**По отчетным периодам:**\n")
+		for _, line := range lines {
+			result.WriteString("- " + line + "\n")
+		}
+	}
+	if lines := taxPaymentLines(r, time.Now()); len(lines) > 0 {
+		result.WriteString("\n**Платежи:**\n")
+		for _, line := range lines {
+			result.WriteString("- " + line + "\n")
+		}
+	}
+	for _, warning := range r.Warnings {
+		result.WriteString("\n⚠️ " + warning + "\n")
+	}
+	result.WriteString("\n")
+	for _, note := range r.Notes {
+		result.WriteString("_" + note + "._\n")
+	}
+	result.WriteString("\n")
+	return result.String()
+}
@@ -0,0 +1,309 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/models"
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// bulkUploadResult - результат загрузки одного файла из пакета
+type bulkUploadResult struct {
+	Filename string `json:"filename"`          // для файлов из архива - путь внутри архива
+	Archive  string `json:"archive,omitempty"` // архив, из которого взят файл
+	OK       bool   `json:"ok"`
+	Status   int    `json:"status"` // HTTP статус, который получил бы этот файл при загрузке по одному
+	Code     string `json:"code,omitempty"`
+	Error    string `json:"error,omitempty"`
+	File     gin.H  `json:"file,omitempty"`
+}
+
+type bulkUploadResponse struct {
+	Results    []bulkUploadResult `json:"results"`
+	Uploaded   int                `json:"uploaded"`
+	Duplicates int                `json:"duplicates"`
+	Failed     int                `json:"failed"`
+}
+
+// bulkBatch - состояние одной пакетной загрузки
+type bulkBatch struct {
+	h        *Handler
+	ctx      context.Context
+	userID   string
+	meta     models.UpdateFileRequest
+	limits   uploadLimits
+	files    int // сколько файлов уже принято к обработке
+	response bulkUploadResponse
+}
+
+// bulkUpload загружает несколько файлов и распаковывает ZIP-архивы. Ошибка в одном файле
+// не останавливает загрузку остальных - она попадает в результат этого файла.
+func (h *Handler) bulkUpload(ctx context.Context, userID string, headers []*multipart.FileHeader, meta models.UpdateFileRequest, limits uploadLimits) bulkUploadResponse {
+	b := &bulkBatch{h: h, ctx: ctx, userID: userID, meta: meta, limits: limits}
+	b.response.Results = []bulkUploadResult{}
+	for _, header := range headers {
+		if isArchiveName(header.Filename) {
+			b.addArchive(header)
+		} else {
+			b.addFile(header)
+		}
+	}
+	return b.response
+}
+
+func (b *bulkBatch) fail(result bulkUploadResult, uploadErr *uploadError) {
+	result.Status, result.Code, result.Error = uploadErr.Status, uploadErr.Code, uploadErr.Message
+	b.response.Results = append(b.response.Results, result)
+	b.response.Failed++
+}
+
+func (b *bulkBatch) save(result bulkUploadResult, src uploadSource) {
+	file, uploadErr := b.h.saveUpload(b.ctx, b.userID, src, b.meta, b.limits)
+	if uploadErr != nil {
+		b.fail(result, uploadErr)
+		return
+	}
+	result.OK, result.Status, result.File = true, http.StatusOK, file
+	b.response.Results = append(b.response.Results, result)
+	if duplicate, _ := file["duplicate"].(bool); duplicate {
+		b.response.Duplicates++
+	} else {
+		b.response.Uploaded++
+	}
+}
+
+func (b *bulkBatch) tooManyFiles() *uploadError {
+	return &uploadError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Code:    uploadErrTooManyFiles,
+		Message: fmt.Sprintf("Too many files in one upload, maximum is %d", b.limits.MaxFiles),
+	}
+}
+
+// addFile загружает обычный файл из формы
+func (b *bulkBatch) addFile(header *multipart.FileHeader) {
+	result := bulkUploadResult{Filename: header.Filename}
+	if b.files >= b.limits.MaxFiles {
+		b.fail(result, b.tooManyFiles())
+		return
+	}
+	b.files++
+
+	file, err := header.Open()
+	if err != nil {
+		b.fail(result, &uploadError{Status: http.StatusInternalServerError, Code: uploadErrInternal, Message: "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	b.save(result, uploadSource{
+		Name:        header.Filename,
+		Size:        header.Size,
+		ContentType: header.Header.Get("Content-Type"),
+		Content:     file,
+	})
+}
+
+// addArchive распаковывает ZIP-архив и загружает каждый файл из него. Папки архива
+// становятся папками файлов. Защита от zip-бомб: ограничены число файлов, размер каждого
+// файла и всего распакованного содержимого, а также степень сжатия; вложенные архивы не распаковываются.
+func (b *bulkBatch) addArchive(header *multipart.FileHeader) {
+	archiveResult := bulkUploadResult{Filename: header.Filename}
+	invalid := &uploadError{
+		Status:  http.StatusUnsupportedMediaType,
+		Code:    uploadErrInvalidArchive,
+		Message: fmt.Sprintf("File %q is not a valid ZIP archive", header.Filename),
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		b.fail(archiveResult, &uploadError{Status: http.StatusInternalServerError, Code: uploadErrInternal, Message: "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	reader, err := zip.NewReader(file, header.Size)
+	if err != nil {
+		b.fail(archiveResult, invalid)
+		return
+	}
+
+	var entries []*zip.File
+	for _, f := range reader.File {
+		if !f.FileInfo().IsDir() && !isArchiveJunk(archiveEntryName(f)) {
+			entries = append(entries, f)
+		}
+	}
+	if len(entries) == 0 {
+		b.fail(archiveResult, &uploadError{Status: http.StatusBadRequest, Code: uploadErrEmptyFile, Message: "Archive contains no files"})
+		return
+	}
+	if b.files+len(entries) > b.limits.MaxFiles {
+		b.fail(archiveResult, b.tooManyFiles())
+		return
+	}
+	b.files += len(entries)
+
+	var unpacked int64
+	for _, f := range entries {
+		name := archiveEntryName(f)
+		result := bulkUploadResult{Filename: name, Archive: header.Filename}
+
+		clean, ok := safeArchivePath(name)
+		if !ok {
+			b.fail(result, &uploadError{
+				Status:  http.StatusBadRequest,
+				Code:    uploadErrUnsafePath,
+				Message: fmt.Sprintf("Unsafe path in archive: %q", name),
+			})
+			continue
+		}
+		if isArchiveName(clean) {
+			b.fail(result, &uploadError{
+				Status:  http.StatusUnprocessableEntity,
+				Code:    uploadErrNestedArchive,
+				Message: "Nested archives are not supported",
+			})
+			continue
+		}
+
+		data, uploadErr := b.readEntry(f, &unpacked)
+		if uploadErr != nil {
+			b.fail(result, uploadErr)
+			continue
+		}
+
+		folder := path.Dir(clean)
+		if folder == "." {
+			folder = ""
+		}
+		b.save(result, uploadSource{
+			Name:    path.Base(clean),
+			Folder:  folder,
+			Size:    int64(len(data)),
+			Content: bytes.NewReader(data),
+		})
+	}
+}
+
+// suspiciousRatioMinSize - степень сжатия проверяется только у файлов крупнее этого размера:
+// маленькие файлы с повторяющимся текстом сжимаются очень сильно и без злого умысла
+const suspiciousRatioMinSize = 1 << 20
+
+// readEntry читает файл из архива в память. Размеры в заголовке архива могут быть подделаны,
+// поэтому лимиты проверяются и по ним, и по фактически прочитанным байтам.
+func (b *bulkBatch) readEntry(f *zip.File, unpacked *int64) ([]byte, *uploadError) {
+	tooLarge := &uploadError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Code:    uploadErrFileTooLarge,
+		Message: fmt.Sprintf("File is too large, maximum is %s", formatBytes(b.limits.MaxFileSize)),
+	}
+	archiveTooLarge := &uploadError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Code:    uploadErrArchiveTooLarge,
+		Message: fmt.Sprintf("Unpacked archive is too large, maximum is %s", formatBytes(b.limits.MaxArchiveUnpacked)),
+	}
+	suspicious := &uploadError{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    uploadErrSuspiciousZip,
+		Message: fmt.Sprintf("File is compressed more than %d times, the archive may be a zip bomb", maxCompressionRatio),
+	}
+	isSuspicious := func(size uint64) bool {
+		return size > suspiciousRatioMinSize && size > f.CompressedSize64*maxCompressionRatio
+	}
+
+	if f.UncompressedSize64 > uint64(b.limits.MaxFileSize) {
+		return nil, tooLarge
+	}
+	if *unpacked+int64(f.UncompressedSize64) > b.limits.MaxArchiveUnpacked {
+		return nil, archiveTooLarge
+	}
+	if isSuspicious(f.UncompressedSize64) {
+		return nil, suspicious
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, &uploadError{Status: http.StatusUnprocessableEntity, Code: uploadErrInvalidArchive, Message: "Failed to unpack file"}
+	}
+	defer rc.Close()
+
+	limit := b.limits.MaxFileSize
+	if remaining := b.limits.MaxArchiveUnpacked - *unpacked; remaining < limit {
+		limit = remaining
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	*unpacked += int64(len(data))
+	switch {
+	case int64(len(data)) > b.limits.MaxFileSize:
+		return nil, tooLarge
+	case int64(len(data)) > limit:
+		return nil, archiveTooLarge
+	case isSuspicious(uint64(len(data))):
+		return nil, suspicious
+	case err != nil:
+		// В том числе несовпадение контрольной суммы
+		return nil, &uploadError{Status: http.StatusUnprocessableEntity, Code: uploadErrInvalidArchive, Message: "Failed to unpack file"}
+	}
+	return data, nil
+}
+
+// isArchiveName - файл загружается как ZIP-архив, который нужно распаковать
+func isArchiveName(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".zip")
+}
+
+// archiveEntryName возвращает имя файла в архиве. Архиватор Windows записывает русские имена
+// в кодировке CP866 без флага UTF-8.
+func archiveEntryName(f *zip.File) string {
+	if utf8.ValidString(f.Name) {
+		return f.Name
+	}
+	if name, err := charmap.CodePage866.NewDecoder().String(f.Name); err == nil {
+		return name
+	}
+	return strings.ToValidUTF8(f.Name, "_")
+}
+
+// isArchiveJunk - служебные файлы архиваторов и ОС, которые пропускаются без ошибки
+func isArchiveJunk(name string) bool {
+	name = strings.ReplaceAll(name, "\\", "/")
+	base := path.Base(name)
+	return strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(base, "._") ||
+		base == ".DS_Store" || strings.EqualFold(base, "Thumbs.db") || strings.EqualFold(base, "desktop.ini")
+}
+
+// safeArchivePath проверяет путь файла в архиве: без абсолютных путей, букв дисков, ".."
+// и управляющих символов. Возвращает путь через "/" без лишних частей.
+func safeArchivePath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return "", false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", false
+		}
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f {
+			return "", false
+		}
+	}
+	clean := path.Clean(name)
+	if clean == "." || clean == "" {
+		return "", false
+	}
+	return clean, true
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/models"
+	"archive/zip"
+	"bytes"
+	"context"
+	"hash/crc32"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type zipEntry struct {
+	name string
+	data []byte
+	// Если больше нуля - в заголовке записывается этот размер вместо настоящего
+	fakeSize uint64
+}
+
+func makeZip(t *testing.T, entries ...zipEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, e := range entries {
+		if e.fakeSize > 0 {
+			raw := deflateRaw(t, e.data)
+			header := &zip.FileHeader{
+				Name:               e.name,
+				Method:             zip.Deflate,
+				CRC32:              crc32.ChecksumIEEE(e.data),
+				CompressedSize64:   uint64(len(raw)),
+				UncompressedSize64: e.fakeSize,
+			}
+			rw, err := w.CreateRaw(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rw.Write(raw)
+			continue
+		}
+		fw, err := w.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(e.data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// deflateRaw сжимает данные так же, как их хранит ZIP
+func deflateRaw(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	fw, err := w.Create("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	w.Close()
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset, err := r.File[0].DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()[offset : offset+int64(r.File[0].CompressedSize64)]
+}
+
+// formFiles собирает multipart-форму и возвращает ее файлы, как их получает обработчик
+func formFiles(t *testing.T, files ...zipEntry) []*multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, f := range files {
+		fw, err := w.CreateFormFile("files", f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(f.data)
+	}
+	w.Close()
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(32 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	return form.File["files"]
+}
+
+type wantResult struct {
+	filename string
+	status   int
+	code     string
+}
+
+func TestBulkUploadArchive(t *testing.T) {
+	text := []byte("Дата;Сумма\n01.03.2026;1500\n")
+	zeros := make([]byte, 2<<20)
+
+	tests := []struct {
+		name    string
+		entries []zipEntry
+		limits  func(*uploadLimits)
+		want    []wantResult
+	}{
+		{
+			name: "небезопасные пути",
+			entries: []zipEntry{
+				{name: "../x.txt", data: text},
+				{name: "docs/../../x.txt", data: text},
+				{name: "/etc/x.txt", data: text},
+				{name: "C:/x.txt", data: text},
+				{name: `C:\Windows\x.txt`, data: text},
+				{name: `..\x.txt`, data: text},
+				{name: "2026/март/выписка.csv", data: text},
+			},
+			want: []wantResult{
+				{"../x.txt", http.StatusBadRequest, uploadErrUnsafePath},
+				{"docs/../../x.txt", http.StatusBadRequest, uploadErrUnsafePath},
+				{"/etc/x.txt", http.StatusBadRequest, uploadErrUnsafePath},
+				{"C:/x.txt", http.StatusBadRequest, uploadErrUnsafePath},
+				{`C:\Windows\x.txt`, http.StatusBadRequest, uploadErrUnsafePath},
+				{`..\x.txt`, http.StatusBadRequest, uploadErrUnsafePath},
+				{"2026/март/выписка.csv", http.StatusOK, ""},
+			},
+		},
+		{
+			name: "вложенный архив",
+			entries: []zipEntry{
+				{name: "inner.zip", data: makeZip(t, zipEntry{name: "a.txt", data: text})},
+				{name: "a.txt", data: text},
+			},
+			want: []wantResult{
+				{"inner.zip", http.StatusUnprocessableEntity, uploadErrNestedArchive},
+				{"a.txt", http.StatusOK, ""},
+			},
+		},
+		{
+			name:    "степень сжатия больше допустимой",
+			entries: []zipEntry{{name: "bomb.txt", data: zeros}},
+			limits:  func(l *uploadLimits) { l.MaxFileSize = 4 << 20 },
+			want:    []wantResult{{"bomb.txt", http.StatusUnprocessableEntity, uploadErrSuspiciousZip}},
+		},
+		{
+			// archive/zip не читает больше размера из заголовка - файл отклоняется как поврежденный
+			name:    "размер в заголовке занижен",
+			entries: []zipEntry{{name: "bomb.txt", data: zeros, fakeSize: 100}},
+			limits:  func(l *uploadLimits) { l.MaxFileSize = 4 << 20 },
+			want:    []wantResult{{"bomb.txt", http.StatusUnprocessableEntity, uploadErrInvalidArchive}},
+		},
+		{
+			name:    "файл больше лимита",
+			entries: []zipEntry{{name: "big.txt", data: bytes.Repeat([]byte("строка выписки\n"), 80000)}},
+			want:    []wantResult{{"big.txt", http.StatusRequestEntityTooLarge, uploadErrFileTooLarge}},
+		},
+		{
+			name: "распакованный архив больше лимита",
+			entries: []zipEntry{
+				{name: "a.txt", data: bytes.Repeat([]byte("a"), 600)},
+				{name: "b.txt", data: bytes.Repeat([]byte("b"), 600)},
+			},
+			limits: func(l *uploadLimits) { l.MaxArchiveUnpacked = 1000 },
+			want: []wantResult{
+				{"a.txt", http.StatusOK, ""},
+				{"b.txt", http.StatusRequestEntityTooLarge, uploadErrArchiveTooLarge},
+			},
+		},
+		{
+			name: "файлов больше MaxFiles",
+			entries: []zipEntry{
+				{name: "a.txt", data: []byte("a")},
+				{name: "b.txt", data: []byte("b")},
+				{name: "c.txt", data: []byte("c")},
+			},
+			limits: func(l *uploadLimits) { l.MaxFiles = 2 },
+			want:   []wantResult{{"archive.zip", http.StatusRequestEntityTooLarge, uploadErrTooManyFiles}},
+		},
+		{
+			name: "служебные файлы пропускаются",
+			entries: []zipEntry{
+				{name: "__MACOSX/._a.txt", data: text},
+				{name: ".DS_Store", data: text},
+			},
+			want: []wantResult{{"archive.zip", http.StatusBadRequest, uploadErrEmptyFile}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t)
+			limits := testLimits()
+			if tt.limits != nil {
+				tt.limits(&limits)
+			}
+			headers := formFiles(t, zipEntry{name: "archive.zip", data: makeZip(t, tt.entries...)})
+			response := h.bulkUpload(context.Background(), testUserID, headers, models.UpdateFileRequest{}, limits)
+			checkBulkResults(t, response, tt.want)
+		})
+	}
+}
+
+func TestBulkUploadTooManyFiles(t *testing.T) {
+	h := newTestHandler(t)
+	limits := testLimits()
+	limits.MaxFiles = 2
+	headers := formFiles(t,
+		zipEntry{name: "a.txt", data: []byte("a")},
+		zipEntry{name: "b.txt", data: []byte("b")},
+		zipEntry{name: "c.txt", data: []byte("c")},
+		zipEntry{name: "archive.zip", data: makeZip(t, zipEntry{name: "d.txt", data: []byte("d")})},
+	)
+	response := h.bulkUpload(context.Background(), testUserID, headers, models.UpdateFileRequest{}, limits)
+	checkBulkResults(t, response, []wantResult{
+		{"a.txt", http.StatusOK, ""},
+		{"b.txt", http.StatusOK, ""},
+		{"c.txt", http.StatusRequestEntityTooLarge, uploadErrTooManyFiles},
+		{"archive.zip", http.StatusRequestEntityTooLarge, uploadErrTooManyFiles},
+	})
+}
+
+func checkBulkResults(t *testing.T, response bulkUploadResponse, want []wantResult) {
+	t.Helper()
+	if len(response.Results) != len(want) {
+		t.Fatalf("results = %+v, want %d", response.Results, len(want))
+	}
+	failed := 0
+	for i, w := range want {
+		got := response.Results[i]
+		if got.Filename != w.filename || got.Status != w.status || got.Code != w.code {
+			t.Errorf("result %d = %s %d %q, want %s %d %q", i, got.Filename, got.Status, got.Code, w.filename, w.status, w.code)
+		}
+		if got.OK != (w.status == http.StatusOK) {
+			t.Errorf("result %d ok = %v", i, got.OK)
+		}
+		if !got.OK {
+			failed++
+		}
+	}
+	if response.Failed != failed || response.Uploaded != len(want)-failed {
+		t.Errorf("uploaded %d, failed %d; want %d, %d", response.Uploaded, response.Failed, len(want)-failed, failed)
+	}
+}
+
+func TestSafeArchivePath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"2026/выписка.txt", "2026/выписка.txt", true},
+		{`2026\март\выписка.txt`, "2026/март/выписка.txt", true},
+		{"./a//b.txt", "a/b.txt", true},
+		{"a/b/../c.txt", "", false}, // ".." не допускается, даже если путь остается внутри архива
+		{"../x.txt", "", false},
+		{"a/../../x.txt", "", false},
+		{"/x.txt", "", false},
+		{`\x.txt`, "", false},
+		{"C:x.txt", "", false},
+		{"d:/x.txt", "", false},
+		{"a\x00.txt", "", false},
+		{"a\nb.txt", "", false},
+		{".", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := safeArchivePath(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("safeArchivePath(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+		if ok && strings.Contains(got, "..") {
+			t.Errorf("safeArchivePath(%q) = %q keeps ..", tt.name, got)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/calendar"
+	"alfa-hack-backend/internal/payroll"
+	"alfa-hack-backend/internal/tax"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultCalendarDays     = 90              // календарь по умолчанию - на 90 дней вперед
+	maxCalendarDays         = 2 * 366         // наибольший период календаря
+	defaultReminderInterval = time.Hour       // как часто проверять сроки для напоминаний
+	reminderStartDelay      = 2 * time.Minute // первая проверка после запуска сервера
+)
+
+// defaultReminderDays - за сколько дней до срока напоминать
+var defaultReminderDays = []int{7, 1}
+
+// calendarNote - откуда берутся суммы в календаре
+const calendarNote = "Суммы налогов - из расчета по выпискам на сегодня, взносов за сотрудников - по окладам из списков сотрудников; " +
+	"у остальных сроков сумма не рассчитывается"
+
+// calendarProfile - профиль бизнеса для календаря. Если число сотрудников в профиле не указано (-1),
+// оно берется из списков сотрудников: работающие в текущем месяце.
+func (h *Handler) calendarProfile(userID string) (calendar.Profile, error) {
+	var p calendar.Profile
+	taxProfile, err := h.loadTaxProfile(userID)
+	if err != nil {
+		return p, err
+	}
+	defaultForm(&taxProfile)
+	p.Tax = taxProfile
+	err = h.db.QueryRow("SELECT COALESCE(region, ''), COALESCE(employees_count, -1) FROM users WHERE id = ?", userID).
+		Scan(&p.Region, &p.Employees)
+	if err != nil || p.Employees >= 0 {
+		return p, err
+	}
+	stored, err := h.loadEmployees(userID, nil)
+	if err != nil {
+		return p, err
+	}
+	employees := make([]payroll.Employee, len(stored))
+	for i, e := range stored {
+		employees[i] = e.Employee
+	}
+	p.Employees = len(payroll.Month(employees, time.Now(), h.payrollSettings(userID)).Employees)
+	return p, nil
+}
+
+// calendarWarnings - чего не хватает в профиле для полного календаря
+func calendarWarnings(p calendar.Profile) []string {
+	warnings := []string{}
+	if p.Tax.Regime == "" {
+		warnings = append(warnings, "Не указана система налогообложения: в календаре только сроки по сотрудникам. "+
+			"Укажите ее в профиле (PUT /api/user/profile)")
+	}
+	if p.Region == "" {
+		warnings = append(warnings, "Не указан регион: региональные сборы (торговый сбор в Москве) не учитываются")
+	}
+	return warnings
+}
+
+// paymentKey - вид платежа и срок
+type paymentKey struct {
+	code string
+	due  string
+}
+
+// fillAmounts подставляет суммы в платежи календаря: налоги - из расчета по выпискам за налоговый год,
+// взносы за сотрудников - из расчета зарплаты за месяц. Суммы, которые не удалось рассчитать, остаются нулевыми.
+func (h *Handler) fillAmounts(userID string, p calendar.Profile, list []calendar.Obligation) {
+	taxPayments := map[int]map[paymentKey]int64{}
+	var employees []payroll.Employee
+	employeesLoaded := false
+	settings := h.payrollSettings(userID)
+	for i := range list {
+		o := &list[i]
+		if o.TaxCode != "" && p.Tax.Regime != "" {
+			payments, ok := taxPayments[o.Year]
+			if !ok {
+				payments = h.taxPayments(userID, p.Tax, o.Year)
+				taxPayments[o.Year] = payments
+			}
+			o.Amount = payments[paymentKey{o.TaxCode, sqlDate(o.Due)}]
+		}
+		if o.Month > 0 && (o.Code == "contributions" || o.Code == "injury") {
+			if !employeesLoaded {
+				employeesLoaded = true
+				stored, err := h.loadEmployees(userID, nil)
+				if err != nil {
+					log.Printf("Failed to load employees for calendar of user %s: %v", userID, err)
+				}
+				for _, e := range stored {
+					employees = append(employees, e.Employee)
+				}
+			}
+			if len(employees) == 0 {
+				continue
+			}
+			month := payroll.Month(employees, time.Date(o.Year, time.Month(o.Month), 1, 0, 0, 0, 0, time.UTC), settings)
+			o.Amount = month.Contributions
+			if o.Code == "injury" {
+				o.Amount = month.Injury
+			}
+		}
+	}
+}
+
+// taxPayments - платежи из расчета налогов за год по выпискам; пусто, если расчет не удался
+func (h *Handler) taxPayments(userID string, profile tax.Profile, year int) map[paymentKey]int64 {
+	payments := map[paymentKey]int64{}
+	input, _, err := h.taxInput(userID, nil, year)
+	if err != nil {
+		log.Printf("Failed to compute tax for calendar of user %s: %v", userID, err)
+		return payments
+	}
+	result, err := tax.Calculate(profile, input)
+	if err != nil {
+		log.Printf("Failed to compute tax for calendar of user %s: %v", userID, err)
+		return payments
+	}
+	for _, payment := range result.Payments {
+		payments[paymentKey{payment.Code, sqlDate(payment.Due)}] += payment.Amount
+	}
+	return payments
+}
+
+// bindCalendarPeriod - период календаря из ?from=&to= или ?period=; по умолчанию from - сегодня,
+// to - через days дней после from. При ошибке отвечает 400.
+func bindCalendarPeriod(c *gin.Context, from time.Time, days int) (time.Time, time.Time, bool) {
+	fromValue, toValue, ok := bindPeriod(c)
+	if !ok {
+		return from, from, false
+	}
+	if fromValue != "" {
+		from, _ = time.Parse("2006-01-02", fromValue)
+	}
+	to := from.AddDate(0, 0, days)
+	if toValue != "" {
+		to, _ = time.Parse("2006-01-02", toValue)
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be earlier than from"})
+		return from, to, false
+	}
+	if to.Sub(from) > maxCalendarDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("calendar period must not exceed %d days", maxCalendarDays)})
+		return from, to, false
+	}
+	return from, to, true
+}
+
+// today - текущая дата без времени
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// obligationJSON - обязательство календаря в ответе API
+func obligationJSON(o calendar.Obligation, now time.Time) gin.H {
+	var amount interface{}
+	if o.Amount > 0 {
+		amount = rubles(o.Amount)
+	}
+	return gin.H{
+		"id": o.ID, "code": o.Code, "kind": o.Kind, "kind_name": calendar.KindNames[o.Kind], "title": o.Title,
+		"period": o.Period, "description": o.Description, "due_date": sqlDate(o.Due),
+		"days_left": int(o.Due.Sub(now).Hours() / 24), "year": o.Year, "amount": amount, "conditional": o.Conditional,
+	}
+}
+
+// GetCalendar - налоговые и отчетные сроки по профилю бизнеса (?from=&to= или ?period=2026-10;
+// по умолчанию - на 90 дней вперед)
+func (h *Handler) GetCalendar(c *gin.Context) {
+	now := today()
+	from, to, ok := bindCalendarPeriod(c, now, defaultCalendarDays)
+	if !ok {
+		return
+	}
+	userID := c.GetString("user_id")
+	profile, err := h.calendarProfile(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	list := calendar.Generate(profile, from, to)
+	h.fillAmounts(userID, profile, list)
+	obligations := []gin.H{}
+	for _, o := range list {
+		obligations = append(obligations, obligationJSON(o, now))
+	}
+	c.JSON(http.StatusOK, gin.H{"calendar": gin.H{
+		"from": sqlDate(from), "to": sqlDate(to),
+		"profile": gin.H{
+			"tax_regime": profile.Tax.Regime, "tax_regime_name": tax.RegimeNames[profile.Tax.Regime],
+			"legal_form": profile.Tax.Form, "employees": profile.Employees, "region": profile.Region,
+		},
+		"obligations": obligations,
+		"warnings":    calendarWarnings(profile),
+		"notes":       []string{calendarNote},
+	}})
+}
+
+// GetCalendarICS - календарь сроков в формате iCalendar для импорта в календарь (?from=&to=;
+// по умолчанию - с начала текущего года на год вперед). В событиях - напоминания за REMINDER_DAYS дней.
+func (h *Handler) GetCalendarICS(c *gin.Context) {
+	now := today()
+	from, to, ok := bindCalendarPeriod(c, time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.UTC), 0)
+	if !ok {
+		return
+	}
+	if c.Query("to") == "" && c.Query("period") == "" {
+		to = now.AddDate(1, 0, 0)
+	}
+	userID := c.GetString("user_id")
+	profile, err := h.calendarProfile(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	list := calendar.Generate(profile, from, to)
+	h.fillAmounts(userID, profile, list)
+	data := calendar.ICS(list, calendar.ICSOptions{
+		Name:      "Налоговый календарь",
+		UIDSuffix: userID + "@alfa-hack",
+		Alarms:    reminderDays(),
+		Now:       time.Now(),
+	})
+	c.Header("Content-Disposition", `attachment; filename="tax-calendar.ics"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", data)
+}
+
+// reminderDays - за сколько дней до срока напоминать: REMINDER_DAYS через запятую, например "7,3,1"
+// (0 - в день срока)
+func reminderDays() []int {
+	value := os.Getenv("REMINDER_DAYS")
+	if value == "" {
+		return defaultReminderDays
+	}
+	var days []int
+	for _, part := range strings.Split(value, ",") {
+		d, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || d < 0 || d > 60 {
+			log.Printf("Invalid REMINDER_DAYS %q, using %v", value, defaultReminderDays)
+			return defaultReminderDays
+		}
+		days = append(days, d)
+	}
+	sort.Ints(days)
+	return days
+}
+
+// SendReminders отправляет напоминания о сроках, до которых осталось не больше дней из REMINDER_DAYS.
+// По каждому обязательству отправляется одно напоминание на каждый порог: если сервер не работал,
+// пропущенные пороги не досылаются, а отправляется ближайший.
+func (h *Handler) SendReminders(ctx context.Context, notifier calendar.Notifier) (int, error) {
+	return h.sendReminders(ctx, notifier, today())
+}
+
+// sendReminders отправляет напоминания на дату now
+func (h *Handler) sendReminders(ctx context.Context, notifier calendar.Notifier, now time.Time) (int, error) {
+	days := reminderDays()
+	rows, err := h.db.Query("SELECT id, username FROM users ORDER BY created_at")
+	if err != nil {
+		return 0, err
+	}
+	type user struct{ id, username string }
+	var users []user
+	for rows.Next() {
+		var u user
+		if err := rows.Scan(&u.id, &u.username); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		users = append(users, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, u := range users {
+		profile, err := h.calendarProfile(u.id)
+		if err != nil {
+			log.Printf("Failed to load calendar profile for user %s: %v", u.id, err)
+			continue
+		}
+		list := calendar.Generate(profile, now, now.AddDate(0, 0, days[len(days)-1]))
+		amountsFilled := false
+		for i := range list {
+			o := &list[i]
+			left := int(o.Due.Sub(now).Hours() / 24)
+			threshold := -1
+			for _, d := range days {
+				if d >= left {
+					threshold = d
+					break
+				}
+			}
+			if threshold < 0 {
+				continue
+			}
+			var exists int
+			err := h.db.QueryRow(
+				"SELECT COUNT(*) FROM reminders WHERE user_id = ? AND obligation_id = ? AND days_before = ?",
+				u.id, o.ID, threshold,
+			).Scan(&exists)
+			if err != nil {
+				return sent, err
+			}
+			if exists > 0 {
+				continue
+			}
+			if !amountsFilled {
+				amountsFilled = true
+				h.fillAmounts(u.id, profile, list)
+			}
+			reminder := calendar.Reminder{UserID: u.id, Username: u.username, Obligation: *o, DaysLeft: left}
+			if err := notifier.Notify(ctx, reminder); err != nil {
+				log.Printf("Failed to send reminder %s to user %s via %s: %v", o.ID, u.id, notifier.Name(), err)
+				continue
+			}
+			_, err = h.db.Exec(
+				"INSERT OR IGNORE INTO reminders (user_id, obligation_id, days_before, notifier) VALUES (?, ?, ?, ?)",
+				u.id, o.ID, threshold, notifier.Name(),
+			)
+			if err != nil {
+				return sent, err
+			}
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// StartReminders запускает периодическую отправку напоминаний о сроках.
+// REMINDER_INTERVAL - период проверки (по умолчанию 1h, 0 - отключить); notifier nil - напоминания отключены.
+func (h *Handler) StartReminders(notifier calendar.Notifier) {
+	if notifier == nil {
+		log.Println("Deadline reminders are disabled")
+		return
+	}
+	interval := defaultReminderInterval
+	if value := os.Getenv("REMINDER_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if value == "0" {
+			parsed, err = 0, nil
+		}
+		if err != nil || parsed < 0 {
+			log.Printf("Invalid REMINDER_INTERVAL %q, using %s", value, defaultReminderInterval)
+		} else {
+			interval = parsed
+		}
+	}
+	if interval == 0 {
+		log.Println("Deadline reminders are disabled")
+		return
+	}
+
+	go func() {
+		time.Sleep(reminderStartDelay)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			sent, err := h.SendReminders(context.Background(), notifier)
+			if err != nil {
+				log.Printf("Deadline reminders failed: %v", err)
+			} else if sent > 0 {
+				log.Printf("Deadline reminders: sent %d via %s", sent, notifier.Name())
+			}
+			<-ticker.C
+		}
+	}()
+}
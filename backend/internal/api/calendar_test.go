@@ -0,0 +1,131 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/calendar"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func date(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// testNotifier запоминает отправленные напоминания; с fail возвращает ошибку
+type testNotifier struct {
+	sent []calendar.Reminder
+	fail bool
+}
+
+func (n *testNotifier) Name() string { return "test" }
+
+func (n *testNotifier) Notify(ctx context.Context, reminder calendar.Reminder) error {
+	if n.fail {
+		return errors.New("notifier is down")
+	}
+	n.sent = append(n.sent, reminder)
+	return nil
+}
+
+// newReminderHandler - пользователь ИП на УСН «доходы» без сотрудников: 27 и 28 апреля 2026 г.
+// у него четыре срока (декларация и налог за 2025 г., уведомление и аванс за I квартал)
+func newReminderHandler(t *testing.T) *Handler {
+	t.Helper()
+	t.Setenv("REMINDER_DAYS", "7,1")
+	h := newTestHandler(t)
+	if _, err := h.db.Exec(
+		"UPDATE users SET tax_regime = 'usn_income', legal_form = 'ip', employees_count = 0 WHERE id = ?", testUserID,
+	); err != nil {
+		t.Fatalf("set tax profile: %v", err)
+	}
+	return h
+}
+
+func sentThresholds(t *testing.T, h *Handler) map[int]int {
+	t.Helper()
+	rows, err := h.db.Query("SELECT days_before FROM reminders WHERE user_id = ?", testUserID)
+	if err != nil {
+		t.Fatalf("read reminders: %v", err)
+	}
+	defer rows.Close()
+	thresholds := make(map[int]int)
+	for rows.Next() {
+		var days int
+		rows.Scan(&days)
+		thresholds[days]++
+	}
+	return thresholds
+}
+
+// Напоминание на каждый порог отправляется один раз
+func TestSendRemindersOncePerThreshold(t *testing.T) {
+	h := newReminderHandler(t)
+	n := &testNotifier{}
+	steps := []struct {
+		date string
+		sent int
+	}{
+		{"2026-04-21", 4}, // до сроков 6-7 дней - порог 7
+		{"2026-04-21", 0},
+		{"2026-04-22", 0}, // тот же порог 7
+		{"2026-04-27", 4}, // порог 1
+		{"2026-04-28", 0},
+	}
+	for _, step := range steps {
+		sent, err := h.sendReminders(context.Background(), n, date(t, step.date))
+		if err != nil {
+			t.Fatalf("%s: sendReminders: %v", step.date, err)
+		}
+		if sent != step.sent {
+			t.Errorf("%s: sent %d, want %d", step.date, sent, step.sent)
+		}
+	}
+	if len(n.sent) != 8 {
+		t.Fatalf("notifier got %d reminders, want 8", len(n.sent))
+	}
+	if r := n.sent[0]; r.Obligation.ID != "usn_declaration-2025-20260427" || r.DaysLeft != 6 || r.Username != "owner" {
+		t.Errorf("first reminder = %s, %d days left, user %q", r.Obligation.ID, r.DaysLeft, r.Username)
+	}
+	if got := sentThresholds(t, h); got[7] != 4 || got[1] != 4 {
+		t.Errorf("reminders by threshold = %v, want 4 for 7 and 1", got)
+	}
+}
+
+// Если сервер не работал в день порога 7, отправляется только ближайший порог
+func TestSendRemindersMissedThreshold(t *testing.T) {
+	h := newReminderHandler(t)
+	n := &testNotifier{}
+	sent, err := h.sendReminders(context.Background(), n, date(t, "2026-04-27"))
+	if err != nil || sent != 4 {
+		t.Fatalf("sendReminders = %d, %v; want 4", sent, err)
+	}
+	for _, r := range n.sent {
+		if r.DaysLeft > 1 {
+			t.Errorf("%s: %d days left", r.Obligation.ID, r.DaysLeft)
+		}
+	}
+	if got := sentThresholds(t, h); got[7] != 0 || got[1] != 4 {
+		t.Errorf("reminders by threshold = %v, want only 4 for 1", got)
+	}
+}
+
+// Неотправленное напоминание не записывается и отправляется при следующей проверке
+func TestSendRemindersNotifierFails(t *testing.T) {
+	h := newReminderHandler(t)
+	sent, err := h.sendReminders(context.Background(), &testNotifier{fail: true}, date(t, "2026-04-21"))
+	if err != nil || sent != 0 {
+		t.Fatalf("sendReminders = %d, %v; want 0", sent, err)
+	}
+	if got := sentThresholds(t, h); len(got) != 0 {
+		t.Errorf("reminders recorded after failures: %v", got)
+	}
+	if sent, _ := h.sendReminders(context.Background(), &testNotifier{}, date(t, "2026-04-22")); sent != 4 {
+		t.Errorf("retry sent %d, want 4", sent)
+	}
+}
@@ -0,0 +1,342 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/ai"
+	"alfa-hack-backend/internal/bank"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cashFlowData - операции и остатки из выписок в одной валюте
+type cashFlowData struct {
+	currency     string
+	transactions []bank.Transaction // по дате
+	from         time.Time          // начало истории: первая операция или начало первой выписки с остатком
+	asOf         time.Time          // дата последних данных
+	opening      int64              // остаток на начало from
+	hasBalance   bool               // остатки известны по всем счетам с операциями
+}
+
+// loadCashFlow загружает операции и остатки из текущих версий выписок. Без currency берется валюта
+// с наибольшим числом операций; fileIDs ограничивает выписки (nil - все). nil, если операций нет.
+func (h *Handler) loadCashFlow(userID, currency string, fileIDs []string) (*cashFlowData, error) {
+	fileCondition, fileArgs := "", []interface{}{}
+	if fileIDs != nil {
+		if len(fileIDs) == 0 {
+			return nil, nil
+		}
+		placeholders := make([]string, len(fileIDs))
+		for i, id := range fileIDs {
+			placeholders[i] = "?"
+			fileArgs = append(fileArgs, id)
+		}
+		fileCondition = " AND file_id IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+
+	rows, err := h.db.Query(
+		currentTransactions+`SELECT date, amount, currency, direction, internal, account, counterparty, counterparty_inn, category
+		FROM operations WHERE 1 = 1`+fileCondition+` ORDER BY date, id`,
+		append([]interface{}{userID}, fileArgs...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var all []bank.Transaction
+	counts := make(map[string]int)
+	for rows.Next() {
+		var t bank.Transaction
+		var date string
+		if err := rows.Scan(&date, &t.Amount, &t.Currency, &t.Direction, &t.Internal, &t.Account, &t.Counterparty,
+			&t.CounterpartyINN, &t.Category); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if t.Date, err = time.Parse("2006-01-02", date); err != nil {
+			continue
+		}
+		all = append(all, t)
+		counts[t.Currency]++
+	}
+	rows.Close()
+
+	data := &cashFlowData{currency: strings.ToUpper(strings.TrimSpace(currency))}
+	if data.currency == "" {
+		data.currency = mainCurrency(counts)
+	}
+	accounts := make(map[string]bool)
+	for _, t := range all {
+		if t.Currency == data.currency {
+			data.transactions = append(data.transactions, t)
+			accounts[t.Account] = true
+		}
+	}
+	if len(data.transactions) == 0 {
+		return nil, nil
+	}
+	data.from = data.transactions[0].Date
+	data.asOf = data.transactions[len(data.transactions)-1].Date
+
+	// Остаток на начало - по первой выписке с остатками по каждому счету
+	rows, err = h.db.Query(
+		`SELECT s.account, s.date_from, s.date_to, s.opening_balance FROM bank_statements s JOIN files f ON f.id = s.file_id
+		WHERE f.user_id = ? AND s.version = CASE WHEN COALESCE(f.pinned_version, 0) > 0 THEN f.pinned_version ELSE f.version END
+		AND s.currency = ?`+strings.ReplaceAll(fileCondition, "file_id", "s.file_id")+` ORDER BY s.date_from`,
+		append([]interface{}{userID, data.currency}, fileArgs...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	openings := make(map[string]bool)
+	for rows.Next() {
+		var account, dateFrom, dateTo string
+		var opening sql.NullInt64
+		if err := rows.Scan(&account, &dateFrom, &dateTo, &opening); err != nil {
+			return nil, err
+		}
+		if date, err := time.Parse("2006-01-02", dateTo); err == nil && date.After(data.asOf) {
+			data.asOf = date
+		}
+		date, err := time.Parse("2006-01-02", dateFrom)
+		if err != nil || !opening.Valid || account == "" || openings[account] {
+			continue
+		}
+		openings[account] = true
+		data.opening += opening.Int64
+		if date.Before(data.from) {
+			data.from = date
+		}
+	}
+	data.hasBalance = true
+	for account := range accounts {
+		if !openings[account] {
+			data.hasBalance = false
+		}
+	}
+	if !data.hasBalance {
+		data.opening = 0
+	}
+	return data, rows.Err()
+}
+
+// mainCurrency - валюта с наибольшим числом операций (при равенстве - первая по алфавиту)
+func mainCurrency(counts map[string]int) string {
+	main := ""
+	for currency, count := range counts {
+		if main == "" || count > counts[main] || (count == counts[main] && currency < main) {
+			main = currency
+		}
+	}
+	return main
+}
+
+// GetCashFlow - поступления, списания и остаток по дням или месяцам
+// (?group_by=day|month, currency, from=&to= или period=2025-03)
+func (h *Handler) GetCashFlow(c *gin.Context) {
+	groupBy := c.DefaultQuery("group_by", "month")
+	if groupBy != "day" && groupBy != "month" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be day or month"})
+		return
+	}
+	from, to := c.Query("from"), c.Query("to")
+	if period := c.Query("period"); period != "" {
+		start, end, err := ai.ParsePeriod(period)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		from, to = start, end
+	}
+	for _, date := range []string{from, to} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid date %q: expected YYYY-MM-DD", date)})
+			return
+		}
+	}
+
+	data, err := h.loadCashFlow(c.GetString("user_id"), c.Query("currency"), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if data == nil {
+		c.JSON(http.StatusOK, gin.H{"currency": c.Query("currency"), "group_by": groupBy, "has_balance": false, "series": []gin.H{}})
+		return
+	}
+
+	// Остаток считается по всей истории, а в ответ попадает только запрошенный период
+	var days []bank.DayFlow
+	for _, day := range bank.DailyFlows(data.transactions, data.from, data.asOf, data.opening) {
+		date := day.Date.Format("2006-01-02")
+		if (from == "" || date >= from) && (to == "" || date <= to) {
+			days = append(days, day)
+		}
+	}
+
+	series := []gin.H{}
+	var totalIn, totalOut int64
+	if groupBy == "day" {
+		for _, day := range days {
+			series = append(series, gin.H{
+				"date": day.Date.Format("2006-01-02"), "in": rubles(day.In), "out": rubles(day.Out),
+				"net": rubles(day.In - day.Out), "transfers": rubles(day.Transfers), "balance": rubles(day.Balance),
+			})
+			totalIn, totalOut = totalIn+day.In, totalOut+day.Out
+		}
+	} else {
+		for _, month := range bank.MonthlyFlows(days) {
+			series = append(series, gin.H{
+				"month": month.Month, "in": rubles(month.In), "out": rubles(month.Out), "net": rubles(month.In - month.Out),
+				"transfers": rubles(month.Transfers), "opening_balance": rubles(month.Opening),
+				"closing_balance": rubles(month.Closing), "min_balance": rubles(month.MinBalance),
+			})
+			totalIn, totalOut = totalIn+month.In, totalOut+month.Out
+		}
+	}
+
+	response := gin.H{
+		"currency":    data.currency,
+		"group_by":    groupBy,
+		"has_balance": data.hasBalance,
+		"as_of":       data.asOf.Format("2006-01-02"),
+		"series":      series,
+		"total_in":    rubles(totalIn),
+		"total_out":   rubles(totalOut),
+	}
+	if !data.hasBalance {
+		response["warning"] = "Opening balance is unknown for some accounts: balance is the cumulative net flow"
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetCashFlowForecast - прогноз остатка на 30-90 дней после последней выписки по регулярным платежам
+// и среднему обороту, с кассовыми разрывами (?days=30, currency, min_balance - допустимый остаток в рублях)
+func (h *Handler) GetCashFlowForecast(c *gin.Context) {
+	days := bank.ForecastDefaultDays
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < bank.ForecastMinDays || parsed > bank.ForecastMaxDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("days must be between %d and %d", bank.ForecastMinDays, bank.ForecastMaxDays)})
+			return
+		}
+		days = parsed
+	}
+	var minBalance int64
+	if value := c.Query("min_balance"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_balance must be a number"})
+			return
+		}
+		minBalance = int64(math.Round(parsed * 100))
+	}
+
+	data, err := h.loadCashFlow(c.GetString("user_id"), c.Query("currency"), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if data == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No bank statement transactions to forecast from"})
+		return
+	}
+	f := data.forecast(days, minBalance)
+
+	recurring := []gin.H{}
+	for _, r := range f.Recurring {
+		recurring = append(recurring, gin.H{
+			"name": r.Name, "inn": r.INN, "category": r.Category, "category_name": bank.CategoryNames[r.Category],
+			"direction": r.Direction, "amount": rubles(r.Amount), "day": r.Day, "months": r.Months,
+			"last_date": r.LastDate.Format("2006-01-02"),
+		})
+	}
+	payments := scheduledPaymentsJSON(f.Payments)
+	daily := []gin.H{}
+	for _, day := range f.Days {
+		daily = append(daily, gin.H{
+			"date": day.Date.Format("2006-01-02"), "in": rubles(day.In), "out": rubles(day.Out), "balance": rubles(day.Balance),
+		})
+	}
+	monthly := []gin.H{}
+	for _, month := range forecastMonths(f) {
+		monthly = append(monthly, gin.H{
+			"month": month.Month, "in": rubles(month.In), "out": rubles(month.Out),
+			"closing_balance": rubles(month.Closing), "min_balance": rubles(month.MinBalance),
+		})
+	}
+	gaps := []gin.H{}
+	for _, gap := range f.Gaps {
+		gaps = append(gaps, gin.H{
+			"from": gap.From.Format("2006-01-02"), "to": gap.To.Format("2006-01-02"),
+			"lowest_balance": rubles(gap.Lowest), "lowest_date": gap.LowestDate.Format("2006-01-02"),
+			"shortfall": rubles(gap.Shortfall), "payments": scheduledPaymentsJSON(gap.Payments),
+		})
+	}
+
+	response := gin.H{
+		"currency":       data.currency,
+		"as_of":          f.AsOf.Format("2006-01-02"),
+		"days":           days,
+		"has_balance":    f.HasBalance,
+		"balance":        rubles(f.Balance),
+		"min_balance":    rubles(f.MinBalance),
+		"end_balance":    rubles(f.EndBalance),
+		"lowest_balance": rubles(f.Lowest),
+		"lowest_date":    f.LowestDate.Format("2006-01-02"),
+		"daily_in":       rubles(f.DailyIn),
+		"daily_out":      rubles(f.DailyOut),
+		"seasonal":       f.Seasonal,
+		"recurring":      recurring,
+		"payments":       payments,
+		"daily":          daily,
+		"monthly":        monthly,
+		"gaps":           gaps,
+	}
+	if !f.HasBalance {
+		response["warning"] = "Opening balance is unknown for some accounts: balances are relative to the last statement date and cash gaps are not detected"
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// forecast строит прогноз от остатка на дату последних данных
+func (d *cashFlowData) forecast(days int, minBalance int64) *bank.CashForecast {
+	balance := d.opening
+	for _, t := range d.transactions {
+		if t.Direction == bank.DirectionIn {
+			balance += t.Amount
+		} else {
+			balance -= t.Amount
+		}
+	}
+	f := bank.Forecast(d.transactions, d.asOf, balance, d.hasBalance, days, minBalance)
+	f.Currency = d.currency
+	return f
+}
+
+// forecastMonths - прогноз по месяцам
+func forecastMonths(f *bank.CashForecast) []bank.MonthFlow {
+	days := make([]bank.DayFlow, len(f.Days))
+	for i, day := range f.Days {
+		days[i] = bank.DayFlow{Date: day.Date, In: day.In, Out: day.Out, Balance: day.Balance}
+	}
+	return bank.MonthlyFlows(days)
+}
+
+func scheduledPaymentsJSON(payments []bank.ScheduledPayment) []gin.H {
+	result := []gin.H{}
+	for _, p := range payments {
+		result = append(result, gin.H{
+			"date": p.Date.Format("2006-01-02"), "name": p.Name, "category": p.Category,
+			"category_name": bank.CategoryNames[p.Category], "direction": p.Direction,
+			"amount": rubles(p.Amount), "balance_after": rubles(p.BalanceAfter),
+		})
+	}
+	return result
+}
@@ -0,0 +1,549 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/ai"
+	"alfa-hack-backend/internal/bank"
+	"alfa-hack-backend/internal/models"
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxLLMCategorize - сколько операций без категории отправлять модели за один проход
+	maxLLMCategorize = 200
+	// metricsMonths - за сколько последних месяцев с операциями показатели попадают в промпт
+	metricsMonths = 3
+)
+
+// categorizeStats - итоги прохода категоризации
+type categorizeStats struct {
+	Total         int `json:"total"`
+	Changed       int `json:"changed"`
+	ByLLM         int `json:"by_llm"`
+	Uncategorized int `json:"uncategorized"`
+}
+
+// userCategorizer собирает категоризатор из правил пользователя и встроенных правил
+func (h *Handler) userCategorizer(userID string) (*bank.Categorizer, error) {
+	rules, err := h.categoryRules(userID)
+	if err != nil {
+		return nil, err
+	}
+	return bank.NewCategorizer(rules), nil
+}
+
+func (h *Handler) categoryRules(userID string) ([]bank.Rule, error) {
+	rows, err := h.db.Query("SELECT id, type, pattern, category, direction FROM category_rules WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rules []bank.Rule
+	for rows.Next() {
+		var rule bank.Rule
+		if err := rows.Scan(&rule.ID, &rule.Type, &rule.Pattern, &rule.Category, &rule.Direction); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// categorizeUser заново определяет категории всех операций пользователя: категория, выбранная
+// пользователем для операции, важнее правил, правила пользователя - встроенных. Категории, выбранные
+// моделью, сохраняются, пока не сработает правило. С useLLM операции без категории отправляются модели.
+func (h *Handler) categorizeUser(ctx context.Context, userID string, useLLM bool) (categorizeStats, error) {
+	var stats categorizeStats
+	categorizer, err := h.userCategorizer(userID)
+	if err != nil {
+		return stats, err
+	}
+
+	overrides := make(map[string]string)
+	rows, err := h.db.QueryContext(ctx, "SELECT fingerprint, category FROM transaction_overrides WHERE user_id = ?", userID)
+	if err != nil {
+		return stats, err
+	}
+	for rows.Next() {
+		var fingerprint, category string
+		if err := rows.Scan(&fingerprint, &category); err != nil {
+			rows.Close()
+			return stats, err
+		}
+		overrides[fingerprint] = category
+	}
+	rows.Close()
+
+	type update struct {
+		id       int64
+		category string
+		source   string
+		ruleID   int64
+	}
+	var updates []update
+	var uncategorized []ai.UncategorizedTransaction
+	rows, err = h.db.QueryContext(ctx,
+		`SELECT id, direction, internal, amount, currency, counterparty, counterparty_inn, counterparty_account, purpose, mcc,
+		fingerprint, category, category_source, category_rule_id FROM transactions WHERE user_id = ?`,
+		userID,
+	)
+	if err != nil {
+		return stats, err
+	}
+	for rows.Next() {
+		var t bank.Transaction
+		var id, oldRuleID int64
+		var fingerprint, oldCategory, oldSource string
+		if err := rows.Scan(&id, &t.Direction, &t.Internal, &t.Amount, &t.Currency, &t.Counterparty, &t.CounterpartyINN,
+			&t.CounterpartyAccount, &t.Purpose, &t.MCC, &fingerprint, &oldCategory, &oldSource, &oldRuleID); err != nil {
+			rows.Close()
+			return stats, err
+		}
+		stats.Total++
+
+		category, source, ruleID := categorizer.Categorize(t)
+		if override, ok := overrides[fingerprint]; ok {
+			category, source, ruleID = override, bank.CategorySourceUser, 0
+		} else if category == "" && oldSource == bank.CategorySourceLLM {
+			category, source = oldCategory, oldSource
+		}
+		if category == "" {
+			uncategorized = append(uncategorized, ai.UncategorizedTransaction{
+				ID: id, Direction: t.Direction, Amount: t.Amount, Currency: t.Currency,
+				Counterparty: t.Counterparty, Purpose: t.Purpose, MCC: t.MCC,
+			})
+		}
+		if category != oldCategory || source != oldSource || ruleID != oldRuleID {
+			updates = append(updates, update{id, category, source, ruleID})
+		}
+	}
+	rows.Close()
+
+	if useLLM && len(uncategorized) > 0 {
+		batch := uncategorized
+		if len(batch) > maxLLMCategorize {
+			batch = batch[:maxLLMCategorize]
+		}
+		byLLM, err := ai.CategorizeWithLLM(batch)
+		if err != nil {
+			log.Printf("LLM categorization failed for user %s: %v", userID, err)
+		}
+		for id, category := range byLLM {
+			updates = append(updates, update{id, category, bank.CategorySourceLLM, 0})
+		}
+		stats.ByLLM = len(byLLM)
+	}
+	stats.Uncategorized = len(uncategorized) - stats.ByLLM
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return stats, err
+	}
+	defer tx.Rollback()
+	changed := make(map[int64]bool)
+	for _, u := range updates {
+		_, err := tx.Exec("UPDATE transactions SET category = ?, category_source = ?, category_rule_id = ? WHERE id = ?",
+			u.category, u.source, u.ruleID, u.id)
+		if err != nil {
+			return stats, err
+		}
+		changed[u.id] = true
+	}
+	stats.Changed = len(changed)
+	return stats, tx.Commit()
+}
+
+// categorizeStale определяет категории операций, загруженных до появления категоризации
+func (h *Handler) categorizeStale() {
+	rows, err := h.db.Query("SELECT DISTINCT user_id FROM transactions WHERE category_source = ''")
+	if err != nil {
+		log.Printf("Failed to find transactions without categories: %v", err)
+		return
+	}
+	var users []string
+	for rows.Next() {
+		var userID string
+		if rows.Scan(&userID) == nil {
+			users = append(users, userID)
+		}
+	}
+	rows.Close()
+	for _, userID := range users {
+		if _, err := h.categorizeUser(context.Background(), userID, false); err != nil {
+			log.Printf("Failed to categorize transactions of user %s: %v", userID, err)
+		}
+	}
+}
+
+// GetTransactionCategories - список категорий операций
+func (h *Handler) GetTransactionCategories(c *gin.Context) {
+	categories := make([]gin.H, 0, len(bank.CategoryOrder))
+	for _, code := range bank.CategoryOrder {
+		categories = append(categories, gin.H{"code": code, "name": bank.CategoryNames[code]})
+	}
+	c.JSON(http.StatusOK, gin.H{"categories": categories, "llm_enabled": ai.CategorizerLLMEnabled()})
+}
+
+// UpdateTransactionCategory - категория операции, выбранная пользователем ({"category": "rent", "learn": true}).
+// Пустая категория возвращает автоматическую. С learn (по умолчанию) из операции выводится правило:
+// по ИНН контрагента, а без него - по наименованию контрагента или MCC.
+func (h *Handler) UpdateTransactionCategory(c *gin.Context) {
+	userID := c.GetString("user_id")
+	var req struct {
+		Category *string `json:"category"`
+		Learn    *bool   `json:"learn"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Category == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "category is required"})
+		return
+	}
+	category := strings.TrimSpace(*req.Category)
+	if _, ok := bank.CategoryNames[category]; !ok && category != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown category " + strconv.Quote(category)})
+		return
+	}
+
+	var t bank.Transaction
+	var fingerprint string
+	err := h.db.QueryRow(
+		"SELECT direction, counterparty, counterparty_inn, mcc, fingerprint FROM transactions WHERE id = ? AND user_id = ?",
+		c.Param("id"), userID,
+	).Scan(&t.Direction, &t.Counterparty, &t.CounterpartyINN, &t.MCC, &fingerprint)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if category == "" {
+		_, err = h.db.Exec("DELETE FROM transaction_overrides WHERE user_id = ? AND fingerprint = ?", userID, fingerprint)
+	} else {
+		_, err = h.db.Exec(
+			`INSERT INTO transaction_overrides (user_id, fingerprint, category) VALUES (?, ?, ?)
+			ON CONFLICT(user_id, fingerprint) DO UPDATE SET category = excluded.category, updated_at = CURRENT_TIMESTAMP`,
+			userID, fingerprint, category,
+		)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save category"})
+		return
+	}
+
+	var learned interface{}
+	if category != "" && category != bank.CategoryTransfer && (req.Learn == nil || *req.Learn) {
+		if rule := learnedRule(t, category); rule != nil {
+			if rule.ID, err = h.saveCategoryRule(userID, *rule, true); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save rule"})
+				return
+			}
+			learned = categoryRuleJSON(*rule, true)
+		}
+	}
+
+	stats, err := h.categorizeUser(c.Request.Context(), userID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to categorize transactions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":            c.Param("id"),
+		"category":      category,
+		"learned_rule":  learned,
+		"recategorized": stats.Changed,
+	})
+}
+
+// learnedRule выводит правило из операции, категорию которой исправил пользователь
+func learnedRule(t bank.Transaction, category string) *bank.Rule {
+	rule := bank.Rule{Category: category, Direction: t.Direction}
+	switch {
+	case t.CounterpartyINN != "":
+		rule.Type, rule.Pattern = bank.RuleINN, t.CounterpartyINN
+	case strings.TrimSpace(t.Counterparty) != "":
+		rule.Type, rule.Pattern = bank.RulePurpose, regexp.QuoteMeta(strings.TrimSpace(t.Counterparty))
+	case t.MCC != "":
+		rule.Type, rule.Pattern = bank.RuleMCC, t.MCC
+	default:
+		return nil
+	}
+	if rule.Compile() != nil {
+		return nil
+	}
+	return &rule
+}
+
+// saveCategoryRule сохраняет правило; правило с тем же видом, шаблоном и направлением заменяется
+func (h *Handler) saveCategoryRule(userID string, rule bank.Rule, learned bool) (int64, error) {
+	_, err := h.db.Exec(
+		`INSERT INTO category_rules (user_id, type, pattern, category, direction, learned) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, type, pattern, direction) DO UPDATE SET category = excluded.category, learned = excluded.learned`,
+		userID, rule.Type, rule.Pattern, rule.Category, rule.Direction, learned,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = h.db.QueryRow(
+		"SELECT id FROM category_rules WHERE user_id = ? AND type = ? AND pattern = ? AND direction = ?",
+		userID, rule.Type, rule.Pattern, rule.Direction,
+	).Scan(&id)
+	return id, err
+}
+
+func categoryRuleJSON(rule bank.Rule, learned bool) gin.H {
+	return gin.H{
+		"id":            rule.ID,
+		"type":          rule.Type,
+		"pattern":       rule.Pattern,
+		"category":      rule.Category,
+		"category_name": bank.CategoryNames[rule.Category],
+		"direction":     rule.Direction,
+		"learned":       learned,
+	}
+}
+
+// GetCategoryRules - правила категоризации пользователя с числом операций, к которым они применились
+func (h *Handler) GetCategoryRules(c *gin.Context) {
+	rows, err := h.db.Query(
+		`SELECT r.id, r.type, r.pattern, r.category, r.direction, r.learned, r.created_at,
+			(SELECT COUNT(*) FROM transactions t WHERE t.user_id = r.user_id AND t.category_rule_id = r.id)
+		FROM category_rules r WHERE r.user_id = ? ORDER BY r.id`,
+		c.GetString("user_id"),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	rules := []gin.H{}
+	for rows.Next() {
+		var rule bank.Rule
+		var learned bool
+		var createdAt string
+		var matches int
+		if err := rows.Scan(&rule.ID, &rule.Type, &rule.Pattern, &rule.Category, &rule.Direction, &learned, &createdAt, &matches); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		item := categoryRuleJSON(rule, learned)
+		item["created_at"] = createdAt
+		item["matches"] = matches
+		rules = append(rules, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// CreateCategoryRule - новое правило ({"type": "inn|purpose|mcc", "pattern": "...", "category": "...", "direction": ""})
+func (h *Handler) CreateCategoryRule(c *gin.Context) {
+	userID := c.GetString("user_id")
+	var req struct {
+		Type      string `json:"type" binding:"required"`
+		Pattern   string `json:"pattern" binding:"required"`
+		Category  string `json:"category" binding:"required"`
+		Direction string `json:"direction"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule := bank.Rule{Type: req.Type, Pattern: req.Pattern, Category: req.Category, Direction: req.Direction}
+	if err := rule.Compile(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var err error
+	if rule.ID, err = h.saveCategoryRule(userID, rule, false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save rule"})
+		return
+	}
+	stats, err := h.categorizeUser(c.Request.Context(), userID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to categorize transactions"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"rule": categoryRuleJSON(rule, false), "recategorized": stats.Changed})
+}
+
+// DeleteCategoryRule - удаление правила; операции по нему категоризуются заново
+func (h *Handler) DeleteCategoryRule(c *gin.Context) {
+	userID := c.GetString("user_id")
+	result, err := h.db.Exec("DELETE FROM category_rules WHERE id = ? AND user_id = ?", c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete rule"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+	stats, err := h.categorizeUser(c.Request.Context(), userID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to categorize transactions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Rule deleted successfully", "recategorized": stats.Changed})
+}
+
+// CategorizeTransactions - заново применить правила ко всем операциям ({"llm": true} - операции
+// без категории отправить модели, если включено CATEGORIZER_LLM)
+func (h *Handler) CategorizeTransactions(c *gin.Context) {
+	var req struct {
+		LLM bool `json:"llm"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.LLM && !ai.CategorizerLLMEnabled() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "LLM categorization is disabled (set CATEGORIZER_LLM=true and OPENROUTER_API_KEY)"})
+		return
+	}
+	stats, err := h.categorizeUser(c.Request.Context(), c.GetString("user_id"), req.LLM)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to categorize transactions"})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// financialMetrics считает показатели для промпта по выбранным файлам: по операциям из выписок -
+// поступления и списания по категориям за последние месяцы в основной валюте (с наибольшим числом операций)
+// и прогноз остатка на 30 дней, по кассовым чекам - продажи за последние 30 дней, по отчетам маркетплейсов -
+// выплата и юнит-экономика артикулов за последние 30 дней, по документам ЭДО - статус оплаты по выпискам,
+// по спискам сотрудников - зарплата, НДФЛ и взносы за текущий месяц, по системе налогообложения из профиля -
+// налоги за год последней операции
+func (h *Handler) financialMetrics(userID string, files []models.File) *ai.FinancialMetrics {
+	if len(files) == 0 {
+		return nil
+	}
+	ids := make([]string, len(files))
+	for i, file := range files {
+		ids[i] = file.ID
+	}
+	metrics := h.bankMetrics(userID, ids)
+	if sales := h.salesMetrics(userID, ids); sales != nil {
+		if metrics == nil {
+			metrics = &ai.FinancialMetrics{}
+		}
+		metrics.Sales = sales
+	}
+	if report := h.marketplaceMetrics(userID, ids); report != nil {
+		if metrics == nil {
+			metrics = &ai.FinancialMetrics{}
+		}
+		metrics.Marketplace = report
+	}
+	if documents := h.edoMetrics(userID, ids); documents != nil {
+		if metrics == nil {
+			metrics = &ai.FinancialMetrics{}
+		}
+		metrics.Documents = documents
+	}
+	if staff := h.payrollMetrics(userID, ids); staff != nil {
+		if metrics == nil {
+			metrics = &ai.FinancialMetrics{}
+		}
+		metrics.Payroll = staff
+	}
+	if taxes := h.taxMetrics(userID, ids); taxes != nil {
+		if metrics == nil {
+			metrics = &ai.FinancialMetrics{}
+		}
+		metrics.Tax = taxes
+	}
+	return metrics
+}
+
+// bankMetrics - поступления и списания по категориям и прогноз остатка по выпискам среди файлов; nil, если операций нет
+func (h *Handler) bankMetrics(userID string, ids []string) *ai.FinancialMetrics {
+	placeholders := make([]string, len(ids))
+	args := []interface{}{userID}
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+	rows, err := h.db.Query(
+		currentTransactions+`SELECT substr(date, 1, 7) AS month, currency, direction, category, SUM(amount), COUNT(*)
+		FROM operations WHERE internal = 0 AND category != 'transfer' AND file_id IN (`+strings.Join(placeholders, ", ")+`)
+		GROUP BY month, currency, direction, category`,
+		args...,
+	)
+	if err != nil {
+		log.Printf("Failed to compute financial metrics for user %s: %v", userID, err)
+		return nil
+	}
+	defer rows.Close()
+
+	type group struct {
+		month, currency string
+		amount          ai.CategoryAmount
+	}
+	var groups []group
+	counts := make(map[string]int)
+	for rows.Next() {
+		var g group
+		var count int
+		if err := rows.Scan(&g.month, &g.currency, &g.amount.Direction, &g.amount.Category, &g.amount.Amount, &count); err != nil {
+			log.Printf("Failed to compute financial metrics for user %s: %v", userID, err)
+			return nil
+		}
+		groups = append(groups, g)
+		counts[g.currency] += count
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	metrics := &ai.FinancialMetrics{Currency: mainCurrency(counts)}
+	months := make(map[string]*ai.MonthMetrics)
+	var keys []string
+	for _, g := range groups {
+		if g.currency != metrics.Currency {
+			continue
+		}
+		month := months[g.month]
+		if month == nil {
+			month = &ai.MonthMetrics{Month: g.month}
+			months[g.month] = month
+			keys = append(keys, g.month)
+		}
+		if g.amount.Direction == bank.DirectionIn {
+			month.Income += g.amount.Amount
+		} else {
+			month.Expenses += g.amount.Amount
+		}
+		month.Categories = append(month.Categories, g.amount)
+	}
+	sort.Strings(keys)
+	if len(keys) > metricsMonths {
+		keys = keys[len(keys)-metricsMonths:]
+	}
+	for _, key := range keys {
+		metrics.Months = append(metrics.Months, *months[key])
+	}
+
+	if data, err := h.loadCashFlow(userID, metrics.Currency, ids); err != nil {
+		log.Printf("Failed to forecast cash flow for user %s: %v", userID, err)
+	} else if data != nil {
+		metrics.Forecast = data.forecast(bank.ForecastDefaultDays, 0)
+	}
+	return metrics
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/bank"
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func addTestTransaction(t *testing.T, h *Handler, fingerprint, inn, counterparty, purpose string) int64 {
+	t.Helper()
+	result, err := h.db.Exec(
+		`INSERT INTO transactions (user_id, file_id, version, date, amount, direction, counterparty, counterparty_inn, purpose, fingerprint)
+		VALUES (?, 'f1', 1, '2026-03-02', 1500000, ?, ?, ?, ?, ?)`,
+		testUserID, bank.DirectionOut, counterparty, inn, purpose, fingerprint,
+	)
+	if err != nil {
+		t.Fatalf("create transaction: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	return id
+}
+
+func transactionCategory(t *testing.T, h *Handler, id int64) (category, source string) {
+	t.Helper()
+	if err := h.db.QueryRow("SELECT category, category_source FROM transactions WHERE id = ?", id).Scan(&category, &source); err != nil {
+		t.Fatalf("read transaction %d: %v", id, err)
+	}
+	return category, source
+}
+
+// Категория, выбранная для операции, важнее правил; выученное правило важнее встроенных
+func TestUpdateTransactionCategory(t *testing.T) {
+	h := newTestHandler(t)
+	addTestFile(t, h, "f1", "выписка.txt")
+	rentByRule := addTestTransaction(t, h, "fp1", "500100732259", "ИП Петров", "Оплата за аренду склада")
+	sameINN := addTestTransaction(t, h, "fp2", "500100732259", "ИП Петров", "Оплата по договору 15")
+	otherRent := addTestTransaction(t, h, "fp3", "7701234567", "ООО Склад", "Арендная плата за март")
+	if _, err := h.categorizeUser(context.Background(), testUserID, false); err != nil {
+		t.Fatalf("categorizeUser: %v", err)
+	}
+
+	type want struct {
+		id       int64
+		category string
+		source   string
+	}
+	steps := []struct {
+		name  string
+		id    int64
+		body  string
+		rules int
+		want  []want
+	}{
+		{
+			name: "до исправлений - встроенные правила",
+			want: []want{
+				{rentByRule, bank.CategoryRent, bank.CategorySourceRule},
+				{sameINN, "", ""},
+				{otherRent, bank.CategoryRent, bank.CategorySourceRule},
+			},
+		},
+		{
+			name: "исправление выучивает правило по ИНН", id: rentByRule, body: `{"category": "suppliers"}`, rules: 1,
+			want: []want{
+				{rentByRule, bank.CategorySuppliers, bank.CategorySourceUser},
+				{sameINN, bank.CategorySuppliers, bank.CategorySourceUserRule},
+				{otherRent, bank.CategoryRent, bank.CategorySourceRule},
+			},
+		},
+		{
+			name: "категория операции важнее выученного правила", id: sameINN, body: `{"category": "marketing", "learn": false}`, rules: 1,
+			want: []want{
+				{sameINN, bank.CategoryMarketing, bank.CategorySourceUser},
+				{rentByRule, bank.CategorySuppliers, bank.CategorySourceUser},
+			},
+		},
+		{
+			name: "сброс категории - выученное правило важнее встроенного", id: rentByRule, body: `{"category": ""}`, rules: 1,
+			want: []want{
+				{rentByRule, bank.CategorySuppliers, bank.CategorySourceUserRule},
+				{sameINN, bank.CategoryMarketing, bank.CategorySourceUser},
+			},
+		},
+	}
+	for _, step := range steps {
+		if step.body != "" {
+			w := serve(h.UpdateTransactionCategory, http.MethodPatch, "/transactions/:id", "/transactions/"+strconv.FormatInt(step.id, 10), step.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: status %d: %s", step.name, w.Code, w.Body.String())
+			}
+			var rules int
+			h.db.QueryRow("SELECT COUNT(*) FROM category_rules WHERE user_id = ? AND learned = 1", testUserID).Scan(&rules)
+			if rules != step.rules {
+				t.Errorf("%s: %d learned rules, want %d", step.name, rules, step.rules)
+			}
+		}
+		for _, w := range step.want {
+			if category, source := transactionCategory(t, h, w.id); category != w.category || source != w.source {
+				t.Errorf("%s: transaction %d = %q (%s), want %q (%s)", step.name, w.id, category, source, w.category, w.source)
+			}
+		}
+	}
+
+	if w := serve(h.UpdateTransactionCategory, http.MethodPatch, "/transactions/:id", "/transactions/"+strconv.FormatInt(otherRent, 10), `{"category": "cars"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown category: status %d, want 400", w.Code)
+	}
+}
+
+func TestLearnedRule(t *testing.T) {
+	tests := []struct {
+		name     string
+		t        bank.Transaction
+		ruleType string
+		pattern  string
+	}{
+		{"по ИНН", bank.Transaction{CounterpartyINN: "7701234567", Counterparty: "ООО Ромашка", MCC: "5411"}, bank.RuleINN, "7701234567"},
+		{"по наименованию без ИНН", bank.Transaction{Counterparty: " ООО (Ромашка) "}, bank.RulePurpose, `ООО \(Ромашка\)`},
+		{"по MCC", bank.Transaction{MCC: "5812"}, bank.RuleMCC, "5812"},
+		{"не из чего", bank.Transaction{Purpose: "Оплата"}, "", ""},
+	}
+	for _, tt := range tests {
+		tt.t.Direction = bank.DirectionOut
+		rule := learnedRule(tt.t, bank.CategorySuppliers)
+		if tt.ruleType == "" {
+			if rule != nil {
+				t.Errorf("%s: rule %+v, want none", tt.name, rule)
+			}
+			continue
+		}
+		if rule == nil || rule.Type != tt.ruleType || rule.Pattern != tt.pattern || rule.Direction != bank.DirectionOut {
+			t.Errorf("%s: rule %+v, want %s %q", tt.name, rule, tt.ruleType, tt.pattern)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Какие файлы попали в контекст ответа
+const (
+	fileScopeAll     = "all"     // все файлы пользователя (по умолчанию)
+	fileScopeChat    = "chat"    // файлы, прикрепленные к чату
+	fileScopeMessage = "message" // файлы, выбранные для конкретного сообщения
+	fileScopeFilter  = "filter"  // файлы, отобранные для сообщения по папке, тегам, виду и периоду
+)
+
+var (
+	errUnknownFile   = errors.New("unknown file id")
+	errInvalidFilter = errors.New("invalid file filter")
+)
+
+// analysisFiles возвращает файлы пользователя в том виде, в каком они идут в анализ:
+// для каждого берется закрепленная версия, если она есть, иначе последняя
+func (h *Handler) analysisFiles(userID string, where string, args ...interface{}) ([]models.File, error) {
+	query := `SELECT f.id, f.filename, COALESCE(v.file_path, f.file_path), f.file_type, COALESCE(v.version, f.version, 1) FROM files f
+		LEFT JOIN file_versions v ON v.file_id = f.id AND v.version = f.pinned_version
+		WHERE f.user_id = ?`
+	if where != "" {
+		query += " AND " + where
+	}
+	rows, err := h.db.Query(query+" ORDER BY f.uploaded_at", append([]interface{}{userID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []models.File
+	for rows.Next() {
+		var f models.File
+		if err := rows.Scan(&f.ID, &f.Filename, &f.FilePath, &f.FileType, &f.Version); err != nil {
+			continue
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// filesByIDs возвращает файлы пользователя с указанными id; errUnknownFile, если какого-то нет
+func (h *Handler) filesByIDs(userID string, ids []string) ([]models.File, error) {
+	if len(ids) == 0 {
+		return []models.File{}, nil
+	}
+	unique := make(map[string]bool)
+	var args []interface{}
+	for _, id := range ids {
+		if !unique[id] {
+			unique[id] = true
+			args = append(args, id)
+		}
+	}
+	files, err := h.analysisFiles(userID, "f.id IN (?"+strings.Repeat(", ?", len(args)-1)+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) != len(args) {
+		return nil, errUnknownFile
+	}
+	return files, nil
+}
+
+// selectFiles выбирает файлы для ответа: выбранные в сообщении (fileIDs != nil),
+// иначе отобранные фильтром, иначе прикрепленные к чату, иначе все файлы пользователя
+func (h *Handler) selectFiles(userID, chatID string, fileIDs []string, filter *models.FileFilter) ([]models.File, string, error) {
+	if fileIDs != nil {
+		files, err := h.filesByIDs(userID, fileIDs)
+		return files, fileScopeMessage, err
+	}
+	if filter != nil && !filter.IsEmpty() {
+		where, args, err := fileFilterWhere(*filter)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %v", errInvalidFilter, err)
+		}
+		files, err := h.analysisFiles(userID, where, args...)
+		return files, fileScopeFilter, err
+	}
+	if chatID != "" {
+		files, err := h.analysisFiles(userID, "f.id IN (SELECT file_id FROM chat_files WHERE chat_id = ?)", chatID)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(files) > 0 {
+			return files, fileScopeChat, nil
+		}
+	}
+	files, err := h.analysisFiles(userID, "")
+	return files, fileScopeAll, err
+}
+
+// fileRefs - краткое описание файлов для ответа и истории
+func fileRefs(files []models.File) []models.FileRef {
+	refs := make([]models.FileRef, 0, len(files))
+	for _, f := range files {
+		refs = append(refs, models.FileRef{ID: f.ID, Filename: f.Filename, Version: f.Version})
+	}
+	return refs
+}
+
+// setChatFiles заменяет набор файлов, прикрепленных к чату
+func setChatFiles(tx *sql.Tx, chatID string, fileIDs []string) error {
+	if _, err := tx.Exec("DELETE FROM chat_files WHERE chat_id = ?", chatID); err != nil {
+		return err
+	}
+	for _, id := range fileIDs {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO chat_files (chat_id, file_id) VALUES (?, ?)", chatID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chatExists проверяет, что чат принадлежит пользователю
+func (h *Handler) chatExists(userID, chatID string) bool {
+	var exists bool
+	err := h.db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM chats WHERE id = ? AND user_id = ?)",
+		chatID, userID,
+	).Scan(&exists)
+	return err == nil && exists
+}
+
+// GetChatFiles - файлы, прикрепленные к чату
+func (h *Handler) GetChatFiles(c *gin.Context) {
+	userID := c.GetString("user_id")
+	chatID := c.Param("id")
+
+	if !h.chatExists(userID, chatID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
+		return
+	}
+
+	files, err := h.analysisFiles(userID, "f.id IN (SELECT file_id FROM chat_files WHERE chat_id = ?)", chatID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get chat files"})
+		return
+	}
+
+	scope := fileScopeChat
+	if len(files) == 0 {
+		scope = fileScopeAll
+	}
+	c.JSON(http.StatusOK, gin.H{"chat_id": chatID, "file_scope": scope, "files": fileRefs(files)})
+}
+
+// SetChatFiles - прикрепляет к чату набор файлов (пустой список - снова использовать все файлы)
+func (h *Handler) SetChatFiles(c *gin.Context) {
+	userID := c.GetString("user_id")
+	chatID := c.Param("id")
+
+	var req models.ChatFilesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.chatExists(userID, chatID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
+		return
+	}
+
+	files, err := h.filesByIDs(userID, req.FileIDs)
+	if errors.Is(err, errUnknownFile) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown file id"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+	err = setChatFiles(tx, chatID, req.FileIDs)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update chat files"})
+		return
+	}
+
+	scope := fileScopeChat
+	if len(files) == 0 {
+		scope = fileScopeAll
+	}
+	c.JSON(http.StatusOK, gin.H{"chat_id": chatID, "file_scope": scope, "files": fileRefs(files)})
+}
@@ -0,0 +1,367 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/ai"
+	"alfa-hack-backend/internal/edo"
+	"alfa-hack-backend/internal/storage"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// importEDODocument разбирает УПД или счет-фактуру из версии файла и сохраняет документ вместо
+// сохраненного раньше. Для файлов, которые не являются документом ЭДО, только удаляет старый документ.
+func (h *Handler) importEDODocument(ctx context.Context, userID string, task ingestTask) error {
+	var doc *edo.Document
+	if edo.IsDocumentType(strings.TrimPrefix(strings.ToLower(path.Ext(task.FilePath)), ".")) {
+		data, err := storage.ReadAll(ctx, h.store, task.FilePath)
+		if err != nil {
+			return err
+		}
+		doc, err = edo.Parse(data)
+		if err != nil && !errors.Is(err, edo.ErrUnknownFormat) {
+			return err
+		}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"edo_documents", "edo_items"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE file_id = ? AND version = ?", task.FileID, task.Version); err != nil {
+			return err
+		}
+	}
+	if doc == nil {
+		return tx.Commit()
+	}
+
+	result, err := tx.Exec(
+		`INSERT INTO edo_documents (user_id, file_id, version, kind, function, title, number, date, currency,
+		seller_name, seller_inn, seller_kpp, buyer_name, buyer_inn, buyer_kpp, amount, vat, total, fingerprint)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		userID, task.FileID, task.Version, doc.Kind, doc.Function, doc.Title, doc.Number, sqlDate(doc.Date), doc.Currency,
+		doc.Seller.Name, doc.Seller.INN, doc.Seller.KPP, doc.Buyer.Name, doc.Buyer.INN, doc.Buyer.KPP,
+		doc.Amount, doc.VAT, doc.Total, edoFingerprint(doc),
+	)
+	if err != nil {
+		return err
+	}
+	documentID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for _, item := range doc.Items {
+		_, err := tx.Exec(
+			`INSERT INTO edo_items (document_id, user_id, file_id, version, num, name, unit, quantity, price, amount,
+			vat_rate, vat, total) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			documentID, userID, task.FileID, task.Version, item.Num, item.Name, item.Unit, item.Quantity, item.Price,
+			item.Amount, item.VATRate, item.VAT, item.Total,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// edoFingerprint - отпечаток документа: продавец, функция, номер и дата однозначно определяют документ,
+// поэтому один УПД, загруженный в двух файлах, учитывается один раз
+func edoFingerprint(doc *edo.Document) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{doc.Seller.INN, doc.Function, doc.Number, sqlDate(doc.Date)}, "|")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// edoPeriod возвращает дату документа ЭДО из версии файла; ok=false, если версия не документ ЭДО
+func (h *Handler) edoPeriod(fileID string, version int) (date time.Time, ok bool, err error) {
+	var count int
+	var value string
+	err = h.db.QueryRow(
+		"SELECT COUNT(*), COALESCE(MAX(date), '') FROM edo_documents WHERE file_id = ? AND version = ?",
+		fileID, version,
+	).Scan(&count, &value)
+	if err != nil || count == 0 {
+		return date, false, err
+	}
+	date, _ = time.Parse("2006-01-02", value)
+	return date, true, nil
+}
+
+// currentEDODocuments - документы ЭДО из текущих (закрепленных или последних) версий файлов пользователя
+// без повторов одного документа. Первый аргумент запроса - id пользователя.
+const currentEDODocuments = `WITH current AS (
+	SELECT d.* FROM edo_documents d JOIN files f ON f.id = d.file_id
+	WHERE f.user_id = ? AND d.version = CASE WHEN COALESCE(f.pinned_version, 0) > 0 THEN f.pinned_version ELSE f.version END
+), docs AS (
+	SELECT * FROM current WHERE id IN (SELECT MIN(id) FROM current GROUP BY fingerprint)
+) `
+
+// edoRecord - сохраненный документ ЭДО с найденной оплатой
+type edoRecord struct {
+	ID       int64
+	FileID   string
+	Filename string
+	Document *edo.Document
+	Match    edo.Match
+}
+
+// reconciledDocuments загружает все документы ЭДО пользователя по убыванию даты и сопоставляет их
+// с операциями из выписок. Сверка всегда идет по всем документам, чтобы одна операция не засчитывалась
+// разным документам в зависимости от фильтра.
+func (h *Handler) reconciledDocuments(userID string) ([]edoRecord, error) {
+	rows, err := h.db.Query(
+		currentEDODocuments+`SELECT d.id, d.file_id, f.filename, d.kind, d.function, d.title, d.number, d.date, d.currency,
+		d.seller_name, d.seller_inn, d.seller_kpp, d.buyer_name, d.buyer_inn, d.buyer_kpp, d.amount, d.vat, d.total
+		FROM docs d JOIN files f ON f.id = d.file_id ORDER BY d.date DESC, d.id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var records []edoRecord
+	var docs []*edo.Document
+	inns := make(map[string]bool)
+	for rows.Next() {
+		var r edoRecord
+		var d edo.Document
+		var date string
+		if err := rows.Scan(&r.ID, &r.FileID, &r.Filename, &d.Kind, &d.Function, &d.Title, &d.Number, &date, &d.Currency,
+			&d.Seller.Name, &d.Seller.INN, &d.Seller.KPP, &d.Buyer.Name, &d.Buyer.INN, &d.Buyer.KPP,
+			&d.Amount, &d.VAT, &d.Total); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d.Date, _ = time.Parse("2006-01-02", date)
+		r.Document = &d
+		records = append(records, r)
+		docs = append(docs, &d)
+		for _, inn := range []string{d.Seller.INN, d.Buyer.INN} {
+			if inn != "" {
+				inns[inn] = true
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	args := []interface{}{userID}
+	placeholders := make([]string, 0, len(inns))
+	for inn := range inns {
+		placeholders = append(placeholders, "?")
+		args = append(args, inn)
+	}
+	rows, err = h.db.Query(
+		currentTransactions+`SELECT id, date, amount, currency, direction, counterparty_inn, purpose FROM operations
+		WHERE internal = 0 AND counterparty_inn IN (`+strings.Join(append(placeholders, "NULL"), ", ")+`) ORDER BY date, id`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var payments []edo.Payment
+	for rows.Next() {
+		var p edo.Payment
+		var date, direction string
+		if err := rows.Scan(&p.ID, &date, &p.Amount, &p.Currency, &direction, &p.INN, &p.Purpose); err != nil {
+			return nil, err
+		}
+		if p.Date, err = time.Parse("2006-01-02", date); err != nil {
+			continue
+		}
+		p.Incoming = direction == "in"
+		payments = append(payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, match := range edo.Reconcile(docs, payments) {
+		records[i].Match = match
+	}
+	return records, nil
+}
+
+// edoMetrics - документы ЭДО среди файлов со статусом оплаты; nil, если документов нет
+func (h *Handler) edoMetrics(userID string, fileIDs []string) *ai.EDOMetrics {
+	records, err := h.reconciledDocuments(userID)
+	if err != nil {
+		log.Printf("Failed to reconcile EDO documents for user %s: %v", userID, err)
+		return nil
+	}
+	selected := make(map[string]bool, len(fileIDs))
+	for _, id := range fileIDs {
+		selected[id] = true
+	}
+	metrics := &ai.EDOMetrics{}
+	for _, r := range records {
+		if selected[r.FileID] {
+			metrics.Documents = append(metrics.Documents, ai.EDODocument{Document: r.Document, Match: r.Match})
+		}
+	}
+	if len(metrics.Documents) == 0 {
+		return nil
+	}
+	return metrics
+}
+
+// edoPartyJSON - продавец или покупатель в ответе API
+func edoPartyJSON(p edo.Party) gin.H {
+	return gin.H{"name": p.Name, "inn": p.INN, "kpp": p.KPP}
+}
+
+// edoDocumentJSON - документ ЭДО с оплатой в ответе API
+func edoDocumentJSON(r edoRecord) gin.H {
+	d := r.Document
+	payments := []gin.H{}
+	for _, p := range r.Match.Payments {
+		payments = append(payments, gin.H{
+			"transaction_id": p.ID, "date": sqlDate(p.Date), "amount": rubles(p.Amount), "purpose": p.Purpose,
+		})
+	}
+	return gin.H{
+		"id":          r.ID,
+		"file_id":     r.FileID,
+		"filename":    r.Filename,
+		"kind":        d.Kind,
+		"function":    d.Function,
+		"title":       d.Title,
+		"number":      d.Number,
+		"date":        sqlDate(d.Date),
+		"currency":    d.Currency,
+		"seller":      edoPartyJSON(d.Seller),
+		"buyer":       edoPartyJSON(d.Buyer),
+		"amount":      rubles(d.Amount),
+		"vat":         rubles(d.VAT),
+		"total":       rubles(d.Total),
+		"status":      r.Match.Status,
+		"role":        r.Match.Role,
+		"paid":        rubles(r.Match.Paid),
+		"outstanding": rubles(d.Total - r.Match.Paid),
+		"payments":    payments,
+	}
+}
+
+// GetEDODocuments - УПД и счета-фактуры со статусом оплаты по выпискам (?kind=invoice|upd|transfer,
+// inn= - ИНН продавца или покупателя, from=&to= или period=2025-03, status=paid|partial|unpaid)
+func (h *Handler) GetEDODocuments(c *gin.Context) {
+	kind := c.Query("kind")
+	if _, known := edo.KindNames[kind]; kind != "" && !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be invoice, upd or transfer"})
+		return
+	}
+	status := c.Query("status")
+	if _, known := edo.StatusNames[status]; status != "" && !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be paid, partial or unpaid"})
+		return
+	}
+	from, to, ok := bindPeriod(c)
+	if !ok {
+		return
+	}
+	inn := strings.TrimSpace(c.Query("inn"))
+
+	records, err := h.reconciledDocuments(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	documents := []gin.H{}
+	totals := make(map[string]int64)
+	for _, r := range records {
+		d := r.Document
+		date := sqlDate(d.Date)
+		switch {
+		case kind != "" && d.Kind != kind, status != "" && r.Match.Status != status,
+			inn != "" && d.Seller.INN != inn && d.Buyer.INN != inn,
+			from != "" && date < from, to != "" && (date == "" || date > to):
+			continue
+		}
+		documents = append(documents, edoDocumentJSON(r))
+		totals["total"] += d.Total
+		totals["vat"] += d.VAT
+		totals["paid"] += r.Match.Paid
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"documents":   documents,
+		"total":       rubles(totals["total"]),
+		"vat":         rubles(totals["vat"]),
+		"paid":        rubles(totals["paid"]),
+		"outstanding": rubles(totals["total"] - totals["paid"]),
+	})
+}
+
+// GetEDODocument - документ ЭДО со строками товаров, итогами по ставкам НДС и найденными оплатами
+func (h *Handler) GetEDODocument(c *gin.Context) {
+	userID := c.GetString("user_id")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document id"})
+		return
+	}
+	records, err := h.reconciledDocuments(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var record *edoRecord
+	for i := range records {
+		if records[i].ID == id {
+			record = &records[i]
+			break
+		}
+	}
+	if record == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+
+	rows, err := h.db.Query(
+		`SELECT num, name, unit, quantity, price, amount, vat_rate, vat, total FROM edo_items
+		WHERE document_id = ? AND user_id = ? ORDER BY num, id`,
+		id, userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+	items := []gin.H{}
+	for rows.Next() {
+		var item edo.Item
+		if err := rows.Scan(&item.Num, &item.Name, &item.Unit, &item.Quantity, &item.Price, &item.Amount,
+			&item.VATRate, &item.VAT, &item.Total); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		record.Document.Items = append(record.Document.Items, item)
+		items = append(items, gin.H{
+			"num": item.Num, "name": item.Name, "unit": item.Unit, "quantity": item.Quantity, "price": rubles(item.Price),
+			"amount": rubles(item.Amount), "vat_rate": item.VATRate, "vat": rubles(item.VAT), "total": rubles(item.Total),
+		})
+	}
+	vat := []gin.H{}
+	for _, group := range record.Document.VATGroups() {
+		vat = append(vat, gin.H{"rate": group.Rate, "amount": rubles(group.Amount), "vat": rubles(group.VAT)})
+	}
+
+	response := edoDocumentJSON(*record)
+	response["items"] = items
+	response["vat_groups"] = vat
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,451 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/ai"
+	"alfa-hack-backend/internal/models"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ограничения на описание файла
+const (
+	maxFolderLength      = 200
+	maxDescriptionLength = 2000
+	maxTagLength         = 50
+	maxTagsPerFile       = 20
+)
+
+// normalizeFolder приводит путь папки к виду "Отчеты/2024": без пустых частей и лишних пробелов
+func normalizeFolder(folder string) (string, error) {
+	var parts []string
+	for _, part := range strings.Split(strings.ReplaceAll(folder, "\\", "/"), "/") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	folder = strings.Join(parts, "/")
+	if utf8.RuneCountInString(folder) > maxFolderLength {
+		return "", fmt.Errorf("folder is too long, maximum is %d characters", maxFolderLength)
+	}
+	return folder, nil
+}
+
+// normalizeTags приводит теги к нижнему регистру и убирает повторы. Запятая разделяет теги.
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, value := range tags {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#")))
+			if tag == "" || seen[tag] {
+				continue
+			}
+			if utf8.RuneCountInString(tag) > maxTagLength {
+				return nil, fmt.Errorf("tag %q is too long, maximum is %d characters", tag, maxTagLength)
+			}
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	if len(result) > maxTagsPerFile {
+		return nil, fmt.Errorf("too many tags, maximum is %d", maxTagsPerFile)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// splitTags разбирает теги из group_concat
+func splitTags(tags string) []string {
+	if tags == "" {
+		return []string{}
+	}
+	result := strings.Split(tags, ",")
+	sort.Strings(result)
+	return result
+}
+
+// normalizeFileMeta проверяет и нормализует запрос на изменение описания файла
+func normalizeFileMeta(req *models.UpdateFileRequest) error {
+	if req.Folder != nil {
+		folder, err := normalizeFolder(*req.Folder)
+		if err != nil {
+			return err
+		}
+		req.Folder = &folder
+	}
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		if utf8.RuneCountInString(description) > maxDescriptionLength {
+			return fmt.Errorf("description is too long, maximum is %d characters", maxDescriptionLength)
+		}
+		req.Description = &description
+	}
+	if req.Tags != nil {
+		tags, err := normalizeTags(*req.Tags)
+		if err != nil {
+			return err
+		}
+		req.Tags = &tags
+	}
+	if req.Period != nil {
+		period := strings.ToUpper(strings.TrimSpace(*req.Period))
+		if period != "" {
+			if _, _, err := ai.ParsePeriod(period); err != nil {
+				return err
+			}
+		}
+		req.Period = &period
+	}
+	if req.DocKind != nil {
+		kind := strings.ToLower(strings.TrimSpace(*req.DocKind))
+		if _, ok := ai.DocKindNames[kind]; kind != "" && !ok {
+			return fmt.Errorf("unknown document kind %q", kind)
+		}
+		req.DocKind = &kind
+	}
+	return nil
+}
+
+// fileMetaFromForm читает описание файла из полей формы загрузки (folder, description, tags, period, doc_kind)
+func fileMetaFromForm(c *gin.Context) (models.UpdateFileRequest, error) {
+	var req models.UpdateFileRequest
+	if value, ok := c.GetPostForm("folder"); ok {
+		req.Folder = &value
+	}
+	if value, ok := c.GetPostForm("description"); ok {
+		req.Description = &value
+	}
+	if values, ok := c.GetPostFormArray("tags"); ok {
+		req.Tags = &values
+	}
+	if value, ok := c.GetPostForm("period"); ok && strings.TrimSpace(value) != "" {
+		req.Period = &value
+	}
+	if value, ok := c.GetPostForm("doc_kind"); ok && strings.TrimSpace(value) != "" {
+		req.DocKind = &value
+	}
+	return req, normalizeFileMeta(&req)
+}
+
+// setFileTags заменяет теги файла
+func setFileTags(tx *sql.Tx, fileID string, tags []string) error {
+	if _, err := tx.Exec("DELETE FROM file_tags WHERE file_id = ?", fileID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO file_tags (file_id, tag) VALUES (?, ?)", fileID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setFilePeriod записывает период вместе с его границами (по ним работает фильтр)
+func setFilePeriod(tx *sql.Tx, fileID, period string, auto bool) error {
+	start, end := "", ""
+	if period != "" {
+		var err error
+		if start, end, err = ai.ParsePeriod(period); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec("UPDATE files SET period = ?, period_start = ?, period_end = ?, period_auto = ? WHERE id = ?",
+		period, start, end, auto, fileID)
+	return err
+}
+
+// applyFileMeta сохраняет указанные в запросе поля. Пустые период и вид документа
+// возвращают их автоматическое определение.
+func applyFileMeta(tx *sql.Tx, fileID string, req models.UpdateFileRequest) error {
+	if req.Folder != nil {
+		if _, err := tx.Exec("UPDATE files SET folder = ? WHERE id = ?", *req.Folder, fileID); err != nil {
+			return err
+		}
+	}
+	if req.Description != nil {
+		if _, err := tx.Exec("UPDATE files SET description = ? WHERE id = ?", *req.Description, fileID); err != nil {
+			return err
+		}
+	}
+	if req.Tags != nil {
+		if err := setFileTags(tx, fileID, *req.Tags); err != nil {
+			return err
+		}
+	}
+	if req.Period != nil {
+		if err := setFilePeriod(tx, fileID, *req.Period, *req.Period == ""); err != nil {
+			return err
+		}
+	}
+	if req.DocKind != nil {
+		if _, err := tx.Exec("UPDATE files SET doc_kind = ?, doc_kind_auto = ? WHERE id = ?",
+			*req.DocKind, *req.DocKind == "", fileID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detectFileMeta определяет вид документа и период для полей, которые пользователь не задал сам.
+// Анализируется версия, которая идет в анализ (закрепленная или последняя).
+func (h *Handler) detectFileMeta(fileID string) error {
+	file, err := h.findFile("id = ?", fileID)
+	if err != nil || file == nil {
+		return err
+	}
+	if !file.DocKindAuto && !file.PeriodAuto {
+		return nil
+	}
+	version := file.Version
+	if file.PinnedVersion > 0 {
+		version = file.PinnedVersion
+		if v, err := h.getFileVersion(file.ID, file.PinnedVersion); err == nil && v != nil {
+			file.FilePath = v.FilePath
+		}
+	}
+
+	kind, period := ai.DetectDocument(*file, time.Now())
+	// Разобранная банковская выписка: вид и период известны точно
+	if from, to, ok, err := h.statementPeriod(file.ID, version); err != nil {
+		return err
+	} else if ok {
+		kind = ai.DocKindBankStatement
+		if statementPeriod := ai.PeriodForRange(from, to); statementPeriod != "" {
+			period = statementPeriod
+		}
+	}
+	// Выгрузка кассовых чеков - отчет о продажах
+	if from, to, ok, err := h.receiptsPeriod(file.ID, version); err != nil {
+		return err
+	} else if ok {
+		kind = ai.DocKindSalesReport
+		if receiptsPeriod := ai.PeriodForRange(from, to); receiptsPeriod != "" {
+			period = receiptsPeriod
+		}
+	}
+	// Отчет маркетплейса о реализации - тоже отчет о продажах
+	if from, to, ok, err := h.marketplacePeriod(file.ID, version); err != nil {
+		return err
+	} else if ok {
+		kind = ai.DocKindSalesReport
+		if reportPeriod := ai.PeriodForRange(from, to); reportPeriod != "" {
+			period = reportPeriod
+		}
+	}
+	// УПД и счет-фактура из ЭДО относятся к месяцу даты документа
+	if date, ok, err := h.edoPeriod(file.ID, version); err != nil {
+		return err
+	} else if ok {
+		kind = ai.DocKindInvoice
+		if !date.IsZero() {
+			period = date.Format("2006-01")
+		}
+	}
+	// Список сотрудников с окладами - кадровый документ; период из текста файла
+	if ok, err := h.hasStaff(file.ID, version); err != nil {
+		return err
+	} else if ok {
+		kind = ai.DocKindPayroll
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if file.DocKindAuto {
+		if _, err := tx.Exec("UPDATE files SET doc_kind = ? WHERE id = ?", kind, file.ID); err != nil {
+			return err
+		}
+	}
+	if file.PeriodAuto {
+		if err := setFilePeriod(tx, file.ID, period, true); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// fileFilterWhere строит условие SQL для отбора файлов (таблица files с псевдонимом f)
+func fileFilterWhere(filter models.FileFilter) (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.Folder != "" {
+		folder, err := normalizeFolder(filter.Folder)
+		if err != nil {
+			return "", nil, err
+		}
+		if folder != "" {
+			// Папка вместе с вложенными; LIKE не подходит - в именах бывают % и _
+			conditions = append(conditions, "(f.folder = ? OR substr(f.folder, 1, ?) = ?)")
+			args = append(args, folder, utf8.RuneCountInString(folder)+1, folder+"/")
+		}
+	}
+	if len(filter.Tags) > 0 {
+		tags, err := normalizeTags(filter.Tags)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, tag := range tags {
+			conditions = append(conditions, "f.id IN (SELECT file_id FROM file_tags WHERE tag = ?)")
+			args = append(args, tag)
+		}
+	}
+	if filter.DocKind != "" {
+		kind := strings.ToLower(strings.TrimSpace(filter.DocKind))
+		if _, ok := ai.DocKindNames[kind]; !ok {
+			return "", nil, fmt.Errorf("unknown document kind %q", kind)
+		}
+		conditions = append(conditions, "f.doc_kind = ?")
+		args = append(args, kind)
+	}
+	if filter.Period != "" {
+		start, end, err := ai.ParsePeriod(filter.Period)
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, "f.period != '' AND f.period_start >= ? AND f.period_end <= ?")
+		args = append(args, start, end)
+	}
+
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// UpdateFile - изменение папки, описания, тегов, периода и вида документа
+func (h *Handler) UpdateFile(c *gin.Context) {
+	file := h.userFileFromParam(c)
+	if file == nil {
+		return
+	}
+
+	var req models.UpdateFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := normalizeFileMeta(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+	err = applyFileMeta(tx, file.ID, req)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update file"})
+		return
+	}
+
+	// Поля, возвращенные к автоматическому определению, определяем заново
+	if (req.Period != nil && *req.Period == "") || (req.DocKind != nil && *req.DocKind == "") {
+		if err := h.detectFileMeta(file.ID); err != nil {
+			log.Printf("Failed to detect document kind for file %s: %v", file.ID, err)
+		}
+	}
+
+	updated, err := h.findFile("id = ?", file.ID)
+	if err != nil || updated == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	updated.FilePath = ""
+	c.JSON(http.StatusOK, updated)
+}
+
+// GetFolders - папки пользователя с количеством файлов (включая вложенные папки)
+func (h *Handler) GetFolders(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	rows, err := h.db.Query(
+		"SELECT COALESCE(folder, ''), COUNT(*) FROM files WHERE user_id = ? GROUP BY COALESCE(folder, '')",
+		userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get folders"})
+		return
+	}
+	defer rows.Close()
+
+	// Родительские папки тоже попадают в список, даже если в них нет файлов напрямую
+	counts := make(map[string]int)
+	for rows.Next() {
+		var folder string
+		var count int
+		if err := rows.Scan(&folder, &count); err != nil || folder == "" {
+			continue
+		}
+		parts := strings.Split(folder, "/")
+		for i := range parts {
+			counts[strings.Join(parts[:i+1], "/")] += count
+		}
+	}
+
+	type folderInfo struct {
+		Path      string `json:"path"`
+		FileCount int    `json:"file_count"`
+	}
+	folders := make([]folderInfo, 0, len(counts))
+	for path, count := range counts {
+		folders = append(folders, folderInfo{Path: path, FileCount: count})
+	}
+	sort.Slice(folders, func(i, j int) bool { return folders[i].Path < folders[j].Path })
+
+	c.JSON(http.StatusOK, gin.H{"folders": folders})
+}
+
+// GetTags - теги пользователя с количеством файлов
+func (h *Handler) GetTags(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	rows, err := h.db.Query(
+		`SELECT t.tag, COUNT(*) FROM file_tags t JOIN files f ON f.id = t.file_id
+		WHERE f.user_id = ? GROUP BY t.tag ORDER BY t.tag`,
+		userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get tags"})
+		return
+	}
+	defer rows.Close()
+
+	type tagInfo struct {
+		Tag       string `json:"tag"`
+		FileCount int    `json:"file_count"`
+	}
+	tags := []tagInfo{}
+	for rows.Next() {
+		var t tagInfo
+		if err := rows.Scan(&t.Tag, &t.FileCount); err != nil {
+			continue
+		}
+		tags = append(tags, t)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// GetDocKinds - виды документов, которые можно указать файлу
+func (h *Handler) GetDocKinds(c *gin.Context) {
+	kinds := make([]gin.H, 0, len(ai.DocKindNames))
+	for _, kind := range []string{ai.DocKindSalesReport, ai.DocKindPayroll, ai.DocKindContract,
+		ai.DocKindBankStatement, ai.DocKindInvoice, ai.DocKindOther} {
+		kinds = append(kinds, gin.H{"kind": kind, "name": ai.DocKindNames[kind]})
+	}
+	c.JSON(http.StatusOK, gin.H{"doc_kinds": kinds})
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/ai"
+	"alfa-hack-backend/internal/models"
+	"alfa-hack-backend/internal/storage"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fileContentTypes - Content-Type для скачивания по расширению файла
+var fileContentTypes = map[string]string{
+	"docx":  "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"xlsx":  "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"txt":   "text/plain",
+	"csv":   "text/csv",
+	"md":    "text/markdown",
+	"xml":   "application/xml",
+	"json":  "application/json",
+	"sta":   "text/plain",
+	"mt940": "text/plain",
+}
+
+func contentTypeFor(fileType string) string {
+	if contentType, ok := fileContentTypes[fileType]; ok {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension("." + fileType); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// fileVersionFromQuery возвращает версию из ?version=N. Без параметра берется
+// закрепленная версия (если pinned и она есть) или последняя. При ошибке сам отвечает клиенту.
+func (h *Handler) fileVersionFromQuery(c *gin.Context, file *models.File, pinned bool) *models.FileVersion {
+	number := file.Version
+	if pinned && file.PinnedVersion > 0 {
+		number = file.PinnedVersion
+	}
+	if value := c.Query("version"); value != "" {
+		var err error
+		if number, err = strconv.Atoi(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+			return nil
+		}
+	}
+
+	version, err := h.getFileVersion(file.ID, number)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil
+	}
+	if version == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return nil
+	}
+	return version
+}
+
+// DownloadFile - скачивание исходного файла (последняя версия или ?version=N)
+func (h *Handler) DownloadFile(c *gin.Context) {
+	file := h.userFileFromParam(c)
+	if file == nil {
+		return
+	}
+	version := h.fileVersionFromQuery(c, file, false)
+	if version == nil {
+		return
+	}
+
+	rc, err := h.store.Get(c.Request.Context(), version.FilePath)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File content not found in storage"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer rc.Close()
+
+	// Имя файла может быть на кириллице - mime кодирует его как filename*=utf-8''...
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": file.Filename})
+	c.DataFromReader(http.StatusOK, version.FileSize, contentTypeFor(file.FileType), rc, map[string]string{
+		"Content-Disposition":    disposition,
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// GetFileText - текст и таблицы, которые парсер извлек из файла, то есть то, что "читает" AI.
+// По умолчанию используется версия, которая идет в анализ (закрепленная или последняя).
+func (h *Handler) GetFileText(c *gin.Context) {
+	file := h.userFileFromParam(c)
+	if file == nil {
+		return
+	}
+	version := h.fileVersionFromQuery(c, file, true)
+	if version == nil {
+		return
+	}
+
+	file.FilePath = version.FilePath
+	extraction, err := ai.ExtractFile(*file)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File content not found in storage"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Failed to parse file", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file_id":        file.ID,
+		"filename":       file.Filename,
+		"version":        version.Version,
+		"sections":       extraction.Sections,
+		"warnings":       extraction.Warnings,
+		"truncated":      extraction.Truncated,
+		"total_chars":    extraction.TotalChars,
+		"included_chars": extraction.IncludedChars,
+		"chunks":         extraction.Chunks,
+	})
+}
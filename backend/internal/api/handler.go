@@ -3,12 +3,15 @@ package api
 import (
 	"alfa-hack-backend/internal/ai"
 	"alfa-hack-backend/internal/models"
+	"alfa-hack-backend/internal/storage"
+	"context"
 	"database/sql"
-	"io"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
+	"path"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -18,11 +21,14 @@ import (
 )
 
 type Handler struct {
-	db *sql.DB
+	db    *sql.DB
+	store storage.Storage
+
+	ingestWake chan struct{} // сигнал обработчикам файлов (см. StartIngestion)
 }
 
-func NewHandler(db *sql.DB) *Handler {
-	return &Handler{db: db}
+func NewHandler(db *sql.DB, store storage.Storage) *Handler {
+	return &Handler{db: db, store: store, ingestWake: make(chan struct{}, maxIngestWorkers)}
 }
 
 // Register - регистрация нового пользователя
@@ -121,78 +127,234 @@ func (h *Handler) Login(c *gin.Context) {
 	})
 }
 
-// UploadFile - загрузка файла
+// UploadFile - загрузка файла. В форме может быть несколько файлов (поля file или files)
+// и ZIP-архивы - тогда ответ содержит результат по каждому файлу (см. bulkUpload).
 func (h *Handler) UploadFile(c *gin.Context) {
 	userID := c.GetString("user_id")
+	limits := uploadLimitsFromEnv()
+
+	// Не даем читать тело запроса сверх лимита (запас на заголовки multipart)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.MaxRequestSize+1<<20)
 
-	file, header, err := c.Request.FormFile("file")
+	form, err := c.MultipartForm()
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("Request is too large, maximum is %s", formatBytes(limits.MaxRequestSize)),
+				"code":  uploadErrFileTooLarge,
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+		return
+	}
+	headers := append(form.File["file"], form.File["files"]...)
+	if len(headers) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
 		return
 	}
-	defer file.Close()
 
-	// Создание директории для файлов пользователя
-	// Используем переменную окружения или путь по умолчанию
-	baseUploadDir := os.Getenv("UPLOADS_DIR")
-	if baseUploadDir == "" {
-		// Для локального запуска используем относительный путь
-		baseUploadDir = filepath.Join("..", "uploads")
+	// Папка, описание, теги, период и вид документа из полей формы (необязательные, общие для всех файлов)
+	meta, err := fileMetaFromForm(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	uploadDir := filepath.Join(baseUploadDir, userID)
-	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload directory"})
+
+	// Один обычный файл - прежний формат ответа
+	if len(headers) == 1 && !isArchiveName(headers[0].Filename) {
+		header := headers[0]
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+			return
+		}
+		defer file.Close()
+
+		result, uploadErr := h.saveUpload(c.Request.Context(), userID, uploadSource{
+			Name:        header.Filename,
+			Size:        header.Size,
+			ContentType: header.Header.Get("Content-Type"),
+			Content:     file,
+		}, meta, limits)
+		if uploadErr != nil {
+			c.JSON(uploadErr.Status, gin.H{"error": uploadErr.Message, "code": uploadErr.Code})
+			return
+		}
+		c.JSON(http.StatusOK, result)
 		return
 	}
 
-	// Сохранение файла
-	fileID := uuid.New().String()
-	fileExt := filepath.Ext(header.Filename)
-	filePath := filepath.Join(uploadDir, fileID+fileExt)
+	c.JSON(http.StatusOK, h.bulkUpload(c.Request.Context(), userID, headers, meta, limits))
+}
+
+// uploadSource - один загружаемый файл
+type uploadSource struct {
+	Name        string // имя файла без пути
+	Folder      string // папка внутри архива; пусто для обычных файлов
+	Size        int64
+	ContentType string
+	Content     uploadReader
+}
+
+// saveUpload проверяет файл и сохраняет его как новый файл или новую версию файла с тем же именем.
+// Возвращает описание файла для ответа.
+func (h *Handler) saveUpload(ctx context.Context, userID string, src uploadSource, meta models.UpdateFileRequest, limits uploadLimits) (gin.H, *uploadError) {
+	fileType, uploadErr := validateUpload(src.Content, src.Name, src.Size, limits)
+	if uploadErr != nil {
+		return nil, uploadErr
+	}
+
+	// Папки архива продолжают папку, указанную в форме
+	if src.Folder != "" {
+		folder := src.Folder
+		if meta.Folder != nil {
+			folder = path.Join(*meta.Folder, src.Folder)
+		}
+		normalized, err := normalizeFolder(folder)
+		if err != nil {
+			return nil, &uploadError{Status: http.StatusBadRequest, Code: uploadErrUnsafePath, Message: err.Error()}
+		}
+		meta.Folder = &normalized
+	}
 
-	dst, err := os.Create(filePath)
+	// Хеш содержимого: по нему распознаем повторную загрузку того же файла
+	hash, err := hashFile(src.Content)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
-		return
+		return nil, &uploadError{Status: http.StatusInternalServerError, Code: uploadErrInternal, Message: "Failed to read file"}
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
-		return
+	// Файл с таким именем в той же папке уже есть - загрузка станет его новой версией.
+	// Без папки файл загружается в корень, и одноименные файлы из других папок не затрагиваются.
+	folder := ""
+	if meta.Folder != nil {
+		folder = *meta.Folder
+	}
+	existing, err := h.findFile("user_id = ? AND filename = ? AND COALESCE(folder, '') = ?", userID, src.Name, folder)
+	if err == nil && existing != nil && existing.SHA256 == "" {
+		// Файл загружен до появления хешей - считаем хеш по содержимому в хранилище
+		if existing.SHA256, err = h.backfillHash(ctx, existing); err != nil {
+			log.Printf("Failed to hash file %s: %v", existing.ID, err)
+			err = nil
+		}
+	}
+	if err == nil && existing == nil {
+		// Такое же содержимое под другим именем - тоже повторная загрузка
+		existing, err = h.findFile("user_id = ? AND sha256 = ?", userID, hash)
+	}
+	if err != nil {
+		return nil, &uploadError{Status: http.StatusInternalServerError, Code: uploadErrInternal, Message: "Database error"}
+	}
+	if existing != nil && existing.SHA256 == hash {
+		// Повторная загрузка того же содержимого: ничего не сохраняем
+		return gin.H{
+			"id":          existing.ID,
+			"filename":    existing.Filename,
+			"file_type":   existing.FileType,
+			"file_size":   existing.FileSize,
+			"uploaded_at": existing.UploadedAt,
+			"sha256":      existing.SHA256,
+			"version":     existing.Version,
+			"duplicate":   true,
+		}, nil
+	}
+
+	if uploadErr := h.checkQuota(userID, src.Size, limits); uploadErr != nil {
+		return nil, uploadErr
+	}
+
+	fileID, version := uuid.New().String(), 1
+	if existing != nil {
+		fileID = existing.ID
+		if version, err = nextVersion(h.db, fileID); err != nil {
+			return nil, &uploadError{Status: http.StatusInternalServerError, Code: uploadErrInternal, Message: "Database error"}
+		}
 	}
 
-	// Сохранение информации о файле в БД
-	fileSize := header.Size
-	fileType := strings.ToLower(fileExt[1:]) // убираем точку
+	// Сохранение файла в хранилище; в БД записывается ключ вида "<userID>/<fileID>.<ext>" (см. versionKey)
+	filePath := versionKey(userID, fileID, version, fileType)
+	if err := h.store.Put(ctx, filePath, src.Content, src.Size, src.ContentType); err != nil {
+		return nil, &uploadError{Status: http.StatusInternalServerError, Code: uploadErrInternal, Message: "Failed to save file"}
+	}
 
-	_, err = h.db.Exec(
-		"INSERT INTO files (id, user_id, filename, file_path, file_type, file_size) VALUES (?, ?, ?, ?, ?, ?)",
-		fileID, userID, header.Filename, filePath, fileType, fileSize,
-	)
+	// Сохранение информации о файле в БД; при одновременной загрузке той же версии
+	// вставка упрется в UNIQUE (file_id, version)
+	fileSize := src.Size
+
+	tx, err := h.db.Begin()
 	if err != nil {
-		os.Remove(filePath)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file info"})
-		return
+		h.deleteBlobs(ctx, []string{filePath})
+		return nil, &uploadError{Status: http.StatusInternalServerError, Code: uploadErrInternal, Message: "Database error"}
 	}
+	defer tx.Rollback()
 
-	c.JSON(http.StatusOK, gin.H{
-		"id":         fileID,
-		"filename":   header.Filename,
-		"file_type":  fileType,
-		"file_size":  fileSize,
+	if existing == nil {
+		_, err = tx.Exec(
+			"INSERT INTO files (id, user_id, filename, file_path, file_type, file_size, sha256, version) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			fileID, userID, src.Name, filePath, fileType, fileSize, hash, version,
+		)
+	}
+	if err == nil {
+		err = h.addFileVersion(tx, fileID, version, filePath, fileSize, hash)
+	}
+	if err == nil {
+		err = applyFileMeta(tx, fileID, meta)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		h.deleteBlobs(ctx, []string{filePath})
+		return nil, &uploadError{Status: http.StatusInternalServerError, Code: uploadErrInternal, Message: "Failed to save file info"}
+	}
+
+	// Разбор файла, вид документа и период определяются в фоне (GET /api/files/:id/status)
+	h.wakeIngestion()
+	saved, err := h.findFile("id = ?", fileID)
+	if err != nil || saved == nil {
+		saved = &models.File{Tags: []string{}}
+	}
+
+	return gin.H{
+		"id":          fileID,
+		"filename":    src.Name,
+		"file_type":   fileType,
+		"file_size":   fileSize,
 		"uploaded_at": time.Now(),
-	})
+		"sha256":      hash,
+		"version":     version,
+		"duplicate":   false,
+		"folder":      saved.Folder,
+		"description": saved.Description,
+		"tags":        saved.Tags,
+		"period":      saved.Period,
+		"doc_kind":    saved.DocKind,
+		"status":      ingestQueued,
+	}, nil
 }
 
-// GetFiles - получение списка файлов пользователя
+// GetFiles - получение списка файлов пользователя.
+// Фильтры: ?folder= (вместе с вложенными), ?tag= (можно несколько), ?doc_kind=, ?period=
 func (h *Handler) GetFiles(c *gin.Context) {
 	userID := c.GetString("user_id")
 
-	rows, err := h.db.Query(
-		"SELECT id, filename, file_type, file_size, uploaded_at FROM files WHERE user_id = ? ORDER BY uploaded_at DESC",
-		userID,
-	)
+	var filter models.FileFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	where, args, err := fileFilterWhere(filter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	query := fileSelect + " WHERE f.user_id = ?"
+	if where != "" {
+		query += " AND " + where
+	}
+
+	rows, err := h.db.Query(query+" ORDER BY f.uploaded_at DESC", append([]interface{}{userID}, args...)...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get files", "files": []interface{}{}})
 		return
@@ -201,10 +363,11 @@ func (h *Handler) GetFiles(c *gin.Context) {
 
 	var files []models.File
 	for rows.Next() {
-		var f models.File
-		if err := rows.Scan(&f.ID, &f.Filename, &f.FileType, &f.FileSize, &f.UploadedAt); err != nil {
+		f, err := scanFile(rows)
+		if err != nil {
 			continue
 		}
+		f.UserID, f.FilePath = "", ""
 		files = append(files, f)
 	}
 
@@ -235,19 +398,70 @@ func (h *Handler) DeleteFile(c *gin.Context) {
 		return
 	}
 
-	// Удаление из БД
-	_, err = h.db.Exec("DELETE FROM files WHERE id = ? AND user_id = ?", fileID, userID)
+	versions, err := h.getFileVersions(fileID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Удаление из БД вместе со всеми версиями
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file"})
+		return
+	}
+	defer tx.Rollback()
+	err = deleteFileRows(tx, fileID)
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file"})
 		return
 	}
 
-	// Удаление файла с диска
-	os.Remove(filePath)
+	// Удаление файла и всех его версий из хранилища. Если не получилось, объекты
+	// останутся без записей в базе - их удалит сверка хранилища (см. Reconcile)
+	keys := []string{filePath}
+	for _, v := range versions {
+		if v.FilePath != filePath {
+			keys = append(keys, v.FilePath)
+		}
+	}
+	h.deleteBlobs(c.Request.Context(), keys)
 
 	c.JSON(http.StatusOK, gin.H{"message": "File deleted successfully"})
 }
 
+// deleteFileRows удаляет файл и все связанные с ним записи. Внешние ключи в SQLite
+// не включены, поэтому зависимые таблицы чистим явно.
+func deleteFileRows(tx *sql.Tx, fileID string) error {
+	// Разобранное содержимое удаляем из кеша, если такого же файла больше ни у кого нет
+	_, err := tx.Exec(
+		`DELETE FROM parsed_cache WHERE sha256 IN (SELECT sha256 FROM file_versions WHERE file_id = ?)
+		AND sha256 NOT IN (SELECT sha256 FROM file_versions WHERE file_id != ?)`,
+		fileID, fileID,
+	)
+	for _, table := range []string{"ingest_jobs", "file_versions", "chat_files", "file_tags", "bank_statements", "transactions", "receipts", "receipt_items", "marketplace_sales", "edo_documents", "edo_items", "employees"} {
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM "+table+" WHERE file_id = ?", fileID)
+		}
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM files WHERE id = ?", fileID)
+	}
+	return err
+}
+
+// deleteBlobs удаляет объекты из хранилища; ошибки только логируются
+func (h *Handler) deleteBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := h.store.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete %s from storage, it will be removed by reconciliation: %v", key, err)
+		}
+	}
+}
+
 // CreateChat - создание нового чата
 func (h *Handler) CreateChat(c *gin.Context) {
 	userID := c.GetString("user_id")
@@ -258,13 +472,34 @@ func (h *Handler) CreateChat(c *gin.Context) {
 		req.Title = "Новый чат"
 	}
 
+	files, err := h.filesByIDs(userID, req.FileIDs)
+	if errors.Is(err, errUnknownFile) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown file id"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
 	chatID := uuid.New().String()
 	now := time.Now()
 
-	_, err := h.db.Exec(
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create chat"})
+		return
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(
 		"INSERT INTO chats (id, user_id, title, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
 		chatID, userID, req.Title, now, now,
 	)
+	if err == nil {
+		err = setChatFiles(tx, chatID, req.FileIDs)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create chat"})
 		return
@@ -275,6 +510,7 @@ func (h *Handler) CreateChat(c *gin.Context) {
 		"title":      req.Title,
 		"created_at": now,
 		"updated_at": now,
+		"files":      fileRefs(files),
 	})
 }
 
@@ -327,6 +563,7 @@ func (h *Handler) DeleteChat(c *gin.Context) {
 	}
 
 	// Удаление чата (сообщения удалятся каскадно)
+	h.db.Exec("DELETE FROM chat_files WHERE chat_id = ?", chatID)
 	_, err = h.db.Exec("DELETE FROM chats WHERE id = ? AND user_id = ?", chatID, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete chat"})
@@ -346,6 +583,20 @@ func (h *Handler) SendMessage(c *gin.Context) {
 		return
 	}
 
+	// Файлы для контекста: выбранные или отобранные фильтром в сообщении, прикрепленные к чату или все файлы пользователя.
+	// Выбираем до создания чата, чтобы не оставлять пустой чат при неверных file_ids.
+	files, fileScope, err := h.selectFiles(userID, req.ChatID, req.FileIDs, req.FileFilter)
+	if errors.Is(err, errUnknownFile) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown file id"})
+		return
+	} else if errors.Is(err, errInvalidFilter) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user files"})
+		return
+	}
+
 	// Если chat_id не указан, создаем новый чат
 	var chatID string
 	if req.ChatID == "" {
@@ -384,25 +635,39 @@ func (h *Handler) SendMessage(c *gin.Context) {
 	var username, businessName, specialization string
 	h.db.QueryRow("SELECT username, COALESCE(business_name, '') as business_name, specialization FROM users WHERE id = ?", userID).Scan(&username, &businessName, &specialization)
 
-	// Получение всех файлов пользователя
-	files, err := h.getUserFiles(userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user files"})
-		return
-	}
+	// Определение категории вопроса (явно выбранная категория имеет приоритет)
+	classification := ai.ClassifyQuestion(req.Message, req.Category)
 
 	// Генерация ответа через AI
-	response, err := ai.GenerateResponse(req.Message, req.Category, username, businessName, specialization, files)
-	if err != nil {
+	result, err := ai.GenerateResponse(req.Message, classification.Category, username, businessName, specialization, files, h.financialMetrics(userID, files))
+	if errors.Is(err, ai.ErrAIUnavailable) {
+		// Шаблонный fallback отключен - честно сообщаем, что AI недоступен
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":           "AI service is unavailable",
+			"chat_id":         chatID,
+			"degraded_reason": result.DegradedReason,
+		})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate response"})
 		return
 	}
+	latencyMs := result.Latency.Milliseconds()
+	sourcesJSON, _ := json.Marshal(result.Sources)
+	usedFiles := fileRefs(files)
+	filesJSON, _ := json.Marshal(usedFiles)
 
 	// Сохранение сообщения в БД
 	messageID := uuid.New().String()
 	_, err = h.db.Exec(
-		"INSERT INTO messages (id, chat_id, user_id, message, response, category) VALUES (?, ?, ?, ?, ?, ?)",
-		messageID, chatID, userID, req.Message, response, req.Category,
+		`INSERT INTO messages (id, chat_id, user_id, message, response, category,
+			provider, model, prompt_tokens, completion_tokens, latency_ms, fallback_attempts, is_fallback, degraded_reason, sources, prompt_version,
+			category_confidence, category_method, files, file_scope)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		messageID, chatID, userID, req.Message, result.Text, classification.Category,
+		result.Provider, result.Model, result.PromptTokens, result.CompletionTokens, latencyMs, result.FallbackAttempts, result.IsFallback,
+		result.DegradedReason, string(sourcesJSON), result.PromptVersion,
+		classification.Confidence, classification.Method, string(filesJSON), fileScope,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save message"})
@@ -410,12 +675,72 @@ func (h *Handler) SendMessage(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"id":         messageID,
-		"chat_id":    chatID,
-		"message":    req.Message,
-		"response":   response,
-		"category":   req.Category,
-		"created_at": time.Now(),
+		"id":                  messageID,
+		"chat_id":             chatID,
+		"message":             req.Message,
+		"response":            result.Text,
+		"category":            classification.Category,
+		"category_confidence": classification.Confidence,
+		"category_method":     classification.Method,
+		"created_at":          time.Now(),
+		"provider":            result.Provider,
+		"model":               result.Model,
+		"prompt_tokens":       result.PromptTokens,
+		"completion_tokens":   result.CompletionTokens,
+		"latency_ms":          latencyMs,
+		"fallback_attempts":   result.FallbackAttempts,
+		"is_fallback":         result.IsFallback,
+		"source":              result.Source(),
+		"degraded_reason":     result.DegradedReason,
+		"sources":             result.Sources,
+		"prompt_version":      result.PromptVersion,
+		"files":               usedFiles,
+		"file_scope":          fileScope,
+	})
+}
+
+// PreviewPrompt - итоговый промпт для вопроса текущего пользователя (без обращения к модели)
+func (h *Handler) PreviewPrompt(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req models.ChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var username, businessName, specialization string
+	h.db.QueryRow("SELECT username, COALESCE(business_name, '') as business_name, specialization FROM users WHERE id = ?", userID).Scan(&username, &businessName, &specialization)
+
+	files, fileScope, err := h.selectFiles(userID, req.ChatID, req.FileIDs, req.FileFilter)
+	if errors.Is(err, errUnknownFile) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown file id"})
+		return
+	} else if errors.Is(err, errInvalidFilter) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user files"})
+		return
+	}
+
+	// Категория определяется так же, как при отправке сообщения
+	classification := ai.ClassifyQuestion(req.Message, req.Category)
+
+	prompt, version, err := ai.PreviewPrompt(req.Message, classification.Category, username, businessName, specialization, files, h.financialMetrics(userID, files))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render prompt", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"prompt":              prompt,
+		"prompt_version":      version,
+		"category":            classification.Category,
+		"category_confidence": classification.Confidence,
+		"category_method":     classification.Method,
+		"files":               fileRefs(files),
+		"file_scope":          fileScope,
 	})
 }
 
@@ -444,6 +769,12 @@ func (h *Handler) GetUser(c *gin.Context) {
 	var messageCount int
 	h.db.QueryRow("SELECT COUNT(*) FROM messages WHERE user_id = ?", userID).Scan(&messageCount)
 
+	usage, err := h.getUserUsage(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get usage stats"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"user": gin.H{
 			"id":             user.ID,
@@ -454,6 +785,7 @@ func (h *Handler) GetUser(c *gin.Context) {
 		"stats": gin.H{
 			"files_count":    fileCount,
 			"messages_count": messageCount,
+			"usage":          usage,
 		},
 	})
 }
@@ -476,7 +808,13 @@ func (h *Handler) GetChatHistory(c *gin.Context) {
 	}
 
 	rows, err := h.db.Query(
-		"SELECT id, message, response, category, created_at FROM messages WHERE chat_id = ? ORDER BY created_at ASC",
+		`SELECT id, message, response, category, created_at,
+			COALESCE(provider, ''), COALESCE(model, ''), COALESCE(prompt_tokens, 0), COALESCE(completion_tokens, 0),
+			COALESCE(latency_ms, 0), COALESCE(fallback_attempts, 0), COALESCE(is_fallback, 0), COALESCE(degraded_reason, ''),
+			COALESCE(sources, '[]'), COALESCE(prompt_version, ''),
+			COALESCE(category_confidence, 0), COALESCE(category_method, ''),
+			COALESCE(files, '[]'), COALESCE(file_scope, '')
+		FROM messages WHERE chat_id = ? ORDER BY created_at ASC`,
 		chatID,
 	)
 	if err != nil {
@@ -488,9 +826,28 @@ func (h *Handler) GetChatHistory(c *gin.Context) {
 	var messages []models.Message
 	for rows.Next() {
 		var m models.Message
-		if err := rows.Scan(&m.ID, &m.Message, &m.Response, &m.Category, &m.CreatedAt); err != nil {
+		var sourcesJSON, filesJSON string
+		if err := rows.Scan(&m.ID, &m.Message, &m.Response, &m.Category, &m.CreatedAt,
+			&m.Provider, &m.Model, &m.PromptTokens, &m.CompletionTokens,
+			&m.LatencyMs, &m.FallbackAttempts, &m.IsFallback, &m.DegradedReason,
+			&sourcesJSON, &m.PromptVersion, &m.CategoryConfidence, &m.CategoryMethod,
+			&filesJSON, &m.FileScope); err != nil {
 			continue
 		}
+		if err := json.Unmarshal([]byte(sourcesJSON), &m.Sources); err != nil || m.Sources == nil {
+			m.Sources = []models.Source{}
+		}
+		if err := json.Unmarshal([]byte(filesJSON), &m.Files); err != nil || m.Files == nil {
+			m.Files = []models.FileRef{}
+		}
+		// Источник есть только у ответа ассистента. Записи до появления метаданных
+		// генерации (колонки добавлены со значением '') без провайдера - источник неизвестен
+		if m.Response != "" && m.Provider != "" {
+			m.Source = ai.SourceLLM
+			if m.IsFallback {
+				m.Source = ai.SourceTemplate
+			}
+		}
 		m.ChatID = chatID
 		messages = append(messages, m)
 	}
@@ -505,25 +862,20 @@ func (h *Handler) GetChatHistory(c *gin.Context) {
 
 // Вспомогательные функции
 
-func (h *Handler) getUserFiles(userID string) ([]models.File, error) {
-	rows, err := h.db.Query(
-		"SELECT id, filename, file_path, file_type FROM files WHERE user_id = ?",
+// getUserUsage считает суммарное использование AI по всем сообщениям пользователя
+func (h *Handler) getUserUsage(userID string) (models.UsageStats, error) {
+	var usage models.UsageStats
+	err := h.db.QueryRow(
+		`SELECT COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0),
+			COALESCE(SUM(is_fallback), 0), CAST(COALESCE(AVG(latency_ms), 0) AS INTEGER)
+		FROM messages WHERE user_id = ?`,
 		userID,
-	)
+	).Scan(&usage.Messages, &usage.PromptTokens, &usage.CompletionTokens, &usage.FallbackMessages, &usage.AvgLatencyMs)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var files []models.File
-	for rows.Next() {
-		var f models.File
-		if err := rows.Scan(&f.ID, &f.Filename, &f.FilePath, &f.FileType); err != nil {
-			continue
-		}
-		files = append(files, f)
+		return usage, err
 	}
-	return files, nil
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage, nil
 }
 
 func generateToken(userID, username string) string {
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/database"
+	"alfa-hack-backend/internal/storage"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testUserID = "user-1"
+
+// newTestHandler создает обработчик с базой SQLite и локальным хранилищем во временной папке
+// и пользователем testUserID. Фоновые обработчики файлов не запускаются.
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	dir := t.TempDir()
+
+	db, err := database.InitDB(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.CreateTables(db); err != nil {
+		t.Fatalf("CreateTables: %v", err)
+	}
+	store, err := storage.NewLocal(filepath.Join(dir, "uploads"))
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+
+	if _, err := db.Exec(
+		"INSERT INTO users (id, username, password_hash, business_name, specialization) VALUES (?, ?, ?, ?, ?)",
+		testUserID, "owner", "hash", "Кофейня", "кафе",
+	); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return NewHandler(db, store)
+}
+
+// testLimits - лимиты загрузки для тестов: txt и csv, 1 МБ на файл
+func testLimits() uploadLimits {
+	return uploadLimits{
+		MaxFileSize:        1 << 20,
+		MaxUserStorage:     10 << 20,
+		AllowedTypes:       map[string]bool{"txt": true, "csv": true},
+		MaxRequestSize:     10 << 20,
+		MaxFiles:           10,
+		MaxArchiveUnpacked: 5 << 20,
+	}
+}
+
+// serve выполняет запрос к обработчику от имени testUserID; route задает параметры пути, например "/transactions/:id"
+func serve(handler gin.HandlerFunc, method, route, target, body string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Handle(method, route, func(c *gin.Context) {
+		c.Set("user_id", testUserID)
+		handler(c)
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// addTestFile создает запись о файле пользователя без содержимого в хранилище
+func addTestFile(t *testing.T, h *Handler, id, filename string) {
+	t.Helper()
+	if _, err := h.db.Exec(
+		"INSERT INTO files (id, user_id, filename, file_path, file_type, file_size) VALUES (?, ?, ?, ?, ?, ?)",
+		id, testUserID, filename, testUserID+"/"+id+".txt", "txt", 0,
+	); err != nil {
+		t.Fatalf("create file: %v", err)
+	}
+}
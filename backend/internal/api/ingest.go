@@ -0,0 +1,321 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/ai"
+	"alfa-hack-backend/internal/models"
+	"alfa-hack-backend/internal/storage"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Статусы обработки версии файла
+const (
+	ingestQueued     = "queued"
+	ingestProcessing = "processing"
+	ingestDone       = "done"
+	ingestFailed     = "failed"
+)
+
+const (
+	defaultIngestWorkers = 2
+	maxIngestWorkers     = 16
+	// Очередь хранится в таблице ingest_jobs: обработчики просыпаются по сигналу после загрузки,
+	// а на случай пропущенного сигнала еще и периодически проверяют очередь
+	ingestPollInterval = 30 * time.Second
+	// Задание, которое столько раз прервалось перезапуском сервера, больше не возвращается в очередь:
+	// скорее всего, файл роняет процесс при каждой попытке
+	maxIngestAttempts = 3
+)
+
+// ingestWorkersFromEnv читает INGEST_WORKERS - число параллельных обработчиков
+func ingestWorkersFromEnv() int {
+	if value, err := strconv.Atoi(os.Getenv("INGEST_WORKERS")); err == nil && value > 0 {
+		if value > maxIngestWorkers {
+			return maxIngestWorkers
+		}
+		return value
+	}
+	return defaultIngestWorkers
+}
+
+// StartIngestion запускает фоновые обработчики загруженных файлов.
+// Задания, прерванные перезапуском сервера, возвращаются в очередь, если попытки не исчерпаны.
+func (h *Handler) StartIngestion() {
+	if _, err := h.db.Exec(
+		`UPDATE ingest_jobs SET status = ?, error = ?, finished_at = CURRENT_TIMESTAMP WHERE status = ? AND attempts >= ?`,
+		ingestFailed, fmt.Sprintf("processing was interrupted %d times", maxIngestAttempts), ingestProcessing, maxIngestAttempts,
+	); err != nil {
+		log.Printf("Failed to fail repeatedly interrupted ingestion jobs: %v", err)
+	}
+	if _, err := h.db.Exec("UPDATE ingest_jobs SET status = ? WHERE status = ?", ingestQueued, ingestProcessing); err != nil {
+		log.Printf("Failed to requeue interrupted ingestion jobs: %v", err)
+	}
+	// Операции, загруженные до появления категорий
+	go h.categorizeStale()
+
+	workers := ingestWorkersFromEnv()
+	for i := 0; i < workers; i++ {
+		go h.ingestWorker()
+	}
+	log.Printf("File ingestion started with %d workers", workers)
+}
+
+// wakeIngestion сообщает обработчикам, что в очереди появились задания. Не блокирует:
+// если обработчики уже проснулись, они и так заберут новое задание.
+func (h *Handler) wakeIngestion() {
+	select {
+	case h.ingestWake <- struct{}{}:
+	default:
+	}
+}
+
+func (h *Handler) ingestWorker() {
+	ticker := time.NewTicker(ingestPollInterval)
+	defer ticker.Stop()
+	for {
+		for h.processNextIngestJob() {
+		}
+		select {
+		case <-h.ingestWake:
+		case <-ticker.C:
+		}
+	}
+}
+
+type ingestTask struct {
+	ID       string
+	FileID   string
+	Version  int
+	FilePath string
+}
+
+// processNextIngestJob забирает из очереди самое старое задание и выполняет его.
+// Возвращает false, если очередь пуста.
+func (h *Handler) processNextIngestJob() bool {
+	var task ingestTask
+	// Одним запросом: два обработчика не могут забрать одно задание
+	err := h.db.QueryRow(
+		`UPDATE ingest_jobs SET status = ?, started_at = CURRENT_TIMESTAMP, finished_at = NULL, error = '', attempts = attempts + 1
+		WHERE id = (SELECT id FROM ingest_jobs WHERE status = ? ORDER BY created_at LIMIT 1)
+		RETURNING id, file_id, version, file_path`,
+		ingestProcessing, ingestQueued,
+	).Scan(&task.ID, &task.FileID, &task.Version, &task.FilePath)
+	if err == sql.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		log.Printf("Failed to take ingestion job: %v", err)
+		return false
+	}
+
+	h.runIngestJob(task)
+	return true
+}
+
+// runIngestJob разбирает версию файла, сохраняет статистику для промпта и операции
+// банковской выписки, затем определяет вид документа и период.
+// Паника в парсере помечает задание ошибкой, а не роняет сервер.
+func (h *Handler) runIngestJob(task ingestTask) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Panic while processing file %s version %d: %v\n%s", task.FileID, task.Version, r, debug.Stack())
+			h.finishIngestJob(task, nil, fmt.Errorf("panic: %v", r))
+		}
+	}()
+
+	file, err := h.findFile("id = ?", task.FileID)
+	if err != nil {
+		h.finishIngestJob(task, nil, err)
+		return
+	}
+	if file == nil {
+		// Файл удален, пока задание ждало очереди
+		h.db.Exec("DELETE FROM ingest_jobs WHERE id = ?", task.ID)
+		return
+	}
+	isCurrent := file.PinnedVersion == task.Version || (file.PinnedVersion == 0 && file.Version == task.Version)
+	file.FilePath = task.FilePath
+
+	// Разобранный документ попадает в кеш; повторная загрузка того же содержимого берется из него
+	doc, err := ai.LoadDocument(*file)
+	if errors.Is(err, storage.ErrNotFound) {
+		err = errors.New("file content not found in storage")
+	}
+	if err != nil {
+		h.finishIngestJob(task, nil, err)
+		return
+	}
+
+	// Операции банковской выписки, кассовые чеки, отчеты маркетплейсов, документы ЭДО и сотрудники сохраняются
+	// отдельно (GET /api/transactions, /api/receipts, /api/marketplace/skus, /api/edo/documents, /api/payroll/employees)
+	extraction := ai.NewExtraction(*file, doc)
+	if err := h.importStatement(context.Background(), file.UserID, task); err != nil {
+		log.Printf("Failed to import bank statement from file %s version %d: %v", task.FileID, task.Version, err)
+		extraction.Warnings = append(extraction.Warnings, "Не удалось сохранить операции выписки: "+err.Error())
+	}
+	if err := h.importReceipts(context.Background(), file.UserID, task); err != nil {
+		log.Printf("Failed to import receipts from file %s version %d: %v", task.FileID, task.Version, err)
+		extraction.Warnings = append(extraction.Warnings, "Не удалось сохранить чеки: "+err.Error())
+	}
+	if err := h.importMarketplaceReport(context.Background(), file.UserID, task); err != nil {
+		log.Printf("Failed to import marketplace report from file %s version %d: %v", task.FileID, task.Version, err)
+		extraction.Warnings = append(extraction.Warnings, "Не удалось сохранить отчет маркетплейса: "+err.Error())
+	}
+	if err := h.importEDODocument(context.Background(), file.UserID, task); err != nil {
+		log.Printf("Failed to import EDO document from file %s version %d: %v", task.FileID, task.Version, err)
+		extraction.Warnings = append(extraction.Warnings, "Не удалось сохранить документ ЭДО: "+err.Error())
+	}
+	if err := h.importStaff(context.Background(), file.UserID, task); err != nil {
+		log.Printf("Failed to import staff list from file %s version %d: %v", task.FileID, task.Version, err)
+		extraction.Warnings = append(extraction.Warnings, "Не удалось сохранить список сотрудников: "+err.Error())
+	}
+
+	if !h.finishIngestJob(task, extraction, nil) {
+		return
+	}
+	if isCurrent {
+		if err := h.detectFileMeta(file.ID); err != nil {
+			log.Printf("Failed to detect document kind for file %s: %v", file.ID, err)
+		}
+	}
+}
+
+// finishIngestJob записывает результат задания. Возвращает false, если задание
+// за время обработки было удалено вместе с файлом.
+func (h *Handler) finishIngestJob(task ingestTask, extraction *ai.Extraction, jobErr error) bool {
+	var result sql.Result
+	var err error
+	if jobErr != nil {
+		log.Printf("Failed to process file %s version %d: %v", task.FileID, task.Version, jobErr)
+		result, err = h.db.Exec(
+			`UPDATE ingest_jobs SET status = ?, error = ?, warnings = '[]', total_chars = 0, included_chars = 0, chunks = 0,
+			truncated = 0, finished_at = CURRENT_TIMESTAMP WHERE id = ?`,
+			ingestFailed, jobErr.Error(), task.ID,
+		)
+	} else {
+		warnings, _ := json.Marshal(extraction.Warnings)
+		result, err = h.db.Exec(
+			`UPDATE ingest_jobs SET status = ?, error = '', warnings = ?, total_chars = ?, included_chars = ?, chunks = ?,
+			truncated = ?, finished_at = CURRENT_TIMESTAMP WHERE id = ?`,
+			ingestDone, string(warnings), extraction.TotalChars, extraction.IncludedChars, extraction.Chunks,
+			extraction.Truncated, task.ID,
+		)
+	}
+	if err != nil {
+		log.Printf("Failed to save ingestion result for file %s: %v", task.FileID, err)
+		return false
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		// Файл удалили во время обработки
+		return false
+	}
+	return true
+}
+
+// getIngestJob возвращает задание обработки версии файла; nil, если его нет
+func (h *Handler) getIngestJob(fileID string, version int) (*models.IngestJob, error) {
+	var job models.IngestJob
+	var warnings string
+	var startedAt, finishedAt sql.NullTime
+	err := h.db.QueryRow(
+		`SELECT file_id, version, status, COALESCE(error, ''), COALESCE(warnings, '[]'), total_chars, included_chars,
+		chunks, truncated, attempts, created_at, started_at, finished_at
+		FROM ingest_jobs WHERE file_id = ? AND version = ?`,
+		fileID, version,
+	).Scan(&job.FileID, &job.Version, &job.Status, &job.Error, &warnings, &job.TotalChars, &job.IncludedChars,
+		&job.Chunks, &job.Truncated, &job.Attempts, &job.CreatedAt, &startedAt, &finishedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(warnings), &job.Warnings); err != nil || job.Warnings == nil {
+		job.Warnings = []string{}
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
+
+// GetFileStatus - статус обработки файла (последняя версия или ?version=N) и ошибки разбора
+func (h *Handler) GetFileStatus(c *gin.Context) {
+	file := h.userFileFromParam(c)
+	if file == nil {
+		return
+	}
+	version := h.fileVersionFromQuery(c, file, false)
+	if version == nil {
+		return
+	}
+
+	job, err := h.getIngestJob(file.ID, version.Version)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Processing job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// ReprocessFile - повторная обработка версии файла (например, после ошибки чтения из хранилища)
+func (h *Handler) ReprocessFile(c *gin.Context) {
+	file := h.userFileFromParam(c)
+	if file == nil {
+		return
+	}
+	version := h.fileVersionFromQuery(c, file, false)
+	if version == nil {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+	// Документ разбираем заново, а не берем из кеша
+	_, err = tx.Exec("DELETE FROM parsed_cache WHERE sha256 = ?", version.SHA256)
+	if err == nil {
+		_, err = tx.Exec(
+			`UPDATE ingest_jobs SET status = ?, error = '', warnings = '[]', total_chars = 0, included_chars = 0, chunks = 0,
+			truncated = 0, attempts = 0, created_at = CURRENT_TIMESTAMP, started_at = NULL, finished_at = NULL
+			WHERE file_id = ? AND version = ? AND status != ?`,
+			ingestQueued, file.ID, version.Version, ingestProcessing,
+		)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue file processing"})
+		return
+	}
+	h.wakeIngestion()
+
+	job, err := h.getIngestJob(file.ID, version.Version)
+	if err != nil || job == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
@@ -0,0 +1,347 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/ai"
+	"alfa-hack-backend/internal/marketplace"
+	"alfa-hack-backend/internal/storage"
+	"alfa-hack-backend/internal/xlsx"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// marketplaceMetricsDays - за сколько последних дней отчеты маркетплейсов попадают в промпт
+const marketplaceMetricsDays = 30
+
+// importMarketplaceReport разбирает отчет маркетплейса из версии файла и сохраняет итоги по артикулам
+// вместо сохраненных раньше. Для файлов, которые не являются отчетом, только удаляет старые итоги.
+func (h *Handler) importMarketplaceReport(ctx context.Context, userID string, task ingestTask) error {
+	var report *marketplace.Report
+	if marketplace.IsReportType(strings.TrimPrefix(strings.ToLower(path.Ext(task.FilePath)), ".")) {
+		data, err := storage.ReadAll(ctx, h.store, task.FilePath)
+		if err != nil {
+			return err
+		}
+		// Книгу, которая не читается, не считаем отчетом: ошибку разбора покажет обработка файла
+		if wb, err := xlsx.Read(data); err == nil {
+			report, err = marketplace.Parse(wb)
+			if err != nil && !errors.Is(err, marketplace.ErrUnknownFormat) {
+				return err
+			}
+		}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM marketplace_sales WHERE file_id = ? AND version = ?", task.FileID, task.Version); err != nil {
+		return err
+	}
+	if report == nil {
+		return tx.Commit()
+	}
+
+	dateFrom, dateTo := sqlDate(report.DateFrom), sqlDate(report.DateTo)
+	for _, sku := range report.SKUs() {
+		_, err := tx.Exec(
+			`INSERT INTO marketplace_sales (user_id, file_id, version, marketplace, date_from, date_to, sku, article, name,
+			sold, returned, revenue, commission, logistics, penalties, storage, other, payout, fingerprint)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			userID, task.FileID, task.Version, report.Marketplace, dateFrom, dateTo, sku.SKU, sku.Article, sku.Name,
+			sku.Sold, sku.Returned, sku.Revenue, sku.Commission, sku.Logistics, sku.Penalties, sku.Storage, sku.Other,
+			sku.Payout, marketplaceFingerprint(report.Marketplace, dateFrom, dateTo, sku.SKU),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// marketplaceFingerprint - отпечаток артикула в отчете: один и тот же отчет, загруженный в двух файлах,
+// учитывается один раз
+func marketplaceFingerprint(name, dateFrom, dateTo, sku string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{name, dateFrom, dateTo, sku}, "|")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// marketplacePeriod возвращает период отчета маркетплейса из версии файла; ok=false, если версия не отчет
+func (h *Handler) marketplacePeriod(fileID string, version int) (from, to time.Time, ok bool, err error) {
+	var count int
+	var dateFrom, dateTo string
+	err = h.db.QueryRow(
+		`SELECT COUNT(*), COALESCE(MIN(NULLIF(date_from, '')), ''), COALESCE(MAX(NULLIF(date_to, '')), '')
+		FROM marketplace_sales WHERE file_id = ? AND version = ?`,
+		fileID, version,
+	).Scan(&count, &dateFrom, &dateTo)
+	if err != nil || count == 0 {
+		return from, to, false, err
+	}
+	from, _ = time.Parse("2006-01-02", dateFrom)
+	to, _ = time.Parse("2006-01-02", dateTo)
+	return from, to, true, nil
+}
+
+// currentMarketplaceSales - итоги по артикулам из текущих (закрепленных или последних) версий файлов
+// пользователя без повторов одного отчета. Первый аргумент запроса - id пользователя.
+const currentMarketplaceSales = `WITH current AS (
+	SELECT m.* FROM marketplace_sales m JOIN files f ON f.id = m.file_id
+	WHERE f.user_id = ? AND m.version = CASE WHEN COALESCE(f.pinned_version, 0) > 0 THEN f.pinned_version ELSE f.version END
+), sales AS (
+	SELECT * FROM current WHERE id IN (SELECT MIN(id) FROM current GROUP BY fingerprint)
+) `
+
+// marketplaceWhere строит условие SQL для отбора отчетов, которые пересекаются с периодом
+// (YYYY-MM-DD, включительно), по маркетплейсу и файлам (nil - все)
+func marketplaceWhere(from, to, name string, fileIDs []string) (string, []interface{}) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+	if from != "" {
+		conditions = append(conditions, "date_to >= ?")
+		args = append(args, from)
+	}
+	if to != "" {
+		conditions = append(conditions, "date_from <= ?")
+		args = append(args, to)
+	}
+	if name != "" {
+		conditions = append(conditions, "marketplace = ?")
+		args = append(args, name)
+	}
+	if fileIDs != nil {
+		placeholders := make([]string, len(fileIDs))
+		for i, id := range fileIDs {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		conditions = append(conditions, "file_id IN ("+strings.Join(append(placeholders, "NULL"), ", ")+")")
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// loadMarketplaceSummary складывает итоги отчетов по артикулам; период итогов - от начала
+// первого до конца последнего из отобранных отчетов
+func (h *Handler) loadMarketplaceSummary(userID, from, to, name string, fileIDs []string) (marketplace.Summary, error) {
+	where, args := marketplaceWhere(from, to, name, fileIDs)
+	rows, err := h.db.Query(
+		currentMarketplaceSales+`SELECT marketplace, date_from, date_to, sku, article, name, sold, returned, revenue,
+		commission, logistics, penalties, storage, other, payout FROM sales WHERE `+where+` ORDER BY id`,
+		append([]interface{}{userID}, args...)...,
+	)
+	if err != nil {
+		return marketplace.Summary{}, err
+	}
+	defer rows.Close()
+
+	var skus []marketplace.SKU
+	var dateFrom, dateTo string
+	for rows.Next() {
+		var s marketplace.SKU
+		var reportFrom, reportTo string
+		if err := rows.Scan(&s.Marketplace, &reportFrom, &reportTo, &s.SKU, &s.Article, &s.Name, &s.Sold, &s.Returned,
+			&s.Revenue, &s.Commission, &s.Logistics, &s.Penalties, &s.Storage, &s.Other, &s.Payout); err != nil {
+			return marketplace.Summary{}, err
+		}
+		skus = append(skus, s)
+		if reportFrom != "" && (dateFrom == "" || reportFrom < dateFrom) {
+			dateFrom = reportFrom
+		}
+		if reportTo > dateTo {
+			dateTo = reportTo
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return marketplace.Summary{}, err
+	}
+	summary := marketplace.Summarize(skus)
+	summary.DateFrom, _ = time.Parse("2006-01-02", dateFrom)
+	summary.DateTo, _ = time.Parse("2006-01-02", dateTo)
+	return summary, nil
+}
+
+// marketplaceMetrics - итоги отчетов маркетплейсов среди файлов за последние 30 дней до конца
+// последнего отчета; nil, если отчетов нет
+func (h *Handler) marketplaceMetrics(userID string, fileIDs []string) *ai.MarketplaceMetrics {
+	where, args := marketplaceWhere("", "", "", fileIDs)
+	var last string
+	err := h.db.QueryRow(
+		currentMarketplaceSales+`SELECT COALESCE(MAX(date_to), '') FROM sales WHERE `+where,
+		append([]interface{}{userID}, args...)...,
+	).Scan(&last)
+	if err != nil {
+		log.Printf("Failed to compute marketplace metrics for user %s: %v", userID, err)
+		return nil
+	}
+	to, err := time.Parse("2006-01-02", last)
+	if err != nil {
+		return nil
+	}
+	from := to.AddDate(0, 0, -(marketplaceMetricsDays - 1))
+	summary, err := h.loadMarketplaceSummary(userID, sqlDate(from), last, "", fileIDs)
+	if err != nil {
+		log.Printf("Failed to compute marketplace metrics for user %s: %v", userID, err)
+		return nil
+	}
+	if len(summary.Marketplaces) == 0 {
+		return nil
+	}
+	return &ai.MarketplaceMetrics{Summary: summary}
+}
+
+// bindMarketplace читает маркетплейс из параметров запроса; при ошибке отвечает 400
+func bindMarketplace(c *gin.Context) (string, bool) {
+	name := strings.ToLower(strings.TrimSpace(c.Query("marketplace")))
+	if _, known := marketplace.Names[name]; name != "" && !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "marketplace must be wildberries or ozon"})
+		return "", false
+	}
+	return name, true
+}
+
+// marketplaceSKUJSON - юнит-экономика артикула в ответе API
+func marketplaceSKUJSON(s marketplace.SKU) gin.H {
+	issues := s.Issues()
+	if issues == nil {
+		issues = []string{}
+	}
+	return gin.H{
+		"marketplace":     s.Marketplace,
+		"sku":             s.SKU,
+		"article":         s.Article,
+		"name":            s.Name,
+		"sold":            s.Sold,
+		"returned":        s.Returned,
+		"units":           s.Units(),
+		"return_rate":     s.ReturnRate(),
+		"revenue":         rubles(s.Revenue),
+		"commission":      rubles(s.Commission),
+		"logistics":       rubles(s.Logistics),
+		"penalties":       rubles(s.Penalties),
+		"storage":         rubles(s.Storage),
+		"other":           rubles(s.Other),
+		"payout":          rubles(s.Payout),
+		"payout_per_unit": rubles(s.PayoutPerUnit()),
+		"issues":          issues,
+	}
+}
+
+// marketplaceSKUOrder - сортировки артикулов
+var marketplaceSKUOrder = map[string]func(a, b marketplace.SKU) bool{
+	"payout":      func(a, b marketplace.SKU) bool { return a.Payout > b.Payout },
+	"revenue":     func(a, b marketplace.SKU) bool { return a.Revenue > b.Revenue },
+	"sold":        func(a, b marketplace.SKU) bool { return a.Sold > b.Sold },
+	"return_rate": func(a, b marketplace.SKU) bool { return a.ReturnRate() > b.ReturnRate() },
+	"unit_payout": func(a, b marketplace.SKU) bool { return a.PayoutPerUnit() > b.PayoutPerUnit() },
+}
+
+// GetMarketplaceSKUs - юнит-экономика по артикулам из отчетов маркетплейсов с итогами: выручка,
+// удержания, чистая выплата и процент возвратов (?marketplace=wildberries|ozon, from=&to= или period=2025-03,
+// sort=payout|revenue|sold|return_rate|unit_payout, issues=true - только артикулы с проблемами)
+func (h *Handler) GetMarketplaceSKUs(c *gin.Context) {
+	name, ok := bindMarketplace(c)
+	if !ok {
+		return
+	}
+	from, to, ok := bindPeriod(c)
+	if !ok {
+		return
+	}
+	order, known := marketplaceSKUOrder[c.DefaultQuery("sort", "payout")]
+	if !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be payout, revenue, sold, return_rate or unit_payout"})
+		return
+	}
+	onlyIssues, _ := strconv.ParseBool(c.Query("issues"))
+
+	s, err := h.loadMarketplaceSummary(c.GetString("user_id"), from, to, name, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	sort.SliceStable(s.SKUs, func(i, j int) bool { return order(s.SKUs[i], s.SKUs[j]) })
+	skus := []gin.H{}
+	for _, sku := range s.SKUs {
+		if onlyIssues && len(sku.Issues()) == 0 {
+			continue
+		}
+		skus = append(skus, marketplaceSKUJSON(sku))
+	}
+	marketplaces := s.Marketplaces
+	if marketplaces == nil {
+		marketplaces = []string{}
+	}
+
+	response := gin.H{
+		"marketplaces": marketplaces,
+		"date_from":    sqlDate(s.DateFrom),
+		"date_to":      sqlDate(s.DateTo),
+		"sold":         s.Sold,
+		"returned":     s.Returned,
+		"return_rate":  s.ReturnRate(),
+		"revenue":      rubles(s.Revenue),
+		"commission":   rubles(s.Commission),
+		"logistics":    rubles(s.Logistics),
+		"penalties":    rubles(s.Penalties),
+		"storage":      rubles(s.Storage),
+		"other":        rubles(s.Other),
+		"payout":       rubles(s.Payout),
+		"unallocated":  rubles(s.Unallocated),
+		"skus":         skus,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetMarketplaceReports - загруженные отчеты маркетплейсов: период, продажи, возвраты и выплата
+// (?marketplace=wildberries|ozon)
+func (h *Handler) GetMarketplaceReports(c *gin.Context) {
+	name, ok := bindMarketplace(c)
+	if !ok {
+		return
+	}
+	where, args := marketplaceWhere("", "", name, nil)
+	rows, err := h.db.Query(
+		currentMarketplaceSales+`SELECT s.file_id, f.filename, s.marketplace, s.date_from, s.date_to,
+		SUM(CASE WHEN s.sku != '' THEN 1 ELSE 0 END), SUM(s.sold), SUM(s.returned), SUM(s.revenue), SUM(s.payout)
+		FROM sales s JOIN files f ON f.id = s.file_id WHERE `+where+`
+		GROUP BY s.file_id, s.marketplace, s.date_from, s.date_to ORDER BY s.date_to DESC, f.filename`,
+		append([]interface{}{c.GetString("user_id")}, args...)...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	reports := []gin.H{}
+	for rows.Next() {
+		var fileID, filename, market, dateFrom, dateTo string
+		var skus, sold, returned int
+		var revenue, payout int64
+		if err := rows.Scan(&fileID, &filename, &market, &dateFrom, &dateTo, &skus, &sold, &returned, &revenue, &payout); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		rate := 0.0
+		if sold > 0 {
+			rate = float64(returned) / float64(sold)
+		}
+		reports = append(reports, gin.H{
+			"file_id": fileID, "filename": filename, "marketplace": market, "date_from": dateFrom, "date_to": dateTo,
+			"skus": skus, "sold": sold, "returned": returned, "return_rate": rate, "revenue": rubles(revenue),
+			"payout": rubles(payout),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"reports": reports})
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/ai"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler хранит кеш разобранных документов в таблице parsed_cache (реализует ai.DocumentCache).
+// Документ зависит только от содержимого файла, его расширения (по нему выбирается парсер) и версии
+// парсера, поэтому одинаковые файлы разных пользователей и восстановленные версии разбираются один раз.
+
+// ContentHash возвращает SHA-256 версии файла по ключу в хранилище
+func (h *Handler) ContentHash(key string) string {
+	var hash string
+	err := h.db.QueryRow(
+		"SELECT sha256 FROM file_versions WHERE file_path = ? AND COALESCE(sha256, '') != '' LIMIT 1",
+		key,
+	).Scan(&hash)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get content hash for %s: %v", key, err)
+	}
+	return hash
+}
+
+// GetDocument возвращает документ из кеша
+func (h *Handler) GetDocument(hash, ext, parserVersion string) (*ai.Document, bool) {
+	var data string
+	err := h.db.QueryRow(
+		"SELECT document FROM parsed_cache WHERE sha256 = ? AND ext = ? AND parser_version = ?",
+		hash, ext, parserVersion,
+	).Scan(&data)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to load parsed document %s: %v", hash, err)
+		}
+		return nil, false
+	}
+	var doc ai.Document
+	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+		log.Printf("Failed to decode parsed document %s: %v", hash, err)
+		return nil, false
+	}
+	return &doc, true
+}
+
+// PutDocument сохраняет разобранный документ в кеш
+func (h *Handler) PutDocument(hash, ext, parserVersion string, doc *ai.Document) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	_, err = h.db.Exec(
+		"INSERT OR REPLACE INTO parsed_cache (sha256, ext, parser_version, document, size) VALUES (?, ?, ?, ?, ?)",
+		hash, ext, parserVersion, string(data), len(data),
+	)
+	return err
+}
+
+// PruneParseCache удаляет документы, разобранные другой версией парсера. Вызывается при запуске.
+func (h *Handler) PruneParseCache() {
+	result, err := h.db.Exec("DELETE FROM parsed_cache WHERE parser_version != ?", ai.ParserVersion)
+	if err != nil {
+		log.Printf("Failed to prune parsed documents cache: %v", err)
+		return
+	}
+	if removed, _ := result.RowsAffected(); removed > 0 {
+		log.Printf("Parser version changed to %s: removed %d cached documents", ai.ParserVersion, removed)
+	}
+}
+
+// GetParseCacheStats - попадания и промахи кеша разобранных документов и его размер
+func (h *Handler) GetParseCacheStats(c *gin.Context) {
+	var entries int
+	var size sql.NullInt64
+	err := h.db.QueryRow(
+		"SELECT COUNT(*), SUM(size) FROM parsed_cache WHERE parser_version = ?",
+		ai.ParserVersion,
+	).Scan(&entries, &size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cache":      ai.GetCacheStats(),
+		"entries":    entries,
+		"size_bytes": size.Int64,
+	})
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/ai"
+	"net/http"
+	"testing"
+)
+
+func cachedVersions(t *testing.T, h *Handler, hash string) []string {
+	t.Helper()
+	rows, err := h.db.Query("SELECT ext || '/' || parser_version FROM parsed_cache WHERE sha256 = ? ORDER BY ext, parser_version", hash)
+	if err != nil {
+		t.Fatalf("read parsed_cache: %v", err)
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key string
+		rows.Scan(&key)
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Одинаковое содержимое разбирается один раз; документ ищется по SHA-256, расширению и версии парсера
+func TestParseCache(t *testing.T) {
+	h := newTestHandler(t)
+	ai.SetStorage(h.store)
+	ai.SetDocumentCache(h)
+	t.Cleanup(func() {
+		ai.SetStorage(nil)
+		ai.SetDocumentCache(nil)
+	})
+
+	const content = "Месяц;Выручка\nМарт;100\n"
+	firstID, _ := uploadText(t, h, "март.csv", "", content)
+	copyID, _ := uploadText(t, h, "копия.csv", "Архив", content)
+	first, _ := h.findFile("id = ?", firstID)
+	copied, _ := h.findFile("id = ?", copyID)
+	hash := h.ContentHash(first.FilePath)
+	if hash == "" || h.ContentHash(copied.FilePath) != hash {
+		t.Fatalf("content hashes %q and %q, want equal", hash, h.ContentHash(copied.FilePath))
+	}
+	if h.ContentHash("user-1/unknown.csv") != "" {
+		t.Error("unknown key has a content hash")
+	}
+
+	before := ai.GetCacheStats()
+	doc, err := ai.LoadDocument(*first)
+	if err != nil {
+		t.Fatalf("LoadDocument: %v", err)
+	}
+	if _, err := ai.LoadDocument(*copied); err != nil {
+		t.Fatalf("LoadDocument: %v", err)
+	}
+	if after := ai.GetCacheStats(); after.Misses-before.Misses != 1 || after.Hits-before.Hits != 1 {
+		t.Errorf("misses +%d, hits +%d; want one of each", after.Misses-before.Misses, after.Hits-before.Hits)
+	}
+	if got := cachedVersions(t, h, hash); len(got) != 1 || got[0] != "csv/"+ai.ParserVersion {
+		t.Errorf("cached %v, want csv/%s", got, ai.ParserVersion)
+	}
+
+	if cached, ok := h.GetDocument(hash, "csv", ai.ParserVersion); !ok || len(cached.Sections) != len(doc.Sections) {
+		t.Errorf("GetDocument = %+v, %v", cached, ok)
+	}
+	for _, key := range [][2]string{{"txt", ai.ParserVersion}, {"csv", "0"}} {
+		if _, ok := h.GetDocument(hash, key[0], key[1]); ok {
+			t.Errorf("GetDocument(%s, %s) hit", key[0], key[1])
+		}
+	}
+
+	// При запуске удаляются документы, разобранные другой версией парсера
+	if err := h.PutDocument(hash, "txt", "0", doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.PutDocument("other", "csv", "0", doc); err != nil {
+		t.Fatal(err)
+	}
+	h.PruneParseCache()
+	var entries int
+	h.db.QueryRow("SELECT COUNT(*) FROM parsed_cache").Scan(&entries)
+	if got := cachedVersions(t, h, hash); entries != 1 || len(got) != 1 || got[0] != "csv/"+ai.ParserVersion {
+		t.Errorf("after prune: %d entries, %v for the file", entries, got)
+	}
+
+	// Повторная обработка разбирает файл заново
+	if w := serve(h.ReprocessFile, http.MethodPost, "/files/:id/reprocess", "/files/"+firstID+"/reprocess", ""); w.Code != http.StatusAccepted {
+		t.Fatalf("reprocess: status %d: %s", w.Code, w.Body.String())
+	}
+	if got := cachedVersions(t, h, hash); len(got) != 0 {
+		t.Errorf("after reprocess cached %v", got)
+	}
+	before = ai.GetCacheStats()
+	if _, err := ai.LoadDocument(*copied); err != nil {
+		t.Fatalf("LoadDocument: %v", err)
+	}
+	if after := ai.GetCacheStats(); after.Misses-before.Misses != 1 {
+		t.Errorf("document after reprocess was not parsed again")
+	}
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/ai"
+	"alfa-hack-backend/internal/payroll"
+	"alfa-hack-backend/internal/storage"
+	"alfa-hack-backend/internal/xlsx"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// importStaff разбирает список сотрудников из версии файла и сохраняет сотрудников вместо
+// сохраненных раньше. Для файлов без таблицы сотрудников только удаляет старые записи.
+func (h *Handler) importStaff(ctx context.Context, userID string, task ingestTask) error {
+	var staff *payroll.Staff
+	fileType := strings.TrimPrefix(strings.ToLower(path.Ext(task.FilePath)), ".")
+	if payroll.IsStaffType(fileType) {
+		data, err := storage.ReadAll(ctx, h.store, task.FilePath)
+		if err != nil {
+			return err
+		}
+		if fileType == "xlsx" {
+			// Книгу, которая не читается, не считаем списком сотрудников: ошибку разбора покажет обработка файла
+			if wb, err := xlsx.Read(data); err == nil {
+				staff, err = payroll.ParseWorkbook(wb)
+				if err != nil && !errors.Is(err, payroll.ErrUnknownFormat) {
+					return err
+				}
+			}
+		} else {
+			staff, err = payroll.ParseText(data)
+			if err != nil && !errors.Is(err, payroll.ErrUnknownFormat) {
+				return err
+			}
+		}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM employees WHERE file_id = ? AND version = ?", task.FileID, task.Version); err != nil {
+		return err
+	}
+	if staff == nil {
+		return tx.Commit()
+	}
+	for _, e := range staff.Employees {
+		_, err := tx.Exec(
+			`INSERT INTO employees (user_id, file_id, version, name, position, salary, hire_date, fire_date, fingerprint)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			userID, task.FileID, task.Version, e.Name, e.Position, e.Salary, sqlDate(e.HireDate), sqlDate(e.FireDate),
+			employeeFingerprint(e),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// employeeFingerprint - отпечаток сотрудника по ФИО: один сотрудник из нескольких кадровых файлов
+// учитывается один раз
+func employeeFingerprint(e payroll.Employee) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(e.Name, "ё", "е")), " "))))
+	return hex.EncodeToString(sum[:16])
+}
+
+// hasStaff - в версии файла есть список сотрудников
+func (h *Handler) hasStaff(fileID string, version int) (bool, error) {
+	var count int
+	err := h.db.QueryRow("SELECT COUNT(*) FROM employees WHERE file_id = ? AND version = ?", fileID, version).Scan(&count)
+	return count > 0, err
+}
+
+// currentEmployees - сотрудники из текущих (закрепленных или последних) версий файлов пользователя.
+// Сотрудник из нескольких файлов берется из последнего загруженного: он точнее отражает оклад
+// и увольнение. Первый аргумент запроса - id пользователя.
+const currentEmployees = `WITH current AS (
+	SELECT e.* FROM employees e JOIN files f ON f.id = e.file_id
+	WHERE f.user_id = ? AND e.version = CASE WHEN COALESCE(f.pinned_version, 0) > 0 THEN f.pinned_version ELSE f.version END
+), staff AS (
+	SELECT * FROM current WHERE id IN (SELECT MAX(id) FROM current GROUP BY fingerprint)
+) `
+
+// storedEmployee - сотрудник и файл, из которого он взят
+type storedEmployee struct {
+	payroll.Employee
+	ID       int64
+	FileID   string
+	Filename string
+}
+
+// loadEmployees загружает сотрудников пользователя из файлов (nil - из всех) по ФИО
+func (h *Handler) loadEmployees(userID string, fileIDs []string) ([]storedEmployee, error) {
+	where := "1 = 1"
+	args := []interface{}{userID}
+	if fileIDs != nil {
+		placeholders := make([]string, len(fileIDs))
+		for i, id := range fileIDs {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		where = "s.file_id IN (" + strings.Join(append(placeholders, "NULL"), ", ") + ")"
+	}
+	rows, err := h.db.Query(
+		currentEmployees+`SELECT s.id, s.file_id, f.filename, s.name, s.position, s.salary, s.hire_date, s.fire_date
+		FROM staff s JOIN files f ON f.id = s.file_id WHERE `+where+` ORDER BY s.name, s.id`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []storedEmployee
+	for rows.Next() {
+		var e storedEmployee
+		var hire, fire string
+		if err := rows.Scan(&e.ID, &e.FileID, &e.Filename, &e.Name, &e.Position, &e.Salary, &hire, &fire); err != nil {
+			return nil, err
+		}
+		e.HireDate, _ = time.Parse("2006-01-02", hire)
+		e.FireDate, _ = time.Parse("2006-01-02", fire)
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+// payrollSettings - условия работодателя из профиля бизнеса: субъект МСП, приоритетная отрасль
+// и тариф на травматизм. Если профиль не прочитан, используются условия по умолчанию.
+func (h *Handler) payrollSettings(userID string) payroll.Settings {
+	settings := payroll.DefaultSettings
+	err := h.db.QueryRow(
+		"SELECT COALESCE(payroll_sme, 1), COALESCE(payroll_priority, 0), COALESCE(injury_rate, ?) FROM users WHERE id = ?",
+		payroll.DefaultInjuryPct, userID,
+	).Scan(&settings.SME, &settings.Priority, &settings.InjuryPct)
+	if err != nil {
+		log.Printf("Failed to load payroll settings for user %s: %v", userID, err)
+		return payroll.DefaultSettings
+	}
+	return settings
+}
+
+// payrollMetrics - зарплата сотрудников из файлов за текущий месяц; nil, если сотрудников нет
+func (h *Handler) payrollMetrics(userID string, fileIDs []string) *ai.PayrollMetrics {
+	stored, err := h.loadEmployees(userID, fileIDs)
+	if err != nil {
+		log.Printf("Failed to compute payroll metrics for user %s: %v", userID, err)
+		return nil
+	}
+	if len(stored) == 0 {
+		return nil
+	}
+	employees := make([]payroll.Employee, len(stored))
+	for i, e := range stored {
+		employees[i] = e.Employee
+	}
+	p := payroll.Month(employees, time.Now(), h.payrollSettings(userID))
+	if len(p.Employees) == 0 {
+		return nil
+	}
+	return &ai.PayrollMetrics{Payroll: p}
+}
+
+// GetEmployees - сотрудники из кадровых файлов: ФИО, должность, оклад, даты приема и увольнения
+func (h *Handler) GetEmployees(c *gin.Context) {
+	stored, err := h.loadEmployees(c.GetString("user_id"), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	employees := []gin.H{}
+	for _, e := range stored {
+		employees = append(employees, gin.H{
+			"id": e.ID, "file_id": e.FileID, "filename": e.Filename, "name": e.Name, "position": e.Position,
+			"salary": rubles(e.Salary), "hire_date": sqlDate(e.HireDate), "fire_date": sqlDate(e.FireDate),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"employees": employees})
+}
+
+// payrollTotals - суммы расчета зарплаты в ответе API
+func payrollTotals(gross, ndfl, net, contributions, injury, cost int64) gin.H {
+	return gin.H{
+		"gross": rubles(gross), "ndfl": rubles(ndfl), "net": rubles(net), "contributions": rubles(contributions),
+		"injury": rubles(injury), "cost": rubles(cost),
+	}
+}
+
+// GetPayroll - расчет зарплаты по месяцам периода (?period=2025-03|2025-Q1|2025, по умолчанию текущий месяц):
+// начислено, НДФЛ, на руки, страховые взносы и стоимость для работодателя по месяцам и по сотрудникам
+func (h *Handler) GetPayroll(c *gin.Context) {
+	period := c.DefaultQuery("period", time.Now().Format("2006-01"))
+	start, end, err := ai.ParsePeriod(period)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, _ := time.Parse("2006-01-02", start)
+	to, _ := time.Parse("2006-01-02", end)
+
+	stored, err := h.loadEmployees(c.GetString("user_id"), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	employees := make([]payroll.Employee, len(stored))
+	for i, e := range stored {
+		employees[i] = e.Employee
+	}
+	settings := h.payrollSettings(c.GetString("user_id"))
+
+	months := []gin.H{}
+	var total payroll.MonthCost
+	byEmployee := make(map[string]*payroll.MonthCost)
+	var order []string
+	exact := true
+	for month := from; !month.After(to); month = month.AddDate(0, 1, 0) {
+		p := payroll.Month(employees, month, settings)
+		exact = exact && p.ExactRates
+		entry := payrollTotals(p.Gross, p.NDFL, p.Net, p.Contributions, p.Injury, p.Cost)
+		entry["month"] = month.Format("2006-01")
+		entry["employees"] = len(p.Employees)
+		months = append(months, entry)
+		for _, cost := range p.Employees {
+			sum, ok := byEmployee[cost.Employee.Name]
+			if !ok {
+				sum = &payroll.MonthCost{Employee: cost.Employee}
+				byEmployee[cost.Employee.Name] = sum
+				order = append(order, cost.Employee.Name)
+			}
+			for _, s := range []*payroll.MonthCost{sum, &total} {
+				s.Gross += cost.Gross
+				s.NDFL += cost.NDFL
+				s.Net += cost.Net
+				s.Contributions += cost.Contributions
+				s.Injury += cost.Injury
+				s.Cost += cost.Cost
+			}
+		}
+	}
+
+	result := []gin.H{}
+	for _, name := range order {
+		sum := byEmployee[name]
+		entry := payrollTotals(sum.Gross, sum.NDFL, sum.Net, sum.Contributions, sum.Injury, sum.Cost)
+		entry["name"] = sum.Employee.Name
+		entry["position"] = sum.Employee.Position
+		entry["salary"] = rubles(sum.Employee.Salary)
+		result = append(result, entry)
+	}
+	rates, _ := payroll.RatesFor(from.Year())
+	response := payrollTotals(total.Gross, total.NDFL, total.Net, total.Contributions, total.Injury, total.Cost)
+	response["period"] = period
+	response["months"] = months
+	response["employees"] = result
+	response["settings"] = gin.H{
+		"sme": settings.SME, "priority": settings.Priority, "reduced_rate": settings.Reduced(rates),
+		"injury_rate": settings.InjuryPct, "rates_year": rates.Year, "rates_exact": exact,
+		"mrot": rubles(rates.MROT), "base_limit": rubles(rates.BaseLimit),
+	}
+	c.JSON(http.StatusOK, response)
+}
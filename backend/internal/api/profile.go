@@ -0,0 +1,224 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/models"
+	"alfa-hack-backend/internal/tax"
+	"database/sql"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadTaxProfile - налоговый профиль пользователя; Regime пустой, если система налогообложения не указана
+func (h *Handler) loadTaxProfile(userID string) (tax.Profile, error) {
+	var p tax.Profile
+	err := h.db.QueryRow(
+		`SELECT COALESCE(tax_regime, ''), COALESCE(legal_form, ''), COALESCE(tax_rate, 0), COALESCE(patent_income, 0),
+		COALESCE(patent_months, 0) FROM users WHERE id = ?`,
+		userID,
+	).Scan(&p.Regime, &p.Form, &p.Rate, &p.PatentIncome, &p.PatentMonths)
+	return p, err
+}
+
+// defaultForm - если форма бизнеса не указана, считается ИП: у малого бизнеса это самый частый случай,
+// а патент и НПД доступны только ИП
+func defaultForm(p *tax.Profile) {
+	if p.Form == "" && p.Regime != "" {
+		p.Form = tax.FormIP
+	}
+}
+
+// taxProfileJSON - налоговый профиль в ответе API
+func taxProfileJSON(p tax.Profile) gin.H {
+	return gin.H{
+		"tax_regime":      p.Regime,
+		"tax_regime_name": tax.RegimeNames[p.Regime],
+		"legal_form":      p.Form,
+		"tax_rate":        p.Rate,
+		"default_rate":    tax.DefaultRate(p.Regime),
+		"patent_income":   rubles(p.PatentIncome),
+		"patent_months":   p.PatentMonths,
+	}
+}
+
+// GetProfile - профиль бизнеса: название, специализация и налоговые настройки
+func (h *Handler) GetProfile(c *gin.Context) {
+	userID := c.GetString("user_id")
+	var businessName, specialization, region string
+	var employees int
+	err := h.db.QueryRow(
+		"SELECT COALESCE(business_name, ''), specialization, COALESCE(region, ''), COALESCE(employees_count, -1) FROM users WHERE id = ?",
+		userID,
+	).Scan(&businessName, &specialization, &region, &employees)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	p, err := h.loadTaxProfile(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	profile := taxProfileJSON(p)
+	profile["business_name"] = businessName
+	profile["specialization"] = specialization
+	profile["region"] = region
+	profile["employees"] = employees
+	settings := h.payrollSettings(userID)
+	profile["payroll_sme"] = settings.SME
+	profile["payroll_priority"] = settings.Priority
+	profile["injury_rate"] = settings.InjuryPct
+	c.JSON(http.StatusOK, gin.H{"profile": profile})
+}
+
+// UpdateProfile - изменение профиля бизнеса. Система налогообложения проверяется вместе с формой
+// бизнеса и ставкой: патент и НПД доступны только ИП, ставка региона не выше общей.
+// Регион и число сотрудников используются в календаре сроков, условия работодателя - в расчете зарплаты.
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	userID := c.GetString("user_id")
+	var req models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p, err := h.loadTaxProfile(userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if req.TaxRegime != nil {
+		// Ставка региона относится к прежней системе налогообложения
+		if regime := strings.ToLower(strings.TrimSpace(*req.TaxRegime)); regime != p.Regime {
+			p.Regime, p.Rate = regime, 0
+		}
+	}
+	if req.LegalForm != nil {
+		p.Form = strings.ToLower(strings.TrimSpace(*req.LegalForm))
+	}
+	if req.TaxRate != nil {
+		p.Rate = *req.TaxRate
+	}
+	if req.PatentIncome != nil {
+		p.PatentIncome = int64(math.Round(*req.PatentIncome * 100))
+	}
+	if req.PatentMonths != nil {
+		p.PatentMonths = *req.PatentMonths
+	}
+	defaultForm(&p)
+	if p.Regime != "" {
+		if err := p.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Region != nil && !validRegion(strings.TrimSpace(*req.Region)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "region must be a two-digit region code, e.g. 77"})
+		return
+	}
+	var employees int
+	if err := h.db.QueryRow("SELECT COALESCE(employees_count, -1) FROM users WHERE id = ?", userID).Scan(&employees); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if req.Employees != nil {
+		if *req.Employees < -1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "employees must be -1 (from staff lists) or a non-negative number"})
+			return
+		}
+		employees = *req.Employees
+	}
+	if req.InjuryRate != nil && (*req.InjuryRate < 0 || *req.InjuryRate > 10) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "injury_rate must be a percentage between 0 and 10"})
+		return
+	}
+	if employees > 0 && p.Regime == tax.RegimeNPD {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "self-employed (npd) cannot have employees"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+	if req.BusinessName != nil {
+		if _, err := tx.Exec("UPDATE users SET business_name = ? WHERE id = ?", strings.TrimSpace(*req.BusinessName), userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+	if req.Specialization != nil {
+		if _, err := tx.Exec("UPDATE users SET specialization = ? WHERE id = ?", strings.TrimSpace(*req.Specialization), userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+	if req.Region != nil {
+		if _, err := tx.Exec("UPDATE users SET region = ? WHERE id = ?", strings.TrimSpace(*req.Region), userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+	if req.Employees != nil {
+		if _, err := tx.Exec("UPDATE users SET employees_count = ? WHERE id = ?", *req.Employees, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+	if req.PayrollSME != nil {
+		if _, err := tx.Exec("UPDATE users SET payroll_sme = ? WHERE id = ?", *req.PayrollSME, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+	if req.PayrollPriority != nil {
+		if _, err := tx.Exec("UPDATE users SET payroll_priority = ? WHERE id = ?", *req.PayrollPriority, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+	if req.InjuryRate != nil {
+		if _, err := tx.Exec("UPDATE users SET injury_rate = ? WHERE id = ?", *req.InjuryRate, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+	_, err = tx.Exec(
+		"UPDATE users SET tax_regime = ?, legal_form = ?, tax_rate = ?, patent_income = ?, patent_months = ? WHERE id = ?",
+		p.Regime, p.Form, p.Rate, p.PatentIncome, p.PatentMonths, userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	h.GetProfile(c)
+}
+
+// validRegion - пустая строка (регион не указан) или двузначный код региона
+func validRegion(region string) bool {
+	if region == "" {
+		return true
+	}
+	if len(region) != 2 || region == "00" {
+		return false
+	}
+	for _, r := range region {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
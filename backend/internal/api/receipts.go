@@ -0,0 +1,419 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/ai"
+	"alfa-hack-backend/internal/receipts"
+	"alfa-hack-backend/internal/storage"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultReceiptsLimit = 100
+	maxReceiptsLimit     = 1000
+	// salesMetricsDays - за сколько последних дней продаж показатели попадают в промпт
+	salesMetricsDays  = 30
+	receiptTimeLayout = "2006-01-02 15:04:05"
+)
+
+// importReceipts разбирает выгрузку кассовых чеков из версии файла и сохраняет чеки вместо
+// сохраненных раньше. Для файлов, которые не являются выгрузкой чеков, только удаляет старые чеки.
+func (h *Handler) importReceipts(ctx context.Context, userID string, task ingestTask) error {
+	var export *receipts.Export
+	if receipts.IsExportType(strings.TrimPrefix(strings.ToLower(path.Ext(task.FilePath)), ".")) {
+		data, err := storage.ReadAll(ctx, h.store, task.FilePath)
+		if err != nil {
+			return err
+		}
+		export, err = receipts.Parse(data)
+		if err != nil && !errors.Is(err, receipts.ErrUnknownFormat) {
+			return err
+		}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"receipts", "receipt_items"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE file_id = ? AND version = ?", task.FileID, task.Version); err != nil {
+			return err
+		}
+	}
+	if export == nil {
+		return tx.Commit()
+	}
+
+	for _, r := range export.Receipts {
+		result, err := tx.Exec(
+			`INSERT INTO receipts (user_id, file_id, version, datetime, operation, total, cash, card, fiscal_drive,
+			fiscal_document, fingerprint) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			userID, task.FileID, task.Version, r.DateTime.Format(receiptTimeLayout), r.Operation, r.Total, r.Cash, r.Card,
+			r.FiscalDrive, r.FiscalDocument, receiptFingerprint(r),
+		)
+		if err != nil {
+			return err
+		}
+		receiptID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for _, item := range r.Items {
+			_, err := tx.Exec(
+				`INSERT INTO receipt_items (receipt_id, user_id, file_id, version, name, price, quantity, amount)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				receiptID, userID, task.FileID, task.Version, item.Name, item.Price, item.Quantity, item.Amount,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// receiptFingerprint - отпечаток чека: номер ФН и ФД однозначно определяют чек, без них
+// чек узнается по времени, сумме и оплате
+func receiptFingerprint(r receipts.Receipt) string {
+	key := r.FiscalDrive + "|" + r.FiscalDocument
+	if r.FiscalDrive == "" || r.FiscalDocument == "" {
+		key = strings.Join([]string{
+			r.DateTime.Format(receiptTimeLayout), r.Operation, strconv.FormatInt(r.Total, 10),
+			strconv.FormatInt(r.Cash, 10), strconv.FormatInt(r.Card, 10),
+		}, "|")
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// receiptsPeriod возвращает период чеков из версии файла; ok=false, если версия не выгрузка чеков
+func (h *Handler) receiptsPeriod(fileID string, version int) (from, to time.Time, ok bool, err error) {
+	var count int
+	var dateFrom, dateTo string
+	err = h.db.QueryRow(
+		"SELECT COUNT(*), COALESCE(MIN(datetime), ''), COALESCE(MAX(datetime), '') FROM receipts WHERE file_id = ? AND version = ?",
+		fileID, version,
+	).Scan(&count, &dateFrom, &dateTo)
+	if err != nil || count == 0 {
+		return from, to, false, err
+	}
+	from, _ = time.Parse(receiptTimeLayout, dateFrom)
+	to, _ = time.Parse(receiptTimeLayout, dateTo)
+	return from, to, true, nil
+}
+
+// currentReceipts - чеки из текущих (закрепленных или последних) версий файлов пользователя.
+// Один чек из нескольких выгрузок учитывается один раз. Первый аргумент запроса - id пользователя.
+const currentReceipts = `WITH current AS (
+	SELECT r.* FROM receipts r JOIN files f ON f.id = r.file_id
+	WHERE f.user_id = ? AND r.version = CASE WHEN COALESCE(f.pinned_version, 0) > 0 THEN f.pinned_version ELSE f.version END
+), checks AS (
+	SELECT * FROM current WHERE id IN (SELECT MIN(id) FROM current GROUP BY fingerprint)
+) `
+
+// receiptsWhere строит условие SQL для отбора чеков по датам (YYYY-MM-DD, включительно) и файлам (nil - все)
+func receiptsWhere(from, to string, fileIDs []string) (string, []interface{}) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+	if from != "" {
+		conditions = append(conditions, "substr(datetime, 1, 10) >= ?")
+		args = append(args, from)
+	}
+	if to != "" {
+		conditions = append(conditions, "substr(datetime, 1, 10) <= ?")
+		args = append(args, to)
+	}
+	if fileIDs != nil {
+		placeholders := make([]string, len(fileIDs))
+		for i, id := range fileIDs {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		conditions = append(conditions, "file_id IN ("+strings.Join(append(placeholders, "NULL"), ", ")+")")
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// loadReceipts загружает чеки с позициями по времени чека
+func (h *Handler) loadReceipts(userID, from, to string, fileIDs []string) ([]receipts.Receipt, error) {
+	where, args := receiptsWhere(from, to, fileIDs)
+	args = append([]interface{}{userID}, args...)
+	rows, err := h.db.Query(
+		currentReceipts+`SELECT id, datetime, operation, total, cash, card, fiscal_drive, fiscal_document
+		FROM checks WHERE `+where+` ORDER BY datetime, id`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var list []receipts.Receipt
+	index := make(map[int64]int)
+	for rows.Next() {
+		var id int64
+		var r receipts.Receipt
+		var dateTime string
+		if err := rows.Scan(&id, &dateTime, &r.Operation, &r.Total, &r.Cash, &r.Card, &r.FiscalDrive, &r.FiscalDocument); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if r.DateTime, err = time.Parse(receiptTimeLayout, dateTime); err != nil {
+			continue
+		}
+		index[id] = len(list)
+		list = append(list, r)
+	}
+	rows.Close()
+	if len(list) == 0 {
+		return nil, nil
+	}
+
+	rows, err = h.db.Query(
+		currentReceipts+`SELECT receipt_id, name, price, quantity, amount FROM receipt_items
+		WHERE receipt_id IN (SELECT id FROM checks WHERE `+where+`) ORDER BY id`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var receiptID int64
+		var item receipts.Item
+		if err := rows.Scan(&receiptID, &item.Name, &item.Price, &item.Quantity, &item.Amount); err != nil {
+			return nil, err
+		}
+		if i, ok := index[receiptID]; ok {
+			list[i].Items = append(list[i].Items, item)
+		}
+	}
+	return list, rows.Err()
+}
+
+// salesMetrics - продажи по чекам среди файлов за последние 30 дней до последнего чека
+// и за 30 дней перед ними; nil, если чеков нет
+func (h *Handler) salesMetrics(userID string, fileIDs []string) *ai.SalesMetrics {
+	where, args := receiptsWhere("", "", fileIDs)
+	var last string
+	err := h.db.QueryRow(
+		currentReceipts+`SELECT COALESCE(MAX(datetime), '') FROM checks WHERE `+where,
+		append([]interface{}{userID}, args...)...,
+	).Scan(&last)
+	if err != nil {
+		log.Printf("Failed to compute sales metrics for user %s: %v", userID, err)
+		return nil
+	}
+	lastTime, err := time.Parse(receiptTimeLayout, last)
+	if err != nil {
+		return nil
+	}
+	to := time.Date(lastTime.Year(), lastTime.Month(), lastTime.Day(), 0, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, 0, -(salesMetricsDays - 1))
+	previousFrom := from.AddDate(0, 0, -salesMetricsDays)
+
+	list, err := h.loadReceipts(userID, sqlDate(previousFrom), sqlDate(to), fileIDs)
+	if err != nil {
+		log.Printf("Failed to compute sales metrics for user %s: %v", userID, err)
+		return nil
+	}
+	var current, previous []receipts.Receipt
+	for _, r := range list {
+		if r.DateTime.Before(from) {
+			previous = append(previous, r)
+		} else {
+			current = append(current, r)
+		}
+	}
+	if len(current) == 0 {
+		return nil
+	}
+	metrics := &ai.SalesMetrics{Summary: receipts.Summarize(current)}
+	if len(previous) > 0 {
+		summary := receipts.Summarize(previous)
+		metrics.Previous = &summary
+	}
+	return metrics
+}
+
+// bindPeriod читает период из параметров запроса (from=&to= или period=2025-03); при ошибке отвечает 400
+func bindPeriod(c *gin.Context) (from, to string, ok bool) {
+	from, to = c.Query("from"), c.Query("to")
+	if period := c.Query("period"); period != "" {
+		start, end, err := ai.ParsePeriod(period)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return "", "", false
+		}
+		from, to = start, end
+	}
+	for _, date := range []string{from, to} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid date %q: expected YYYY-MM-DD", date)})
+			return "", "", false
+		}
+	}
+	return from, to, true
+}
+
+// GetReceipts - кассовые чеки из загруженных выгрузок ОФД, новые первыми
+// (?from=&to= или ?period=2025-03, file_id, limit, offset)
+func (h *Handler) GetReceipts(c *gin.Context) {
+	from, to, ok := bindPeriod(c)
+	if !ok {
+		return
+	}
+	var fileIDs []string
+	if fileID := c.Query("file_id"); fileID != "" {
+		fileIDs = []string{fileID}
+	}
+	limit, offset := defaultReceiptsLimit, 0
+	if value, err := strconv.Atoi(c.Query("limit")); err == nil && value > 0 {
+		limit = value
+	}
+	if limit > maxReceiptsLimit {
+		limit = maxReceiptsLimit
+	}
+	if value, err := strconv.Atoi(c.Query("offset")); err == nil && value > 0 {
+		offset = value
+	}
+
+	where, args := receiptsWhere(from, to, fileIDs)
+	args = append([]interface{}{c.GetString("user_id")}, args...)
+	var total int
+	var revenue int64
+	err := h.db.QueryRow(
+		currentReceipts+`SELECT COUNT(*), COALESCE(SUM(CASE WHEN operation = 'refund' THEN -total ELSE total END), 0)
+		FROM checks WHERE `+where,
+		args...,
+	).Scan(&total, &revenue)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	rows, err := h.db.Query(
+		currentReceipts+`SELECT id, file_id, datetime, operation, total, cash, card, fiscal_drive, fiscal_document,
+		(SELECT COUNT(*) FROM receipt_items i WHERE i.receipt_id = checks.id)
+		FROM checks WHERE `+where+` ORDER BY datetime DESC, id DESC LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	list := []gin.H{}
+	for rows.Next() {
+		var id int64
+		var fileID, dateTime, operation, drive, document string
+		var amount, cash, card int64
+		var items int
+		if err := rows.Scan(&id, &fileID, &dateTime, &operation, &amount, &cash, &card, &drive, &document, &items); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		list = append(list, gin.H{
+			"id": id, "file_id": fileID, "datetime": dateTime, "operation": operation, "total": rubles(amount),
+			"cash": rubles(cash), "card": rubles(card), "fiscal_drive": drive, "fiscal_document": document, "items": items,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"receipts": list, "total": total, "revenue": rubles(revenue)})
+}
+
+// GetReceiptsSummary - выручка, средний чек и позиций в чеке, разбивка по часам, дням, дням недели,
+// позициям или способу оплаты (?group_by=day|hour|weekday|item|payment, from=&to= или period=2025-03, file_id)
+func (h *Handler) GetReceiptsSummary(c *gin.Context) {
+	groupBy := c.DefaultQuery("group_by", "day")
+	switch groupBy {
+	case "day", "hour", "weekday", "item", "payment":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be day, hour, weekday, item or payment"})
+		return
+	}
+	from, to, ok := bindPeriod(c)
+	if !ok {
+		return
+	}
+	var fileIDs []string
+	if fileID := c.Query("file_id"); fileID != "" {
+		fileIDs = []string{fileID}
+	}
+	list, err := h.loadReceipts(c.GetString("user_id"), from, to, fileIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	s := receipts.Summarize(list)
+
+	groups := []gin.H{}
+	add := func(key, name string, group receipts.Group) {
+		item := gin.H{"key": key, "name": name, "revenue": rubles(group.Revenue)}
+		switch groupBy {
+		case "item":
+			item["checks"], item["quantity"] = group.Checks, group.Quantity
+		case "payment":
+		default:
+			item["checks"] = group.Checks
+		}
+		groups = append(groups, item)
+	}
+	switch groupBy {
+	case "day":
+		for _, group := range s.ByDay {
+			add(group.Key, group.Key, group)
+		}
+	case "hour":
+		for _, group := range s.ByHour {
+			add(group.Key, group.Key+":00", group)
+		}
+	case "weekday":
+		for _, group := range s.ByWeekday {
+			add(group.Key, weekdayNames[group.Key], group)
+		}
+	case "item":
+		for _, group := range s.ByItem {
+			add(group.Key, group.Key, group)
+		}
+	case "payment":
+		add("cash", "Наличные", receipts.Group{Revenue: s.Cash})
+		add("card", "Безналичные", receipts.Group{Revenue: s.Card})
+	}
+
+	response := gin.H{
+		"group_by":        groupBy,
+		"groups":          groups,
+		"date_from":       nil,
+		"date_to":         nil,
+		"revenue":         rubles(s.Revenue),
+		"sales":           rubles(s.Sales),
+		"refunds":         rubles(s.Refunds),
+		"checks":          s.Checks,
+		"refund_checks":   s.RefundChecks,
+		"days":            s.Days,
+		"average_check":   rubles(s.AverageCheck),
+		"items_per_check": s.ItemsPerCheck,
+		"cash":            rubles(s.Cash),
+		"card":            rubles(s.Card),
+	}
+	if len(list) > 0 {
+		response["date_from"] = s.DateFrom.Format(receiptTimeLayout)
+		response["date_to"] = s.DateTo.Format(receiptTimeLayout)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+var weekdayNames = map[string]string{
+	"1": "Понедельник", "2": "Вторник", "3": "Среда", "4": "Четверг", "5": "Пятница", "6": "Суббота", "7": "Воскресенье",
+}
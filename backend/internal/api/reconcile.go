@@ -0,0 +1,520 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultReconcileInterval = 24 * time.Hour
+	// Первая сверка - через минуту после запуска, чтобы не замедлять старт сервера
+	reconcileStartDelay = time.Minute
+	// Объекты моложе этого возраста не считаются лишними: загрузка может быть еще не записана в базу
+	reconcileGracePeriod = time.Hour
+)
+
+// Две сверки в одном процессе не должны идти одновременно
+var reconcileMu sync.Mutex
+
+// ReconcileReport - результат сверки хранилища файлов с базой
+type ReconcileReport struct {
+	StartedAt      time.Time          `json:"started_at"`
+	FinishedAt     time.Time          `json:"finished_at"`
+	Repair         bool               `json:"repair"`
+	StorageObjects int                `json:"storage_objects"`
+	StorageBytes   int64              `json:"storage_bytes"`
+	OrphanBlobs    []storage.Object   `json:"orphan_blobs"`    // объекты, на которые не ссылается ни одна версия файла
+	StaleTemp      []storage.Object   `json:"stale_temp"`      // временные файлы прерванной записи
+	MissingBlobs   []MissingBlob      `json:"missing_blobs"`   // версии файлов, объекта которых нет в хранилище
+	SizeMismatches []SizeMismatch     `json:"size_mismatches"` // размер объекта не совпадает с записанным в базе
+	DanglingRows   map[string]int     `json:"dangling_rows"`   // записи, ссылающиеся на удаленные файлы, по таблицам
+	Users          []UserStorageUsage `json:"users"`
+	Repaired       ReconcileRepairs   `json:"repaired"`
+	Errors         []string           `json:"errors"`
+}
+
+// MissingBlob - версия файла без объекта в хранилище
+type MissingBlob struct {
+	FileID   string `json:"file_id"`
+	UserID   string `json:"user_id"`
+	Filename string `json:"filename"`
+	Version  int    `json:"version"`
+	Key      string `json:"key"`
+	Current  bool   `json:"current"` // это текущая версия файла
+}
+
+// SizeMismatch - версия файла, размер объекта которой отличается от записанного
+type SizeMismatch struct {
+	FileID      string `json:"file_id"`
+	Version     int    `json:"version"`
+	Key         string `json:"key"`
+	DBSize      int64  `json:"db_size"`
+	StorageSize int64  `json:"storage_size"`
+}
+
+// UserStorageUsage - занятое место пользователя по базе (как считается квота) и по хранилищу
+type UserStorageUsage struct {
+	UserID       string `json:"user_id"`
+	Username     string `json:"username"` // пусто, если в хранилище есть каталог несуществующего пользователя
+	Files        int    `json:"files"`
+	Versions     int    `json:"versions"`
+	DBBytes      int64  `json:"db_bytes"`
+	StorageBytes int64  `json:"storage_bytes"`
+	OrphanBytes  int64  `json:"orphan_bytes"`
+}
+
+// ReconcileRepairs - что исправлено
+type ReconcileRepairs struct {
+	OrphanBlobsDeleted  int `json:"orphan_blobs_deleted"`
+	TempFilesDeleted    int `json:"temp_files_deleted"`
+	DanglingRowsDeleted int `json:"dangling_rows_deleted"`
+	VersionsRemoved     int `json:"versions_removed"` // версии без объекта удалены, у файла остались другие версии
+	FilesRepointed      int `json:"files_repointed"`  // текущей стала последняя сохранившаяся версия
+	FilesRemoved        int `json:"files_removed"`    // у файла не осталось ни одной версии
+}
+
+// HasProblems - найдено расхождение между хранилищем и базой
+func (r *ReconcileReport) HasProblems() bool {
+	dangling := 0
+	for _, n := range r.DanglingRows {
+		dangling += n
+	}
+	return len(r.OrphanBlobs)+len(r.StaleTemp)+len(r.MissingBlobs)+len(r.SizeMismatches)+dangling > 0
+}
+
+// Summary - краткий итог сверки одной строкой (для лога)
+func (r *ReconcileReport) Summary() string {
+	dangling := 0
+	for _, n := range r.DanglingRows {
+		dangling += n
+	}
+	var orphanBytes int64
+	for _, o := range r.OrphanBlobs {
+		orphanBytes += o.Size
+	}
+	summary := fmt.Sprintf(
+		"storage objects: %d (%s), orphan blobs: %d (%s), stale temp files: %d, missing blobs: %d, size mismatches: %d, dangling rows: %d",
+		r.StorageObjects, formatBytes(r.StorageBytes), len(r.OrphanBlobs), formatBytes(orphanBytes),
+		len(r.StaleTemp), len(r.MissingBlobs), len(r.SizeMismatches), dangling,
+	)
+	if r.Repair {
+		p := r.Repaired
+		summary += fmt.Sprintf(
+			"; repaired: %d orphan blobs, %d temp files, %d dangling rows, %d versions, %d files repointed, %d files removed",
+			p.OrphanBlobsDeleted, p.TempFilesDeleted, p.DanglingRowsDeleted, p.VersionsRemoved, p.FilesRepointed, p.FilesRemoved,
+		)
+	}
+	if len(r.Errors) > 0 {
+		summary += fmt.Sprintf("; errors: %d", len(r.Errors))
+	}
+	return summary
+}
+
+func (r *ReconcileReport) addError(format string, args ...interface{}) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+// Таблицы, строки которых ссылаются на файл через file_id
+var fileRefTables = []string{"file_versions", "ingest_jobs", "chat_files", "file_tags", "bank_statements", "transactions", "receipts", "receipt_items", "marketplace_sales", "edo_documents", "edo_items", "employees"}
+
+type storedVersion struct {
+	FileID      string
+	UserID      string
+	Filename    string
+	Version     int
+	Key         string
+	Size        int64
+	CurrentPath string
+}
+
+// Reconcile сверяет хранилище файлов с базой: находит объекты без записей, записи без объектов,
+// расхождения размеров и записи, оставшиеся от удаленных файлов, и считает место по пользователям.
+// С repair=true лишние объекты и записи удаляются, а версии без объекта убираются из файлов.
+func (h *Handler) Reconcile(ctx context.Context, repair bool) (*ReconcileReport, error) {
+	reconcileMu.Lock()
+	defer reconcileMu.Unlock()
+
+	report := &ReconcileReport{
+		StartedAt:      time.Now(),
+		Repair:         repair,
+		OrphanBlobs:    []storage.Object{},
+		StaleTemp:      []storage.Object{},
+		MissingBlobs:   []MissingBlob{},
+		SizeMismatches: []SizeMismatch{},
+		DanglingRows:   map[string]int{},
+		Users:          []UserStorageUsage{},
+		Errors:         []string{},
+	}
+
+	// Сначала база, потом хранилище: объект загрузки, записанной между этими шагами,
+	// окажется моложе reconcileGracePeriod и не будет принят за лишний
+	versions, err := h.storedVersions()
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range fileRefTables {
+		var count int
+		err := h.db.QueryRow("SELECT COUNT(*) FROM " + table + " WHERE file_id NOT IN (SELECT id FROM files)").Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			report.DanglingRows[table] = count
+		}
+	}
+
+	objects, err := h.store.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage: %v", err)
+	}
+	objectsByKey := make(map[string]storage.Object, len(objects))
+	for _, o := range objects {
+		objectsByKey[o.Key] = o
+		report.StorageObjects++
+		report.StorageBytes += o.Size
+	}
+
+	referenced := make(map[string]bool)
+	for _, v := range versions {
+		referenced[v.Key] = true
+		referenced[v.CurrentPath] = true
+	}
+
+	cutoff := time.Now().Add(-reconcileGracePeriod)
+	for _, o := range objects {
+		if !referenced[o.Key] && o.ModTime.Before(cutoff) {
+			report.OrphanBlobs = append(report.OrphanBlobs, o)
+		}
+	}
+	if lister, ok := h.store.(storage.TempLister); ok {
+		temp, err := lister.ListTemp(ctx)
+		if err != nil {
+			report.addError("list temporary files: %v", err)
+		}
+		for _, o := range temp {
+			if o.ModTime.Before(cutoff) {
+				report.StaleTemp = append(report.StaleTemp, o)
+			}
+		}
+	}
+
+	for _, v := range versions {
+		object, ok := objectsByKey[v.Key]
+		if !ok {
+			// Файл могли удалить, пока шла сверка: перепроверяем сам объект
+			if !h.blobMissing(ctx, v.Key) {
+				continue
+			}
+			report.MissingBlobs = append(report.MissingBlobs, MissingBlob{
+				FileID:   v.FileID,
+				UserID:   v.UserID,
+				Filename: v.Filename,
+				Version:  v.Version,
+				Key:      v.Key,
+				Current:  v.Key == v.CurrentPath,
+			})
+			continue
+		}
+		if v.Size > 0 && object.Size != v.Size {
+			report.SizeMismatches = append(report.SizeMismatches, SizeMismatch{
+				FileID:      v.FileID,
+				Version:     v.Version,
+				Key:         v.Key,
+				DBSize:      v.Size,
+				StorageSize: object.Size,
+			})
+		}
+	}
+
+	if report.Users, err = h.storageUsage(versions, objects, report.OrphanBlobs); err != nil {
+		return nil, err
+	}
+
+	if repair {
+		h.repairStorage(ctx, report)
+	}
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// storedVersions возвращает все версии файлов вместе с владельцем и текущей версией файла
+func (h *Handler) storedVersions() ([]storedVersion, error) {
+	rows, err := h.db.Query(
+		`SELECT v.file_id, f.user_id, f.filename, v.version, v.file_path, COALESCE(v.file_size, 0), f.file_path
+		FROM file_versions v JOIN files f ON f.id = v.file_id
+		ORDER BY f.user_id, v.file_id, v.version`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []storedVersion
+	for rows.Next() {
+		var v storedVersion
+		if err := rows.Scan(&v.FileID, &v.UserID, &v.Filename, &v.Version, &v.Key, &v.Size, &v.CurrentPath); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// blobMissing - объекта точно нет в хранилище (ошибки чтения не считаются отсутствием)
+func (h *Handler) blobMissing(ctx context.Context, key string) bool {
+	rc, err := h.store.Get(ctx, key)
+	if err == nil {
+		rc.Close()
+		return false
+	}
+	return errors.Is(err, storage.ErrNotFound)
+}
+
+// storageUsage считает место по пользователям. Объекты лежат по ключам "<userID>/...",
+// поэтому каталог в хранилище есть и у пользователя, и у его лишних объектов.
+func (h *Handler) storageUsage(versions []storedVersion, objects, orphans []storage.Object) ([]UserStorageUsage, error) {
+	usage := make(map[string]*UserStorageUsage)
+	get := func(userID string) *UserStorageUsage {
+		if usage[userID] == nil {
+			usage[userID] = &UserStorageUsage{UserID: userID}
+		}
+		return usage[userID]
+	}
+
+	rows, err := h.db.Query(
+		`SELECT u.id, u.username, COUNT(f.id) FROM users u
+		LEFT JOIN files f ON f.user_id = u.id GROUP BY u.id, u.username`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var userID, username string
+		var files int
+		if err := rows.Scan(&userID, &username, &files); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		u := get(userID)
+		u.Username, u.Files = username, files
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Версии, ссылающиеся на один объект (после восстановления), считаются один раз - как в квоте
+	counted := make(map[string]bool)
+	for _, v := range versions {
+		u := get(v.UserID)
+		u.Versions++
+		if !counted[v.Key] {
+			counted[v.Key] = true
+			u.DBBytes += v.Size
+		}
+	}
+	for _, o := range objects {
+		get(keyOwner(o.Key)).StorageBytes += o.Size
+	}
+	for _, o := range orphans {
+		get(keyOwner(o.Key)).OrphanBytes += o.Size
+	}
+
+	result := make([]UserStorageUsage, 0, len(usage))
+	for _, u := range usage {
+		result = append(result, *u)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].StorageBytes != result[j].StorageBytes {
+			return result[i].StorageBytes > result[j].StorageBytes
+		}
+		return result[i].UserID < result[j].UserID
+	})
+	return result, nil
+}
+
+// keyOwner возвращает пользователя из ключа "<userID>/<fileID>.<ext>"
+func keyOwner(key string) string {
+	owner, _, _ := strings.Cut(key, "/")
+	return owner
+}
+
+// repairStorage исправляет найденные расхождения
+func (h *Handler) repairStorage(ctx context.Context, report *ReconcileReport) {
+	for _, o := range report.OrphanBlobs {
+		if err := h.store.Delete(ctx, o.Key); err != nil {
+			report.addError("delete orphan blob %s: %v", o.Key, err)
+			continue
+		}
+		report.Repaired.OrphanBlobsDeleted++
+	}
+	for _, o := range report.StaleTemp {
+		if err := h.store.Delete(ctx, o.Key); err != nil {
+			report.addError("delete temporary file %s: %v", o.Key, err)
+			continue
+		}
+		report.Repaired.TempFilesDeleted++
+	}
+
+	for _, table := range fileRefTables {
+		if report.DanglingRows[table] == 0 {
+			continue
+		}
+		result, err := h.db.Exec("DELETE FROM " + table + " WHERE file_id NOT IN (SELECT id FROM files)")
+		if err != nil {
+			report.addError("delete dangling rows from %s: %v", table, err)
+			continue
+		}
+		deleted, _ := result.RowsAffected()
+		report.Repaired.DanglingRowsDeleted += int(deleted)
+	}
+
+	missing := make(map[string]map[string]bool) // файл -> ключи без объекта
+	var fileIDs []string
+	for _, m := range report.MissingBlobs {
+		if missing[m.FileID] == nil {
+			missing[m.FileID] = make(map[string]bool)
+			fileIDs = append(fileIDs, m.FileID)
+		}
+		missing[m.FileID][m.Key] = true
+	}
+	for _, fileID := range fileIDs {
+		if err := h.repairMissingBlobs(fileID, missing[fileID], &report.Repaired); err != nil {
+			report.addError("repair file %s: %v", fileID, err)
+		}
+	}
+}
+
+// repairMissingBlobs удаляет версии файла, объектов которых нет в хранилище. Если удалена текущая
+// версия, текущей становится последняя сохранившаяся; если не осталось ни одной - файл удаляется.
+func (h *Handler) repairMissingBlobs(fileID string, missingKeys map[string]bool, repaired *ReconcileRepairs) error {
+	versions, err := h.getFileVersions(fileID)
+	if err != nil {
+		return err
+	}
+	file, err := h.findFile("id = ?", fileID)
+	if err != nil || file == nil {
+		return err
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var kept []int // индексы сохранившихся версий, от новых к старым
+	removed := 0
+	pinnedRemoved := false
+	for i, v := range versions {
+		if !missingKeys[v.FilePath] {
+			kept = append(kept, i)
+			continue
+		}
+		for _, table := range []string{"ingest_jobs", "bank_statements", "transactions", "receipts", "receipt_items", "marketplace_sales", "edo_documents", "edo_items", "employees", "file_versions"} {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE file_id = ? AND version = ?", fileID, v.Version); err != nil {
+				return err
+			}
+		}
+		removed++
+		if v.Version == file.PinnedVersion {
+			pinnedRemoved = true
+		}
+	}
+
+	if len(kept) == 0 {
+		if err := deleteFileRows(tx, fileID); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		repaired.FilesRemoved++
+		log.Printf("Reconcile: removed file %s (%s), none of its versions exist in storage", fileID, file.Filename)
+		return nil
+	}
+
+	repointed := false
+	if missingKeys[file.FilePath] {
+		latest := versions[kept[0]]
+		_, err = tx.Exec(
+			"UPDATE files SET file_path = ?, file_size = ?, sha256 = ?, version = ? WHERE id = ?",
+			latest.FilePath, latest.FileSize, latest.SHA256, latest.Version, fileID,
+		)
+		if err != nil {
+			return err
+		}
+		repointed = true
+	}
+	if pinnedRemoved {
+		if _, err := tx.Exec("UPDATE files SET pinned_version = 0 WHERE id = ?", fileID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	repaired.VersionsRemoved += removed
+	if repointed {
+		repaired.FilesRepointed++
+		log.Printf("Reconcile: file %s (%s) current version is now %d", fileID, file.Filename, versions[kept[0]].Version)
+	}
+	if repointed || pinnedRemoved {
+		if err := h.detectFileMeta(fileID); err != nil {
+			log.Printf("Failed to detect document kind for file %s: %v", fileID, err)
+		}
+	}
+	return nil
+}
+
+// StartReconciler запускает периодическую сверку хранилища с базой.
+// RECONCILE_INTERVAL - период (например, 6h; по умолчанию 24h, 0 - отключить),
+// RECONCILE_REPAIR=true - не только сообщать о расхождениях, но и исправлять их.
+func (h *Handler) StartReconciler() {
+	interval := defaultReconcileInterval
+	if value := os.Getenv("RECONCILE_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if value == "0" {
+			parsed, err = 0, nil
+		}
+		if err != nil || parsed < 0 {
+			log.Printf("Invalid RECONCILE_INTERVAL %q, using %s", value, defaultReconcileInterval)
+		} else {
+			interval = parsed
+		}
+	}
+	if interval == 0 {
+		log.Println("Storage reconciliation is disabled")
+		return
+	}
+	repair := strings.ToLower(os.Getenv("RECONCILE_REPAIR")) == "true"
+
+	go func() {
+		time.Sleep(reconcileStartDelay)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			report, err := h.Reconcile(context.Background(), repair)
+			if err != nil {
+				log.Printf("Storage reconciliation failed: %v", err)
+			} else if report.HasProblems() || len(report.Errors) > 0 {
+				log.Printf("Storage reconciliation found problems: %s", report.Summary())
+				for _, e := range report.Errors {
+					log.Printf("Storage reconciliation error: %s", e)
+				}
+			} else {
+				log.Printf("Storage reconciliation: %s", report.Summary())
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/storage"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// putBlob кладет объект в хранилище; old - объект старше reconcileGracePeriod
+func putBlob(t *testing.T, h *Handler, key, content string, old bool) {
+	t.Helper()
+	if err := h.store.Put(context.Background(), key, strings.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+		t.Fatalf("put %s: %v", key, err)
+	}
+	if old {
+		path := filepath.Join(h.store.(*storage.Local).Root(), filepath.FromSlash(key))
+		past := time.Now().Add(-2 * reconcileGracePeriod)
+		if err := os.Chtimes(path, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// seedReconcile - здоровый файл, файл без объекта в хранилище и лишний объект без записи в базе
+func seedReconcile(t *testing.T, h *Handler) (healthy, lost string) {
+	t.Helper()
+	healthy, _ = uploadText(t, h, "выручка.csv", "", "Месяц;Выручка\nМарт;100\n")
+	lost, _ = uploadText(t, h, "аренда.csv", "", "Месяц;Аренда\nМарт;50\n")
+	lostFile, _ := h.findFile("id = ?", lost)
+	if err := h.store.Delete(context.Background(), lostFile.FilePath); err != nil {
+		t.Fatal(err)
+	}
+	putBlob(t, h, testUserID+"/orphan.csv", "забытая загрузка", true)
+	// Объект моложе reconcileGracePeriod может принадлежать загрузке, которая еще пишется в базу
+	putBlob(t, h, testUserID+"/uploading.csv", "идет загрузка", false)
+	return healthy, lost
+}
+
+func TestReconcileDryRun(t *testing.T) {
+	h := newTestHandler(t)
+	healthy, lost := seedReconcile(t, h)
+
+	report, err := h.Reconcile(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(report.OrphanBlobs) != 1 || report.OrphanBlobs[0].Key != testUserID+"/orphan.csv" {
+		t.Errorf("orphan blobs = %+v, want %s/orphan.csv", report.OrphanBlobs, testUserID)
+	}
+	if len(report.MissingBlobs) != 1 || report.MissingBlobs[0].FileID != lost || !report.MissingBlobs[0].Current {
+		t.Errorf("missing blobs = %+v, want current version of %s", report.MissingBlobs, lost)
+	}
+	if len(report.SizeMismatches) != 0 || len(report.DanglingRows) != 0 || len(report.Errors) != 0 {
+		t.Errorf("unexpected problems: %+v", report)
+	}
+	if !report.HasProblems() || report.StorageObjects != 3 {
+		t.Errorf("has problems %v, %d storage objects; want true and 3", report.HasProblems(), report.StorageObjects)
+	}
+	if len(report.Users) != 1 || report.Users[0].Files != 2 || report.Users[0].Versions != 2 || report.Users[0].OrphanBytes == 0 {
+		t.Errorf("users = %+v", report.Users)
+	}
+
+	// Без repair ничего не меняется
+	if _, err := storage.ReadAll(context.Background(), h.store, testUserID+"/orphan.csv"); err != nil {
+		t.Errorf("orphan blob was deleted: %v", err)
+	}
+	for _, id := range []string{healthy, lost} {
+		if file, _ := h.findFile("id = ?", id); file == nil {
+			t.Errorf("file %s was deleted", id)
+		}
+	}
+	if report.Repaired != (ReconcileRepairs{}) {
+		t.Errorf("repaired = %+v", report.Repaired)
+	}
+}
+
+func TestReconcileRepair(t *testing.T) {
+	h := newTestHandler(t)
+	healthy, lost := seedReconcile(t, h)
+
+	report, err := h.Reconcile(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	want := ReconcileRepairs{OrphanBlobsDeleted: 1, FilesRemoved: 1}
+	if report.Repaired != want || len(report.Errors) != 0 {
+		t.Errorf("repaired = %+v, errors %v; want %+v", report.Repaired, report.Errors, want)
+	}
+
+	// Исправлены только два расхождения: здоровый файл и свежая загрузка не тронуты
+	if _, err := storage.ReadAll(context.Background(), h.store, testUserID+"/orphan.csv"); err == nil {
+		t.Error("orphan blob is still in storage")
+	}
+	if _, err := storage.ReadAll(context.Background(), h.store, testUserID+"/uploading.csv"); err != nil {
+		t.Errorf("fresh upload was deleted: %v", err)
+	}
+	if file, _ := h.findFile("id = ?", lost); file != nil {
+		t.Error("file without content is still listed")
+	}
+	file, _ := h.findFile("id = ?", healthy)
+	if file == nil {
+		t.Fatal("healthy file was deleted")
+	}
+	if data, err := storage.ReadAll(context.Background(), h.store, file.FilePath); err != nil || !strings.Contains(string(data), "Выручка") {
+		t.Errorf("healthy file content: %q, %v", data, err)
+	}
+	var rows int
+	h.db.QueryRow("SELECT COUNT(*) FROM file_versions WHERE file_id = ?", lost).Scan(&rows)
+	if rows != 0 {
+		t.Errorf("%d versions of the removed file are left", rows)
+	}
+
+	again, err := h.Reconcile(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if again.HasProblems() {
+		t.Errorf("problems after repair: %s", again.Summary())
+	}
+}
+
+// Версия без объекта удаляется, а текущей становится последняя сохранившаяся
+func TestReconcileRepairRepointsVersion(t *testing.T) {
+	h := newTestHandler(t)
+	id, _ := uploadText(t, h, "отчет.csv", "", "Месяц;Выручка\nМарт;100\n")
+	uploadText(t, h, "отчет.csv", "", "Месяц;Выручка\nМарт;150\n")
+	file, _ := h.findFile("id = ?", id)
+	if err := h.store.Delete(context.Background(), file.FilePath); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := h.Reconcile(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if want := (ReconcileRepairs{VersionsRemoved: 1, FilesRepointed: 1}); report.Repaired != want {
+		t.Errorf("repaired = %+v, want %+v", report.Repaired, want)
+	}
+	if file, _ = h.findFile("id = ?", id); file == nil || file.Version != 1 {
+		t.Fatalf("file after repair = %+v, want version 1", file)
+	}
+	if data, err := storage.ReadAll(context.Background(), h.store, file.FilePath); err != nil || !strings.Contains(string(data), "100") {
+		t.Errorf("current content %q, %v", data, err)
+	}
+}
@@ -0,0 +1,342 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/ai"
+	"alfa-hack-backend/internal/payroll"
+	"alfa-hack-backend/internal/tax"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// taxOperations - операции выписок, которые считаются доходами и расходами для налогов: без переводов
+// между своими счетами, кредитов, денег владельца и уплаченных налогов и взносов
+const taxOperations = `internal = 0 AND currency = 'RUB' AND category NOT IN ('transfer', 'loans', 'owner')
+	AND NOT (direction = 'out' AND category = 'taxes')`
+
+// taxSources - откуда берутся данные для расчета налогов
+const taxSources = "Доходы и расходы - по операциям из банковских выписок в рублях без переводов между своими счетами, " +
+	"кредитов, денег владельца и уплаченных налогов"
+
+// fileCondition - условие на файлы операций; nil - все файлы пользователя
+func fileCondition(fileIDs []string, args []interface{}) (string, []interface{}) {
+	if fileIDs == nil {
+		return "", args
+	}
+	placeholders := make([]string, len(fileIDs))
+	for i, id := range fileIDs {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+	return " AND file_id IN (" + strings.Join(append(placeholders, "NULL"), ", ") + ")", args
+}
+
+// lastOperationYear - год последней операции в выписках; 0, если операций нет
+func (h *Handler) lastOperationYear(userID string, fileIDs []string) (int, error) {
+	where, args := fileCondition(fileIDs, []interface{}{userID})
+	var last string
+	err := h.db.QueryRow(currentTransactions+"SELECT COALESCE(MAX(date), '') FROM operations WHERE "+taxOperations+where, args...).Scan(&last)
+	if err != nil || last == "" {
+		return 0, err
+	}
+	return strconv.Atoi(last[:4])
+}
+
+// taxInput собирает доходы и расходы года по месяцам из выписок и взносы за сотрудников из списков персонала
+// (fileIDs nil - из всех файлов). Данные считаются до последнего месяца с операциями; found=false,
+// если операций за год нет.
+func (h *Handler) taxInput(userID string, fileIDs []string, year int) (input tax.Input, found bool, err error) {
+	input.Year = year
+	where, args := fileCondition(fileIDs, []interface{}{userID, strconv.Itoa(year)})
+	rows, err := h.db.Query(
+		currentTransactions+`SELECT CAST(substr(date, 6, 2) AS INTEGER) AS month, direction, SUM(amount),
+		SUM(CASE WHEN length(counterparty_inn) IN (10, 12) THEN amount ELSE 0 END)
+		FROM operations WHERE substr(date, 1, 4) = ? AND `+taxOperations+where+`
+		GROUP BY month, direction`,
+		args...,
+	)
+	if err != nil {
+		return input, false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var month int
+		var direction string
+		var amount, legal int64
+		if err := rows.Scan(&month, &direction, &amount, &legal); err != nil {
+			return input, false, err
+		}
+		if month < 1 || month > 12 {
+			continue
+		}
+		m := &input.Months[month-1]
+		if direction == "in" {
+			m.Revenue, m.RevenueLegal = amount, legal
+		} else {
+			m.Expenses = amount
+		}
+		input.Through = max(input.Through, month)
+		found = true
+	}
+	if err := rows.Err(); err != nil {
+		return input, false, err
+	}
+	if !found {
+		input.Through = 12
+		if now := time.Now(); year == now.Year() {
+			input.Through = int(now.Month())
+		}
+	}
+
+	// Взносы за сотрудников по окладам из списков персонала
+	stored, err := h.loadEmployees(userID, fileIDs)
+	if err != nil {
+		return input, found, err
+	}
+	employees := make([]payroll.Employee, len(stored))
+	for i, e := range stored {
+		employees[i] = e.Employee
+	}
+	settings := h.payrollSettings(userID)
+	for m := 0; m < input.Through && len(employees) > 0; m++ {
+		p := payroll.Month(employees, time.Date(year, time.Month(m+1), 1, 0, 0, 0, 0, time.UTC), settings)
+		input.Months[m].Contributions = p.Contributions + p.Injury
+		input.Employees = input.Employees || len(p.Employees) > 0
+	}
+	return input, found, nil
+}
+
+// taxNotes - откуда взяты данные расчета
+func taxNotes(result *tax.Result, input tax.Input) {
+	result.Notes = append([]string{taxSources}, result.Notes...)
+	if result.Regime == tax.RegimeNPD {
+		result.Notes = append(result.Notes, "Доходы от организаций и ИП определены по ИНН плательщика, остальные - доходы от физлиц")
+	}
+	if input.Employees {
+		result.Notes = append(result.Notes, "Взносы за сотрудников посчитаны по окладам из списков сотрудников")
+	}
+}
+
+// taxMetrics - налоги по системе налогообложения из профиля за год последней операции в выписках среди файлов;
+// nil, если система не указана или операций нет
+func (h *Handler) taxMetrics(userID string, fileIDs []string) *ai.TaxMetrics {
+	profile, err := h.loadTaxProfile(userID)
+	if err != nil {
+		log.Printf("Failed to load tax profile for user %s: %v", userID, err)
+		return nil
+	}
+	if profile.Regime == "" {
+		return nil
+	}
+	defaultForm(&profile)
+	year, err := h.lastOperationYear(userID, fileIDs)
+	if err != nil || year == 0 {
+		if err != nil {
+			log.Printf("Failed to compute tax metrics for user %s: %v", userID, err)
+		}
+		return nil
+	}
+	input, _, err := h.taxInput(userID, fileIDs, year)
+	if err != nil {
+		log.Printf("Failed to compute tax metrics for user %s: %v", userID, err)
+		return nil
+	}
+	result, err := tax.Calculate(profile, input)
+	if err != nil {
+		log.Printf("Failed to compute tax metrics for user %s: %v", userID, err)
+		return nil
+	}
+	taxNotes(result, input)
+	return &ai.TaxMetrics{Result: result}
+}
+
+// taxResultJSON - расчет налогов в ответе API
+func taxResultJSON(r *tax.Result) gin.H {
+	periods := []gin.H{}
+	for _, p := range r.Periods {
+		periods = append(periods, gin.H{
+			"name": p.Name, "months": p.Months, "partial": p.Partial, "revenue": rubles(p.Revenue),
+			"expenses": rubles(p.Expenses), "base": rubles(p.Base), "accrued": rubles(p.Accrued),
+			"deduction": rubles(p.Deduction), "tax": rubles(p.Tax), "due": rubles(p.Due), "due_date": sqlDate(p.DueDate),
+		})
+	}
+	deductions := []gin.H{}
+	for _, d := range r.Deductions {
+		deductions = append(deductions, gin.H{"name": d.Name, "amount": rubles(d.Amount)})
+	}
+	payments := []gin.H{}
+	for _, p := range r.Payments {
+		payments = append(payments, gin.H{"code": p.Code, "name": p.Name, "amount": rubles(p.Amount), "due_date": sqlDate(p.Due)})
+	}
+	result := gin.H{
+		"year": r.Year, "tax_regime": r.Regime, "tax_regime_name": tax.RegimeNames[r.Regime], "legal_form": r.Form,
+		"rate": r.Rate, "months": r.Months, "revenue": rubles(r.Revenue), "expenses": rubles(r.Expenses),
+		"tax": rubles(r.Tax), "periods": periods, "deductions": deductions, "allowed_deductions": r.Allowed,
+		"payments": payments, "warnings": append([]string{}, r.Warnings...), "notes": append([]string{}, r.Notes...),
+		"params": gin.H{
+			"year": r.Params.Year, "exact": r.ExactParams, "ip_fixed": rubles(r.Params.IPFixed),
+			"ip_additional_cap": rubles(r.Params.IPAdditionalCap), "usn_limit": rubles(r.Params.USNLimit),
+			"usn_vat_threshold": rubles(r.Params.USNVATThreshold), "vat_rate": r.Params.VATRate,
+			"profit_rate": r.Params.ProfitRate,
+		},
+		"contributions": nil,
+		"vat":           nil,
+	}
+	if c := r.Contributions; c != nil {
+		result["contributions"] = gin.H{
+			"fixed": rubles(c.Fixed), "additional": rubles(c.Additional), "income": rubles(c.Income),
+			"total": rubles(c.Fixed + c.Additional),
+		}
+	}
+	if v := r.VAT; v != nil {
+		result["vat"] = gin.H{"rate": v.Rate, "output": rubles(v.Output), "input": rubles(v.Input), "tax": rubles(v.Tax)}
+	}
+	return result
+}
+
+// bindTaxProfile - налоговый профиль пользователя с заменой полей из запроса (?regime=, ?legal_form=, ?rate=);
+// при ошибке отвечает 400 или 500
+func (h *Handler) bindTaxProfile(c *gin.Context, regime, form string, rate *float64) (tax.Profile, bool) {
+	profile, err := h.loadTaxProfile(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return profile, false
+	}
+	if regime != "" {
+		// Ставка региона из профиля относится к его системе налогообложения
+		if lower := strings.ToLower(strings.TrimSpace(regime)); lower != profile.Regime {
+			profile.Regime, profile.Rate = lower, 0
+		}
+		// Патент и НПД доступны только ИП
+		if form == "" && (profile.Regime == tax.RegimePSN || profile.Regime == tax.RegimeNPD) {
+			profile.Form = tax.FormIP
+		}
+	}
+	if form != "" {
+		profile.Form = strings.ToLower(strings.TrimSpace(form))
+	}
+	if rate != nil {
+		profile.Rate = *rate
+	}
+	if profile.Regime == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tax regime is not set: specify it in PUT /api/user/profile or the regime parameter"})
+		return profile, false
+	}
+	defaultForm(&profile)
+	if err := profile.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return profile, false
+	}
+	return profile, true
+}
+
+// GetTax - расчет налогов за год (?year=, по умолчанию текущий) по системе налогообложения из профиля
+// и операциям из выписок. ?regime=, ?legal_form= и ?rate= позволяют сравнить с другой системой.
+func (h *Handler) GetTax(c *gin.Context) {
+	year := time.Now().Year()
+	if value := c.Query("year"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 2000 || parsed > 2100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid year"})
+			return
+		}
+		year = parsed
+	}
+	var rate *float64
+	if value := c.Query("rate"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rate"})
+			return
+		}
+		rate = &parsed
+	}
+	profile, ok := h.bindTaxProfile(c, c.Query("regime"), c.Query("legal_form"), rate)
+	if !ok {
+		return
+	}
+
+	userID := c.GetString("user_id")
+	input, found, err := h.taxInput(userID, nil, year)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	result, err := tax.Calculate(profile, input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	taxNotes(result, input)
+	if !found {
+		result.Warnings = append(result.Warnings, "Операций из выписок за год нет: доходы и расходы равны нулю")
+	}
+	c.JSON(http.StatusOK, gin.H{"tax": taxResultJSON(result)})
+}
+
+// taxCalculateRequest - данные для расчета налогов без выписок. Суммы в рублях, месяцы - с января.
+// Не указанные система, форма и ставка берутся из профиля.
+type taxCalculateRequest struct {
+	Year         int      `json:"year"`
+	Regime       string   `json:"tax_regime"`
+	LegalForm    string   `json:"legal_form"`
+	Rate         *float64 `json:"tax_rate"`
+	PatentIncome *float64 `json:"patent_income"`
+	PatentMonths *int     `json:"patent_months"`
+	Employees    bool     `json:"employees"`
+	Months       []struct {
+		Revenue       float64 `json:"revenue"`
+		Expenses      float64 `json:"expenses"`
+		RevenueLegal  float64 `json:"revenue_legal"` // доходы от организаций и ИП (для НПД)
+		Contributions float64 `json:"contributions"` // взносы за сотрудников
+	} `json:"months" binding:"required,min=1,max=12"`
+}
+
+// CalculateTax - расчет налогов по доходам и расходам из запроса
+func (h *Handler) CalculateTax(c *gin.Context) {
+	var req taxCalculateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	profile, ok := h.bindTaxProfile(c, req.Regime, req.LegalForm, req.Rate)
+	if !ok {
+		return
+	}
+	if req.PatentIncome != nil {
+		profile.PatentIncome = int64(math.Round(*req.PatentIncome * 100))
+	}
+	if req.PatentMonths != nil {
+		profile.PatentMonths = *req.PatentMonths
+	}
+	input := tax.Input{Year: req.Year, Through: len(req.Months), Employees: req.Employees}
+	if input.Year == 0 {
+		input.Year = time.Now().Year()
+	} else if input.Year < 2000 || input.Year > 2100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid year"})
+		return
+	}
+	kopecks := func(value float64) int64 { return int64(math.Round(value * 100)) }
+	for i, m := range req.Months {
+		if m.Revenue < 0 || m.Expenses < 0 || m.RevenueLegal < 0 || m.Contributions < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "amounts must not be negative"})
+			return
+		}
+		input.Months[i] = tax.Month{
+			Revenue: kopecks(m.Revenue), Expenses: kopecks(m.Expenses), RevenueLegal: kopecks(m.RevenueLegal),
+			Contributions: kopecks(m.Contributions),
+		}
+		input.Employees = input.Employees || m.Contributions > 0
+	}
+	result, err := tax.Calculate(profile, input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tax": taxResultJSON(result)})
+}
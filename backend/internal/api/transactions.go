@@ -0,0 +1,449 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/ai"
+	"alfa-hack-backend/internal/bank"
+	"alfa-hack-backend/internal/models"
+	"alfa-hack-backend/internal/storage"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTransactionsLimit = 100
+	maxTransactionsLimit     = 1000
+)
+
+// importStatement разбирает банковскую выписку из версии файла и сохраняет ее операции
+// вместо сохраненных раньше. Для файлов, которые не являются выпиской, только удаляет старые операции.
+func (h *Handler) importStatement(ctx context.Context, userID string, task ingestTask) error {
+	var st *bank.Statement
+	if bank.IsStatementType(strings.TrimPrefix(strings.ToLower(path.Ext(task.FilePath)), ".")) {
+		data, err := storage.ReadAll(ctx, h.store, task.FilePath)
+		if err != nil {
+			return err
+		}
+		st, err = bank.Parse(data)
+		if err != nil && !errors.Is(err, bank.ErrUnknownFormat) {
+			return err
+		}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"bank_statements", "transactions"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE file_id = ? AND version = ?", task.FileID, task.Version); err != nil {
+			return err
+		}
+	}
+	if st == nil {
+		return tx.Commit()
+	}
+
+	for _, account := range st.Accounts {
+		var opening, closing sql.NullInt64
+		if account.HasBalance {
+			opening = sql.NullInt64{Int64: account.Opening, Valid: true}
+			closing = sql.NullInt64{Int64: account.Closing, Valid: true}
+		}
+		_, err := tx.Exec(
+			`INSERT INTO bank_statements (user_id, file_id, version, format, account, currency, date_from, date_to,
+			opening_balance, closing_balance) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			userID, task.FileID, task.Version, st.Format, account.Number, account.Currency,
+			sqlDate(account.DateFrom), sqlDate(account.DateTo), opening, closing,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if len(st.Accounts) == 0 {
+		// Собственный счет в выписке не указан - сохраняем хотя бы период
+		_, err := tx.Exec(
+			"INSERT INTO bank_statements (user_id, file_id, version, format, date_from, date_to) VALUES (?, ?, ?, ?, ?, ?)",
+			userID, task.FileID, task.Version, st.Format, sqlDate(st.DateFrom), sqlDate(st.DateTo),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, t := range st.Transactions {
+		_, err := tx.Exec(
+			`INSERT INTO transactions (user_id, file_id, version, date, amount, currency, direction, internal, account,
+			counterparty, counterparty_inn, counterparty_account, purpose, doc_number, doc_type, mcc, fingerprint)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			userID, task.FileID, task.Version, sqlDate(t.Date), t.Amount, t.Currency, t.Direction, t.Internal, t.Account,
+			t.Counterparty, t.CounterpartyINN, t.CounterpartyAccount, t.Purpose, t.DocNumber, t.DocType, t.MCC,
+			transactionFingerprint(t),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Категории новых операций; ошибка категоризации не отменяет загрузку выписки
+	if _, err := h.categorizeUser(ctx, userID, ai.CategorizerLLMEnabled()); err != nil {
+		log.Printf("Failed to categorize transactions of user %s: %v", userID, err)
+	}
+	return nil
+}
+
+// transactionFingerprint - отпечаток операции: одна и та же операция из двух выписок
+// за пересекающиеся периоды считается один раз (см. currentTransactions)
+func transactionFingerprint(t bank.Transaction) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		sqlDate(t.Date), strconv.FormatInt(t.Amount, 10), t.Currency, t.Direction, t.Account,
+		t.CounterpartyAccount, t.CounterpartyINN, t.DocNumber,
+	}, "|")))
+	return hex.EncodeToString(sum[:16])
+}
+
+func sqlDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+	return date.Format("2006-01-02")
+}
+
+// statementPeriod возвращает период выписки из версии файла; ok=false, если версия не выписка
+func (h *Handler) statementPeriod(fileID string, version int) (from, to time.Time, ok bool, err error) {
+	var dateFrom, dateTo sql.NullString
+	var count int
+	err = h.db.QueryRow(
+		"SELECT COUNT(*), MIN(NULLIF(date_from, '')), MAX(NULLIF(date_to, '')) FROM bank_statements WHERE file_id = ? AND version = ?",
+		fileID, version,
+	).Scan(&count, &dateFrom, &dateTo)
+	if err != nil || count == 0 {
+		return from, to, false, err
+	}
+	from, _ = time.Parse("2006-01-02", dateFrom.String)
+	to, _ = time.Parse("2006-01-02", dateTo.String)
+	return from, to, true, nil
+}
+
+// currentTransactions - операции из текущих (закрепленных или последних) версий файлов пользователя.
+// Одна операция из нескольких выписок учитывается один раз. Одинаковые операции внутри одной выписки
+// (два платежа в один день на ту же сумму тому же контрагенту без номера документа) - разные операции:
+// повтор определяется по отпечатку и порядковому номеру среди одинаковых операций своей выписки.
+// Первый аргумент запроса - id пользователя.
+const currentTransactions = `WITH current AS (
+	SELECT t.* FROM transactions t JOIN files f ON f.id = t.file_id
+	WHERE f.user_id = ? AND t.version = CASE WHEN COALESCE(f.pinned_version, 0) > 0 THEN f.pinned_version ELSE f.version END
+), numbered AS (
+	SELECT id, fingerprint, ROW_NUMBER() OVER (PARTITION BY file_id, fingerprint ORDER BY id) AS occurrence FROM current
+), operations AS (
+	SELECT * FROM current WHERE id IN (SELECT MIN(id) FROM numbered GROUP BY fingerprint, occurrence)
+) `
+
+// transactionFilterWhere строит условие SQL для отбора операций
+func transactionFilterWhere(filter models.TransactionFilter) (string, []interface{}, error) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+
+	from, to := filter.From, filter.To
+	if filter.Period != "" {
+		start, end, err := ai.ParsePeriod(filter.Period)
+		if err != nil {
+			return "", nil, err
+		}
+		from, to = start, end
+	}
+	for _, date := range []struct{ value, op string }{{from, ">="}, {to, "<="}} {
+		if date.value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date.value); err != nil {
+			return "", nil, fmt.Errorf("invalid date %q: expected YYYY-MM-DD", date.value)
+		}
+		conditions = append(conditions, "date "+date.op+" ?")
+		args = append(args, date.value)
+	}
+
+	switch filter.Direction {
+	case "":
+	case bank.DirectionIn, bank.DirectionOut:
+		conditions = append(conditions, "direction = ?")
+		args = append(args, filter.Direction)
+	default:
+		return "", nil, fmt.Errorf("invalid direction %q: expected in or out", filter.Direction)
+	}
+	if filter.Currency != "" {
+		conditions = append(conditions, "currency = ?")
+		args = append(args, strings.ToUpper(strings.TrimSpace(filter.Currency)))
+	}
+	if filter.Category != "" {
+		conditions = append(conditions, "category = ?")
+		args = append(args, strings.TrimSpace(filter.Category))
+	}
+	if filter.INN != "" {
+		conditions = append(conditions, "counterparty_inn = ?")
+		args = append(args, strings.TrimSpace(filter.INN))
+	}
+	if filter.FileID != "" {
+		conditions = append(conditions, "file_id = ?")
+		args = append(args, filter.FileID)
+	}
+	if !filter.Internal {
+		conditions = append(conditions, "internal = 0")
+	}
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+func rubles(kopecks int64) float64 {
+	return float64(kopecks) / 100
+}
+
+// bindTransactionFilter читает фильтр операций из параметров запроса; при ошибке отвечает 400
+func bindTransactionFilter(c *gin.Context) (string, []interface{}, bool) {
+	var filter models.TransactionFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", nil, false
+	}
+	where, args, err := transactionFilterWhere(filter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", nil, false
+	}
+	return where, append([]interface{}{c.GetString("user_id")}, args...), true
+}
+
+// currencyTotals - итоги по валютам. Суммы в разных валютах не складываются: total_in и total_out
+// заполнены, только если все операции в одной валюте.
+func currencyTotals(response gin.H, totals map[string][2]int64) {
+	currencies := make([]string, 0, len(totals))
+	for currency := range totals {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	list := []gin.H{}
+	for _, currency := range currencies {
+		list = append(list, gin.H{"currency": currency, "in": rubles(totals[currency][0]), "out": rubles(totals[currency][1])})
+	}
+	response["totals"] = list
+	response["total_in"], response["total_out"] = nil, nil
+	switch len(currencies) {
+	case 0:
+		response["total_in"], response["total_out"] = 0, 0
+	case 1:
+		response["total_in"], response["total_out"] = list[0]["in"], list[0]["out"]
+	}
+}
+
+// GetTransactions - операции из загруженных банковских выписок
+// (?from=&to= или ?period=2025-03, direction=in|out, currency, category, inn, file_id, internal=true, limit, offset)
+func (h *Handler) GetTransactions(c *gin.Context) {
+	where, args, ok := bindTransactionFilter(c)
+	if !ok {
+		return
+	}
+	limit, offset := defaultTransactionsLimit, 0
+	if value, err := strconv.Atoi(c.Query("limit")); err == nil && value > 0 {
+		limit = value
+	}
+	if limit > maxTransactionsLimit {
+		limit = maxTransactionsLimit
+	}
+	if value, err := strconv.Atoi(c.Query("offset")); err == nil && value > 0 {
+		offset = value
+	}
+
+	total := 0
+	totals := make(map[string][2]int64)
+	totalRows, err := h.db.Query(
+		currentTransactions+`SELECT currency, COUNT(*), SUM(CASE WHEN direction = 'in' THEN amount ELSE 0 END),
+		SUM(CASE WHEN direction = 'out' THEN amount ELSE 0 END) FROM operations WHERE `+where+` GROUP BY currency`,
+		args...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	for totalRows.Next() {
+		var currency string
+		var count int
+		var in, out int64
+		if err := totalRows.Scan(&currency, &count, &in, &out); err != nil {
+			totalRows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		total += count
+		totals[currency] = [2]int64{in, out}
+	}
+	totalRows.Close()
+
+	rows, err := h.db.Query(
+		currentTransactions+`SELECT id, file_id, date, amount, currency, direction, internal, account, counterparty,
+		counterparty_inn, counterparty_account, purpose, doc_number, doc_type, mcc, category, category_source
+		FROM operations WHERE `+where+` ORDER BY date DESC, id DESC LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	transactions := []models.Transaction{}
+	for rows.Next() {
+		var t models.Transaction
+		var amount int64
+		if err := rows.Scan(&t.ID, &t.FileID, &t.Date, &amount, &t.Currency, &t.Direction, &t.Internal, &t.Account,
+			&t.Counterparty, &t.CounterpartyINN, &t.CounterpartyAccount, &t.Purpose, &t.DocNumber, &t.DocType,
+			&t.MCC, &t.Category, &t.CategorySource); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		t.Amount = rubles(amount)
+		t.CategoryName = bank.CategoryNames[t.Category]
+		transactions = append(transactions, t)
+	}
+
+	response := gin.H{
+		"transactions": transactions,
+		"total":        total,
+	}
+	currencyTotals(response, totals)
+	c.JSON(http.StatusOK, response)
+}
+
+// Группировки для сводки по операциям: ключ группы и ее название
+var transactionGroups = map[string][2]string{
+	"counterparty": {"COALESCE(NULLIF(counterparty_inn, ''), counterparty)", "MAX(counterparty)"},
+	"month":        {"substr(date, 1, 7)", "substr(date, 1, 7)"},
+	"day":          {"date", "date"},
+	"category":     {"category", "category"},
+}
+
+// GetTransactionsSummary - поступления и списания по контрагентам, месяцам или дням отдельно
+// по каждой валюте (?group_by=counterparty|month|day|category и те же фильтры, что у GetTransactions)
+func (h *Handler) GetTransactionsSummary(c *gin.Context) {
+	where, args, ok := bindTransactionFilter(c)
+	if !ok {
+		return
+	}
+	groupBy := c.DefaultQuery("group_by", "counterparty")
+	group, known := transactionGroups[groupBy]
+	if !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be counterparty, month, day or category"})
+		return
+	}
+	order := "total_out DESC, total_in DESC"
+	if groupBy != "counterparty" {
+		order = "key"
+	}
+
+	rows, err := h.db.Query(
+		currentTransactions+`SELECT `+group[0]+` AS key, currency, `+group[1]+`, MAX(counterparty_inn),
+		SUM(CASE WHEN direction = 'in' THEN amount ELSE 0 END) AS total_in,
+		SUM(CASE WHEN direction = 'out' THEN amount ELSE 0 END) AS total_out,
+		SUM(CASE WHEN direction = 'in' THEN 1 ELSE 0 END), SUM(CASE WHEN direction = 'out' THEN 1 ELSE 0 END)
+		FROM operations WHERE `+where+` GROUP BY key, currency ORDER BY currency, `+order,
+		args...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	groups := []gin.H{}
+	totals := make(map[string][2]int64)
+	for rows.Next() {
+		var key, currency, name, inn string
+		var in, out int64
+		var countIn, countOut int
+		if err := rows.Scan(&key, &currency, &name, &inn, &in, &out, &countIn, &countOut); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		group := gin.H{"key": key, "name": name, "currency": currency, "in": rubles(in), "out": rubles(out),
+			"count_in": countIn, "count_out": countOut}
+		switch groupBy {
+		case "counterparty":
+			group["inn"] = inn
+		case "category":
+			group["name"] = bank.CategoryNames[key]
+			if key == "" {
+				group["name"] = "Без категории"
+			}
+		}
+		groups = append(groups, group)
+		sum := totals[currency]
+		totals[currency] = [2]int64{sum[0] + in, sum[1] + out}
+	}
+
+	response := gin.H{
+		"group_by": groupBy,
+		"groups":   groups,
+	}
+	currencyTotals(response, totals)
+	c.JSON(http.StatusOK, response)
+}
+
+// GetBankStatements - загруженные выписки: счета, периоды и остатки
+func (h *Handler) GetBankStatements(c *gin.Context) {
+	rows, err := h.db.Query(
+		`SELECT s.file_id, f.filename, s.format, s.account, s.currency, s.date_from, s.date_to, s.opening_balance,
+		s.closing_balance, (SELECT COUNT(*) FROM transactions t WHERE t.file_id = s.file_id AND t.version = s.version
+			AND (s.account = '' OR t.account = s.account AND t.currency = s.currency))
+		FROM bank_statements s JOIN files f ON f.id = s.file_id
+		WHERE f.user_id = ? AND s.version = CASE WHEN COALESCE(f.pinned_version, 0) > 0 THEN f.pinned_version ELSE f.version END
+		ORDER BY s.date_from DESC, s.account`,
+		c.GetString("user_id"),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	statements := []gin.H{}
+	for rows.Next() {
+		var fileID, filename, format, account, currency, dateFrom, dateTo string
+		var opening, closing sql.NullInt64
+		var transactions int
+		if err := rows.Scan(&fileID, &filename, &format, &account, &currency, &dateFrom, &dateTo, &opening, &closing, &transactions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		statement := gin.H{
+			"file_id":         fileID,
+			"filename":        filename,
+			"format":          format,
+			"account":         account,
+			"currency":        currency,
+			"date_from":       dateFrom,
+			"date_to":         dateTo,
+			"opening_balance": nil,
+			"closing_balance": nil,
+			"transactions":    transactions,
+		}
+		if opening.Valid {
+			statement["opening_balance"] = rubles(opening.Int64)
+			statement["closing_balance"] = rubles(closing.Int64)
+		}
+		statements = append(statements, statement)
+	}
+	c.JSON(http.StatusOK, gin.H{"statements": statements})
+}
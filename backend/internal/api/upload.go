@@ -0,0 +1,296 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Ограничения по умолчанию
+const (
+	defaultMaxFileSizeMB    = 20
+	defaultMaxUserStorageMB = 200
+	defaultAllowedFileTypes = "docx,xlsx,txt,csv,md,xml,json,sta,mt940"
+
+	// Пакетная загрузка: несколько файлов в одном запросе и ZIP-архивы
+	defaultMaxBulkUploadMB      = 100 // размер всего запроса
+	defaultMaxBulkFiles         = 200 // файлов в запросе вместе с содержимым архивов
+	defaultMaxArchiveUnpackedMB = 200 // суммарный размер распакованного архива
+	maxCompressionRatio         = 100 // во сколько раз файл в архиве может быть больше сжатого
+)
+
+// Коды ошибок загрузки (поле "code" в ответе)
+const (
+	uploadErrNoExtension     = "no_extension"
+	uploadErrTypeNotAllowed  = "type_not_allowed"
+	uploadErrContentMismatch = "content_mismatch"
+	uploadErrFileTooLarge    = "file_too_large"
+	uploadErrQuotaExceeded   = "quota_exceeded"
+	uploadErrEmptyFile       = "empty_file"
+	uploadErrInternal        = "internal_error"
+
+	// Ошибки пакетной загрузки и архивов
+	uploadErrTooManyFiles    = "too_many_files"
+	uploadErrInvalidArchive  = "invalid_archive"
+	uploadErrArchiveTooLarge = "archive_too_large"
+	uploadErrUnsafePath      = "unsafe_path"
+	uploadErrNestedArchive   = "nested_archive"
+	uploadErrSuspiciousZip   = "suspicious_compression"
+)
+
+// uploadError - ошибка проверки файла с HTTP статусом для ответа
+type uploadError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *uploadError) Error() string {
+	return e.Message
+}
+
+// uploadLimits - настройки проверки загружаемых файлов
+type uploadLimits struct {
+	MaxFileSize    int64           // байт на один файл
+	MaxUserStorage int64           // байт на все файлы пользователя
+	AllowedTypes   map[string]bool // расширения без точки
+
+	MaxRequestSize     int64 // байт на весь запрос при пакетной загрузке
+	MaxFiles           int   // файлов в одном запросе, включая содержимое архивов
+	MaxArchiveUnpacked int64 // байт в распакованном архиве
+}
+
+// uploadLimitsFromEnv читает MAX_UPLOAD_SIZE_MB, MAX_USER_STORAGE_MB, ALLOWED_FILE_TYPES,
+// MAX_BULK_UPLOAD_MB, MAX_BULK_FILES и MAX_ARCHIVE_UNPACKED_MB
+func uploadLimitsFromEnv() uploadLimits {
+	limits := uploadLimits{
+		MaxFileSize:        envMegabytes("MAX_UPLOAD_SIZE_MB", defaultMaxFileSizeMB),
+		MaxUserStorage:     envMegabytes("MAX_USER_STORAGE_MB", defaultMaxUserStorageMB),
+		AllowedTypes:       make(map[string]bool),
+		MaxRequestSize:     envMegabytes("MAX_BULK_UPLOAD_MB", defaultMaxBulkUploadMB),
+		MaxFiles:           defaultMaxBulkFiles,
+		MaxArchiveUnpacked: envMegabytes("MAX_ARCHIVE_UNPACKED_MB", defaultMaxArchiveUnpackedMB),
+	}
+	if value, err := strconv.Atoi(os.Getenv("MAX_BULK_FILES")); err == nil && value > 0 {
+		limits.MaxFiles = value
+	}
+	// Один файл максимального размера должен проходить и через лимит запроса
+	if limits.MaxRequestSize < limits.MaxFileSize {
+		limits.MaxRequestSize = limits.MaxFileSize
+	}
+
+	allowed := os.Getenv("ALLOWED_FILE_TYPES")
+	if allowed == "" {
+		allowed = defaultAllowedFileTypes
+	}
+	for _, ext := range strings.Split(allowed, ",") {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		// Разрешить можно только форматы, содержимое которых мы умеем проверять
+		if _, ok := fileSignatures[ext]; ok {
+			limits.AllowedTypes[ext] = true
+		}
+	}
+	return limits
+}
+
+func envMegabytes(name string, def int64) int64 {
+	if value, err := strconv.ParseInt(os.Getenv(name), 10, 64); err == nil && value > 0 {
+		return value << 20
+	}
+	return def << 20
+}
+
+// allowedList возвращает разрешенные расширения через запятую (для сообщений об ошибках)
+func (l uploadLimits) allowedList() string {
+	var list []string
+	for _, ext := range fileTypeOrder {
+		if l.AllowedTypes[ext] {
+			list = append(list, ext)
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+// fileTypeOrder - порядок форматов в сообщениях
+var fileTypeOrder = []string{"docx", "xlsx", "txt", "csv", "md", "xml", "json", "sta", "mt940"}
+
+// fileSignatures проверяют, что содержимое файла соответствует расширению
+var fileSignatures = map[string]func(file io.ReaderAt, size int64, head []byte) bool{
+	"docx": func(file io.ReaderAt, size int64, head []byte) bool {
+		return isOfficeZip(file, size, head, "word/document.xml")
+	},
+	"xlsx": func(file io.ReaderAt, size int64, head []byte) bool {
+		return isOfficeZip(file, size, head, "xl/workbook.xml")
+	},
+	"txt": isText,
+	"csv": isText,
+	"md":  isText,
+	"xml": isXML,
+	// Выгрузки чеков ОФД
+	"json": isJSON,
+	// Выписки SWIFT MT940
+	"sta":   isText,
+	"mt940": isText,
+}
+
+// isOfficeZip проверяет сигнатуру ZIP и наличие главной части документа Office Open XML
+func isOfficeZip(file io.ReaderAt, size int64, head []byte, part string) bool {
+	if !bytes.HasPrefix(head, []byte("PK\x03\x04")) {
+		return false
+	}
+	r, err := zip.NewReader(file, size)
+	if err != nil {
+		return false
+	}
+	for _, f := range r.File {
+		if f.Name == part {
+			return true
+		}
+	}
+	return false
+}
+
+// binarySignatures - сигнатуры бинарных форматов, которые нельзя выдавать за текст
+var binarySignatures = [][]byte{
+	[]byte("PK\x03\x04"),                       // zip, docx, xlsx
+	[]byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1"), // xls, doc
+	[]byte("%PDF-"),
+	[]byte("\x89PNG"),
+	[]byte("\xFF\xD8\xFF"), // jpeg
+	[]byte("MZ"),           // exe
+	[]byte("\x7FELF"),
+}
+
+// isText считает файл текстовым, если в начале нет нулевых байт и бинарных сигнатур.
+// Кодировку не проверяем: выгрузки из 1С и банков часто приходят в windows-1251.
+func isText(file io.ReaderAt, size int64, head []byte) bool {
+	for _, signature := range binarySignatures {
+		if bytes.HasPrefix(head, signature) {
+			return false
+		}
+	}
+	return bytes.IndexByte(head, 0) < 0
+}
+
+// isXML - текст, который начинается с "<" (после BOM и пробелов)
+func isXML(file io.ReaderAt, size int64, head []byte) bool {
+	if !isText(file, size, head) {
+		return false
+	}
+	head = bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+	return bytes.HasPrefix(head, []byte("<"))
+}
+
+// isJSON - текст, который начинается с "{" или "[" (после BOM и пробелов)
+func isJSON(file io.ReaderAt, size int64, head []byte) bool {
+	if !isText(file, size, head) {
+		return false
+	}
+	head = bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+	return bytes.HasPrefix(head, []byte("{")) || bytes.HasPrefix(head, []byte("["))
+}
+
+// uploadReader - содержимое загружаемого файла: часть multipart-формы или файл из архива в памяти
+type uploadReader interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+}
+
+// validateUpload проверяет расширение, размер и содержимое файла.
+// Возвращает расширение файла без точки в нижнем регистре.
+func validateUpload(file uploadReader, filename string, size int64, limits uploadLimits) (string, *uploadError) {
+	fileType := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if fileType == "" {
+		return "", &uploadError{
+			Status:  http.StatusUnsupportedMediaType,
+			Code:    uploadErrNoExtension,
+			Message: fmt.Sprintf("File %q has no extension. Allowed types: %s", filename, limits.allowedList()),
+		}
+	}
+	if !limits.AllowedTypes[fileType] {
+		return "", &uploadError{
+			Status:  http.StatusUnsupportedMediaType,
+			Code:    uploadErrTypeNotAllowed,
+			Message: fmt.Sprintf("File type .%s is not allowed. Allowed types: %s", fileType, limits.allowedList()),
+		}
+	}
+
+	if size == 0 {
+		return "", &uploadError{Status: http.StatusBadRequest, Code: uploadErrEmptyFile, Message: "File is empty"}
+	}
+	if size > limits.MaxFileSize {
+		return "", &uploadError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Code:    uploadErrFileTooLarge,
+			Message: fmt.Sprintf("File is too large: %s, maximum is %s", formatBytes(size), formatBytes(limits.MaxFileSize)),
+		}
+	}
+
+	head := make([]byte, 8192)
+	n, err := file.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", &uploadError{Status: http.StatusInternalServerError, Code: uploadErrInternal, Message: "Failed to read file"}
+	}
+	if !fileSignatures[fileType](file, size, head[:n]) {
+		return "", &uploadError{
+			Status:  http.StatusUnsupportedMediaType,
+			Code:    uploadErrContentMismatch,
+			Message: fmt.Sprintf("File content does not match its .%s extension", fileType),
+		}
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", &uploadError{Status: http.StatusInternalServerError, Code: uploadErrInternal, Message: "Failed to read file"}
+	}
+
+	return fileType, nil
+}
+
+// checkQuota проверяет, что файл размером size поместится в квоту пользователя
+func (h *Handler) checkQuota(userID string, size int64, limits uploadLimits) *uploadError {
+	used, err := h.userStorageUsed(userID)
+	if err != nil {
+		return &uploadError{Status: http.StatusInternalServerError, Code: uploadErrInternal, Message: "Database error"}
+	}
+	if used+size > limits.MaxUserStorage {
+		return &uploadError{
+			Status: http.StatusRequestEntityTooLarge,
+			Code:   uploadErrQuotaExceeded,
+			Message: fmt.Sprintf("Storage quota exceeded: used %s of %s, file needs %s",
+				formatBytes(used), formatBytes(limits.MaxUserStorage), formatBytes(size)),
+		}
+	}
+	return nil
+}
+
+// userStorageUsed возвращает суммарный размер всех версий файлов пользователя.
+// Версии, ссылающиеся на один объект в хранилище (после восстановления), считаются один раз.
+func (h *Handler) userStorageUsed(userID string) (int64, error) {
+	var used sql.NullInt64
+	err := h.db.QueryRow(
+		`SELECT SUM(file_size) FROM (
+			SELECT DISTINCT v.file_path, v.file_size FROM file_versions v
+			JOIN files f ON f.id = v.file_id WHERE f.user_id = ?
+		)`,
+		userID,
+	).Scan(&used)
+	return used.Int64, err
+}
+
+func formatBytes(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/models"
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateUpload(t *testing.T) {
+	limits := testLimits()
+	for _, ext := range []string{"docx", "xlsx", "xml", "json"} {
+		limits.AllowedTypes[ext] = true
+	}
+	docx := makeZip(t, zipEntry{name: "[Content_Types].xml", data: []byte("<Types/>")}, zipEntry{name: "word/document.xml", data: []byte("<w:document/>")})
+
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+		status   int
+		code     string
+	}{
+		{name: "текст", filename: "Выписка.TXT", data: []byte("Дата;Сумма\n01.03.2026;100\n")},
+		{name: "текст в windows-1251", filename: "1c.txt", data: []byte("\xc2\xfb\xef\xe8\xf1\xea\xe0")},
+		{name: "xml с BOM", filename: "camt.xml", data: []byte("\xef\xbb\xbf\n<Document/>")},
+		{name: "json", filename: "checks.json", data: []byte(` [{"sum": 100}]`)},
+		{name: "docx", filename: "договор.docx", data: docx},
+
+		{name: "без расширения", filename: "README", data: []byte("text"), status: http.StatusUnsupportedMediaType, code: uploadErrNoExtension},
+		{name: "запрещенный тип", filename: "scan.pdf", data: []byte("%PDF-1.7"), status: http.StatusUnsupportedMediaType, code: uploadErrTypeNotAllowed},
+		{name: "PDF под видом текста", filename: "scan.txt", data: []byte("%PDF-1.7\n"), status: http.StatusUnsupportedMediaType, code: uploadErrContentMismatch},
+		{name: "ZIP под видом csv", filename: "data.csv", data: docx, status: http.StatusUnsupportedMediaType, code: uploadErrContentMismatch},
+		{name: "нулевые байты в тексте", filename: "data.csv", data: []byte("a;b\x00c"), status: http.StatusUnsupportedMediaType, code: uploadErrContentMismatch},
+		{name: "docx без документа", filename: "пустой.docx", data: makeZip(t, zipEntry{name: "word/styles.xml", data: []byte("<w:styles/>")}), status: http.StatusUnsupportedMediaType, code: uploadErrContentMismatch},
+		{name: "docx под видом xlsx", filename: "отчет.xlsx", data: docx, status: http.StatusUnsupportedMediaType, code: uploadErrContentMismatch},
+		{name: "текст под видом xml", filename: "camt.xml", data: []byte("Document"), status: http.StatusUnsupportedMediaType, code: uploadErrContentMismatch},
+		{name: "текст под видом json", filename: "checks.json", data: []byte("sum=100"), status: http.StatusUnsupportedMediaType, code: uploadErrContentMismatch},
+		{name: "пустой файл", filename: "empty.txt", data: nil, status: http.StatusBadRequest, code: uploadErrEmptyFile},
+		{name: "больше лимита", filename: "big.txt", data: bytes.Repeat([]byte("a"), 1<<20+1), status: http.StatusRequestEntityTooLarge, code: uploadErrFileTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := bytes.NewReader(tt.data)
+			fileType, uploadErr := validateUpload(file, tt.filename, int64(len(tt.data)), limits)
+			if tt.code == "" {
+				if uploadErr != nil {
+					t.Fatalf("validateUpload: %d %s: %s", uploadErr.Status, uploadErr.Code, uploadErr.Message)
+				}
+				if want := strings.ToLower(tt.filename[strings.LastIndex(tt.filename, ".")+1:]); fileType != want {
+					t.Errorf("type %q, want %q", fileType, want)
+				}
+				// После проверки файл читается с начала
+				if rest, _ := io.ReadAll(file); !bytes.Equal(rest, tt.data) {
+					t.Error("file is not rewound after validation")
+				}
+				return
+			}
+			if uploadErr == nil {
+				t.Fatalf("validateUpload accepted the file, want %d %s", tt.status, tt.code)
+			}
+			if uploadErr.Status != tt.status || uploadErr.Code != tt.code {
+				t.Errorf("error %d %s (%s), want %d %s", uploadErr.Status, uploadErr.Code, uploadErr.Message, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+// Квота считает все версии файлов пользователя
+func TestSaveUploadQuota(t *testing.T) {
+	h := newTestHandler(t)
+	limits := testLimits()
+	limits.MaxUserStorage = 100
+	upload := func(name, content string) *uploadError {
+		_, uploadErr := h.saveUpload(context.Background(), testUserID, uploadSource{
+			Name: name, Size: int64(len(content)), Content: strings.NewReader(content),
+		}, models.UpdateFileRequest{}, limits)
+		return uploadErr
+	}
+
+	if err := upload("a.txt", strings.Repeat("a", 40)); err != nil {
+		t.Fatalf("first upload: %v", err)
+	}
+	if err := upload("a.txt", strings.Repeat("b", 40)); err != nil {
+		t.Fatalf("second version: %v", err)
+	}
+	err := upload("c.txt", strings.Repeat("c", 21))
+	if err == nil || err.Status != http.StatusRequestEntityTooLarge || err.Code != uploadErrQuotaExceeded {
+		t.Fatalf("upload over quota: %v, want 413 %s", err, uploadErrQuotaExceeded)
+	}
+	if err := upload("c.txt", strings.Repeat("c", 20)); err != nil {
+		t.Errorf("upload up to quota: %v", err)
+	}
+	if used, _ := h.userStorageUsed(testUserID); used != 100 {
+		t.Errorf("storage used %d, want 100", used)
+	}
+}
+
+// uploadForm отправляет файл в POST /api/files/upload
+func uploadForm(h *Handler, filename string, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	fw, _ := w.CreateFormFile("file", filename)
+	fw.Write(data)
+	w.Close()
+
+	router := gin.New()
+	router.POST("/api/files/upload", func(c *gin.Context) {
+		c.Set("user_id", testUserID)
+		h.UploadFile(c)
+	})
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/files/upload", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestUploadFileLimits(t *testing.T) {
+	t.Setenv("MAX_UPLOAD_SIZE_MB", "1")
+	t.Setenv("MAX_USER_STORAGE_MB", "2")
+	t.Setenv("ALLOWED_FILE_TYPES", "txt,csv,pdf")
+	h := newTestHandler(t)
+
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+		status   int
+		code     string
+	}{
+		{"текст", "выписка.txt", []byte("Дата;Сумма\n"), http.StatusOK, ""},
+		// pdf нельзя разрешить: его содержимое не проверяется
+		{"pdf не разрешается через ALLOWED_FILE_TYPES", "scan.pdf", []byte("%PDF-1.7"), http.StatusUnsupportedMediaType, uploadErrTypeNotAllowed},
+		{"подмена расширения", "scan.csv", []byte("\x89PNG\r\n"), http.StatusUnsupportedMediaType, uploadErrContentMismatch},
+		{"больше MAX_UPLOAD_SIZE_MB", "big.txt", bytes.Repeat([]byte("a"), 1<<20+1), http.StatusRequestEntityTooLarge, uploadErrFileTooLarge},
+		{"ровно MAX_UPLOAD_SIZE_MB", "max1.txt", bytes.Repeat([]byte("a"), 1<<20), http.StatusOK, ""},
+		{"сверх MAX_USER_STORAGE_MB", "max2.txt", bytes.Repeat([]byte("b"), 1<<20), http.StatusRequestEntityTooLarge, uploadErrQuotaExceeded},
+	}
+	for _, tt := range tests {
+		w := uploadForm(h, tt.filename, tt.data)
+		if w.Code != tt.status || (tt.code != "" && !strings.Contains(w.Body.String(), `"code":"`+tt.code+`"`)) {
+			t.Errorf("%s: %d %s, want %d %s", tt.name, w.Code, w.Body.String(), tt.status, tt.code)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/ai"
+	"alfa-hack-backend/internal/models"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// fileSelect - колонки files в порядке, который ожидает scanFile
+const fileSelect = `SELECT id, user_id, filename, file_path, file_type, file_size, uploaded_at,
+	COALESCE(sha256, ''), COALESCE(version, 1), COALESCE(pinned_version, 0),
+	COALESCE(folder, ''), COALESCE(description, ''), COALESCE(period, ''), COALESCE(doc_kind, ''),
+	COALESCE(period_auto, 1), COALESCE(doc_kind_auto, 1),
+	COALESCE((SELECT group_concat(tag, ',') FROM file_tags WHERE file_id = f.id), ''),
+	COALESCE((SELECT status FROM ingest_jobs WHERE file_id = f.id AND version = f.version), ''),
+	COALESCE((SELECT error FROM ingest_jobs WHERE file_id = f.id AND version = f.version), '') FROM files f`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFile(row rowScanner) (models.File, error) {
+	var f models.File
+	var tags string
+	err := row.Scan(&f.ID, &f.UserID, &f.Filename, &f.FilePath, &f.FileType, &f.FileSize, &f.UploadedAt,
+		&f.SHA256, &f.Version, &f.PinnedVersion,
+		&f.Folder, &f.Description, &f.Period, &f.DocKind, &f.PeriodAuto, &f.DocKindAuto, &tags,
+		&f.Status, &f.StatusError)
+	f.Tags = splitTags(tags)
+	return f, err
+}
+
+// findFile возвращает файл пользователя по условию; nil, если такого нет
+func (h *Handler) findFile(where string, args ...interface{}) (*models.File, error) {
+	f, err := scanFile(h.db.QueryRow(fileSelect+" WHERE "+where+" LIMIT 1", args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// hashFile считает SHA-256 содержимого и возвращает файл в начало
+func hashFile(file io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// backfillHash считает хеш файла, загруженного до появления хешей, и сохраняет его
+func (h *Handler) backfillHash(ctx context.Context, file *models.File) (string, error) {
+	rc, err := h.store.Get(ctx, file.FilePath)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, rc); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	if _, err := h.db.Exec("UPDATE files SET sha256 = ? WHERE id = ?", sum, file.ID); err != nil {
+		return "", err
+	}
+	if _, err := h.db.Exec("UPDATE file_versions SET sha256 = ? WHERE file_id = ? AND file_path = ?", sum, file.ID, file.FilePath); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+// versionKey - ключ в хранилище для версии файла: первая версия лежит по старой схеме "<userID>/<fileID>.<ext>"
+func versionKey(userID, fileID string, version int, fileType string) string {
+	if version <= 1 {
+		return path.Join(userID, fileID+"."+fileType)
+	}
+	return path.Join(userID, fmt.Sprintf("%s.v%d.%s", fileID, version, fileType))
+}
+
+// addFileVersion записывает новую версию, ставит ее в очередь обработки и делает текущей версией файла
+func (h *Handler) addFileVersion(tx *sql.Tx, fileID string, version int, filePath string, fileSize int64, hash string) error {
+	versionID := uuid.New().String()
+	_, err := tx.Exec(
+		"INSERT INTO file_versions (id, file_id, version, file_path, file_size, sha256) VALUES (?, ?, ?, ?, ?, ?)",
+		versionID, fileID, version, filePath, fileSize, hash,
+	)
+	if err != nil {
+		return err
+	}
+	// Каждая версия проходит фоновую обработку; обработчики будит wakeIngestion после коммита
+	_, err = tx.Exec(
+		"INSERT INTO ingest_jobs (id, file_id, version, file_path) VALUES (?, ?, ?, ?)",
+		versionID, fileID, version, filePath,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"UPDATE files SET file_path = ?, file_size = ?, sha256 = ?, version = ?, uploaded_at = CURRENT_TIMESTAMP WHERE id = ?",
+		filePath, fileSize, hash, version, fileID,
+	)
+	return err
+}
+
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// nextVersion возвращает номер следующей версии файла
+func nextVersion(q rowQuerier, fileID string) (int, error) {
+	var last int
+	err := q.QueryRow("SELECT COALESCE(MAX(version), 0) FROM file_versions WHERE file_id = ?", fileID).Scan(&last)
+	return last + 1, err
+}
+
+// getFileVersions возвращает версии файла от новых к старым
+func (h *Handler) getFileVersions(fileID string) ([]models.FileVersion, error) {
+	rows, err := h.db.Query(
+		"SELECT id, file_id, version, file_path, file_size, COALESCE(sha256, ''), uploaded_at FROM file_versions WHERE file_id = ? ORDER BY version DESC",
+		fileID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []models.FileVersion
+	for rows.Next() {
+		var v models.FileVersion
+		if err := rows.Scan(&v.ID, &v.FileID, &v.Version, &v.FilePath, &v.FileSize, &v.SHA256, &v.UploadedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// getFileVersion возвращает одну версию файла; nil, если такой нет
+func (h *Handler) getFileVersion(fileID string, version int) (*models.FileVersion, error) {
+	var v models.FileVersion
+	err := h.db.QueryRow(
+		"SELECT id, file_id, version, file_path, file_size, COALESCE(sha256, ''), uploaded_at FROM file_versions WHERE file_id = ? AND version = ?",
+		fileID, version,
+	).Scan(&v.ID, &v.FileID, &v.Version, &v.FilePath, &v.FileSize, &v.SHA256, &v.UploadedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// userFileFromParam находит файл текущего пользователя по :id; при ошибке сам отвечает клиенту
+func (h *Handler) userFileFromParam(c *gin.Context) *models.File {
+	file, err := h.findFile("id = ? AND user_id = ?", c.Param("id"), c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil
+	}
+	if file == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return nil
+	}
+	return file
+}
+
+// GetFileVersions - список версий файла
+func (h *Handler) GetFileVersions(c *gin.Context) {
+	file := h.userFileFromParam(c)
+	if file == nil {
+		return
+	}
+
+	versions, err := h.getFileVersions(file.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file versions"})
+		return
+	}
+	if versions == nil {
+		versions = []models.FileVersion{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file_id":        file.ID,
+		"filename":       file.Filename,
+		"version":        file.Version,
+		"pinned_version": file.PinnedVersion,
+		"versions":       versions,
+	})
+}
+
+// RestoreFileVersion - делает содержимое старой версии текущим.
+// Создается новая версия с тем же содержимым (история не переписывается), закрепление снимается.
+func (h *Handler) RestoreFileVersion(c *gin.Context) {
+	file := h.userFileFromParam(c)
+	if file == nil {
+		return
+	}
+
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+	old, err := h.getFileVersion(file.ID, number)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if old == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	version, err := nextVersion(tx, file.ID)
+	if err == nil {
+		// Объект в хранилище не копируем: новая версия ссылается на тот же ключ
+		err = h.addFileVersion(tx, file.ID, version, old.FilePath, old.FileSize, old.SHA256)
+	}
+	if err == nil {
+		_, err = tx.Exec("UPDATE files SET pinned_version = 0 WHERE id = ?", file.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore version"})
+		return
+	}
+	h.wakeIngestion()
+
+	c.JSON(http.StatusOK, gin.H{
+		"file_id":       file.ID,
+		"version":       version,
+		"restored_from": old.Version,
+	})
+}
+
+// PinFileVersion - закрепляет версию файла для анализа (version = 0 - снова использовать последнюю)
+func (h *Handler) PinFileVersion(c *gin.Context) {
+	file := h.userFileFromParam(c)
+	if file == nil {
+		return
+	}
+
+	var req models.PinVersionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if req.Version != 0 {
+		v, err := h.getFileVersion(file.ID, req.Version)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if v == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+			return
+		}
+	}
+
+	if _, err := h.db.Exec("UPDATE files SET pinned_version = ? WHERE id = ?", req.Version, file.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pin version"})
+		return
+	}
+	// В анализ теперь идет другое содержимое - вид документа и период могли измениться
+	if err := h.detectFileMeta(file.ID); err != nil {
+		log.Printf("Failed to detect document kind for file %s: %v", file.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"file_id": file.ID, "pinned_version": req.Version})
+}
+
+// DiffFileVersions - построчное сравнение текста двух версий файла (?from=1&to=2).
+// По умолчанию сравнивается текущая версия с предыдущей.
+func (h *Handler) DiffFileVersions(c *gin.Context) {
+	file := h.userFileFromParam(c)
+	if file == nil {
+		return
+	}
+
+	to, err := strconv.Atoi(c.DefaultQuery("to", strconv.Itoa(file.Version)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' version"})
+		return
+	}
+	// По умолчанию сравнивается с предыдущей версией; у первой версии ее нет
+	if _, ok := c.GetQuery("from"); !ok && to <= 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Version %d has no earlier version to compare with", to)})
+		return
+	}
+	from, err := strconv.Atoi(c.DefaultQuery("from", strconv.Itoa(to-1)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' version"})
+		return
+	}
+
+	var lines [2][]ai.TextLine
+	for i, number := range []int{from, to} {
+		v, err := h.getFileVersion(file.ID, number)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if v == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Version %d not found", number)})
+			return
+		}
+		lines[i], err = ai.ExtractLines(models.File{ID: file.ID, Filename: file.Filename, FilePath: v.FilePath, FileType: file.FileType})
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("Failed to read version %d", number), "details": err.Error()})
+			return
+		}
+	}
+
+	changes, approximate := diffLines(lines[0], lines[1])
+	added, removed := 0, 0
+	for _, change := range changes {
+		if change.Type == diffAdded {
+			added++
+		} else {
+			removed++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file_id":     file.ID,
+		"from":        from,
+		"to":          to,
+		"identical":   len(changes) == 0,
+		"added":       added,
+		"removed":     removed,
+		"approximate": approximate,
+		"changes":     changes,
+	})
+}
+
+const (
+	diffAdded   = "added"
+	diffRemoved = "removed"
+
+	// Больше ячеек таблицы LCS не считаем, сравниваем строки как множества
+	maxDiffCells = 4000000
+)
+
+// diffChange - добавленная или удаленная строка
+type diffChange struct {
+	Type    string `json:"type"`
+	Section string `json:"section"`
+	Num     int    `json:"num"`
+	Text    string `json:"text"`
+}
+
+// diffLines сравнивает строки через наибольшую общую подпоследовательность.
+// Для очень больших файлов возвращает приближенный результат (approximate = true).
+func diffLines(a, b []ai.TextLine) ([]diffChange, bool) {
+	key := func(l ai.TextLine) string { return l.Section + "\x00" + l.Text }
+
+	// Общие начало и конец не участвуют в сравнении
+	start := 0
+	for start < len(a) && start < len(b) && key(a[start]) == key(b[start]) {
+		start++
+	}
+	endA, endB := len(a), len(b)
+	for endA > start && endB > start && key(a[endA-1]) == key(b[endB-1]) {
+		endA--
+		endB--
+	}
+	a, b = a[start:endA], b[start:endB]
+
+	changes := []diffChange{}
+	change := func(t string, l ai.TextLine) diffChange {
+		return diffChange{Type: t, Section: l.Section, Num: l.Num, Text: l.Text}
+	}
+
+	if len(a)*len(b) > maxDiffCells {
+		counts := make(map[string]int)
+		for _, l := range b {
+			counts[key(l)]++
+		}
+		for _, l := range a {
+			if counts[key(l)] > 0 {
+				counts[key(l)]--
+			} else {
+				changes = append(changes, change(diffRemoved, l))
+			}
+		}
+		counts = make(map[string]int)
+		for _, l := range a {
+			counts[key(l)]++
+		}
+		for _, l := range b {
+			if counts[key(l)] > 0 {
+				counts[key(l)]--
+			} else {
+				changes = append(changes, change(diffAdded, l))
+			}
+		}
+		return changes, true
+	}
+
+	// lcs[i][j] - длина общей подпоследовательности a[i:] и b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if key(a[i]) == key(b[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case key(a[i]) == key(b[j]):
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			changes = append(changes, change(diffRemoved, a[i]))
+			i++
+		default:
+			changes = append(changes, change(diffAdded, b[j]))
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		changes = append(changes, change(diffRemoved, a[i]))
+	}
+	for ; j < len(b); j++ {
+		changes = append(changes, change(diffAdded, b[j]))
+	}
+	return changes, false
+}
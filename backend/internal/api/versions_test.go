@@ -0,0 +1,50 @@
+package api
+
+import (
+	"alfa-hack-backend/internal/models"
+	"bytes"
+	"context"
+	"testing"
+)
+
+// uploadText загружает текстовый файл так же, как POST /api/files/upload
+func uploadText(t *testing.T, h *Handler, name, folder, content string) (id string, version int) {
+	t.Helper()
+	var meta models.UpdateFileRequest
+	if folder != "" {
+		meta.Folder = &folder
+	}
+	data := []byte(content)
+	file, uploadErr := h.saveUpload(context.Background(), testUserID, uploadSource{
+		Name:    name,
+		Size:    int64(len(data)),
+		Content: bytes.NewReader(data),
+	}, meta, testLimits())
+	if uploadErr != nil {
+		t.Fatalf("saveUpload(%s/%s): %v", folder, name, uploadErr)
+	}
+	return file["id"].(string), file["version"].(int)
+}
+
+// Файл с тем же именем в другой папке не становится версией загружаемого
+func TestSaveUploadVersionsWithinFolder(t *testing.T) {
+	h := newTestHandler(t)
+
+	q1, _ := uploadText(t, h, "report.csv", "2024/Q1", "Месяц;Выручка\nЯнварь;100\n")
+	root, version := uploadText(t, h, "report.csv", "", "Месяц;Выручка\nФевраль;200\n")
+	if root == q1 || version != 1 {
+		t.Fatalf("upload to root: file %s version %d, want new file (Q1 file %s)", root, version, q1)
+	}
+
+	if id, version := uploadText(t, h, "report.csv", "", "Месяц;Выручка\nМарт;300\n"); id != root || version != 2 {
+		t.Errorf("second upload to root: file %s version %d, want %s version 2", id, version, root)
+	}
+	if id, version := uploadText(t, h, "report.csv", "2024/Q1", "Месяц;Выручка\nЯнварь;150\n"); id != q1 || version != 2 {
+		t.Errorf("second upload to 2024/Q1: file %s version %d, want %s version 2", id, version, q1)
+	}
+
+	var versions int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM file_versions WHERE file_id = ?", q1).Scan(&versions); err != nil || versions != 2 {
+		t.Errorf("2024/Q1/report.csv has %d versions (%v), want 2", versions, err)
+	}
+}
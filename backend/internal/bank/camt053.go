@@ -0,0 +1,383 @@
+package bank
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ISO 20022 camt.053 (BankToCustomerStatement): XML с блоками Stmt - по одному на счет и период.
+// Имена элементов одинаковы во всех версиях camt.053.001.02-.08, поэтому пространство имен
+// не проверяется; различия версий (Sts, Dbtr/Pty) учтены в структурах ниже.
+
+func isCamt053(text string) bool {
+	head := text
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	return strings.Contains(head, "<") && strings.Contains(head, "BkToCstmrStmt")
+}
+
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	ID       string        `xml:"Id"`
+	From     string        `xml:"FrToDt>FrDtTm"`
+	To       string        `xml:"FrToDt>ToDtTm"`
+	Account  camtAccount   `xml:"Acct"`
+	Balances []camtBalance `xml:"Bal"`
+	Entries  []camtEntry   `xml:"Ntry"`
+}
+
+type camtAccount struct {
+	IBAN     string `xml:"Id>IBAN"`
+	Other    string `xml:"Id>Othr>Id"`
+	Currency string `xml:"Ccy"`
+}
+
+func (a camtAccount) number() string {
+	if a.IBAN != "" {
+		return strings.TrimSpace(a.IBAN)
+	}
+	return strings.TrimSpace(a.Other)
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+func (d camtDate) parse() (time.Time, error) {
+	return parseISODate(d.Date + d.DateTime)
+}
+
+type camtBalance struct {
+	Type   string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount camtAmount `xml:"Amt"`
+	Sign   string     `xml:"CdtDbtInd"`
+	Date   camtDate   `xml:"Dt"`
+}
+
+type camtEntry struct {
+	Ref          string          `xml:"NtryRef"`
+	Amount       camtAmount      `xml:"Amt"`
+	Sign         string          `xml:"CdtDbtInd"`
+	Status       camtStatus      `xml:"Sts"`
+	BookingDate  camtDate        `xml:"BookgDt"`
+	ValueDate    camtDate        `xml:"ValDt"`
+	ServicerRef  string          `xml:"AcctSvcrRef"`
+	BankCode     camtBankCode    `xml:"BkTxCd"`
+	Details      []camtTxDetails `xml:"NtryDtls>TxDtls"`
+	AdditionInfo string          `xml:"AddtlNtryInf"`
+}
+
+// camtStatus - в версиях до .08 статус записан текстом (<Sts>BOOK</Sts>), в .08 - кодом (<Sts><Cd>BOOK</Cd></Sts>)
+type camtStatus struct {
+	Text string `xml:",chardata"`
+	Code string `xml:"Cd"`
+}
+
+func (s camtStatus) value() string {
+	if s.Code != "" {
+		return strings.TrimSpace(s.Code)
+	}
+	return strings.TrimSpace(s.Text)
+}
+
+type camtBankCode struct {
+	Domain    string `xml:"Domn>Cd"`
+	Family    string `xml:"Domn>Fmly>Cd"`
+	SubFamily string `xml:"Domn>Fmly>SubFmlyCd"`
+	Prtry     string `xml:"Prtry>Cd"`
+}
+
+func (c camtBankCode) String() string {
+	if c.Domain != "" {
+		return strings.Trim(c.Domain+"/"+c.Family+"/"+c.SubFamily, "/")
+	}
+	return c.Prtry
+}
+
+type camtTxDetails struct {
+	EndToEndID   string      `xml:"Refs>EndToEndId"`
+	ServicerRef  string      `xml:"Refs>AcctSvcrRef"`
+	Amount       camtAmount  `xml:"Amt"`
+	TxAmount     camtAmount  `xml:"AmtDtls>TxAmt>Amt"`
+	Sign         string      `xml:"CdtDbtInd"`
+	Debtor       camtParty   `xml:"RltdPties>Dbtr"`
+	DebtorAcct   camtAccount `xml:"RltdPties>DbtrAcct"`
+	Creditor     camtParty   `xml:"RltdPties>Cdtr"`
+	CreditorAcct camtAccount `xml:"RltdPties>CdtrAcct"`
+	Unstructured []string    `xml:"RmtInf>Ustrd"`
+	CreditorRef  string      `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	AdditionInfo string      `xml:"AddtlTxInf"`
+}
+
+func (d camtTxDetails) amount() camtAmount {
+	if strings.TrimSpace(d.Amount.Value) != "" {
+		return d.Amount
+	}
+	return d.TxAmount
+}
+
+// camtParty - до версии .08 наименование в Dbtr/Nm, начиная с .08 - в Dbtr/Pty/Nm
+type camtParty struct {
+	Name     string      `xml:"Nm"`
+	PtyName  string      `xml:"Pty>Nm"`
+	OrgIDs   []camtOrgID `xml:"Id>OrgId>Othr"`
+	PtyOrgID []camtOrgID `xml:"Pty>Id>OrgId>Othr"`
+}
+
+type camtOrgID struct {
+	ID     string `xml:"Id"`
+	Scheme string `xml:"SchmeNm>Cd"`
+	Prtry  string `xml:"SchmeNm>Prtry"`
+}
+
+func (p camtParty) name() string {
+	if p.Name != "" {
+		return strings.TrimSpace(p.Name)
+	}
+	return strings.TrimSpace(p.PtyName)
+}
+
+// inn возвращает ИНН из идентификаторов организации (схема TXID или "INN"/"ИНН")
+func (p camtParty) inn() string {
+	for _, id := range append(p.OrgIDs, p.PtyOrgID...) {
+		scheme := strings.ToUpper(strings.TrimSpace(id.Scheme + id.Prtry))
+		if scheme == "TXID" || scheme == "INN" || scheme == "ИНН" {
+			return strings.TrimSpace(id.ID)
+		}
+	}
+	return ""
+}
+
+func parseCamt053(text string) (*Statement, error) {
+	var doc camtDocument
+	decoder := xml.NewDecoder(strings.NewReader(text))
+	// Текст уже переведен в UTF-8, объявленную в заголовке кодировку не учитываем
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("camt.053: %w", err)
+	}
+	if len(doc.Statements) == 0 {
+		return nil, ErrUnknownFormat
+	}
+
+	st := &Statement{Format: FormatCamt053}
+	for i, s := range doc.Statements {
+		label := fmt.Sprintf("Выписка %d (%s)", i+1, s.ID)
+		account := Account{Number: s.Account.number(), Currency: strings.TrimSpace(s.Account.Currency)}
+		account.DateFrom, _ = parseISODate(s.From)
+		account.DateTo, _ = parseISODate(s.To)
+
+		opening, closing := camtBalances(s.Balances)
+		if account.Currency == "" {
+			for _, b := range []*camtBalance{opening, closing} {
+				if b != nil && account.Currency == "" {
+					account.Currency = b.Amount.Currency
+				}
+			}
+		}
+		if opening != nil && closing != nil {
+			var errOpening, errClosing error
+			account.Opening, errOpening = camtSigned(opening.Amount.Value, opening.Sign)
+			account.Closing, errClosing = camtSigned(closing.Amount.Value, closing.Sign)
+			account.HasBalance = errOpening == nil && errClosing == nil
+			// PRCD - остаток на конец предыдущего периода, датирован днем до начала выписки
+			if date, err := opening.Date.parse(); err == nil && account.DateFrom.IsZero() {
+				if opening.Type == "PRCD" {
+					date = date.AddDate(0, 0, 1)
+				}
+				account.DateFrom = date
+			}
+			if date, err := closing.Date.parse(); err == nil && account.DateTo.IsZero() {
+				account.DateTo = date
+			}
+		}
+
+		for j, entry := range s.Entries {
+			if status := entry.Status.value(); status != "" && status != "BOOK" {
+				// Ожидающие и информационные записи не меняют остаток
+				continue
+			}
+			transactions, err := camtTransactions(entry, account)
+			if err != nil {
+				st.Warnings = append(st.Warnings, fmt.Sprintf("%s, запись %d: %v", label, j+1, err))
+				continue
+			}
+			st.Transactions = append(st.Transactions, transactions...)
+		}
+		st.addAccount(account)
+	}
+	return st, nil
+}
+
+// camtBalances возвращает остатки на начало (OPBD или PRCD) и на конец (CLBD) периода
+func camtBalances(balances []camtBalance) (opening, closing *camtBalance) {
+	for i := range balances {
+		switch balances[i].Type {
+		case "OPBD":
+			opening = &balances[i]
+		case "PRCD":
+			if opening == nil {
+				opening = &balances[i]
+			}
+		case "CLBD":
+			closing = &balances[i]
+		}
+	}
+	return opening, closing
+}
+
+// camtSigned переводит сумму с признаком CRDT/DBIT в копейки со знаком (DBIT - отрицательный остаток)
+func camtSigned(value, sign string) (int64, error) {
+	amount, err := parseAmount(value)
+	if err != nil {
+		return 0, err
+	}
+	if sign == "DBIT" {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// camtTransactions превращает запись выписки в операции. Пакетная запись (несколько TxDtls со своими
+// суммами) разбивается на операции; если суммы деталей не сходятся с записью, она остается одной операцией.
+func camtTransactions(entry camtEntry, account Account) ([]Transaction, error) {
+	amount, err := parseAmount(entry.Amount.Value)
+	if err != nil {
+		return nil, amountError(entry.Amount.Value, err)
+	}
+	direction, err := camtDirection(entry.Sign)
+	if err != nil {
+		return nil, err
+	}
+	date, err := entry.BookingDate.parse()
+	if err != nil {
+		if date, err = entry.ValueDate.parse(); err != nil {
+			return nil, fmt.Errorf("не указана дата проводки")
+		}
+	}
+	currency := entry.Amount.Currency
+	if currency == "" {
+		currency = account.Currency
+	}
+
+	base := Transaction{
+		Date:      date,
+		Amount:    amount,
+		Currency:  currency,
+		Direction: direction,
+		Account:   account.Number,
+		DocNumber: firstNonEmpty(entry.ServicerRef, entry.Ref),
+		DocType:   entry.BankCode.String(),
+		Purpose:   strings.TrimSpace(entry.AdditionInfo),
+	}
+	if len(entry.Details) == 0 {
+		return []Transaction{base}, nil
+	}
+	if len(entry.Details) == 1 {
+		return []Transaction{camtApplyDetails(base, entry.Details[0])}, nil
+	}
+
+	var split []Transaction
+	var sum int64
+	for _, details := range entry.Details {
+		t := camtApplyDetails(base, details)
+		value := details.amount()
+		detailAmount, err := parseAmount(value.Value)
+		if err != nil {
+			return []Transaction{camtApplyDetails(base, entry.Details[0])}, nil
+		}
+		t.Amount = detailAmount
+		if details.Sign != "" {
+			if t.Direction, err = camtDirection(details.Sign); err != nil {
+				return nil, err
+			}
+		}
+		if t.Direction == direction {
+			sum += detailAmount
+		} else {
+			sum -= detailAmount
+		}
+		split = append(split, t)
+	}
+	if sum != amount {
+		return []Transaction{camtApplyDetails(base, entry.Details[0])}, nil
+	}
+	return split, nil
+}
+
+// camtApplyDetails дополняет операцию контрагентом, ссылками и назначением платежа из TxDtls
+func camtApplyDetails(t Transaction, details camtTxDetails) Transaction {
+	party, partyAccount := details.Creditor, details.CreditorAcct
+	if t.Direction == DirectionIn {
+		party, partyAccount = details.Debtor, details.DebtorAcct
+	}
+	t.Counterparty = party.name()
+	t.CounterpartyINN = party.inn()
+	t.CounterpartyAccount = partyAccount.number()
+
+	if ref := strings.TrimSpace(details.EndToEndID); ref != "" && ref != "NOTPROVIDED" {
+		t.DocNumber = ref
+	} else if ref := strings.TrimSpace(details.ServicerRef); ref != "" {
+		t.DocNumber = ref
+	}
+
+	var purpose []string
+	for _, line := range details.Unstructured {
+		if line = strings.TrimSpace(line); line != "" {
+			purpose = append(purpose, line)
+		}
+	}
+	if len(purpose) == 0 && strings.TrimSpace(details.CreditorRef) != "" {
+		purpose = append(purpose, strings.TrimSpace(details.CreditorRef))
+	}
+	if len(purpose) == 0 && strings.TrimSpace(details.AdditionInfo) != "" {
+		purpose = append(purpose, strings.TrimSpace(details.AdditionInfo))
+	}
+	if len(purpose) > 0 {
+		t.Purpose = strings.Join(purpose, " ")
+	}
+	return t
+}
+
+func camtDirection(sign string) (string, error) {
+	switch strings.TrimSpace(sign) {
+	case "CRDT":
+		return DirectionIn, nil
+	case "DBIT":
+		return DirectionOut, nil
+	}
+	return "", fmt.Errorf("неизвестный признак дебета/кредита %q", sign)
+}
+
+// parseISODate разбирает дату "2006-01-02" или дату со временем "2006-01-02T15:04:05..."
+func parseISODate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > 10 {
+		s = s[:10]
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
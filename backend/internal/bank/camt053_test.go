@@ -0,0 +1,76 @@
+package bank
+
+import (
+	"fmt"
+	"testing"
+)
+
+func camtExample(closing string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+<BkToCstmrStmt><Stmt>
+<Id>STMT-1</Id>
+<FrToDt><FrDtTm>2026-03-01T00:00:00</FrDtTm><ToDtTm>2026-03-31T23:59:59</ToDtTm></FrToDt>
+<Acct><Id><IBAN>DE89370400440532013000</IBAN></Id><Ccy>EUR</Ccy></Acct>
+<Bal><Tp><CdOrPrtry><Cd>OPBD</Cd></CdOrPrtry></Tp><Amt Ccy="EUR">1000.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Dt><Dt>2026-03-01</Dt></Dt></Bal>
+<Bal><Tp><CdOrPrtry><Cd>CLBD</Cd></CdOrPrtry></Tp><Amt Ccy="EUR">%s</Amt><CdtDbtInd>CRDT</CdtDbtInd><Dt><Dt>2026-03-31</Dt></Dt></Bal>
+<Ntry><Amt Ccy="EUR">1500.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2026-03-02</Dt></BookgDt>
+<NtryDtls><TxDtls><RltdPties><Dbtr><Nm>Muster GmbH</Nm></Dbtr></RltdPties><RmtInf><Ustrd>Rechnung 42</Ustrd></RmtInf></TxDtls></NtryDtls></Ntry>
+<Ntry><Amt Ccy="EUR">300.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2026-03-05</Dt></BookgDt>
+<NtryDtls>
+<TxDtls><Amt Ccy="EUR">100.00</Amt><RltdPties><Cdtr><Nm>Lieferant A</Nm></Cdtr></RltdPties></TxDtls>
+<TxDtls><Amt Ccy="EUR">200.00</Amt><RltdPties><Cdtr><Nm>Lieferant B</Nm></Cdtr></RltdPties></TxDtls>
+</NtryDtls></Ntry>
+<Ntry><Amt Ccy="EUR">999.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts>PDNG</Sts><BookgDt><Dt>2026-03-06</Dt></BookgDt></Ntry>
+</Stmt></BkToCstmrStmt>
+</Document>`, closing)
+}
+
+func TestCamt053BalanceCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		closing  string
+		mismatch bool
+	}{
+		// 1 000 + 1 500 - 300; ожидающая запись PDNG не учитывается
+		{"остатки сходятся", "2200.00", false},
+		{"остатки не сходятся", "3199.00", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, err := Parse([]byte(camtExample(tt.closing)))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := hasWarning(st, "остатки не сходятся"); got != tt.mismatch {
+				t.Errorf("mismatch warning %v, want %v (warnings %q)", got, tt.mismatch, st.Warnings)
+			}
+		})
+	}
+}
+
+// Пакетная запись разбивается на операции по суммам деталей
+func TestCamt053BatchSplit(t *testing.T) {
+	st, err := Parse([]byte(camtExample("2200.00")))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if st.Format != FormatCamt053 || len(st.Transactions) != 3 {
+		t.Fatalf("format %s, %d transactions", st.Format, len(st.Transactions))
+	}
+	tests := []struct {
+		amount       int64
+		direction    string
+		counterparty string
+	}{
+		{1500_00, DirectionIn, "Muster GmbH"},
+		{100_00, DirectionOut, "Lieferant A"},
+		{200_00, DirectionOut, "Lieferant B"},
+	}
+	for i, tt := range tests {
+		tr := st.Transactions[i]
+		if tr.Amount != tt.amount || tr.Direction != tt.direction || tr.Counterparty != tt.counterparty {
+			t.Errorf("transaction %d = %+v, want %d %s %s", i, tr, tt.amount, tt.direction, tt.counterparty)
+		}
+	}
+}
@@ -0,0 +1,481 @@
+package bank
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Горизонт прогноза в днях
+const (
+	ForecastMinDays     = 30
+	ForecastMaxDays     = 90
+	ForecastDefaultDays = 30
+)
+
+const (
+	// forecastLookbackDays - за сколько последних дней считается обычный дневной оборот
+	forecastLookbackDays = 90
+	// weekdayProfileDays - с какой длины истории учитывается разница между днями недели
+	weekdayProfileDays = 28
+	// recurringMaxAgeDays - регулярный платеж, которого не было дольше, считается прекратившимся
+	recurringMaxAgeDays = 45
+	// recurringDaySpread - платежи одному получателю, отстоящие не больше чем на столько дней месяца,
+	// считаются одним регулярным платежом (аванс 10-го и зарплата 25-го - два разных)
+	recurringDaySpread = 3
+)
+
+// DayFlow - движение денег за день. In и Out - без переводов между своими счетами, Transfers - сальдо
+// таких переводов (не равно нулю, если второй счет не попал в выписки); Balance - остаток на конец дня.
+type DayFlow struct {
+	Date      time.Time
+	In        int64
+	Out       int64
+	Transfers int64
+	Balance   int64
+}
+
+// MonthFlow - движение денег за месяц ("2025-03") с остатками на начало, конец и минимальным за месяц
+type MonthFlow struct {
+	Month      string
+	In         int64
+	Out        int64
+	Transfers  int64
+	Opening    int64
+	Closing    int64
+	MinBalance int64
+}
+
+// DailyFlows строит движение денег по дням с from по to включительно; opening - остаток на начало from.
+// Операции вне периода не учитываются.
+func DailyFlows(transactions []Transaction, from, to time.Time, opening int64) []DayFlow {
+	from, to = dayStart(from), dayStart(to)
+	if to.Before(from) {
+		return nil
+	}
+	days := make([]DayFlow, daysBetween(from, to)+1)
+	for i := range days {
+		days[i].Date = from.AddDate(0, 0, i)
+	}
+	for _, t := range transactions {
+		i := daysBetween(from, dayStart(t.Date))
+		if i < 0 || i >= len(days) {
+			continue
+		}
+		switch {
+		case t.Internal:
+			days[i].Transfers += t.signed()
+		case t.Direction == DirectionIn:
+			days[i].In += t.Amount
+		default:
+			days[i].Out += t.Amount
+		}
+	}
+	balance := opening
+	for i := range days {
+		balance += days[i].In - days[i].Out + days[i].Transfers
+		days[i].Balance = balance
+	}
+	return days
+}
+
+// MonthlyFlows сворачивает движение по дням в движение по месяцам
+func MonthlyFlows(days []DayFlow) []MonthFlow {
+	var months []MonthFlow
+	for _, day := range days {
+		key := day.Date.Format("2006-01")
+		if len(months) == 0 || months[len(months)-1].Month != key {
+			opening := day.Balance - day.In + day.Out - day.Transfers
+			months = append(months, MonthFlow{Month: key, Opening: opening, MinBalance: day.Balance})
+		}
+		month := &months[len(months)-1]
+		month.In += day.In
+		month.Out += day.Out
+		month.Transfers += day.Transfers
+		month.Closing = day.Balance
+		if day.Balance < month.MinBalance {
+			month.MinBalance = day.Balance
+		}
+	}
+	return months
+}
+
+// RecurringPayment - регулярный ежемесячный платеж или поступление
+type RecurringPayment struct {
+	Name      string
+	INN       string
+	Category  string
+	Direction string
+	Amount    int64 // ожидаемая сумма - медиана последних месяцев
+	Day       int   // число месяца
+	Months    int   // в скольких месяцах был платеж
+	LastDate  time.Time
+}
+
+// ScheduledPayment - ожидаемый регулярный платеж в прогнозе
+type ScheduledPayment struct {
+	Date         time.Time
+	Name         string
+	Category     string
+	Direction    string
+	Amount       int64
+	BalanceAfter int64 // прогноз остатка на конец дня платежа
+}
+
+// ForecastDay - прогноз на день: обычный оборот и регулярные платежи
+type ForecastDay struct {
+	Date     time.Time
+	In       int64
+	Out      int64
+	Balance  int64
+	Payments []ScheduledPayment
+}
+
+// CashGap - кассовый разрыв: дни подряд, когда прогноз остатка ниже допустимого
+type CashGap struct {
+	From       time.Time
+	To         time.Time
+	Lowest     int64
+	LowestDate time.Time
+	Shortfall  int64              // сколько не хватает до допустимого остатка в худший день
+	Payments   []ScheduledPayment // регулярные списания в первый день разрыва
+}
+
+// CashForecast - прогноз движения денег после даты последних данных
+type CashForecast struct {
+	Currency   string
+	AsOf       time.Time // дата последних данных; прогноз начинается со следующего дня
+	Balance    int64     // остаток на AsOf
+	HasBalance bool      // остаток известен из выписок; без него прогнозируется только сальдо
+	MinBalance int64     // допустимый остаток: ниже него - кассовый разрыв
+	DailyIn    int64     // обычные поступления в день сверх регулярных
+	DailyOut   int64     // обычные списания в день сверх регулярных
+	Seasonal   bool      // учтена сезонность по тем же месяцам прошлого года
+	Days       []ForecastDay
+	Recurring  []RecurringPayment
+	Payments   []ScheduledPayment // регулярные платежи за период прогноза по дате
+	Gaps       []CashGap
+	EndBalance int64
+	Lowest     int64
+	LowestDate time.Time
+}
+
+// Forecast прогнозирует движение денег на days дней после asOf: регулярные платежи ставятся
+// на их обычное число месяца, остальной оборот - средний за последние 90 дней с поправкой на день
+// недели и, если история длиннее года, на сезонность. balance - остаток на конец asOf.
+func Forecast(transactions []Transaction, asOf time.Time, balance int64, hasBalance bool, days int, minBalance int64) *CashForecast {
+	asOf = dayStart(asOf)
+	f := &CashForecast{AsOf: asOf, Balance: balance, HasBalance: hasBalance, MinBalance: minBalance}
+	var recurringTx map[int]bool
+	f.Recurring, recurringTx = detectRecurring(transactions, asOf)
+
+	// Обычный оборот - операции, не вошедшие в регулярные платежи
+	var regular []Transaction
+	for i, t := range transactions {
+		if !t.Internal && !recurringTx[i] && !dayStart(t.Date).After(asOf) {
+			regular = append(regular, t)
+		}
+	}
+	in := newFlowModel(regular, asOf, DirectionIn)
+	out := newFlowModel(regular, asOf, DirectionOut)
+	f.DailyIn, f.DailyOut = int64(math.Round(in.average)), int64(math.Round(out.average))
+	f.Seasonal = in.seasonal || out.seasonal
+
+	end := asOf.AddDate(0, 0, days)
+	scheduled := make(map[time.Time][]ScheduledPayment)
+	for _, r := range f.Recurring {
+		for month := time.Date(asOf.Year(), asOf.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(end); month = month.AddDate(0, 1, 0) {
+			date := monthDay(month, r.Day)
+			if !date.After(asOf) || date.After(end) || sameMonth(date, r.LastDate) {
+				continue
+			}
+			scheduled[date] = append(scheduled[date], ScheduledPayment{
+				Date: date, Name: r.Name, Category: r.Category, Direction: r.Direction, Amount: r.Amount,
+			})
+		}
+	}
+
+	f.Lowest, f.LowestDate = balance, asOf
+	current := balance
+	for i := 1; i <= days; i++ {
+		day := ForecastDay{Date: asOf.AddDate(0, 0, i)}
+		day.In, day.Out = in.expected(day.Date), out.expected(day.Date)
+		payments := scheduled[day.Date]
+		for _, p := range payments {
+			if p.Direction == DirectionIn {
+				day.In += p.Amount
+			} else {
+				day.Out += p.Amount
+			}
+		}
+		current += day.In - day.Out
+		day.Balance = current
+		for _, p := range payments {
+			p.BalanceAfter = current
+			day.Payments = append(day.Payments, p)
+			f.Payments = append(f.Payments, p)
+		}
+		if current < f.Lowest {
+			f.Lowest, f.LowestDate = current, day.Date
+		}
+		f.Days = append(f.Days, day)
+	}
+	f.EndBalance = current
+	if hasBalance {
+		f.Gaps = findGaps(f.Days, minBalance)
+	}
+	return f
+}
+
+// findGaps находит периоды, когда прогноз остатка ниже minBalance
+func findGaps(days []ForecastDay, minBalance int64) []CashGap {
+	var gaps []CashGap
+	var gap *CashGap
+	for _, day := range days {
+		if day.Balance >= minBalance {
+			gap = nil
+			continue
+		}
+		if gap == nil {
+			gaps = append(gaps, CashGap{From: day.Date, Lowest: day.Balance, LowestDate: day.Date})
+			gap = &gaps[len(gaps)-1]
+			for _, p := range day.Payments {
+				if p.Direction == DirectionOut {
+					gap.Payments = append(gap.Payments, p)
+				}
+			}
+		}
+		gap.To = day.Date
+		if day.Balance < gap.Lowest {
+			gap.Lowest, gap.LowestDate = day.Balance, day.Date
+		}
+		gap.Shortfall = minBalance - gap.Lowest
+	}
+	return gaps
+}
+
+// detectRecurring находит платежи, которые повторяются каждый месяц примерно в одно число с похожей
+// суммой, и возвращает их вместе с индексами операций, из которых они составлены
+func detectRecurring(transactions []Transaction, asOf time.Time) ([]RecurringPayment, map[int]bool) {
+	groups := make(map[string][]int)
+	var keys []string
+	for i, t := range transactions {
+		if t.Internal || dayStart(t.Date).After(asOf) {
+			continue
+		}
+		party := t.CounterpartyINN
+		if party == "" {
+			party = strings.ToLower(strings.Join(strings.Fields(t.Counterparty), " "))
+		}
+		if party == "" {
+			continue
+		}
+		key := t.Direction + "|" + t.Category + "|" + party
+		if groups[key] == nil {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+	sort.Strings(keys)
+
+	var result []RecurringPayment
+	used := make(map[int]bool)
+	for _, key := range keys {
+		indexes := groups[key]
+		sort.SliceStable(indexes, func(a, b int) bool {
+			return transactions[indexes[a]].Date.Day() < transactions[indexes[b]].Date.Day()
+		})
+		// Платежи группируются по близким числам месяца
+		start := 0
+		for i := 1; i <= len(indexes); i++ {
+			if i < len(indexes) && transactions[indexes[i]].Date.Day()-transactions[indexes[i-1]].Date.Day() <= recurringDaySpread {
+				continue
+			}
+			if payment, ok := recurringSeries(transactions, indexes[start:i], asOf); ok {
+				result = append(result, payment)
+				for _, index := range indexes[start:i] {
+					used[index] = true
+				}
+			}
+			start = i
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Day != result[j].Day {
+			return result[i].Day < result[j].Day
+		}
+		return result[i].Amount > result[j].Amount
+	})
+	return result, used
+}
+
+// recurringSeries проверяет, что платежи одного получателя в близкие числа месяца регулярны:
+// не меньше двух месяцев, пропущено не больше 40% месяцев, последний платеж недавно, суммы
+// различаются не больше чем вдвое
+func recurringSeries(transactions []Transaction, indexes []int, asOf time.Time) (RecurringPayment, bool) {
+	type monthTotal struct {
+		key    string
+		amount int64
+		last   Transaction
+	}
+	var months []monthTotal
+	byMonth := make(map[string]int)
+	for _, index := range indexes {
+		t := transactions[index]
+		key := t.Date.Format("2006-01")
+		i, ok := byMonth[key]
+		if !ok {
+			i = len(months)
+			byMonth[key] = i
+			months = append(months, monthTotal{key: key})
+		}
+		months[i].amount += t.Amount
+		if !t.Date.Before(months[i].last.Date) {
+			months[i].last = t
+		}
+	}
+	// Ежедневные операции (например, возмещение по эквайрингу) - не ежемесячный платеж
+	if len(months) < 2 || len(indexes) > 2*len(months) {
+		return RecurringPayment{}, false
+	}
+	sort.Slice(months, func(i, j int) bool { return months[i].key < months[j].key })
+
+	first, last := months[0].last.Date, months[len(months)-1].last.Date
+	span := (last.Year()-first.Year())*12 + int(last.Month()-first.Month()) + 1
+	if len(months)*10 < span*6 || daysBetween(dayStart(last), asOf) > recurringMaxAgeDays {
+		return RecurringPayment{}, false
+	}
+
+	recent := months
+	if len(recent) > 3 {
+		recent = recent[len(recent)-3:]
+	}
+	amounts := make([]int64, 0, len(recent))
+	days := make([]int, 0, len(recent))
+	for _, m := range recent {
+		amounts = append(amounts, m.amount)
+		days = append(days, m.last.Date.Day())
+	}
+	sort.Slice(amounts, func(i, j int) bool { return amounts[i] < amounts[j] })
+	sort.Ints(days)
+	if amounts[0] <= 0 || amounts[len(amounts)-1] > 2*amounts[0] {
+		return RecurringPayment{}, false
+	}
+
+	latest := months[len(months)-1].last
+	return RecurringPayment{
+		Name:      firstNonEmpty(latest.Counterparty, latest.CounterpartyINN),
+		INN:       latest.CounterpartyINN,
+		Category:  latest.Category,
+		Direction: latest.Direction,
+		Amount:    amounts[len(amounts)/2],
+		Day:       days[len(days)/2],
+		Months:    len(months),
+		LastDate:  dayStart(last),
+	}, true
+}
+
+// flowModel - обычный дневной оборот в одном направлении с поправками на день недели и сезонность
+type flowModel struct {
+	average  float64
+	weekday  [7]float64
+	seasonal bool
+	// Для сезонности: суммы по месяцам и средний дневной оборот за те же дни год назад
+	months          map[string]int64
+	lastYearAverage float64
+}
+
+func newFlowModel(transactions []Transaction, asOf time.Time, direction string) *flowModel {
+	m := &flowModel{months: make(map[string]int64)}
+	for i := range m.weekday {
+		m.weekday[i] = 1
+	}
+	if len(transactions) == 0 {
+		return m
+	}
+	historyStart := dayStart(transactions[0].Date)
+	for _, t := range transactions {
+		if date := dayStart(t.Date); date.Before(historyStart) {
+			historyStart = date
+		}
+	}
+
+	from := asOf.AddDate(0, 0, -(forecastLookbackDays - 1))
+	if historyStart.After(from) {
+		from = historyStart
+	}
+	window := daysBetween(from, asOf) + 1
+	lastYearFrom, lastYearTo := from.AddDate(-1, 0, 0), asOf.AddDate(-1, 0, 0)
+	var total, lastYearTotal int64
+	var weekdayTotals [7]int64
+	for _, t := range transactions {
+		if t.Direction != direction {
+			continue
+		}
+		date := dayStart(t.Date)
+		if !date.Before(from) {
+			total += t.Amount
+			weekdayTotals[date.Weekday()] += t.Amount
+		}
+		if !date.Before(lastYearFrom) && !date.After(lastYearTo) {
+			lastYearTotal += t.Amount
+		}
+		m.months[date.Format("2006-01")] += t.Amount
+	}
+	m.average = float64(total) / float64(window)
+
+	if window >= weekdayProfileDays && total > 0 {
+		var weekdays [7]int
+		for date := from; !date.After(asOf); date = date.AddDate(0, 0, 1) {
+			weekdays[date.Weekday()]++
+		}
+		for i := range m.weekday {
+			if weekdays[i] > 0 {
+				m.weekday[i] = float64(weekdayTotals[i]) / float64(weekdays[i]) / m.average
+			}
+		}
+	}
+	// Сезонность - только если история начинается не позже, чем те же дни год назад
+	if !historyStart.After(lastYearFrom) && lastYearTotal > 0 {
+		m.seasonal = true
+		m.lastYearAverage = float64(lastYearTotal) / float64(daysBetween(lastYearFrom, lastYearTo)+1)
+	}
+	return m
+}
+
+// expected - ожидаемый обычный оборот за день
+func (m *flowModel) expected(date time.Time) int64 {
+	value := m.average * m.weekday[date.Weekday()]
+	if m.seasonal {
+		// Во сколько раз тот же месяц год назад отличался от тех же дней, что и окно среднего
+		lastYear := time.Date(date.Year()-1, date.Month(), 1, 0, 0, 0, 0, time.UTC)
+		perDay := float64(m.months[lastYear.Format("2006-01")]) / float64(monthDays(lastYear))
+		value *= math.Min(2, math.Max(0.5, perDay/m.lastYearAverage))
+	}
+	return int64(math.Round(value))
+}
+
+func dayStart(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func daysBetween(from, to time.Time) int {
+	return int(math.Round(to.Sub(from).Hours() / 24))
+}
+
+func sameMonth(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.Month() == b.Month()
+}
+
+func monthDays(month time.Time) int {
+	return time.Date(month.Year(), month.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// monthDay - число месяца; для коротких месяцев 31-е становится последним днем
+func monthDay(month time.Time, day int) time.Time {
+	if last := monthDays(month); day > last {
+		day = last
+	}
+	return time.Date(month.Year(), month.Month(), day, 0, 0, 0, 0, time.UTC)
+}
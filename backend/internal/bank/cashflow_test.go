@@ -0,0 +1,189 @@
+package bank
+
+import (
+	"testing"
+	"time"
+)
+
+func day(s string) time.Time {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestDailyAndMonthlyFlows(t *testing.T) {
+	transactions := []Transaction{
+		{Date: day("2026-01-30"), Amount: 50000, Direction: DirectionIn},
+		{Date: day("2026-01-31"), Amount: 20000, Direction: DirectionOut},
+		{Date: day("2026-01-31"), Amount: 10000, Direction: DirectionOut, Internal: true},
+		{Date: day("2026-02-01"), Amount: 70000, Direction: DirectionOut},
+		{Date: day("2026-02-02"), Amount: 30000, Direction: DirectionIn},
+		{Date: day("2026-02-10"), Amount: 99999, Direction: DirectionIn}, // вне периода
+	}
+	days := DailyFlows(transactions, day("2026-01-30"), day("2026-02-02"), 100000)
+	wantBalances := []int64{150000, 120000, 50000, 80000}
+	if len(days) != len(wantBalances) {
+		t.Fatalf("days = %d, want %d", len(days), len(wantBalances))
+	}
+	for i, want := range wantBalances {
+		if days[i].Balance != want {
+			t.Errorf("%s balance %d, want %d", days[i].Date.Format("2006-01-02"), days[i].Balance, want)
+		}
+	}
+	if days[1].Out != 20000 || days[1].Transfers != -10000 {
+		t.Errorf("2026-01-31: out %d, transfers %d", days[1].Out, days[1].Transfers)
+	}
+
+	months := MonthlyFlows(days)
+	want := []MonthFlow{
+		{Month: "2026-01", In: 50000, Out: 20000, Transfers: -10000, Opening: 100000, Closing: 120000, MinBalance: 120000},
+		{Month: "2026-02", In: 30000, Out: 70000, Opening: 120000, Closing: 80000, MinBalance: 50000},
+	}
+	if len(months) != len(want) {
+		t.Fatalf("months = %+v", months)
+	}
+	for i := range want {
+		if months[i] != want[i] {
+			t.Errorf("month %d = %+v, want %+v", i, months[i], want[i])
+		}
+	}
+
+	if DailyFlows(transactions, day("2026-02-02"), day("2026-01-30"), 0) != nil {
+		t.Error("DailyFlows with to before from returned days")
+	}
+}
+
+// forecastHistory - январь-март 2026: выручка 10 000 ₽ каждый день, аренда 150 000 ₽ 5-го
+// и зарплата 400 000 ₽ 25-го числа
+func forecastHistory() []Transaction {
+	var transactions []Transaction
+	for d := day("2026-01-01"); !d.After(day("2026-03-31")); d = d.AddDate(0, 0, 1) {
+		transactions = append(transactions, Transaction{
+			Date: d, Amount: 1000000, Direction: DirectionIn, Category: CategoryRevenue,
+			Counterparty: "АО Альфа-Банк", CounterpartyINN: "7728168971", Purpose: "Возмещение по эквайрингу",
+		})
+	}
+	for _, month := range []string{"2026-01", "2026-02", "2026-03"} {
+		transactions = append(transactions,
+			Transaction{Date: day(month + "-05"), Amount: 15000000, Direction: DirectionOut, Category: CategoryRent,
+				Counterparty: "ООО Арендодатель", CounterpartyINN: "7701234567"},
+			Transaction{Date: day(month + "-25"), Amount: 40000000, Direction: DirectionOut, Category: CategoryPayroll,
+				Counterparty: "Сотрудники"},
+		)
+	}
+	return transactions
+}
+
+func TestForecastRecurring(t *testing.T) {
+	f := Forecast(forecastHistory(), day("2026-03-31"), 5000000, true, ForecastMaxDays, 0)
+
+	if len(f.Recurring) != 2 {
+		t.Fatalf("recurring = %+v, want rent and payroll", f.Recurring)
+	}
+	if r := f.Recurring[0]; r.Category != CategoryRent || r.Day != 5 || r.Amount != 15000000 || r.Months != 3 {
+		t.Errorf("recurring[0] = %+v", r)
+	}
+	if r := f.Recurring[1]; r.Category != CategoryPayroll || r.Day != 25 || r.Amount != 40000000 {
+		t.Errorf("recurring[1] = %+v", r)
+	}
+	// Ежедневная выручка - обычный оборот, а регулярные платежи в него не входят
+	if f.DailyIn != 1000000 || f.DailyOut != 0 || f.Seasonal {
+		t.Errorf("daily in %d, out %d, seasonal %v", f.DailyIn, f.DailyOut, f.Seasonal)
+	}
+
+	if len(f.Days) != ForecastMaxDays || !f.Days[0].Date.Equal(day("2026-04-01")) {
+		t.Fatalf("days = %d from %v", len(f.Days), f.Days[0].Date)
+	}
+	var dates []string
+	for _, p := range f.Payments {
+		dates = append(dates, p.Date.Format("01-02"))
+	}
+	want := []string{"04-05", "04-25", "05-05", "05-25", "06-05", "06-25"}
+	if len(dates) != len(want) {
+		t.Fatalf("payments on %v, want %v", dates, want)
+	}
+	for i := range want {
+		if dates[i] != want[i] {
+			t.Errorf("payments on %v, want %v", dates, want)
+			break
+		}
+	}
+	// 90 дней выручки минус три месяца аренды и зарплаты
+	if want := int64(5000000 + 90*1000000 - 3*15000000 - 3*40000000); f.EndBalance != want {
+		t.Errorf("end balance %d, want %d", f.EndBalance, want)
+	}
+}
+
+func TestForecastCashGaps(t *testing.T) {
+	tests := []struct {
+		name       string
+		balance    int64
+		hasBalance bool
+		minBalance int64
+		gaps       int
+		from, to   string
+		lowest     int64
+		shortfall  int64
+		payment    string
+	}{
+		{
+			name: "аренда уводит остаток в минус", balance: 5000000, hasBalance: true,
+			gaps: 2, from: "04-05", to: "04-09", lowest: -5000000, shortfall: 5000000, payment: CategoryRent,
+		},
+		{
+			name: "допустимый остаток 50 000 ₽", balance: 5000000, hasBalance: true, minBalance: 5000000,
+			gaps: 2, from: "04-05", to: "04-14", lowest: -5000000, shortfall: 10000000, payment: CategoryRent,
+		},
+		{
+			name: "остатка хватает до зарплаты", balance: 29000000, hasBalance: true,
+			gaps: 1, from: "04-25", to: "04-25", lowest: -1000000, shortfall: 1000000, payment: CategoryPayroll,
+		},
+		{
+			// Остаток ровно на допустимом уровне - еще не разрыв
+			name: "остаток опускается ровно до нуля", balance: 30000000, hasBalance: true,
+		},
+		{name: "остатка хватает на весь месяц", balance: 60000000, hasBalance: true},
+		{name: "без остатка разрывы не ищутся", balance: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Forecast(forecastHistory(), day("2026-03-31"), tt.balance, tt.hasBalance, ForecastDefaultDays, tt.minBalance)
+			if len(f.Gaps) != tt.gaps {
+				t.Fatalf("gaps = %+v, want %d", f.Gaps, tt.gaps)
+			}
+			if tt.gaps == 0 {
+				return
+			}
+			gap := f.Gaps[0]
+			if gap.From.Format("01-02") != tt.from || gap.To.Format("01-02") != tt.to {
+				t.Errorf("first gap %s..%s, want %s..%s", gap.From.Format("01-02"), gap.To.Format("01-02"), tt.from, tt.to)
+			}
+			if gap.Lowest != tt.lowest || gap.Shortfall != tt.shortfall {
+				t.Errorf("first gap lowest %d, shortfall %d; want %d, %d", gap.Lowest, gap.Shortfall, tt.lowest, tt.shortfall)
+			}
+			if len(gap.Payments) != 1 || gap.Payments[0].Category != tt.payment {
+				t.Errorf("first gap payments %+v, want %s", gap.Payments, tt.payment)
+			}
+		})
+	}
+}
+
+func TestMonthDay(t *testing.T) {
+	tests := []struct {
+		month string
+		day   int
+		want  string
+	}{
+		{"2026-02-01", 31, "2026-02-28"},
+		{"2028-02-01", 30, "2028-02-29"},
+		{"2026-04-01", 31, "2026-04-30"},
+		{"2026-05-01", 31, "2026-05-31"},
+	}
+	for _, tt := range tests {
+		if got := monthDay(day(tt.month), tt.day).Format("2006-01-02"); got != tt.want {
+			t.Errorf("monthDay(%s, %d) = %s, want %s", tt.month, tt.day, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package bank
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Категории операций
+const (
+	CategoryRevenue   = "revenue"
+	CategoryRent      = "rent"
+	CategoryPayroll   = "payroll"
+	CategoryTaxes     = "taxes"
+	CategorySuppliers = "suppliers"
+	CategoryMarketing = "marketing"
+	CategoryAcquiring = "acquiring"
+	CategoryUtilities = "utilities"
+	CategoryLoans     = "loans"
+	CategoryOwner     = "owner"
+	CategoryTransfer  = "transfer"
+	CategoryOther     = "other"
+)
+
+// CategoryOrder - категории в порядке показа
+var CategoryOrder = []string{
+	CategoryRevenue, CategoryRent, CategoryPayroll, CategoryTaxes, CategorySuppliers, CategoryMarketing,
+	CategoryAcquiring, CategoryUtilities, CategoryLoans, CategoryOwner, CategoryTransfer, CategoryOther,
+}
+
+// CategoryNames - названия категорий для пользователя
+var CategoryNames = map[string]string{
+	CategoryRevenue:   "Выручка",
+	CategoryRent:      "Аренда",
+	CategoryPayroll:   "Зарплата",
+	CategoryTaxes:     "Налоги и взносы",
+	CategorySuppliers: "Поставщики",
+	CategoryMarketing: "Маркетинг",
+	CategoryAcquiring: "Эквайринг и комиссии банка",
+	CategoryUtilities: "Коммунальные услуги и связь",
+	CategoryLoans:     "Кредиты и займы",
+	CategoryOwner:     "Выплаты владельцу",
+	CategoryTransfer:  "Переводы между своими счетами",
+	CategoryOther:     "Прочее",
+}
+
+// Откуда взялась категория операции
+const (
+	CategorySourceUser     = "user"      // пользователь указал категорию для операции
+	CategorySourceUserRule = "user_rule" // правило пользователя, в том числе выученное
+	CategorySourceRule     = "rule"      // встроенное правило
+	CategorySourceInternal = "internal"  // перевод между собственными счетами
+	CategorySourceLLM      = "llm"       // категорию выбрала модель
+)
+
+// Виды правил
+const (
+	RuleINN     = "inn"     // ИНН контрагента
+	RulePurpose = "purpose" // регулярное выражение по контрагенту и назначению платежа
+	RuleMCC     = "mcc"     // код категории продавца: "5411" или диапазон "5811-5814"
+)
+
+// Rule - правило категоризации. Direction ограничивает правило поступлениями или списаниями.
+type Rule struct {
+	ID        int64
+	Type      string
+	Pattern   string
+	Category  string
+	Direction string
+
+	re       *regexp.Regexp
+	mccFrom  int
+	mccTo    int
+	userRule bool
+}
+
+// Compile проверяет правило и готовит его к применению
+func (r *Rule) Compile() error {
+	if _, ok := CategoryNames[r.Category]; !ok || r.Category == CategoryTransfer {
+		return fmt.Errorf("unknown category %q", r.Category)
+	}
+	if r.Direction != "" && r.Direction != DirectionIn && r.Direction != DirectionOut {
+		return fmt.Errorf("invalid direction %q: expected in or out", r.Direction)
+	}
+	r.Pattern = strings.TrimSpace(r.Pattern)
+	if r.Pattern == "" {
+		return fmt.Errorf("empty pattern")
+	}
+
+	switch r.Type {
+	case RuleINN:
+		if !innRe.MatchString(r.Pattern) {
+			return fmt.Errorf("invalid INN %q: expected 10 or 12 digits", r.Pattern)
+		}
+	case RulePurpose:
+		re, err := regexp.Compile("(?i)" + r.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression: %v", err)
+		}
+		r.re = re
+	case RuleMCC:
+		from, to, _ := strings.Cut(r.Pattern, "-")
+		if to == "" {
+			to = from
+		}
+		var errFrom, errTo error
+		r.mccFrom, errFrom = strconv.Atoi(strings.TrimSpace(from))
+		r.mccTo, errTo = strconv.Atoi(strings.TrimSpace(to))
+		if errFrom != nil || errTo != nil || r.mccFrom > r.mccTo || r.mccTo > 9999 {
+			return fmt.Errorf("invalid MCC %q: expected 5411 or 5811-5814", r.Pattern)
+		}
+	default:
+		return fmt.Errorf("invalid rule type %q: expected inn, purpose or mcc", r.Type)
+	}
+	return nil
+}
+
+func (r *Rule) match(t Transaction) bool {
+	if r.Direction != "" && r.Direction != t.Direction {
+		return false
+	}
+	switch r.Type {
+	case RuleINN:
+		return t.CounterpartyINN == r.Pattern
+	case RulePurpose:
+		return r.re.MatchString(t.Counterparty + " " + t.Purpose)
+	case RuleMCC:
+		mcc, err := strconv.Atoi(t.MCC)
+		return err == nil && t.MCC != "" && mcc >= r.mccFrom && mcc <= r.mccTo
+	}
+	return false
+}
+
+var innRe = regexp.MustCompile(`^\d{10}(\d{2})?$`)
+
+// Встроенные правила. Go regexp не считает кириллицу буквами в \w и \b, поэтому окончания
+// записаны через [а-яё]*. Порядок важен: первое совпавшее правило определяет категорию.
+var builtinRules = []Rule{
+	// Казначейство России (ФНС России) - получатель единого налогового платежа
+	{Type: RuleINN, Pattern: "7727406020", Category: CategoryTaxes, Direction: DirectionOut},
+
+	{Type: RuleMCC, Pattern: "9311", Category: CategoryTaxes, Direction: DirectionOut},
+	{Type: RuleMCC, Pattern: "7311", Category: CategoryMarketing, Direction: DirectionOut},
+	{Type: RuleMCC, Pattern: "4812-4816", Category: CategoryUtilities, Direction: DirectionOut},
+	{Type: RuleMCC, Pattern: "4899-4900", Category: CategoryUtilities, Direction: DirectionOut},
+	{Type: RuleMCC, Pattern: "5411-5499", Category: CategorySuppliers, Direction: DirectionOut},
+
+	{Type: RulePurpose, Category: CategoryTaxes, Direction: DirectionOut, Pattern: `единый налоговый|(^|[^а-яё])енп([^а-яё]|$)|` +
+		`уплат[а-яё]* налог|налог (на|по) |ндфл|страхов[а-яё]* взнос|взнос[а-яё]* на (омс|опс|обязательн)|` +
+		`(^|[^а-яё])пени([^а-яё]|$)|патент|(^|[^а-яё])уфк |казначейств|(^|[^а-яё])(и|меж)?фнс|социальн[а-яё]* фонд|(^|[^а-яё])сфр([^а-яё]|$)`},
+	{Type: RulePurpose, Category: CategoryPayroll, Direction: DirectionOut, Pattern: `заработн[а-яё]* плат|зарплат|з/п|` +
+		`отпускн|больничн|пособи[а-яё]* по|выплат[а-яё]* (сотрудник|работник)|преми[а-яё]* (сотрудник|работник)`},
+	{Type: RulePurpose, Category: CategoryLoans, Pattern: `кредит|займ|заём|лизинг|погашени[а-яё]* (основного долга|процент)`},
+	{Type: RulePurpose, Category: CategoryRent, Direction: DirectionOut, Pattern: `аренд|субаренд|найм[а-яё]* помещ`},
+	{Type: RulePurpose, Category: CategoryAcquiring, Direction: DirectionOut, Pattern: `эквайринг|комисси|` +
+		`обслуживани[а-яё]* (счет|счёт|карт|тариф)|плата за (обслуживание|ведение|пакет)|тарифн[а-яё]* план`},
+	{Type: RulePurpose, Category: CategoryMarketing, Direction: DirectionOut, Pattern: `реклам|продвижени|маркетинг|` +
+		`яндекс[. ]?директ|(^|[^a-z])smm([^a-z]|$)|таргет|рекламн`},
+	{Type: RulePurpose, Category: CategoryUtilities, Direction: DirectionOut, Pattern: `электроэнерг|электроснабж|коммунальн|` +
+		`водоснабж|водоотвед|теплоснабж|тепловая энерг|вывоз [а-яё]*\s*(мусор|отход)|услуг[а-яё]* связи|интернет|телефони`},
+	{Type: RulePurpose, Category: CategoryOwner, Direction: DirectionOut, Pattern: `перевод собственных средств|` +
+		`на личн[а-яё]* (нужды|карт|счет)|дивиденд|вывод [а-яё]*\s*средств|доход предпринимател`},
+	{Type: RulePurpose, Category: CategorySuppliers, Direction: DirectionOut, Pattern: `поставк|товар|закупк|сырь|продукци|` +
+		`накладн|(^|[^а-яё])упд([^а-яё]|$)|счет[а-яё]*[- ]фактур|по сч[её]ту|продукт`},
+	// Прочие поступления - выручка: оплата покупателей, возмещение по эквайрингу, инкассация
+	{Type: RulePurpose, Category: CategoryRevenue, Direction: DirectionIn, Pattern: `.`},
+}
+
+func init() {
+	for i := range builtinRules {
+		if err := builtinRules[i].Compile(); err != nil {
+			panic(fmt.Sprintf("bank: builtin rule %q: %v", builtinRules[i].Pattern, err))
+		}
+	}
+}
+
+// Categorizer выбирает категорию операции: сначала по правилам пользователя
+// (ИНН, затем MCC, затем назначение платежа), потом по встроенным правилам
+type Categorizer struct {
+	rules []*Rule
+}
+
+// NewCategorizer готовит правила пользователя; правила с ошибками пропускаются
+func NewCategorizer(userRules []Rule) *Categorizer {
+	c := &Categorizer{}
+	for _, ruleType := range []string{RuleINN, RuleMCC, RulePurpose} {
+		for i := range userRules {
+			rule := userRules[i]
+			if rule.Type != ruleType || rule.Compile() != nil {
+				continue
+			}
+			rule.userRule = true
+			c.rules = append(c.rules, &rule)
+		}
+	}
+	for i := range builtinRules {
+		c.rules = append(c.rules, &builtinRules[i])
+	}
+	return c
+}
+
+// Categorize возвращает категорию операции, ее источник и id сработавшего правила пользователя.
+// Если ни одно правило не подошло, категория пустая.
+func (c *Categorizer) Categorize(t Transaction) (category, source string, ruleID int64) {
+	if t.Internal {
+		return CategoryTransfer, CategorySourceInternal, 0
+	}
+	for _, rule := range c.rules {
+		if !rule.match(t) {
+			continue
+		}
+		if rule.userRule {
+			return rule.Category, CategorySourceUserRule, rule.ID
+		}
+		return rule.Category, CategorySourceRule, 0
+	}
+	return "", "", 0
+}
+
+// mccRe - код MCC в назначении платежа по карточным операциям: "MCC 5411", "MCC:5812"
+var mccRe = regexp.MustCompile(`(?i)(^|[^a-z])mcc[\s:=-]*(\d{4})([^\d]|$)`)
+
+// MCCFromText находит код MCC в тексте операции
+func MCCFromText(text string) string {
+	if match := mccRe.FindStringSubmatch(text); match != nil {
+		return match[2]
+	}
+	return ""
+}
@@ -0,0 +1,166 @@
+package bank
+
+import "testing"
+
+func TestCategorize(t *testing.T) {
+	userRules := []Rule{
+		// Правила пользователя проверяются в порядке ИНН, MCC, назначение - независимо от порядка в списке
+		{ID: 1, Type: RulePurpose, Pattern: "ООО Ромашка", Category: CategorySuppliers},
+		{ID: 2, Type: RuleMCC, Pattern: "5811-5814", Category: CategoryMarketing, Direction: DirectionOut},
+		{ID: 3, Type: RuleINN, Pattern: "7701234567", Category: CategoryRent, Direction: DirectionOut},
+		// Правило пользователя перекрывает встроенное для того же назначения
+		{ID: 4, Type: RulePurpose, Pattern: `интернет`, Category: CategoryMarketing},
+		// Правила с ошибками пропускаются
+		{ID: 5, Type: RulePurpose, Pattern: "(", Category: CategoryOther},
+		{ID: 6, Type: RuleINN, Pattern: "123", Category: CategoryOther},
+		{ID: 7, Type: RuleMCC, Pattern: "5999", Category: CategoryTransfer},
+	}
+	c := NewCategorizer(userRules)
+
+	tests := []struct {
+		name     string
+		t        Transaction
+		category string
+		source   string
+		ruleID   int64
+	}{
+		{
+			name:     "перевод между своими счетами важнее правил",
+			t:        Transaction{Direction: DirectionOut, Internal: true, CounterpartyINN: "7701234567"},
+			category: CategoryTransfer, source: CategorySourceInternal,
+		},
+		{
+			name:     "ИНН пользователя важнее назначения пользователя",
+			t:        Transaction{Direction: DirectionOut, CounterpartyINN: "7701234567", Counterparty: "ООО Ромашка", Purpose: "Оплата по счету"},
+			category: CategoryRent, source: CategorySourceUserRule, ruleID: 3,
+		},
+		{
+			name:     "MCC пользователя важнее назначения пользователя",
+			t:        Transaction{Direction: DirectionOut, MCC: "5812", Counterparty: "ООО Ромашка"},
+			category: CategoryMarketing, source: CategorySourceUserRule, ruleID: 2,
+		},
+		{
+			name:     "направление ограничивает правило пользователя",
+			t:        Transaction{Direction: DirectionIn, CounterpartyINN: "7701234567", Purpose: "Оплата за кофе"},
+			category: CategoryRevenue, source: CategorySourceRule,
+		},
+		{
+			name:     "правило пользователя важнее встроенного",
+			t:        Transaction{Direction: DirectionOut, Purpose: "Оплата за интернет, март"},
+			category: CategoryMarketing, source: CategorySourceUserRule, ruleID: 4,
+		},
+		{
+			name:     "назначение без учета регистра",
+			t:        Transaction{Direction: DirectionOut, Counterparty: "ооо ромашка"},
+			category: CategorySuppliers, source: CategorySourceUserRule, ruleID: 1,
+		},
+		{
+			name:     "встроенное правило по ИНН казначейства",
+			t:        Transaction{Direction: DirectionOut, CounterpartyINN: "7727406020", Purpose: "Оплата по счету"},
+			category: CategoryTaxes, source: CategorySourceRule,
+		},
+		{
+			name:     "первое совпавшее встроенное правило: налоги раньше зарплаты",
+			t:        Transaction{Direction: DirectionOut, Purpose: "НДФЛ с заработной платы за март"},
+			category: CategoryTaxes, source: CategorySourceRule,
+		},
+		{
+			name:     "зарплата",
+			t:        Transaction{Direction: DirectionOut, Purpose: "Перечисление заработной платы за март"},
+			category: CategoryPayroll, source: CategorySourceRule,
+		},
+		{
+			name:     "аренда",
+			t:        Transaction{Direction: DirectionOut, Purpose: "Арендная плата за апрель"},
+			category: CategoryRent, source: CategorySourceRule,
+		},
+		{
+			name:     "ЕНП целым словом",
+			t:        Transaction{Direction: DirectionOut, Purpose: "ЕНП за 1 квартал"},
+			category: CategoryTaxes, source: CategorySourceRule,
+		},
+		{
+			name:     "поступление по умолчанию - выручка",
+			t:        Transaction{Direction: DirectionIn, Purpose: "Возмещение по операциям с картами"},
+			category: CategoryRevenue, source: CategorySourceRule,
+		},
+		{
+			name: "списание без совпадений остается без категории",
+			t:    Transaction{Direction: DirectionOut, Purpose: "Оплата по договору 15"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			category, source, ruleID := c.Categorize(tt.t)
+			if category != tt.category || source != tt.source || ruleID != tt.ruleID {
+				t.Errorf("Categorize = %q, %q, %d; want %q, %q, %d", category, source, ruleID, tt.category, tt.source, tt.ruleID)
+			}
+		})
+	}
+}
+
+func TestCategorizeMCC(t *testing.T) {
+	c := NewCategorizer(nil)
+	tests := []struct {
+		mcc       string
+		direction string
+		category  string
+	}{
+		{"5411", DirectionOut, CategorySuppliers},
+		{"5499", DirectionOut, CategorySuppliers},
+		{"5500", DirectionOut, ""},
+		{"4814", DirectionOut, CategoryUtilities},
+		{"4900", DirectionOut, CategoryUtilities},
+		{"7311", DirectionOut, CategoryMarketing},
+		{"9311", DirectionOut, CategoryTaxes},
+		{"0742", DirectionOut, ""},
+		{"5411", DirectionIn, CategoryRevenue}, // возврат по карте - поступление
+	}
+	for _, tt := range tests {
+		category, _, _ := c.Categorize(Transaction{Direction: tt.direction, MCC: tt.mcc, Purpose: "Покупка по карте"})
+		if category != tt.category {
+			t.Errorf("MCC %s %s: category %q, want %q", tt.mcc, tt.direction, category, tt.category)
+		}
+	}
+}
+
+func TestMCCFromText(t *testing.T) {
+	tests := map[string]string{
+		"Покупка по карте *1234, MCC 5411, ПЯТЕРОЧКА": "5411",
+		"Оплата товаров MCC:5812":                     "5812",
+		"mcc=4814 МТС":                                "4814",
+		"Оплата по счету 54111":                       "",
+		"MCC 54111":                                   "",
+		"XMCC 5411":                                   "",
+	}
+	for text, want := range tests {
+		if got := MCCFromText(text); got != want {
+			t.Errorf("MCCFromText(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestRuleCompile(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		ok   bool
+	}{
+		{Rule{Type: RuleINN, Pattern: "7701234567", Category: CategoryRent}, true},
+		{Rule{Type: RuleINN, Pattern: "770123456789", Category: CategoryRent}, true},
+		{Rule{Type: RuleINN, Pattern: "77012345", Category: CategoryRent}, false},
+		{Rule{Type: RuleMCC, Pattern: "5811-5814", Category: CategoryMarketing}, true},
+		{Rule{Type: RuleMCC, Pattern: "5814-5811", Category: CategoryMarketing}, false},
+		{Rule{Type: RuleMCC, Pattern: "12345", Category: CategoryMarketing}, false},
+		{Rule{Type: RulePurpose, Pattern: "  ", Category: CategoryOther}, false},
+		{Rule{Type: RulePurpose, Pattern: "аренд", Category: "unknown"}, false},
+		{Rule{Type: RulePurpose, Pattern: "аренд", Category: CategoryTransfer}, false},
+		{Rule{Type: RulePurpose, Pattern: "аренд", Category: CategoryRent, Direction: "both"}, false},
+		{Rule{Type: "amount", Pattern: "100", Category: CategoryRent}, false},
+	}
+	for _, tt := range tests {
+		rule := tt.rule
+		if err := rule.Compile(); (err == nil) != tt.ok {
+			t.Errorf("Compile(%+v) = %v, want ok %v", tt.rule, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SWIFT MT940: поля ":тег:значение", продолжение поля - на следующих строках. Сообщение
+// начинается с :20:, в одном файле бывает несколько сообщений (по счетам и дням):
+//
+//	:25: счет  :60F:/:60M: остаток на начало  :61: операция  :86: ее описание  :62F:/:62M: остаток на конец
+
+var (
+	mt940FieldRe = regexp.MustCompile(`^:(\d{2}[A-Z]?):`)
+	// :60F:C250301EUR1234,56 - признак, дата YYMMDD, валюта, сумма
+	mt940BalanceRe = regexp.MustCompile(`^([CD])(\d{6})([A-Z]{3})([\d,]+)`)
+	// :61:2503010301D100,00NTRFNONREF//BANKREF - дата валютирования, [дата проводки MMDD], признак
+	// (C, D или RC, RD - сторно), [код средств], сумма, тип операции, референс клиента, [//референс банка]
+	mt940LineRe = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?(\d[\d,]*)([NSF][A-Z0-9]{3})([^/\n]*)(?://([^\n]*))?`)
+	// Структурированное :86: (немецкие банки): код операции, затем подполя ?NN
+	mt940GVCRe      = regexp.MustCompile(`^\d{3}\?`)
+	mt940CurrencyRe = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+func isMT940(text string) bool {
+	head := text
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	return strings.Contains(head, ":20:") && strings.Contains(head, ":25:") &&
+		(strings.Contains(head, ":60F:") || strings.Contains(head, ":60M:"))
+}
+
+type mt940Field struct {
+	tag, value string
+}
+
+// mt940Fields разбивает текст на поля, пропуская заголовки SWIFT ({1:...}{2:...}{4:) и концы сообщений (-})
+func mt940Fields(text string) []mt940Field {
+	var fields []mt940Field
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r ")
+		if match := mt940FieldRe.FindStringSubmatch(line); match != nil {
+			fields = append(fields, mt940Field{tag: match[1], value: line[len(match[0]):]})
+			continue
+		}
+		if line == "" || line == "-" || line == "-}" || strings.HasPrefix(line, "{") {
+			continue
+		}
+		if len(fields) > 0 {
+			fields[len(fields)-1].value += "\n" + line
+		}
+	}
+	return fields
+}
+
+func parseMT940(text string) (*Statement, error) {
+	st := &Statement{Format: FormatMT940}
+	var account *Account
+	var transactions []Transaction
+	var lastTransaction *Transaction
+	message := 0
+
+	flush := func() {
+		if account == nil {
+			return
+		}
+		// Дата остатка на начало у разных банков - предыдущий день или первый день выписки
+		if len(transactions) > 0 && (account.DateFrom.IsZero() || transactions[0].Date.Before(account.DateFrom)) {
+			account.DateFrom = transactions[0].Date
+		}
+		if !account.DateTo.IsZero() && account.DateFrom.After(account.DateTo) {
+			account.DateFrom = account.DateTo
+		}
+		st.Transactions = append(st.Transactions, transactions...)
+		st.addAccount(*account)
+		account, transactions, lastTransaction = nil, nil, nil
+	}
+
+	for _, field := range mt940Fields(text) {
+		switch field.tag {
+		case "20":
+			flush()
+			message++
+			account = &Account{}
+		case "25":
+			if account != nil {
+				account.Number = mt940AccountNumber(field.value)
+			}
+		case "60F", "60M":
+			if account == nil {
+				continue
+			}
+			amount, date, currency, err := mt940Balance(field.value)
+			if errors.Is(err, ErrThousandths) {
+				// Операции в валюте счета разбираются и без остатков
+				account.Currency = currency
+				st.Warnings = append(st.Warnings, fmt.Sprintf("Сообщение %d: остаток на начало в тысячных долях валюты не поддерживается, остатки не проверяются", message))
+				continue
+			}
+			if err != nil {
+				st.Warnings = append(st.Warnings, fmt.Sprintf("Сообщение %d: неверный остаток на начало %q", message, field.value))
+				continue
+			}
+			account.Opening, account.Currency, account.HasBalance = amount, currency, true
+			// Остаток на начало - на конец предыдущего дня
+			account.DateFrom = date.AddDate(0, 0, 1)
+		case "62F", "62M":
+			if account == nil {
+				continue
+			}
+			amount, date, _, err := mt940Balance(field.value)
+			if err != nil {
+				st.Warnings = append(st.Warnings, fmt.Sprintf("Сообщение %d: неверный остаток на конец %q", message, field.value))
+				account.HasBalance = false
+				continue
+			}
+			account.Closing, account.DateTo = amount, date
+		case "61":
+			if account == nil {
+				continue
+			}
+			lastTransaction = nil
+			t, err := mt940Transaction(field.value)
+			if err != nil {
+				st.Warnings = append(st.Warnings, fmt.Sprintf("Сообщение %d, операция %d: %v", message, len(transactions)+1, err))
+				continue
+			}
+			t.Account, t.Currency = account.Number, account.Currency
+			transactions = append(transactions, t)
+			lastTransaction = &transactions[len(transactions)-1]
+		case "86":
+			if lastTransaction != nil {
+				mt940ApplyInfo(lastTransaction, field.value)
+				lastTransaction = nil
+			}
+		}
+	}
+	flush()
+
+	if len(st.Accounts) == 0 {
+		return nil, ErrUnknownFormat
+	}
+	return st, nil
+}
+
+// mt940AccountNumber - счет из :25:. Немецкие банки пишут "BLZ/счет", некоторые - "счет/валюта"
+func mt940AccountNumber(value string) string {
+	value = strings.TrimSpace(strings.SplitN(value, "\n", 2)[0])
+	bankCode, number, ok := strings.Cut(value, "/")
+	switch {
+	case !ok || bankCode == "":
+		return value
+	case mt940CurrencyRe.MatchString(number):
+		return bankCode
+	}
+	return number
+}
+
+// mt940Balance разбирает остаток вида "C250301EUR1234,56"
+func mt940Balance(value string) (amount int64, date time.Time, currency string, err error) {
+	match := mt940BalanceRe.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0, date, "", fmt.Errorf("invalid balance %q", value)
+	}
+	if date, err = mt940Date(match[2]); err != nil {
+		return 0, date, "", err
+	}
+	if amount, err = parseAmount(match[4]); err != nil {
+		return 0, date, match[3], err
+	}
+	if match[1] == "D" {
+		amount = -amount
+	}
+	return amount, date, match[3], nil
+}
+
+// mt940Transaction разбирает строку операции :61:
+func mt940Transaction(value string) (Transaction, error) {
+	var t Transaction
+	match := mt940LineRe.FindStringSubmatch(value)
+	if match == nil {
+		return t, fmt.Errorf("неверная строка операции %q", strings.SplitN(value, "\n", 2)[0])
+	}
+	date, err := mt940Date(match[1])
+	if err != nil {
+		return t, fmt.Errorf("неверная дата %q", match[1])
+	}
+	amount, err := parseAmount(match[5])
+	if err != nil {
+		return t, amountError(match[5], err)
+	}
+	t.Date, t.Amount = date, amount
+
+	// Сторно кредита уменьшает остаток, сторно дебета - увеличивает
+	switch match[3] {
+	case "C", "RD":
+		t.Direction = DirectionIn
+	case "D", "RC":
+		t.Direction = DirectionOut
+	}
+	t.DocType = match[6]
+	if ref := strings.TrimSpace(match[7]); ref != "" && ref != "NONREF" {
+		t.DocNumber = ref
+	} else {
+		t.DocNumber = strings.TrimSpace(match[8])
+	}
+	// Дополнительные сведения - на второй строке поля
+	if _, details, ok := strings.Cut(value, "\n"); ok {
+		t.Purpose = strings.TrimSpace(details)
+	}
+	return t, nil
+}
+
+// mt940Date разбирает дату YYMMDD
+func mt940Date(value string) (time.Time, error) {
+	return time.Parse("060102", value)
+}
+
+// mt940ApplyInfo дополняет операцию сведениями из поля :86:. Поддерживаются подполя ?NN
+// (?20-?29 и ?60-?63 - назначение, ?31 - счет, ?32-?33 - наименование контрагента)
+// и теги вида /NAME/.../REMI/...; иначе весь текст считается назначением платежа.
+func mt940ApplyInfo(t *Transaction, value string) {
+	value = strings.ReplaceAll(value, "\n", "")
+	switch {
+	case mt940GVCRe.MatchString(value):
+		var purpose, name []string
+		for _, part := range strings.Split(value[3:], "?")[1:] {
+			if len(part) < 2 {
+				continue
+			}
+			// Подполя режут текст по длине, поэтому пробелы на границах сохраняются
+			code, text := part[:2], part[2:]
+			switch {
+			case code >= "20" && code <= "29", code >= "60" && code <= "63":
+				purpose = append(purpose, text)
+			case code == "31":
+				t.CounterpartyAccount = strings.TrimSpace(text)
+			case code == "32", code == "33":
+				name = append(name, text)
+			}
+		}
+		t.Purpose = strings.TrimSpace(strings.Join(purpose, ""))
+		t.Counterparty = strings.TrimSpace(strings.Join(name, ""))
+	case strings.HasPrefix(value, "/"):
+		tags := mt940Tags(value)
+		// /CNTP/счет/BIC/наименование/город/ - контрагент одним тегом
+		counterparty := strings.Split(tags["CNTP"], "/")
+		for len(counterparty) < 3 {
+			counterparty = append(counterparty, "")
+		}
+		t.Counterparty = firstNonEmpty(tags["NAME"], tags["BENM"], tags["ORDP"], counterparty[2])
+		t.CounterpartyAccount = firstNonEmpty(tags["ACCT"], tags["IBAN"], counterparty[0])
+		t.CounterpartyINN = tags["INN"]
+		if purpose := firstNonEmpty(tags["REMI"], tags["PURP"]); purpose != "" {
+			t.Purpose = purpose
+		}
+	default:
+		t.Purpose = strings.TrimSpace(value)
+	}
+}
+
+// mt940Tags разбирает "/NAME/ООО Ромашка/INN/7701234567/REMI/Оплата по счету 15" в словарь.
+// Теги - латинские буквы в верхнем регистре; значение - до следующего известного тега.
+func mt940Tags(value string) map[string]string {
+	known := map[string]bool{"NAME": true, "BENM": true, "ORDP": true, "ACCT": true, "IBAN": true,
+		"INN": true, "REMI": true, "PURP": true, "EREF": true, "BIC": true, "CNTP": true, "KPP": true}
+	tags := make(map[string]string)
+	parts := strings.Split(value, "/")
+	current := ""
+	for _, part := range parts[1:] {
+		if known[part] {
+			current = part
+			tags[current] = ""
+			continue
+		}
+		if current != "" {
+			tags[current] += part + "/"
+		}
+	}
+	for tag, text := range tags {
+		tags[tag] = strings.TrimSpace(strings.TrimSuffix(text, "/"))
+	}
+	return tags
+}
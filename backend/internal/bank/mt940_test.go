@@ -0,0 +1,79 @@
+package bank
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mt940Statement(opening, closing string) string {
+	return strings.Join([]string{
+		":20:STMT20260301",
+		":25:DE89370400440532013000",
+		":28C:1/1",
+		":60F:" + opening,
+		":61:2603020302C1500,00NTRFNONREF//B1",
+		":86:166?00GUTSCHRIFT?20Rechnung 42?32Muster GmbH",
+		":61:2603030303D250,50NMSCREF1",
+		":86:Miete Maerz",
+		":61:2603030303RD100,00NTRFNONREF",
+		":86:Storno",
+		":62F:" + closing,
+		"-",
+		"",
+	}, "\r\n")
+}
+
+func TestMT940BalanceCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		opening  string
+		closing  string
+		mismatch bool
+	}{
+		// 1 000,00 + 1 500,00 - 250,50 + 100,00 (сторно дебета) = 2 349,50
+		{"остатки сходятся", "C260301EUR1000,00", "C260303EUR2349,50", false},
+		{"отрицательный остаток", "D260301EUR500,00", "C260303EUR849,50", false},
+		{"остатки не сходятся", "C260301EUR1000,00", "C260303EUR2249,50", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, err := Parse([]byte(mt940Statement(tt.opening, tt.closing)))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if st.Format != FormatMT940 || len(st.Transactions) != 3 {
+				t.Fatalf("format %s, %d transactions", st.Format, len(st.Transactions))
+			}
+			if got := hasWarning(st, "остатки не сходятся"); got != tt.mismatch {
+				t.Errorf("mismatch warning %v, want %v (warnings %q)", got, tt.mismatch, st.Warnings)
+			}
+		})
+	}
+}
+
+func TestMT940Transactions(t *testing.T) {
+	st, err := Parse([]byte(mt940Statement("C260301EUR1000,00", "C260303EUR2349,50")))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	account := st.Accounts[0]
+	if account.Number != "DE89370400440532013000" || account.Currency != "EUR" || account.Opening != 1000_00 ||
+		!account.DateFrom.Equal(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("account = %+v", account)
+	}
+	tests := []struct {
+		amount    int64
+		direction string
+	}{
+		{1500_00, DirectionIn},
+		{250_50, DirectionOut},
+		{100_00, DirectionIn},
+	}
+	for i, tt := range tests {
+		tr := st.Transactions[i]
+		if tr.Amount != tt.amount || tr.Direction != tt.direction || tr.Currency != "EUR" {
+			t.Errorf("transaction %d = %+v, want %d %s", i, tr, tt.amount, tt.direction)
+		}
+	}
+}
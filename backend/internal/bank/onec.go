@@ -0,0 +1,208 @@
+package bank
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Формат 1CClientBankExchange: строки "Ключ=Значение", заголовок файла, секции
+// "СекцияРасчСчет ... КонецРасчСчет" с остатками и "СекцияДокумент=<вид> ... КонецДокумента"
+// с платежными документами.
+
+const onecHeader = "1CClientBankExchange"
+
+func is1C(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line == onecHeader
+		}
+	}
+	return false
+}
+
+// Плательщик и получатель иногда записаны как "ИНН 7701234567 ООО Ромашка"
+var onecNameINNRe = regexp.MustCompile(`^ИНН\s*\d{10,12}\s+`)
+
+func parse1C(text string) (*Statement, error) {
+	st := &Statement{Format: Format1C}
+	own := make(map[string]bool)
+	var ownOrder []string
+	addOwn := func(account string) {
+		if account = strings.TrimSpace(account); account != "" && !own[account] {
+			own[account] = true
+			ownOrder = append(ownOrder, account)
+		}
+	}
+
+	var docs []map[string]string
+	var doc, section map[string]string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		switch {
+		case key == "СекцияДокумент":
+			doc = map[string]string{"СекцияДокумент": value}
+		case key == "КонецДокумента":
+			if doc != nil {
+				docs = append(docs, doc)
+			}
+			doc = nil
+		case key == "СекцияРасчСчет":
+			section = map[string]string{}
+		case key == "КонецРасчСчет":
+			if section != nil {
+				st.addAccountSection(section, addOwn)
+			}
+			section = nil
+		case key == "КонецФайла":
+		case doc != nil:
+			doc[key] = value
+		case section != nil:
+			section[key] = value
+		default:
+			// Заголовок файла
+			switch key {
+			case "РасчСчет":
+				addOwn(value)
+			case "ДатаНачала":
+				if date, err := parseDate(value); err == nil {
+					st.DateFrom = date
+				}
+			case "ДатаКонца":
+				if date, err := parseDate(value); err == nil {
+					st.DateTo = date
+				}
+			}
+		}
+	}
+
+	// Счета без секции остатков
+	for _, number := range ownOrder {
+		found := false
+		for _, account := range st.Accounts {
+			found = found || account.Number == number
+		}
+		if !found {
+			st.addAccount(Account{Number: number, Currency: "RUB"})
+		}
+	}
+
+	for i, doc := range docs {
+		t, err := onecTransaction(doc, own)
+		if err != nil {
+			st.Warnings = append(st.Warnings, fmt.Sprintf("Документ %d (№ %s): %v", i+1, doc["Номер"], err))
+			continue
+		}
+		st.Transactions = append(st.Transactions, t)
+	}
+	return st, nil
+}
+
+// addAccountSection добавляет счет из секции "СекцияРасчСчет"
+func (st *Statement) addAccountSection(section map[string]string, addOwn func(string)) {
+	account := Account{Number: section["РасчСчет"], Currency: "RUB"}
+	if account.Number == "" {
+		return
+	}
+	addOwn(account.Number)
+	opening, errOpening := parseAmount(section["НачальныйОстаток"])
+	closing, errClosing := parseAmount(section["КонечныйОстаток"])
+	if errOpening == nil && errClosing == nil {
+		account.Opening, account.Closing, account.HasBalance = opening, closing, true
+	}
+	account.DateFrom, _ = parseDate(section["ДатаНачала"])
+	account.DateTo, _ = parseDate(section["ДатаКонца"])
+	st.addAccount(account)
+}
+
+// onecTransaction превращает платежный документ в операцию. Направление определяется по тому,
+// чей счет собственный; если собственные счета в файле не указаны - по датам списания и поступления.
+func onecTransaction(doc map[string]string, own map[string]bool) (Transaction, error) {
+	t := Transaction{
+		Currency:  "RUB",
+		DocNumber: doc["Номер"],
+		DocType:   doc["СекцияДокумент"],
+		Purpose:   onecPurpose(doc),
+	}
+
+	amount, err := parseAmount(doc["Сумма"])
+	if err != nil {
+		return t, amountError(doc["Сумма"], err)
+	}
+	t.Amount = amount
+
+	payerAccount, payerOwn := onecAccount(doc, "Плательщик", own)
+	payeeAccount, payeeOwn := onecAccount(doc, "Получатель", own)
+	switch {
+	case payerOwn:
+		t.Direction, t.Internal = DirectionOut, payeeOwn
+	case payeeOwn:
+		t.Direction = DirectionIn
+	case doc["ДатаСписано"] != "":
+		t.Direction = DirectionOut
+	case doc["ДатаПоступило"] != "":
+		t.Direction = DirectionIn
+	default:
+		return t, fmt.Errorf("не удалось определить, списание это или поступление")
+	}
+
+	dateKey, side, ownAccount, otherAccount := "ДатаПоступило", "Плательщик", payeeAccount, payerAccount
+	if t.Direction == DirectionOut {
+		dateKey, side, ownAccount, otherAccount = "ДатаСписано", "Получатель", payerAccount, payeeAccount
+	}
+	date, err := parseDate(doc[dateKey])
+	if err != nil {
+		if date, err = parseDate(doc["Дата"]); err != nil {
+			return t, fmt.Errorf("неверная дата %q", doc["Дата"])
+		}
+	}
+	t.Date = date
+	t.Account = ownAccount
+	t.CounterpartyAccount = otherAccount
+	t.CounterpartyINN = doc[side+"ИНН"]
+	t.Counterparty = onecName(doc, side)
+	return t, nil
+}
+
+// onecAccount возвращает счет плательщика или получателя и признак собственного счета.
+// При непрямых расчетах счет клиента записан в ...РасчСчет, а в ...Счет - корреспондентский.
+func onecAccount(doc map[string]string, side string, own map[string]bool) (string, bool) {
+	for _, key := range []string{side + "РасчСчет", side + "Счет"} {
+		if account := doc[key]; own[account] {
+			return account, true
+		}
+	}
+	if account := doc[side+"РасчСчет"]; account != "" {
+		return account, false
+	}
+	return doc[side+"Счет"], false
+}
+
+// onecName возвращает наименование плательщика или получателя
+func onecName(doc map[string]string, side string) string {
+	if name := doc[side+"1"]; name != "" {
+		return name
+	}
+	return onecNameINNRe.ReplaceAllString(doc[side], "")
+}
+
+// onecPurpose возвращает назначение платежа; в старых версиях формата оно разбито на НазначениеПлатежа1..6
+func onecPurpose(doc map[string]string) string {
+	if purpose := doc["НазначениеПлатежа"]; purpose != "" {
+		return purpose
+	}
+	var parts []string
+	for i := 1; i <= 6; i++ {
+		if part := doc["НазначениеПлатежа"+strconv.Itoa(i)]; part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,120 @@
+package bank
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// onecStatement - выписка 1С: поступление 400 000 ₽ и списание 150 000 ₽ по счету с остатками
+func onecStatement(encoding string, closing string) string {
+	return strings.Join([]string{
+		"1CClientBankExchange",
+		"ВерсияФормата=1.03",
+		"Кодировка=" + encoding,
+		"ДатаНачала=01.01.2026",
+		"ДатаКонца=31.01.2026",
+		"РасчСчет=40702810900000000001",
+		"СекцияРасчСчет",
+		"ДатаНачала=01.01.2026",
+		"ДатаКонца=31.01.2026",
+		"РасчСчет=40702810900000000001",
+		"НачальныйОстаток=100000.00",
+		"КонечныйОстаток=" + closing,
+		"КонецРасчСчет",
+		"СекцияДокумент=Платежное поручение",
+		"Номер=2",
+		"Дата=15.01.2026",
+		"Сумма=400000.00",
+		"ПлательщикСчет=40702810000000000002",
+		"ДатаПоступило=15.01.2026",
+		"Плательщик=ООО Клиент",
+		"ПлательщикИНН=7703000003",
+		"ПолучательСчет=40702810900000000001",
+		"Получатель=ИП Иванов",
+		"НазначениеПлатежа=Оплата по договору 5 за услуги, без НДС",
+		"КонецДокумента",
+		"СекцияДокумент=Платежное поручение",
+		"Номер=4",
+		"Дата=20.01.2026",
+		"Сумма=150000.00",
+		"ПлательщикСчет=40702810900000000001",
+		"ДатаСписано=20.01.2026",
+		"Плательщик=ИП Иванов",
+		"ПолучательСчет=40702810000000000004",
+		"Получатель=ООО Поставщик",
+		"ПолучательИНН=7702000002",
+		"НазначениеПлатежа=Оплата товара по счету 17",
+		"КонецДокумента",
+		"КонецФайла",
+		"",
+	}, "\r\n")
+}
+
+func Test1CEncodings(t *testing.T) {
+	tests := []struct {
+		name string
+		data func() ([]byte, error)
+	}{
+		{"windows-1251", func() ([]byte, error) {
+			return charmap.Windows1251.NewEncoder().Bytes([]byte(onecStatement("Windows", "350000.00")))
+		}},
+		{"cp866", func() ([]byte, error) {
+			return charmap.CodePage866.NewEncoder().Bytes([]byte(onecStatement("DOS", "350000.00")))
+		}},
+		{"utf-8", func() ([]byte, error) { return []byte(onecStatement("UTF-8", "350000.00")), nil }},
+		{"utf-8 с BOM", func() ([]byte, error) { return []byte("\xef\xbb\xbf" + onecStatement("UTF-8", "350000.00")), nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.data()
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			st, err := Parse(data)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if st.Format != Format1C || len(st.Transactions) != 2 || len(st.Warnings) != 0 {
+				t.Fatalf("format %s, %d transactions, warnings %q", st.Format, len(st.Transactions), st.Warnings)
+			}
+			in, out := st.Transactions[0], st.Transactions[1]
+			if in.Direction != DirectionIn || in.Amount != 400_000_00 || in.Counterparty != "ООО Клиент" || in.CounterpartyINN != "7703000003" {
+				t.Errorf("incoming = %+v", in)
+			}
+			if out.Direction != DirectionOut || out.Amount != 150_000_00 || out.Counterparty != "ООО Поставщик" ||
+				out.Purpose != "Оплата товара по счету 17" {
+				t.Errorf("outgoing = %+v", out)
+			}
+		})
+	}
+}
+
+func Test1CBalanceCheck(t *testing.T) {
+	tests := []struct {
+		closing  string
+		mismatch bool
+	}{
+		{"350000.00", false},
+		{"360000.00", true},
+	}
+	for _, tt := range tests {
+		st, err := Parse([]byte(onecStatement("UTF-8", tt.closing)))
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		if got := hasWarning(st, "остатки не сходятся"); got != tt.mismatch {
+			t.Errorf("closing %s: mismatch warning %v, want %v (warnings %q)", tt.closing, got, tt.mismatch, st.Warnings)
+		}
+	}
+}
+
+func hasWarning(st *Statement, text string) bool {
+	for _, w := range st.Warnings {
+		if strings.Contains(w, text) {
+			return true
+		}
+	}
+	return false
+}
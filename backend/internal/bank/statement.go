@@ -0,0 +1,366 @@
+// Package bank разбирает банковские выписки в единый список операций.
+package bank
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Направление операции относительно собственного счета
+const (
+	DirectionIn  = "in"  // поступление на счет
+	DirectionOut = "out" // списание со счета
+)
+
+// Форматы выписок
+const (
+	Format1C      = "1c"      // 1CClientBankExchange - текстовый формат обмена с 1С
+	FormatCamt053 = "camt053" // ISO 20022 camt.053 - XML-выписка
+	FormatMT940   = "mt940"   // SWIFT MT940
+)
+
+// FormatNames - названия форматов для пользователя
+var FormatNames = map[string]string{
+	Format1C:      "1С (1CClientBankExchange)",
+	FormatCamt053: "ISO 20022 camt.053",
+	FormatMT940:   "SWIFT MT940",
+}
+
+// ErrUnknownFormat - файл не является выпиской в известном формате
+var ErrUnknownFormat = errors.New("bank: unknown statement format")
+
+// ErrThousandths - сумма с ненулевыми тысячными долями (валюты с тремя знаками после запятой:
+// KWD, BHD, OMR и др.). Суммы хранятся в сотых долях валюты, поэтому такие операции и остатки
+// пропускаются с предупреждением, а остальная выписка разбирается.
+var ErrThousandths = errors.New("bank: amount has three decimal places")
+
+// minorUnits - число знаков после запятой по ISO 4217 для валют, где их не два
+var minorUnits = map[string]int{
+	"JPY": 0, "KRW": 0, "VND": 0, "CLP": 0, "ISK": 0, "PYG": 0, "UGX": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"KWD": 3, "BHD": 3, "OMR": 3, "JOD": 3, "IQD": 3, "LYD": 3, "TND": 3,
+}
+
+// MinorUnits - число знаков после запятой в сумме валюты по ISO 4217 (для большинства валют 2)
+func MinorUnits(currency string) int {
+	if units, ok := minorUnits[strings.ToUpper(currency)]; ok {
+		return units
+	}
+	return 2
+}
+
+// amountError - текст предупреждения о сумме, которую не удалось разобрать
+func amountError(value string, err error) error {
+	if errors.Is(err, ErrThousandths) {
+		return fmt.Errorf("сумма %q в тысячных долях валюты не поддерживается, операция пропущена", value)
+	}
+	return fmt.Errorf("неверная сумма %q", value)
+}
+
+// Statement - разобранная выписка
+type Statement struct {
+	Format       string
+	DateFrom     time.Time // начало периода выписки; нулевое, если не указано
+	DateTo       time.Time
+	Accounts     []Account
+	Transactions []Transaction
+	Warnings     []string // документы, которые не удалось разобрать, и расхождения остатков
+}
+
+// Account - собственный счет в выписке с остатками. Счет в нескольких валютах - это
+// несколько Account с одним номером.
+type Account struct {
+	Number     string
+	Currency   string
+	DateFrom   time.Time // период, за который указаны остатки
+	DateTo     time.Time
+	Opening    int64 // остаток на начало периода, копейки (центы и т.п. для других валют)
+	Closing    int64 // остаток на конец периода
+	HasBalance bool  // остатки указаны в выписке
+}
+
+// Transaction - операция по счету. Суммы хранятся в копейках и всегда положительны,
+// знак определяется направлением.
+type Transaction struct {
+	Date                time.Time
+	Amount              int64
+	Currency            string
+	Direction           string
+	Internal            bool   // перевод между собственными счетами
+	Account             string // собственный счет
+	Counterparty        string
+	CounterpartyINN     string
+	CounterpartyAccount string
+	Purpose             string
+	DocNumber           string
+	DocType             string // вид документа, например "Платежное поручение"
+	MCC                 string // код категории продавца для операций по карте
+	Category            string // категория, если уже определена (см. Categorizer)
+}
+
+// IsStatementType - в файлах с таким расширением могут быть выписки
+func IsStatementType(fileType string) bool {
+	switch fileType {
+	case "txt", "xml", "sta", "mt940":
+		return true
+	}
+	return false
+}
+
+// Parse определяет формат выписки и разбирает ее. Если формат не распознан, возвращает ErrUnknownFormat.
+func Parse(data []byte) (*Statement, error) {
+	text := decodeText(data)
+	var st *Statement
+	var err error
+	switch {
+	case is1C(text):
+		st, err = parse1C(text)
+	case isCamt053(text):
+		st, err = parseCamt053(text)
+	case isMT940(text):
+		st, err = parseMT940(text)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	st.finish()
+	return st, nil
+}
+
+// addAccount добавляет счет в выписку. Несколько выписок по одному счету и валюте в файле
+// (например, MT940 за каждый день) объединяются: остаток на начало берется из самой ранней,
+// на конец - из самой поздней, а разрыв между ними попадает в предупреждения.
+func (st *Statement) addAccount(account Account) {
+	for i := range st.Accounts {
+		existing := &st.Accounts[i]
+		if existing.Number != account.Number || existing.Currency != account.Currency {
+			continue
+		}
+		earlier, later := *existing, account
+		if account.DateFrom.Before(existing.DateFrom) {
+			earlier, later = account, *existing
+		}
+		if earlier.HasBalance && later.HasBalance && earlier.Closing != later.Opening {
+			st.Warnings = append(st.Warnings, fmt.Sprintf(
+				"Счет %s: остаток на начало %s (%s) не совпадает с остатком на конец предыдущей выписки (%s)",
+				account.Number, formatDay(later.DateFrom), FormatAmount(later.Opening, later.Currency),
+				FormatAmount(earlier.Closing, earlier.Currency)))
+		}
+		merged := earlier
+		merged.Closing = later.Closing
+		merged.HasBalance = earlier.HasBalance && later.HasBalance
+		if later.DateTo.After(merged.DateTo) {
+			merged.DateTo = later.DateTo
+		}
+		if merged.DateFrom.IsZero() {
+			merged.DateFrom = later.DateFrom
+		}
+		*existing = merged
+		return
+	}
+	st.Accounts = append(st.Accounts, account)
+}
+
+// finish упорядочивает операции, отмечает переводы между собственными счетами,
+// заполняет периоды выписки и счетов и сверяет остатки
+func (st *Statement) finish() {
+	own := make(map[string]bool)
+	for _, account := range st.Accounts {
+		own[account.Number] = true
+	}
+	for i := range st.Transactions {
+		t := &st.Transactions[i]
+		if t.CounterpartyAccount != "" && own[t.CounterpartyAccount] {
+			t.Internal = true
+		}
+		if t.MCC == "" {
+			t.MCC = MCCFromText(t.Purpose)
+		}
+	}
+	sort.SliceStable(st.Transactions, func(i, j int) bool {
+		return st.Transactions[i].Date.Before(st.Transactions[j].Date)
+	})
+
+	for _, account := range st.Accounts {
+		if !account.DateFrom.IsZero() && (st.DateFrom.IsZero() || account.DateFrom.Before(st.DateFrom)) {
+			st.DateFrom = account.DateFrom
+		}
+		if account.DateTo.After(st.DateTo) {
+			st.DateTo = account.DateTo
+		}
+	}
+	if st.DateFrom.IsZero() && len(st.Transactions) > 0 {
+		st.DateFrom = st.Transactions[0].Date
+	}
+	if st.DateTo.IsZero() && len(st.Transactions) > 0 {
+		st.DateTo = st.Transactions[len(st.Transactions)-1].Date
+	}
+	for i := range st.Accounts {
+		if st.Accounts[i].DateFrom.IsZero() {
+			st.Accounts[i].DateFrom = st.DateFrom
+		}
+		if st.Accounts[i].DateTo.IsZero() {
+			st.Accounts[i].DateTo = st.DateTo
+		}
+	}
+
+	st.checkBalances()
+}
+
+// checkBalances сверяет остатки: остаток на начало плюс поступления минус списания по счету
+// за период должен давать остаток на конец. Расхождение означает, что выписка неполная или разобрана неверно.
+func (st *Statement) checkBalances() {
+	for _, account := range st.Accounts {
+		if !account.HasBalance {
+			continue
+		}
+		balance := account.Opening
+		for _, t := range st.Transactions {
+			if t.Currency != account.Currency || t.Date.Before(account.DateFrom) || t.Date.After(account.DateTo) {
+				continue
+			}
+			switch {
+			case t.Account == account.Number:
+				balance += t.signed()
+			case t.Internal && t.CounterpartyAccount == account.Number && !st.hasMirror(t):
+				// Перевод с другого собственного счета, записанный в выписке один раз (так бывает в 1С)
+				balance -= t.signed()
+			}
+		}
+		if balance != account.Closing {
+			st.Warnings = append(st.Warnings, fmt.Sprintf(
+				"Счет %s: остатки не сходятся - на начало %s, по операциям на конец %s, в выписке %s",
+				account.Number, FormatAmount(account.Opening, account.Currency),
+				FormatAmount(balance, account.Currency), FormatAmount(account.Closing, account.Currency)))
+		}
+	}
+}
+
+// hasMirror - есть ли в выписке встречная запись перевода между собственными счетами
+func (st *Statement) hasMirror(t Transaction) bool {
+	for _, other := range st.Transactions {
+		if other.Account == t.CounterpartyAccount && other.CounterpartyAccount == t.Account &&
+			other.Amount == t.Amount && other.Direction != t.Direction && other.Date.Equal(t.Date) {
+			return true
+		}
+	}
+	return false
+}
+
+// signed - сумма операции со знаком: поступление положительное, списание отрицательное
+func (t Transaction) signed() int64 {
+	if t.Direction == DirectionOut {
+		return -t.Amount
+	}
+	return t.Amount
+}
+
+// cp866Marker - строка "Кодировка=DOS" в кодировке CP866: так 1С помечает выгрузки в DOS-кодировке
+var cp866Marker, _ = charmap.CodePage866.NewEncoder().Bytes([]byte("Кодировка=DOS"))
+
+// decodeText переводит текст выписки в UTF-8. Банки выгружают файлы в windows-1251,
+// реже в CP866 (в 1С - "Кодировка=DOS") или UTF-8.
+func decodeText(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	decoder := charmap.Windows1251.NewDecoder()
+	if bytes.Contains(data, cp866Marker) {
+		decoder = charmap.CodePage866.NewDecoder()
+	}
+	text, err := decoder.Bytes(data)
+	if err != nil {
+		return strings.ToValidUTF8(string(data), "?")
+	}
+	return string(text)
+}
+
+// parseAmount разбирает сумму вида "15000.00", "15 000,50" или "-100" в копейки (сотые доли валюты).
+// Третий знак после запятой допускается только нулевым, иначе возвращается ErrThousandths.
+func parseAmount(s string) (int64, error) {
+	s = strings.NewReplacer(" ", "", "\u00a0", "", "'", "").Replace(strings.TrimSpace(s))
+	s = strings.ReplaceAll(s, ",", ".")
+	if s == "" {
+		return 0, fmt.Errorf("empty amount")
+	}
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if len(frac) == 3 && frac[2] >= '0' && frac[2] <= '9' {
+		if frac[2] != '0' {
+			return 0, fmt.Errorf("%w: %q", ErrThousandths, s)
+		}
+		frac = frac[:2]
+	}
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+	if whole == "" {
+		whole = "0"
+	}
+	rubles, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	kopecks, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	amount := rubles*100 + kopecks
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// FormatAmount выводит сумму в копейках в виде "15 000,50 ₽". Число знаков после запятой зависит
+// от валюты: "1 500 JPY", "12,350 KWD"; дробная часть у валют без нее выводится, только если она есть.
+func FormatAmount(amount int64, currency string) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	digits := strconv.FormatInt(amount/100, 10)
+	var grouped strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped.WriteRune(' ')
+		}
+		grouped.WriteRune(d)
+	}
+	symbol := currency
+	if currency == "" || currency == "RUB" || currency == "RUR" {
+		symbol = "₽"
+	}
+	switch {
+	case MinorUnits(currency) == 0 && amount%100 == 0:
+		return fmt.Sprintf("%s%s %s", sign, grouped.String(), symbol)
+	case MinorUnits(currency) == 3:
+		return fmt.Sprintf("%s%s,%02d0 %s", sign, grouped.String(), amount%100, symbol)
+	}
+	return fmt.Sprintf("%s%s,%02d %s", sign, grouped.String(), amount%100, symbol)
+}
+
+// parseDate разбирает дату вида 02.01.2006
+func parseDate(s string) (time.Time, error) {
+	return time.Parse("02.01.2006", strings.TrimSpace(s))
+}
+
+func formatDay(date time.Time) string {
+	if date.IsZero() {
+		return "?"
+	}
+	return date.Format("02.01.2006")
+}
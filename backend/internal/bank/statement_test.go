@@ -0,0 +1,88 @@
+package bank
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+		err   error
+	}{
+		{"15000.00", 1500000, nil},
+		{"15 000,50", 1500050, nil},
+		{"-100", -10000, nil},
+		{"0,5", 50, nil},
+		{"1500", 150000, nil}, // JPY без дробной части
+		{"12,350", 1235, nil}, // KWD с нулевыми тысячными
+		{"12,345", 0, ErrThousandths},
+	}
+	for _, tt := range tests {
+		got, err := parseAmount(tt.value)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("parseAmount(%q) error = %v, want %v", tt.value, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseAmount(%q) = %d, %v, want %d", tt.value, got, err, tt.want)
+		}
+	}
+	for _, value := range []string{"", "abc", "1.2345", "1,2x"} {
+		if _, err := parseAmount(value); err == nil {
+			t.Errorf("parseAmount(%q) accepted invalid amount", value)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		currency string
+		want     string
+	}{
+		{1500050, "RUB", "15\u00a0000,50 ₽"},
+		{-10000, "", "-100,00 ₽"},
+		{123456789, "EUR", "1\u00a0234\u00a0567,89 EUR"},
+		{150000, "JPY", "1\u00a0500 JPY"},
+		{1235, "KWD", "12,350 KWD"},
+	}
+	for _, tt := range tests {
+		if got := FormatAmount(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("FormatAmount(%d, %q) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+// Операция в тысячных долях пропускается с предупреждением, остальная выписка разбирается
+func TestMT940ThousandthsSkipped(t *testing.T) {
+	data := strings.Join([]string{
+		":20:STMT1",
+		":25:KW81CBKU0000000000001234560101",
+		":28C:1/1",
+		":60F:C260301KWD100,000",
+		":61:2603020302C12,345NTRFNONREF",
+		":86:Payment with fils",
+		":61:2603030303D10,500NTRFNONREF",
+		":86:Rent",
+		":62F:C260303KWD89,500",
+		"",
+	}, "\n")
+	st, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(st.Transactions) != 1 {
+		t.Fatalf("transactions = %d, want 1", len(st.Transactions))
+	}
+	if tr := st.Transactions[0]; tr.Amount != 1050 || tr.Currency != "KWD" || tr.Direction != DirectionOut {
+		t.Errorf("transaction = %+v", tr)
+	}
+	if !hasWarning(st, "тысячных долях") {
+		t.Errorf("warnings %q do not mention thousandths", st.Warnings)
+	}
+}
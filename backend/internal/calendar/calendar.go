@@ -0,0 +1,465 @@
+// Package calendar строит календарь налоговых и отчетных сроков малого бизнеса по профилю: системе
+// налогообложения, форме бизнеса, наличию сотрудников и региону. Сроки считаются по правилам НК РФ
+// для единого налогового платежа: уведомления об исчисленных суммах - до 25-го числа, платежи - до 28-го.
+// Сроки, выпадающие на выходной или праздник, переносятся на следующий рабочий день (см. tax.IsWorkday).
+package calendar
+
+import (
+	"alfa-hack-backend/internal/tax"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Виды обязательств
+const (
+	KindPayment = "payment" // уплата налога или взносов
+	KindNotice  = "notice"  // уведомление об исчисленных суммах
+	KindReport  = "report"  // декларация или отчет
+)
+
+// KindNames - названия видов обязательств для пользователя
+var KindNames = map[string]string{
+	KindPayment: "Платеж",
+	KindNotice:  "Уведомление",
+	KindReport:  "Отчет",
+}
+
+// RegionMoscow - код Москвы: единственный регион, где введен торговый сбор
+const RegionMoscow = "77"
+
+// Profile - данные бизнеса, от которых зависят сроки
+type Profile struct {
+	Tax tax.Profile
+	// Employees - число сотрудников; при наличии сотрудников добавляются НДФЛ, взносы и отчеты работодателя
+	Employees int
+	// Region - двузначный код региона (77 - Москва)
+	Region string
+}
+
+// Obligation - срок уплаты налога, подачи уведомления или отчета
+type Obligation struct {
+	ID    string // стабильный идентификатор: вид обязательства и срок
+	Code  string // вид обязательства, например usn_advance или rsv
+	Kind  string // KindPayment, KindNotice или KindReport
+	Title string
+	// Period - за какой период, например "I квартал 2026 г."
+	Period      string
+	Description string
+	Due         time.Time
+	// Year - налоговый год, к которому относится обязательство (срок может быть в следующем году)
+	Year int
+	// Month - месяц начисления для ежемесячных платежей; 0 - платеж не за месяц
+	Month int
+	// TaxCode - вид платежа из расчета налогов (tax.Payment*), по которому подставляется сумма
+	TaxCode string
+	// Amount - рассчитанная сумма платежа, копейки; 0 - сумма не рассчитана
+	Amount int64
+	// Conditional - обязательство есть не у всех с таким профилем (условие в описании)
+	Conditional bool
+}
+
+// Названия отчетных периодов по числу месяцев с начала года
+var periodNames = map[int]string{3: "I квартал", 6: "полугодие", 9: "9 месяцев", 12: "год"}
+
+// Названия кварталов
+var quarterNames = []string{"I квартал", "II квартал", "III квартал", "IV квартал"}
+
+// Названия месяцев в именительном падеже
+var monthNames = []string{"январь", "февраль", "март", "апрель", "май", "июнь", "июль", "август", "сентябрь", "октябрь", "ноябрь", "декабрь"}
+
+// Generate - обязательства со сроками с from по to включительно, отсортированные по сроку.
+// Правила применяются к каждому налоговому году, сроки которого могут попасть в период.
+func Generate(p Profile, from, to time.Time) []Obligation {
+	from, to = day(from), day(to)
+	var list []Obligation
+	// Сроки за год наступают до июля следующего года (1% взносов ИП, НДФЛ ИП за год)
+	for year := from.Year() - 1; year <= to.Year(); year++ {
+		for _, o := range forYear(p, year) {
+			if !o.Due.Before(from) && !o.Due.After(to) {
+				list = append(list, o)
+			}
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if !list[i].Due.Equal(list[j].Due) {
+			return list[i].Due.Before(list[j].Due)
+		}
+		return kindOrder(list[i].Kind) < kindOrder(list[j].Kind)
+	})
+	return list
+}
+
+// kindOrder - в один день сначала отчеты и уведомления, потом платежи
+func kindOrder(kind string) int {
+	switch kind {
+	case KindReport:
+		return 0
+	case KindNotice:
+		return 1
+	}
+	return 2
+}
+
+// day - дата без времени в UTC
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// rules - обязательства одного налогового года
+type rules struct {
+	profile Profile
+	year    int
+	list    []Obligation
+}
+
+func (r *rules) add(o Obligation) {
+	o.Year = r.year
+	o.ID = fmt.Sprintf("%s-%d-%s", o.Code, r.year, o.Due.Format("20060102"))
+	r.list = append(r.list, o)
+}
+
+// forYear - все обязательства налогового года по профилю
+func forYear(p Profile, year int) []Obligation {
+	r := &rules{profile: p, year: year}
+	switch p.Tax.Regime {
+	case tax.RegimeUSNIncome, tax.RegimeUSNProfit:
+		r.usn()
+	case tax.RegimePSN:
+		r.patent()
+	case tax.RegimeNPD:
+		r.npd()
+	case tax.RegimeOSNO:
+		if p.Tax.Form == tax.FormOrg {
+			r.profitTax()
+		} else {
+			r.ndflIP()
+		}
+		r.vat()
+	}
+	if p.Tax.Regime != "" && p.Tax.Regime != tax.RegimeNPD {
+		if p.Tax.Form == tax.FormOrg {
+			r.accounting()
+		} else {
+			r.ipContributions()
+		}
+	}
+	// Самозанятые не могут нанимать сотрудников
+	if p.Employees > 0 && p.Tax.Regime != tax.RegimeNPD {
+		r.employer()
+	}
+	if p.Region == RegionMoscow && p.Tax.Regime != tax.RegimePSN && p.Tax.Regime != tax.RegimeNPD {
+		r.tradeFee()
+	}
+	return r.list
+}
+
+// period - название отчетного периода с годом
+func (r *rules) period(months int) string {
+	if months == 12 {
+		return fmt.Sprintf("%d г.", r.year)
+	}
+	return fmt.Sprintf("%s %d г.", periodNames[months], r.year)
+}
+
+// month - название месяца с годом
+func (r *rules) month(m int) string {
+	return fmt.Sprintf("%s %d г.", monthNames[m-1], r.year)
+}
+
+// quarterly - сроки по итогам I квартала, полугодия и 9 месяцев: день месяца, следующего за периодом
+func (r *rules) quarterly(day int, build func(months int, due time.Time)) {
+	for _, months := range []int{3, 6, 9} {
+		build(months, tax.Deadline(r.year, time.Month(months+1), day))
+	}
+}
+
+func (r *rules) usn() {
+	r.quarterly(25, func(months int, due time.Time) {
+		r.add(Obligation{
+			Code: "usn_notice", Kind: KindNotice, Title: "Уведомление об авансовом платеже по УСН",
+			Period: r.period(months), Due: due,
+			Description: "Уведомление об исчисленной сумме аванса подается в ФНС, чтобы деньги с единого налогового счета зачлись в счет УСН",
+		})
+	})
+	r.quarterly(28, func(months int, due time.Time) {
+		r.add(Obligation{
+			Code: "usn_advance", Kind: KindPayment, Title: "Авансовый платеж по УСН", Period: r.period(months),
+			Due: due, TaxCode: tax.PaymentUSN, Description: "Единый налоговый платеж в счет аванса по УСН",
+		})
+	})
+	// Декларация и налог за год: организации - до конца марта, ИП - до конца апреля
+	month := time.April
+	if r.profile.Tax.Form == tax.FormOrg {
+		month = time.March
+	}
+	r.add(Obligation{
+		Code: "usn_declaration", Kind: KindReport, Title: "Декларация по УСН", Period: r.period(12),
+		Due:         tax.Deadline(r.year+1, month, 25),
+		Description: "Годовая декларация по УСН; уведомление за год не нужно",
+	})
+	r.add(Obligation{
+		Code: "usn_tax", Kind: KindPayment, Title: "Налог по УСН за год", Period: r.period(12),
+		Due: tax.Deadline(r.year+1, month, 28), TaxCode: tax.PaymentUSN,
+		Description: "Налог за год за вычетом авансовых платежей; на УСН \"доходы минус расходы\" - не меньше минимального налога 1% от доходов",
+	})
+}
+
+// patent - оплата патента, выданного с 1 января на срок из профиля (как в расчете налогов),
+// и заявление на патент на следующий год
+func (r *rules) patent() {
+	months := r.profile.Tax.PatentMonths
+	if months == 0 {
+		months = 12
+	}
+	start := time.Date(r.year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, months, -1)
+	period := fmt.Sprintf("патент на %d мес. %d г.", months, r.year)
+	if months <= 6 {
+		r.add(Obligation{
+			Code: "patent_payment", Kind: KindPayment, Title: "Оплата патента", Period: period,
+			Due: workdayOn(end), TaxCode: tax.PaymentPatent,
+			Description: "Патент сроком до 6 месяцев оплачивается целиком до окончания срока",
+		})
+	} else {
+		r.add(Obligation{
+			Code: "patent_first", Kind: KindPayment, Title: "Оплата патента: треть стоимости", Period: period,
+			Due: workdayOn(start.AddDate(0, 0, 89)), TaxCode: tax.PaymentPatent,
+			Description: "Треть стоимости патента платится в течение 90 календарных дней после начала его действия",
+		})
+		r.add(Obligation{
+			Code: "patent_rest", Kind: KindPayment, Title: "Оплата патента: остаток стоимости", Period: period,
+			Due: workdayOn(end), TaxCode: tax.PaymentPatent,
+			Description: "Оставшиеся две трети стоимости патента платятся до окончания его срока",
+		})
+	}
+	r.add(Obligation{
+		Code: "patent_application", Kind: KindReport, Title: "Заявление на патент на следующий год",
+		Period: fmt.Sprintf("на %d г.", r.year+1), Due: workdaysBefore(time.Date(r.year+1, time.January, 1, 0, 0, 0, 0, time.UTC), 10),
+		Description: "Заявление подается не позднее чем за 10 рабочих дней до начала действия патента",
+		Conditional: true,
+	})
+}
+
+// npd - налог самозанятого за месяц платится до 28-го числа следующего месяца, деклараций нет
+func (r *rules) npd() {
+	for m := 1; m <= 12; m++ {
+		r.add(Obligation{
+			Code: "npd", Kind: KindPayment, Title: "Налог на профессиональный доход", Period: r.month(m), Month: m,
+			Due: tax.Deadline(r.year, time.Month(m+1), 28), TaxCode: tax.PaymentNPD,
+			Description: "Сумма налога приходит в приложение \"Мой налог\" до 12-го числа; налог меньше 100 ₽ переносится на следующий месяц",
+		})
+	}
+}
+
+// ndflIP - НДФЛ ИП на общей системе: авансы по кварталам и декларация 3-НДФЛ
+func (r *rules) ndflIP() {
+	r.quarterly(25, func(months int, due time.Time) {
+		r.add(Obligation{
+			Code: "ndfl_ip_notice", Kind: KindNotice, Title: "Уведомление об авансовом платеже по НДФЛ ИП",
+			Period: r.period(months), Due: due,
+			Description: "Уведомление об исчисленной сумме аванса по НДФЛ за себя",
+		})
+	})
+	r.quarterly(28, func(months int, due time.Time) {
+		r.add(Obligation{
+			Code: "ndfl_ip_advance", Kind: KindPayment, Title: "Авансовый платеж по НДФЛ ИП", Period: r.period(months),
+			Due: due, TaxCode: tax.PaymentNDFL, Description: "Единый налоговый платеж в счет аванса по НДФЛ за себя",
+		})
+	})
+	r.add(Obligation{
+		Code: "ndfl_ip_declaration", Kind: KindReport, Title: "Декларация 3-НДФЛ", Period: r.period(12),
+		Due: tax.Deadline(r.year+1, time.April, 30), Description: "Годовая декларация ИП на общей системе",
+	})
+	r.add(Obligation{
+		Code: "ndfl_ip_tax", Kind: KindPayment, Title: "НДФЛ ИП за год", Period: r.period(12),
+		Due: tax.Deadline(r.year+1, time.July, 15), TaxCode: tax.PaymentNDFL,
+		Description: "Налог за год за вычетом авансовых платежей",
+	})
+}
+
+// profitTax - налог на прибыль организации с квартальными авансами
+func (r *rules) profitTax() {
+	r.quarterly(25, func(months int, due time.Time) {
+		r.add(Obligation{
+			Code: "profit_declaration", Kind: KindReport, Title: "Декларация по налогу на прибыль", Period: r.period(months),
+			Due: due, Description: "Декларация за отчетный период заменяет уведомление об авансе",
+		})
+	})
+	r.quarterly(28, func(months int, due time.Time) {
+		r.add(Obligation{
+			Code: "profit_advance", Kind: KindPayment, Title: "Авансовый платеж по налогу на прибыль", Period: r.period(months),
+			Due: due, TaxCode: tax.PaymentProfit, Description: "Квартальный авансовый платеж по итогам отчетного периода",
+		})
+	})
+	r.add(Obligation{
+		Code: "profit_declaration", Kind: KindReport, Title: "Декларация по налогу на прибыль", Period: r.period(12),
+		Due: tax.Deadline(r.year+1, time.March, 25), Description: "Годовая декларация по налогу на прибыль",
+	})
+	r.add(Obligation{
+		Code: "profit_tax", Kind: KindPayment, Title: "Налог на прибыль за год", Period: r.period(12),
+		Due: tax.Deadline(r.year+1, time.March, 28), TaxCode: tax.PaymentProfit,
+		Description: "Налог за год за вычетом авансовых платежей",
+	})
+}
+
+// vat - декларация по НДС до 25-го числа после квартала, налог - тремя равными частями до 28-го числа
+// трех следующих месяцев
+func (r *rules) vat() {
+	for q := 0; q < 4; q++ {
+		year, month := r.year, time.Month(q*3+4)
+		if q == 3 {
+			year, month = r.year+1, time.January
+		}
+		period := fmt.Sprintf("%s %d г.", quarterNames[q], r.year)
+		r.add(Obligation{
+			Code: "vat_declaration", Kind: KindReport, Title: "Декларация по НДС", Period: period,
+			Due: tax.Deadline(year, month, 25), Description: "Декларация подается только в электронном виде через оператора ЭДО",
+		})
+		for i := 0; i < 3; i++ {
+			r.add(Obligation{
+				Code: "vat", Kind: KindPayment, Title: fmt.Sprintf("НДС: %d/3 за квартал", i+1), Period: period,
+				Due: tax.Deadline(year, month+time.Month(i), 28), TaxCode: tax.PaymentVAT,
+				Description: "НДС за квартал платится тремя равными частями",
+			})
+		}
+	}
+}
+
+// ipContributions - страховые взносы ИП за себя
+func (r *rules) ipContributions() {
+	r.add(Obligation{
+		Code: "ip_fixed", Kind: KindPayment, Title: "Фиксированные взносы ИП за себя", Period: r.period(12),
+		Due: tax.Deadline(r.year, time.December, 28), TaxCode: tax.PaymentIPFixed,
+		Description: "Взносы на пенсионное и медицинское страхование; их можно платить частями в течение года",
+	})
+	r.add(Obligation{
+		Code: "ip_additional", Kind: KindPayment, Title: "Взнос ИП 1% с дохода сверх 300 000 ₽", Period: r.period(12),
+		Due: tax.Deadline(r.year+1, time.July, 1), TaxCode: tax.PaymentIPAdditional,
+		Description: "Платится, только если доход за год больше 300 000 ₽", Conditional: true,
+	})
+}
+
+// accounting - годовая бухгалтерская отчетность организации
+func (r *rules) accounting() {
+	r.add(Obligation{
+		Code: "accounting", Kind: KindReport, Title: "Бухгалтерская отчетность", Period: r.period(12),
+		Due:         tax.Deadline(r.year+1, time.March, 31),
+		Description: "Бухгалтерский баланс и отчет о финансовых результатах за год в ФНС",
+	})
+}
+
+// employer - НДФЛ с зарплаты, страховые взносы и отчеты работодателя
+func (r *rules) employer() {
+	for m := 1; m <= 12; m++ {
+		// НДФЛ, удержанный с 23-го числа прошлого месяца по 22-е текущего
+		period := fmt.Sprintf("удержан с 23 %s по 22 %s %d г.", monthGenitive[(m+10)%12], monthGenitive[m-1], r.year)
+		if m == 1 {
+			period = fmt.Sprintf("удержан с 1 по 22 января %d г.", r.year)
+		}
+		r.add(Obligation{
+			Code: "ndfl_agent_notice", Kind: KindNotice, Title: "Уведомление по НДФЛ за сотрудников", Period: period,
+			Due:         tax.Deadline(r.year, time.Month(m), 25),
+			Description: "Уведомление о сумме НДФЛ, удержанного с зарплаты и других выплат сотрудникам",
+		})
+		r.add(Obligation{
+			Code: "ndfl_agent", Kind: KindPayment, Title: "НДФЛ за сотрудников", Period: period,
+			Due: tax.Deadline(r.year, time.Month(m), 28), Description: "НДФЛ, удержанный с выплат сотрудникам",
+		})
+
+		// Взносы за месяц платятся в следующем месяце; за последний месяц квартала уведомление и
+		// персонифицированные сведения заменяет расчет по страховым взносам
+		due := time.Month(m + 1)
+		if m%3 != 0 {
+			r.add(Obligation{
+				Code: "contributions_notice", Kind: KindNotice, Title: "Уведомление по страховым взносам", Period: r.month(m),
+				Due: tax.Deadline(r.year, due, 25), Description: "Уведомление о сумме взносов за сотрудников за месяц",
+			})
+			r.add(Obligation{
+				Code: "personal_data", Kind: KindReport, Title: "Персонифицированные сведения о физлицах", Period: r.month(m),
+				Due: tax.Deadline(r.year, due, 25), Description: "Сведения о выплатах сотрудникам за месяц в ФНС",
+			})
+		}
+		r.add(Obligation{
+			Code: "contributions", Kind: KindPayment, Title: "Страховые взносы за сотрудников", Period: r.month(m), Month: m,
+			Due: tax.Deadline(r.year, due, 28), Description: "Единый тариф страховых взносов с выплат сотрудникам",
+		})
+		r.add(Obligation{
+			Code: "injury", Kind: KindPayment, Title: "Взносы на травматизм", Period: r.month(m), Month: m,
+			Due: tax.Deadline(r.year, due, 15), Description: "Взносы от несчастных случаев на производстве платятся в СФР, а не в ФНС",
+		})
+	}
+	// Остаток НДФЛ за 23-31 декабря платится не позднее последнего рабочего дня года
+	lastDay := workdaysBefore(time.Date(r.year+1, time.January, 1, 0, 0, 0, 0, time.UTC), 1)
+	period := fmt.Sprintf("удержан с 23 по 31 декабря %d г.", r.year)
+	r.add(Obligation{
+		Code: "ndfl_agent_year_end_notice", Kind: KindNotice, Title: "Уведомление по НДФЛ за сотрудников", Period: period,
+		Due: lastDay, Description: "Уведомление о НДФЛ, удержанном в конце года, подается в последний рабочий день года",
+	})
+	r.add(Obligation{
+		Code: "ndfl_agent_year_end", Kind: KindPayment, Title: "НДФЛ за сотрудников", Period: period,
+		Due: lastDay, Description: "НДФЛ, удержанный в конце года, платится в последний рабочий день года",
+	})
+
+	for q := 0; q < 4; q++ {
+		year, month := r.year, time.Month(q*3+4)
+		if q == 3 {
+			year, month = r.year+1, time.January
+		}
+		months := (q + 1) * 3
+		r.add(Obligation{
+			Code: "rsv", Kind: KindReport, Title: "Расчет по страховым взносам (РСВ)", Period: r.period(months),
+			Due: tax.Deadline(year, month, 25), Description: "Расчет в ФНС; заменяет уведомление по взносам за последний месяц квартала",
+		})
+		r.add(Obligation{
+			Code: "efs1", Kind: KindReport, Title: "ЕФС-1: сведения о взносах на травматизм", Period: r.period(months),
+			Due:         tax.Deadline(year, month, 25),
+			Description: "Отчет в СФР; сведения о приеме и увольнении сотрудников подаются отдельно на следующий рабочий день",
+		})
+	}
+	r.quarterly(25, func(months int, due time.Time) {
+		r.add(Obligation{
+			Code: "6ndfl", Kind: KindReport, Title: "Расчет 6-НДФЛ", Period: r.period(months), Due: due,
+			Description: "Расчет сумм НДФЛ, исчисленных и удержанных с выплат сотрудникам",
+		})
+	})
+	r.add(Obligation{
+		Code: "6ndfl", Kind: KindReport, Title: "Расчет 6-НДФЛ", Period: r.period(12),
+		Due: tax.Deadline(r.year+1, time.February, 25), Description: "Годовой расчет со справками о доходах сотрудников",
+	})
+}
+
+// tradeFee - торговый сбор в Москве платится до 28-го числа месяца после квартала
+func (r *rules) tradeFee() {
+	for q := 0; q < 4; q++ {
+		year, month := r.year, time.Month(q*3+4)
+		if q == 3 {
+			year, month = r.year+1, time.January
+		}
+		r.add(Obligation{
+			Code: "trade_fee", Kind: KindPayment, Title: "Торговый сбор", Period: fmt.Sprintf("%s %d г.", quarterNames[q], r.year),
+			Due:         tax.Deadline(year, month, 28),
+			Description: "Платится, только если в Москве есть торговый объект (магазин, павильон, киоск); сбор уменьшает налог по УСН \"доходы\"",
+			Conditional: true,
+		})
+	}
+}
+
+// Названия месяцев в родительном падеже
+var monthGenitive = []string{"января", "февраля", "марта", "апреля", "мая", "июня", "июля", "августа", "сентября", "октября", "ноября", "декабря"}
+
+// workdayOn - срок, который заканчивается в нерабочий день, переносится на следующий рабочий день
+func workdayOn(date time.Time) time.Time {
+	return tax.Deadline(date.Year(), date.Month(), date.Day())
+}
+
+// workdaysBefore - рабочий день, который на n рабочих дней раньше даты (выходные и праздники не считаются)
+func workdaysBefore(date time.Time, n int) time.Time {
+	for n > 0 {
+		date = date.AddDate(0, 0, -1)
+		if tax.IsWorkday(date) {
+			n--
+		}
+	}
+	return date
+}
@@ -0,0 +1,174 @@
+package calendar
+
+import (
+	"alfa-hack-backend/internal/tax"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestGenerateUSN(t *testing.T) {
+	p := Profile{Tax: tax.Profile{Regime: tax.RegimeUSNIncome, Form: tax.FormIP}}
+	got := Generate(p, date("2026-04-01"), date("2026-07-31"))
+
+	want := []struct {
+		id          string
+		kind        string
+		period      string
+		conditional bool
+	}{
+		// 25 апреля 2026 - суббота: сроки переносятся на понедельник; в один день отчет раньше уведомления
+		{"usn_declaration-2025-20260427", KindReport, "2025 г.", false},
+		{"usn_notice-2026-20260427", KindNotice, "I квартал 2026 г.", false},
+		{"usn_tax-2025-20260428", KindPayment, "2025 г.", false},
+		{"usn_advance-2026-20260428", KindPayment, "I квартал 2026 г.", false},
+		{"ip_additional-2025-20260701", KindPayment, "2025 г.", true},
+		{"usn_notice-2026-20260727", KindNotice, "полугодие 2026 г.", false},
+		{"usn_advance-2026-20260728", KindPayment, "полугодие 2026 г.", false},
+	}
+	if len(got) != len(want) {
+		for _, o := range got {
+			t.Logf("%s %s", o.ID, o.Period)
+		}
+		t.Fatalf("obligations = %d, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		o := got[i]
+		if o.ID != w.id || o.Kind != w.kind || o.Period != w.period || o.Conditional != w.conditional {
+			t.Errorf("obligation %d = %s %s %q conditional=%v, want %s %s %q conditional=%v",
+				i, o.ID, o.Kind, o.Period, o.Conditional, w.id, w.kind, w.period, w.conditional)
+		}
+	}
+}
+
+func TestGenerateProfiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		profile     Profile
+		present     []string
+		absent      []string
+		conditional []string
+	}{
+		{
+			name:        "УСН ИП в Москве",
+			profile:     Profile{Tax: tax.Profile{Regime: tax.RegimeUSNIncome, Form: tax.FormIP}, Region: RegionMoscow},
+			present:     []string{"usn_advance", "usn_tax", "ip_fixed", "ip_additional", "trade_fee"},
+			absent:      []string{"accounting", "ndfl_agent", "rsv"},
+			conditional: []string{"ip_additional", "trade_fee"},
+		},
+		{
+			name:    "УСН ООО с сотрудниками",
+			profile: Profile{Tax: tax.Profile{Regime: tax.RegimeUSNProfit, Form: tax.FormOrg}, Employees: 3},
+			present: []string{"usn_advance", "accounting", "ndfl_agent", "contributions", "injury", "rsv", "efs1", "6ndfl", "personal_data"},
+			absent:  []string{"ip_fixed", "ip_additional", "trade_fee"},
+		},
+		{
+			name:        "патент на год в Москве - без торгового сбора",
+			profile:     Profile{Tax: tax.Profile{Regime: tax.RegimePSN, Form: tax.FormIP}, Region: RegionMoscow},
+			present:     []string{"patent_first", "patent_rest", "patent_application", "ip_fixed"},
+			absent:      []string{"patent_payment", "trade_fee", "usn_advance"},
+			conditional: []string{"patent_application"},
+		},
+		{
+			name:    "патент на 4 месяца",
+			profile: Profile{Tax: tax.Profile{Regime: tax.RegimePSN, Form: tax.FormIP, PatentMonths: 4}},
+			present: []string{"patent_payment"},
+			absent:  []string{"patent_first", "patent_rest"},
+		},
+		{
+			name:    "самозанятый не бывает работодателем",
+			profile: Profile{Tax: tax.Profile{Regime: tax.RegimeNPD, Form: tax.FormIP}, Employees: 2, Region: RegionMoscow},
+			present: []string{"npd"},
+			absent:  []string{"ndfl_agent", "ip_fixed", "trade_fee"},
+		},
+		{
+			name:    "ОСНО ООО",
+			profile: Profile{Tax: tax.Profile{Regime: tax.RegimeOSNO, Form: tax.FormOrg}},
+			present: []string{"profit_advance", "profit_tax", "profit_declaration", "vat", "vat_declaration", "accounting"},
+			absent:  []string{"ndfl_ip_tax", "ip_fixed"},
+		},
+		{
+			name:    "ОСНО ИП",
+			profile: Profile{Tax: tax.Profile{Regime: tax.RegimeOSNO, Form: tax.FormIP}},
+			present: []string{"ndfl_ip_advance", "ndfl_ip_tax", "vat", "ip_fixed"},
+			absent:  []string{"profit_tax", "accounting"},
+		},
+		{name: "без системы налогообложения", profile: Profile{}, absent: []string{"ip_fixed", "accounting"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codes := make(map[string]Obligation)
+			for _, o := range Generate(tt.profile, date("2026-01-01"), date("2026-12-31")) {
+				codes[o.Code] = o
+			}
+			for _, code := range tt.present {
+				if _, ok := codes[code]; !ok {
+					t.Errorf("%s is missing", code)
+				}
+			}
+			for _, code := range tt.absent {
+				if _, ok := codes[code]; ok {
+					t.Errorf("unexpected %s", code)
+				}
+			}
+			for _, code := range tt.conditional {
+				if !codes[code].Conditional {
+					t.Errorf("%s is not conditional", code)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateNPDMonths(t *testing.T) {
+	list := Generate(Profile{Tax: tax.Profile{Regime: tax.RegimeNPD, Form: tax.FormIP}}, date("2026-01-01"), date("2026-12-31"))
+	if len(list) != 12 {
+		t.Fatalf("npd obligations = %d, want 12", len(list))
+	}
+	// Налог за декабрь 2025 г. платится в январе 2026 г.
+	if first := list[0]; first.Year != 2025 || first.Month != 12 || first.Due.Format("2006-01-02") != "2026-01-28" {
+		t.Errorf("first = %+v", first)
+	}
+}
+
+// Сроки в выходные и праздники, в том числе перенесенные с выходных, сдвигаются на рабочий день
+func TestWorkdayShifts(t *testing.T) {
+	onTests := []struct{ date, want string }{
+		{"2026-04-28", "2026-04-28"}, // вторник
+		{"2026-04-25", "2026-04-27"}, // суббота
+		{"2026-02-23", "2026-02-24"}, // праздник в понедельник
+		{"2026-03-08", "2026-03-10"}, // праздник в воскресенье - выходной и в понедельник 9 марта
+		{"2026-05-09", "2026-05-12"}, // праздник в субботу - выходной в понедельник 11 мая
+		{"2026-06-12", "2026-06-15"}, // праздник в пятницу
+		{"2027-01-03", "2027-01-11"}, // новогодние каникулы, выходные с них не переносятся
+	}
+	for _, tt := range onTests {
+		if got := workdayOn(date(tt.date)).Format("2006-01-02"); got != tt.want {
+			t.Errorf("workdayOn(%s) = %s, want %s", tt.date, got, tt.want)
+		}
+	}
+
+	beforeTests := []struct {
+		date string
+		n    int
+		want string
+	}{
+		{"2027-01-01", 1, "2026-12-31"},
+		{"2027-01-01", 10, "2026-12-18"},
+		{"2026-05-13", 2, "2026-05-08"}, // 9-11 мая - выходные
+		{"2026-01-12", 1, "2026-01-09"}, // 9 января - рабочая пятница
+		{"2026-01-09", 1, "2025-12-31"}, // 1-8 января - праздники
+	}
+	for _, tt := range beforeTests {
+		if got := workdaysBefore(date(tt.date), tt.n).Format("2006-01-02"); got != tt.want {
+			t.Errorf("workdaysBefore(%s, %d) = %s, want %s", tt.date, tt.n, got, tt.want)
+		}
+	}
+}
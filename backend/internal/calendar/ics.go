@@ -0,0 +1,104 @@
+package calendar
+
+import (
+	"alfa-hack-backend/internal/bank"
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ICSOptions - параметры выгрузки в iCalendar
+type ICSOptions struct {
+	Name string // название календаря
+	// UIDSuffix делает UID событий уникальными между пользователями, например "<user_id>@alfa-hack"
+	UIDSuffix string
+	// Alarms - за сколько дней до срока напомнить; пусто - без напоминаний
+	Alarms []int
+	Now    time.Time
+}
+
+// ICS - обязательства в формате iCalendar (RFC 5545): событие на весь день срока с напоминаниями
+func ICS(obligations []Obligation, opts ICSOptions) []byte {
+	var buf bytes.Buffer
+	line := func(s string) {
+		buf.WriteString(fold(s))
+		buf.WriteString("\r\n")
+	}
+	stamp := opts.Now.UTC().Format("20060102T150405Z")
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//alfa-hack//Tax calendar//RU")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	if opts.Name != "" {
+		line("X-WR-CALNAME:" + escape(opts.Name))
+	}
+	for _, o := range obligations {
+		summary := o.Title
+		if o.Amount > 0 {
+			summary += ": " + bank.FormatAmount(o.Amount, "RUB")
+		}
+		line("BEGIN:VEVENT")
+		line("UID:" + o.ID + "-" + opts.UIDSuffix)
+		line("DTSTAMP:" + stamp)
+		line("DTSTART;VALUE=DATE:" + o.Due.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + o.Due.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY:" + escape(summary))
+		line("DESCRIPTION:" + escape(Text(o)))
+		line("CATEGORIES:" + escape(KindNames[o.Kind]))
+		line("TRANSP:TRANSPARENT")
+		for _, days := range opts.Alarms {
+			line("BEGIN:VALARM")
+			line("ACTION:DISPLAY")
+			line("DESCRIPTION:" + escape(summary))
+			line(fmt.Sprintf("TRIGGER:-P%dD", days))
+			line("END:VALARM")
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return buf.Bytes()
+}
+
+// Text - описание обязательства одним текстом: период, сумма, описание и условие
+func Text(o Obligation) string {
+	parts := []string{o.Title + " (" + o.Period + ")"}
+	if o.Amount > 0 {
+		parts = append(parts, "Сумма по расчету: "+bank.FormatAmount(o.Amount, "RUB"))
+	}
+	if o.Description != "" {
+		parts = append(parts, o.Description)
+	}
+	if o.Conditional {
+		parts = append(parts, "Проверьте, относится ли это к вашему бизнесу")
+	}
+	return strings.Join(parts, ".\n") + "."
+}
+
+// escape экранирует текст значения свойства iCalendar
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// fold переносит строку длиннее 75 байт: продолжение начинается с пробела, символы UTF-8 не разрываются
+func fold(s string) string {
+	const limit = 75
+	if len(s) <= limit {
+		return s
+	}
+	var b strings.Builder
+	width := 0
+	for _, r := range s {
+		size := utf8.RuneLen(r)
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
@@ -0,0 +1,108 @@
+package calendar
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+var update = flag.Bool("update", false, "перезаписать эталонные файлы в testdata")
+
+func TestEscape(t *testing.T) {
+	tests := map[string]string{
+		"Уведомление по УСН":       "Уведомление по УСН",
+		"Сумма: 1 000,00 ₽; срок":  `Сумма: 1 000\,00 ₽\; срок`,
+		`C:\Отчеты`:                `C:\\Отчеты`,
+		"строка 1.\nстрока 2":      `строка 1.\nстрока 2`,
+		"строка 1.\r\nстрока 2":    `строка 1.\nстрока 2`,
+		`уже \n экранировано, нет`: `уже \\n экранировано\, нет`,
+	}
+	for s, want := range tests {
+		if got := escape(s); got != want {
+			t.Errorf("escape(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		lines int
+	}{
+		{"ровно 75 байт", strings.Repeat("a", 75), 1},
+		{"76 байт", strings.Repeat("a", 76), 2},
+		{"кириллица на границе", "SUMMARY:" + strings.Repeat("ж", 40), 2},       // 88 байт: 74 + 14
+		{"символы разной длины", "DESCRIPTION:" + strings.Repeat("a₽ж", 40), 4}, // 252 байта
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			folded := fold(tt.s)
+			lines := strings.Split(folded, "\r\n")
+			if len(lines) != tt.lines {
+				t.Errorf("%d lines, want %d: %q", len(lines), tt.lines, folded)
+			}
+			for i, line := range lines {
+				if len(line) > 75 {
+					t.Errorf("line %d is %d bytes", i, len(line))
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line %d splits a UTF-8 character: %q", i, line)
+				}
+				if i > 0 && !strings.HasPrefix(line, " ") {
+					t.Errorf("continuation line %d does not start with a space", i)
+				}
+			}
+			if unfolded := strings.ReplaceAll(folded, "\r\n ", ""); unfolded != tt.s {
+				t.Errorf("unfolded = %q, want %q", unfolded, tt.s)
+			}
+		})
+	}
+}
+
+// Выгрузка сверяется с эталоном testdata/calendar.ics; go test -update перезаписывает эталон
+func TestICSGolden(t *testing.T) {
+	obligations := []Obligation{
+		{
+			ID: "usn_advance-2026-20260428", Code: "usn_advance", Kind: KindPayment,
+			Title: "Авансовый платеж по УСН", Period: "I квартал 2026 г.",
+			Description: "Платится на единый налоговый счет (ЕНС), до 28-го числа месяца после квартала",
+			Due:         date("2026-04-28"), Year: 2026, Amount: 4500000,
+		},
+		{
+			ID: "ip_additional-2025-20260701", Code: "ip_additional", Kind: KindPayment,
+			Title: "Взносы ИП 1% с дохода свыше 300 000 ₽", Period: "2025 г.",
+			Due: date("2026-07-01"), Year: 2025, Conditional: true,
+		},
+	}
+	got := ICS(obligations, ICSOptions{
+		Name:      "Налоговый календарь",
+		UIDSuffix: "user-1@alfa-hack",
+		Alarms:    []int{7, 1},
+		Now:       time.Date(2026, time.April, 20, 12, 30, 0, 0, time.FixedZone("MSK", 3*60*60)),
+	})
+
+	golden := filepath.Join("testdata", "calendar.ics")
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("ICS differs from %s:\n%s", golden, got)
+	}
+	for i, line := range strings.Split(strings.TrimSuffix(string(got), "\r\n"), "\r\n") {
+		if len(line) > 75 || strings.Contains(line, "\n") {
+			t.Errorf("line %d is not folded: %q", i, line)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package calendar
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Reminder - напоминание пользователю о приближающемся сроке
+type Reminder struct {
+	UserID     string
+	Username   string
+	Obligation Obligation
+	DaysLeft   int // дней до срока; 0 - срок сегодня
+}
+
+// Message - текст напоминания
+func (r Reminder) Message() string {
+	when := fmt.Sprintf("через %d дн. (%s)", r.DaysLeft, r.Obligation.Due.Format("02.01.2006"))
+	switch r.DaysLeft {
+	case 0:
+		when = "сегодня"
+	case 1:
+		when = "завтра"
+	}
+	return fmt.Sprintf("Срок %s: %s", when, Text(r.Obligation))
+}
+
+// Notifier отправляет напоминания. Реализация выбирается через NotifierFromEnv.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, reminder Reminder) error
+}
+
+// NotifierFromEnv создает отправителя напоминаний по переменным окружения.
+// REMINDER_NOTIFIER=log (по умолчанию) - напоминания пишутся в лог сервера;
+// REMINDER_NOTIFIER=webhook - POST с JSON на REMINDER_WEBHOOK_URL;
+// REMINDER_NOTIFIER=none - напоминания не отправляются (nil).
+func NotifierFromEnv() (Notifier, error) {
+	switch strings.ToLower(os.Getenv("REMINDER_NOTIFIER")) {
+	case "", "log":
+		return LogNotifier{}, nil
+	case "webhook":
+		return NewWebhookNotifier(os.Getenv("REMINDER_WEBHOOK_URL"))
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown REMINDER_NOTIFIER %q", os.Getenv("REMINDER_NOTIFIER"))
+	}
+}
+
+// LogNotifier пишет напоминания в лог
+type LogNotifier struct{}
+
+func (LogNotifier) Name() string { return "log" }
+
+func (LogNotifier) Notify(_ context.Context, r Reminder) error {
+	log.Printf("Reminder for user %s (%s): %s due %s", r.UserID, r.Username, r.Obligation.ID, r.Obligation.Due.Format("2006-01-02"))
+	return nil
+}
+
+// WebhookNotifier отправляет напоминание POST-запросом с JSON, например в бот мессенджера
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier создает отправителя на адрес webhook
+func NewWebhookNotifier(url string) (*WebhookNotifier, error) {
+	if url == "" {
+		return nil, fmt.Errorf("REMINDER_WEBHOOK_URL is required for webhook notifier")
+	}
+	return &WebhookNotifier{url: url, client: &http.Client{Timeout: 15 * time.Second}}, nil
+}
+
+func (w *WebhookNotifier) Name() string { return "webhook" }
+
+// webhookPayload - тело запроса webhook. Суммы в рублях.
+type webhookPayload struct {
+	UserID      string   `json:"user_id"`
+	Username    string   `json:"username"`
+	ID          string   `json:"obligation_id"`
+	Code        string   `json:"code"`
+	Kind        string   `json:"kind"`
+	Title       string   `json:"title"`
+	Period      string   `json:"period"`
+	DueDate     string   `json:"due_date"`
+	DaysLeft    int      `json:"days_left"`
+	Amount      *float64 `json:"amount"`
+	Conditional bool     `json:"conditional"`
+	Text        string   `json:"text"`
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, r Reminder) error {
+	o := r.Obligation
+	payload := webhookPayload{
+		UserID: r.UserID, Username: r.Username, ID: o.ID, Code: o.Code, Kind: o.Kind, Title: o.Title,
+		Period: o.Period, DueDate: o.Due.Format("2006-01-02"), DaysLeft: r.DaysLeft, Conditional: o.Conditional,
+		Text: r.Message(),
+	}
+	if o.Amount > 0 {
+		amount := float64(o.Amount) / 100
+		payload.Amount = &amount
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -4,12 +4,15 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"path"
+	"strings"
 
 	_ "modernc.org/sqlite"
 )
 
 func InitDB(dbPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite", dbPath+"?_foreign_keys=1")
+	// busy_timeout: запросы API и фоновая обработка файлов пишут в базу одновременно
+	db, err := sql.Open("sqlite", dbPath+"?_foreign_keys=1&_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, err
 	}
@@ -23,6 +26,12 @@ func InitDB(dbPath string) (*sql.DB, error) {
 }
 
 func CreateTables(db *sql.DB) error {
+	// Выписки, загруженные до появления разбора операций, нужно обработать заново
+	hadTransactions, err := tableExists(db, "transactions")
+	if err != nil {
+		return err
+	}
+
 	queries := []string{
 		// Таблица пользователей
 		`CREATE TABLE IF NOT EXISTS users (
@@ -47,6 +56,19 @@ func CreateTables(db *sql.DB) error {
 			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 		)`,
 
+		// Версии файлов: каждая загрузка файла с тем же именем добавляет новую версию
+		`CREATE TABLE IF NOT EXISTS file_versions (
+			id TEXT PRIMARY KEY,
+			file_id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			file_path TEXT NOT NULL,
+			file_size INTEGER,
+			sha256 TEXT DEFAULT '',
+			uploaded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (file_id, version),
+			FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+		)`,
+
 		// Таблица чатов
 		`CREATE TABLE IF NOT EXISTS chats (
 			id TEXT PRIMARY KEY,
@@ -70,13 +92,297 @@ func CreateTables(db *sql.DB) error {
 			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 		)`,
 
+		// Файлы, прикрепленные к чату (если их нет, в чате используются все файлы пользователя)
+		`CREATE TABLE IF NOT EXISTS chat_files (
+			chat_id TEXT NOT NULL,
+			file_id TEXT NOT NULL,
+			added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (chat_id, file_id),
+			FOREIGN KEY (chat_id) REFERENCES chats(id) ON DELETE CASCADE,
+			FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+		)`,
+
+		// Теги файлов (хранятся в нижнем регистре)
+		`CREATE TABLE IF NOT EXISTS file_tags (
+			file_id TEXT NOT NULL,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (file_id, tag),
+			FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+		)`,
+
+		// Обработка версий файлов после загрузки (id совпадает с id версии в file_versions)
+		`CREATE TABLE IF NOT EXISTS ingest_jobs (
+			id TEXT PRIMARY KEY,
+			file_id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			file_path TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'queued',
+			error TEXT DEFAULT '',
+			warnings TEXT DEFAULT '[]',
+			total_chars INTEGER DEFAULT 0,
+			included_chars INTEGER DEFAULT 0,
+			chunks INTEGER DEFAULT 0,
+			truncated INTEGER DEFAULT 0,
+			attempts INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			started_at DATETIME,
+			finished_at DATETIME,
+			FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+		)`,
+
+		// Кеш разобранного содержимого файлов (JSON документа) по хешу содержимого и версии парсера
+		`CREATE TABLE IF NOT EXISTS parsed_cache (
+			sha256 TEXT NOT NULL,
+			ext TEXT NOT NULL DEFAULT '',
+			parser_version TEXT NOT NULL,
+			document TEXT NOT NULL,
+			size INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (sha256, ext, parser_version)
+		)`,
+		// Раньше документы хранились по ключу файла, теперь их заменяет parsed_cache
+		`DROP TABLE IF EXISTS file_documents`,
+
+		// Банковские выписки: по строке на каждый счет в версии файла.
+		// Суммы в копейках, даты в виде YYYY-MM-DD; NULL в остатках - не указаны в выписке
+		`CREATE TABLE IF NOT EXISTS bank_statements (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			file_id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			format TEXT NOT NULL,
+			account TEXT DEFAULT '',
+			currency TEXT DEFAULT 'RUB',
+			date_from TEXT DEFAULT '',
+			date_to TEXT DEFAULT '',
+			opening_balance INTEGER,
+			closing_balance INTEGER,
+			FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+		)`,
+
+		// Операции из банковских выписок. Сумма в копейках и всегда положительная, знак - direction (in/out).
+		// fingerprint одинаков у одной операции из разных выписок за пересекающиеся периоды
+		`CREATE TABLE IF NOT EXISTS transactions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			file_id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			date TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			currency TEXT DEFAULT 'RUB',
+			direction TEXT NOT NULL,
+			internal INTEGER DEFAULT 0,
+			account TEXT DEFAULT '',
+			counterparty TEXT DEFAULT '',
+			counterparty_inn TEXT DEFAULT '',
+			counterparty_account TEXT DEFAULT '',
+			purpose TEXT DEFAULT '',
+			doc_number TEXT DEFAULT '',
+			doc_type TEXT DEFAULT '',
+			fingerprint TEXT NOT NULL,
+			FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+		)`,
+
+		// Правила категоризации операций пользователя: type - inn, purpose или mcc,
+		// learned - правило выучено по исправленной пользователем категории
+		`CREATE TABLE IF NOT EXISTS category_rules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			type TEXT NOT NULL,
+			pattern TEXT NOT NULL,
+			category TEXT NOT NULL,
+			direction TEXT DEFAULT '',
+			learned INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+
+		// Категории, выбранные пользователем для отдельных операций. Хранятся по отпечатку операции,
+		// чтобы переживать повторную обработку выписки и совпадать у одной операции из разных выписок
+		`CREATE TABLE IF NOT EXISTS transaction_overrides (
+			user_id TEXT NOT NULL,
+			fingerprint TEXT NOT NULL,
+			category TEXT NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, fingerprint),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+
+		// Кассовые чеки из выгрузок ОФД. Суммы в копейках и всегда положительные, возврат - operation = 'refund'.
+		// datetime - время на чеке в виде YYYY-MM-DD HH:MM:SS; fingerprint одинаков у одного чека из разных выгрузок
+		`CREATE TABLE IF NOT EXISTS receipts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			file_id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			datetime TEXT NOT NULL,
+			operation TEXT NOT NULL,
+			total INTEGER NOT NULL,
+			cash INTEGER DEFAULT 0,
+			card INTEGER DEFAULT 0,
+			fiscal_drive TEXT DEFAULT '',
+			fiscal_document TEXT DEFAULT '',
+			fingerprint TEXT NOT NULL,
+			FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+		)`,
+
+		// Позиции кассовых чеков
+		`CREATE TABLE IF NOT EXISTS receipt_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			receipt_id INTEGER NOT NULL,
+			user_id TEXT NOT NULL,
+			file_id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			name TEXT DEFAULT '',
+			price INTEGER DEFAULT 0,
+			quantity REAL DEFAULT 1,
+			amount INTEGER NOT NULL,
+			FOREIGN KEY (receipt_id) REFERENCES receipts(id) ON DELETE CASCADE
+		)`,
+
+		// Итоги отчетов маркетплейсов о реализации по артикулам: строка на артикул в версии файла,
+		// строка с пустым sku - удержания без привязки к товару. Суммы в копейках со знаком для продавца,
+		// удержания положительные; fingerprint одинаков у одного отчета, загруженного дважды
+		`CREATE TABLE IF NOT EXISTS marketplace_sales (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			file_id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			marketplace TEXT NOT NULL,
+			date_from TEXT DEFAULT '',
+			date_to TEXT DEFAULT '',
+			sku TEXT DEFAULT '',
+			article TEXT DEFAULT '',
+			name TEXT DEFAULT '',
+			sold INTEGER DEFAULT 0,
+			returned INTEGER DEFAULT 0,
+			revenue INTEGER DEFAULT 0,
+			commission INTEGER DEFAULT 0,
+			logistics INTEGER DEFAULT 0,
+			penalties INTEGER DEFAULT 0,
+			storage INTEGER DEFAULT 0,
+			other INTEGER DEFAULT 0,
+			payout INTEGER DEFAULT 0,
+			fingerprint TEXT NOT NULL,
+			FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+		)`,
+
+		// УПД и счета-фактуры из ЭДО. Суммы в копейках; fingerprint одинаков у одного документа, загруженного дважды
+		`CREATE TABLE IF NOT EXISTS edo_documents (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			file_id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			function TEXT DEFAULT '',
+			title TEXT DEFAULT '',
+			number TEXT NOT NULL,
+			date TEXT DEFAULT '',
+			currency TEXT DEFAULT 'RUB',
+			seller_name TEXT DEFAULT '',
+			seller_inn TEXT DEFAULT '',
+			seller_kpp TEXT DEFAULT '',
+			buyer_name TEXT DEFAULT '',
+			buyer_inn TEXT DEFAULT '',
+			buyer_kpp TEXT DEFAULT '',
+			amount INTEGER DEFAULT 0,
+			vat INTEGER DEFAULT 0,
+			total INTEGER DEFAULT 0,
+			fingerprint TEXT NOT NULL,
+			FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+		)`,
+
+		// Строки товаров и услуг документов ЭДО
+		`CREATE TABLE IF NOT EXISTS edo_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			document_id INTEGER NOT NULL,
+			user_id TEXT NOT NULL,
+			file_id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			num INTEGER DEFAULT 0,
+			name TEXT DEFAULT '',
+			unit TEXT DEFAULT '',
+			quantity REAL DEFAULT 0,
+			price INTEGER DEFAULT 0,
+			amount INTEGER DEFAULT 0,
+			vat_rate TEXT DEFAULT '',
+			vat INTEGER DEFAULT 0,
+			total INTEGER DEFAULT 0,
+			FOREIGN KEY (document_id) REFERENCES edo_documents(id) ON DELETE CASCADE
+		)`,
+
+		// Сотрудники из кадровых файлов (штатное расписание, список персонала). Оклад в копейках за месяц,
+		// даты в виде YYYY-MM-DD; fingerprint одинаков у одного сотрудника из разных файлов
+		`CREATE TABLE IF NOT EXISTS employees (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			file_id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			position TEXT DEFAULT '',
+			salary INTEGER NOT NULL,
+			hire_date TEXT DEFAULT '',
+			fire_date TEXT DEFAULT '',
+			fingerprint TEXT NOT NULL,
+			FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+		)`,
+
+		// Отправленные напоминания о сроках календаря: одно напоминание на обязательство и число дней до срока
+		`CREATE TABLE IF NOT EXISTS reminders (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			obligation_id TEXT NOT NULL,
+			days_before INTEGER NOT NULL,
+			notifier TEXT NOT NULL,
+			sent_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (user_id, obligation_id, days_before),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+
 		// Индекс для быстрого поиска
 		`CREATE INDEX IF NOT EXISTS idx_files_user_id ON files(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_file_versions_file_id ON file_versions(file_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_file_versions_file_path ON file_versions(file_path)`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_files_file_id ON chat_files(file_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_file_tags_tag ON file_tags(tag)`,
+		`CREATE INDEX IF NOT EXISTS idx_ingest_jobs_file_id ON ingest_jobs(file_id, version)`,
+		`CREATE INDEX IF NOT EXISTS idx_ingest_jobs_status ON ingest_jobs(status, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_bank_statements_file_id ON bank_statements(file_id, version)`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_user_date ON transactions(user_id, date)`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_file_id ON transactions(file_id, version)`,
+		`CREATE INDEX IF NOT EXISTS idx_receipts_file_id ON receipts(file_id, version)`,
+		`CREATE INDEX IF NOT EXISTS idx_receipts_user_datetime ON receipts(user_id, datetime)`,
+		`CREATE INDEX IF NOT EXISTS idx_receipt_items_receipt_id ON receipt_items(receipt_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_receipt_items_file_id ON receipt_items(file_id, version)`,
+		`CREATE INDEX IF NOT EXISTS idx_marketplace_sales_file_id ON marketplace_sales(file_id, version)`,
+		`CREATE INDEX IF NOT EXISTS idx_marketplace_sales_user_id ON marketplace_sales(user_id, date_to)`,
+		`CREATE INDEX IF NOT EXISTS idx_edo_documents_file_id ON edo_documents(file_id, version)`,
+		`CREATE INDEX IF NOT EXISTS idx_edo_documents_user_id ON edo_documents(user_id, date)`,
+		`CREATE INDEX IF NOT EXISTS idx_edo_items_document_id ON edo_items(document_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_edo_items_file_id ON edo_items(file_id, version)`,
+		`CREATE INDEX IF NOT EXISTS idx_employees_file_id ON employees(file_id, version)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_category_rules_pattern ON category_rules(user_id, type, pattern, direction)`,
 		`CREATE INDEX IF NOT EXISTS idx_chats_user_id ON chats(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_messages_chat_id ON messages(chat_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_messages_user_id ON messages(user_id)`,
 	}
 
+	// Миграция: парсер выбирается по расширению файла, поэтому оно вошло в ключ кеша разобранных
+	// документов. Старый кеш без расширения удаляется и заполнится заново.
+	var cacheTables, cacheExt int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'parsed_cache'").Scan(&cacheTables); err != nil {
+		return err
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('parsed_cache') WHERE name = 'ext'").Scan(&cacheExt); err != nil {
+		return err
+	}
+	if cacheTables > 0 && cacheExt == 0 {
+		if _, err := db.Exec("DROP TABLE parsed_cache"); err != nil {
+			return err
+		}
+		log.Println("Dropped parsed documents cache without file extension key")
+	}
+
 	for _, query := range queries {
 		if _, err := db.Exec(query); err != nil {
 			return err
@@ -84,15 +390,127 @@ func CreateTables(db *sql.DB) error {
 	}
 
 	// Миграция: добавление колонки business_name если её нет
-	err := addColumnIfNotExists(db, "users", "business_name", "TEXT DEFAULT ''")
+	err = addColumnIfNotExists(db, "users", "business_name", "TEXT DEFAULT ''")
 	if err != nil {
 		log.Printf("Warning: Failed to add business_name column (might already exist): %v", err)
 	}
 
+	// Миграция: налоговый профиль бизнеса
+	userColumns := []struct{ name, def string }{
+		{"tax_regime", "TEXT DEFAULT ''"},
+		{"legal_form", "TEXT DEFAULT ''"},
+		{"tax_rate", "REAL DEFAULT 0"},
+		{"patent_income", "INTEGER DEFAULT 0"},
+		{"patent_months", "INTEGER DEFAULT 0"},
+		{"region", "TEXT DEFAULT ''"},
+		{"employees_count", "INTEGER DEFAULT -1"},
+		{"payroll_sme", "INTEGER DEFAULT 1"},
+		{"payroll_priority", "INTEGER DEFAULT 0"},
+		{"injury_rate", "REAL DEFAULT 0.2"},
+	}
+	for _, col := range userColumns {
+		if err := addColumnIfNotExists(db, "users", col.name, col.def); err != nil {
+			log.Printf("Warning: Failed to add users.%s column: %v", col.name, err)
+		}
+	}
+
+	// Миграция: метаданные генерации ответа в сообщениях
+	messageColumns := []struct{ name, def string }{
+		{"provider", "TEXT DEFAULT ''"},
+		{"model", "TEXT DEFAULT ''"},
+		{"prompt_tokens", "INTEGER DEFAULT 0"},
+		{"completion_tokens", "INTEGER DEFAULT 0"},
+		{"latency_ms", "INTEGER DEFAULT 0"},
+		{"fallback_attempts", "INTEGER DEFAULT 0"},
+		{"is_fallback", "INTEGER DEFAULT 0"},
+		{"degraded_reason", "TEXT DEFAULT ''"},
+		{"sources", "TEXT DEFAULT '[]'"},
+		{"prompt_version", "TEXT DEFAULT ''"},
+		{"category_confidence", "REAL DEFAULT 0"},
+		{"category_method", "TEXT DEFAULT ''"},
+		{"files", "TEXT DEFAULT '[]'"},
+		{"file_scope", "TEXT DEFAULT ''"},
+	}
+	for _, col := range messageColumns {
+		if err := addColumnIfNotExists(db, "messages", col.name, col.def); err != nil {
+			log.Printf("Warning: Failed to add messages.%s column: %v", col.name, err)
+		}
+	}
+
+	// Миграция: хеш содержимого и версии файлов
+	fileColumns := []struct{ name, def string }{
+		{"sha256", "TEXT DEFAULT ''"},
+		{"version", "INTEGER DEFAULT 1"},
+		{"pinned_version", "INTEGER DEFAULT 0"},
+		// Папка, описание, период и вид документа
+		{"folder", "TEXT DEFAULT ''"},
+		{"description", "TEXT DEFAULT ''"},
+		{"period", "TEXT DEFAULT ''"},
+		{"period_start", "TEXT DEFAULT ''"},
+		{"period_end", "TEXT DEFAULT ''"},
+		{"period_auto", "INTEGER DEFAULT 1"},
+		{"doc_kind", "TEXT DEFAULT ''"},
+		{"doc_kind_auto", "INTEGER DEFAULT 1"},
+	}
+	for _, col := range fileColumns {
+		if err := addColumnIfNotExists(db, "files", col.name, col.def); err != nil {
+			log.Printf("Warning: Failed to add files.%s column: %v", col.name, err)
+		}
+	}
+
+	// Миграция: категории операций и MCC
+	transactionColumns := []struct{ name, def string }{
+		{"mcc", "TEXT DEFAULT ''"},
+		{"category", "TEXT DEFAULT ''"},
+		{"category_source", "TEXT DEFAULT ''"},
+		{"category_rule_id", "INTEGER DEFAULT 0"},
+	}
+	for _, col := range transactionColumns {
+		if err := addColumnIfNotExists(db, "transactions", col.name, col.def); err != nil {
+			log.Printf("Warning: Failed to add transactions.%s column: %v", col.name, err)
+		}
+	}
+
+	// Раньше в file_path хранился путь на диске, теперь - ключ в хранилище
+	if err := migrateFileKeys(db); err != nil {
+		log.Printf("Warning: Failed to migrate file paths to storage keys: %v", err)
+	}
+
+	// Файлы, загруженные до появления версий, становятся версией 1
+	_, err = db.Exec(`INSERT INTO file_versions (id, file_id, version, file_path, file_size, sha256, uploaded_at)
+		SELECT id, id, 1, file_path, file_size, sha256, uploaded_at FROM files
+		WHERE id NOT IN (SELECT file_id FROM file_versions)`)
+	if err != nil {
+		log.Printf("Warning: Failed to create initial file versions: %v", err)
+	}
+
+	// Версии, загруженные до появления фоновой обработки, ставим в очередь
+	_, err = db.Exec(`INSERT INTO ingest_jobs (id, file_id, version, file_path)
+		SELECT id, file_id, version, file_path FROM file_versions
+		WHERE id NOT IN (SELECT id FROM ingest_jobs)`)
+	if err != nil {
+		log.Printf("Warning: Failed to queue file processing jobs: %v", err)
+	}
+
+	if !hadTransactions {
+		_, err = db.Exec(`UPDATE ingest_jobs SET status = 'queued', created_at = CURRENT_TIMESTAMP
+			WHERE status IN ('done', 'failed') AND lower(file_path) LIKE '%.txt'`)
+		if err != nil {
+			log.Printf("Warning: Failed to queue text files for bank statement import: %v", err)
+		}
+	}
+
 	log.Println("Database tables created successfully")
 	return nil
 }
 
+// tableExists проверяет, есть ли таблица в базе
+func tableExists(db *sql.DB, tableName string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", tableName).Scan(&count)
+	return count > 0, err
+}
+
 // addColumnIfNotExists добавляет колонку в таблицу, если её нет
 func addColumnIfNotExists(db *sql.DB, tableName, columnName, columnDef string) error {
 	// Проверяем, существует ли колонка
@@ -115,3 +533,37 @@ func addColumnIfNotExists(db *sql.DB, tableName, columnName, columnDef string) e
 
 	return nil
 }
+
+// migrateFileKeys заменяет старые пути на диске ("../uploads/<userID>/<fileID>.xlsx",
+// "/app/uploads/...") ключами хранилища "<userID>/<fileID>.xlsx"
+func migrateFileKeys(db *sql.DB) error {
+	rows, err := db.Query("SELECT id, user_id, file_path FROM files WHERE file_path LIKE '/%' OR file_path LIKE '.%' OR file_path LIKE '%\\%'")
+	if err != nil {
+		return err
+	}
+	type update struct{ id, key string }
+	var updates []update
+	for rows.Next() {
+		var id, userID, filePath string
+		if err := rows.Scan(&id, &userID, &filePath); err != nil {
+			rows.Close()
+			return err
+		}
+		name := path.Base(strings.ReplaceAll(filePath, "\\", "/"))
+		updates = append(updates, update{id: id, key: userID + "/" + name})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, u := range updates {
+		if _, err := db.Exec("UPDATE files SET file_path = ? WHERE id = ?", u.key, u.id); err != nil {
+			return err
+		}
+	}
+	if len(updates) > 0 {
+		log.Printf("Migrated %d file paths to storage keys", len(updates))
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+// Package edo разбирает электронные документы в XML-форматах ФНС, которые приходят через ЭДО:
+// УПД, счет-фактуру и передаточный документ (акт, накладную) по форматам 5.01 и 5.03.
+package edo
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Виды документов
+const (
+	KindInvoice  = "invoice"  // счет-фактура (функция СЧФ)
+	KindUPD      = "upd"      // УПД: счет-фактура и передаточный документ (СЧФДОП)
+	KindTransfer = "transfer" // передаточный документ без счета-фактуры: акт, накладная (ДОП)
+)
+
+// KindNames - названия видов документов для пользователя
+var KindNames = map[string]string{
+	KindInvoice:  "Счет-фактура",
+	KindUPD:      "УПД",
+	KindTransfer: "Передаточный документ (акт, накладная)",
+}
+
+// ErrUnknownFormat - файл не является документом ФНС
+var ErrUnknownFormat = errors.New("edo: unknown document format")
+
+// Document - электронный документ. Суммы в копейках.
+type Document struct {
+	Kind     string
+	Function string // СЧФ, СЧФДОП или ДОП
+	Title    string // наименование документа, как в файле
+	FileID   string // ИдФайл - одинаков у одного документа, полученного дважды
+	Number   string
+	Date     time.Time
+	Currency string // RUB, USD...
+	Seller   Party
+	Buyer    Party
+	Items    []Item
+	Amount   int64 // без НДС
+	VAT      int64
+	Total    int64 // с НДС
+	Warnings []string
+}
+
+// Party - продавец или покупатель
+type Party struct {
+	Name string
+	INN  string
+	KPP  string
+}
+
+// Item - строка табличной части
+type Item struct {
+	Num      int
+	Name     string
+	Unit     string
+	Quantity float64
+	Price    int64 // цена за единицу без НДС
+	Amount   int64 // стоимость без НДС
+	VATRate  string
+	VAT      int64
+	Total    int64 // стоимость с НДС
+}
+
+// VATGroup - стоимость и НДС по ставке
+type VATGroup struct {
+	Rate   string
+	Amount int64
+	VAT    int64
+}
+
+// IsDocumentType - в файлах с таким расширением могут быть документы ФНС
+func IsDocumentType(fileType string) bool {
+	return fileType == "xml"
+}
+
+// Parse разбирает XML-документ ФНС. Если файл не похож на УПД или счет-фактуру, возвращает ErrUnknownFormat.
+func Parse(data []byte) (*Document, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	head := data
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	// Документы ФНС обычно в windows-1251, тогда имена элементов не читаются как UTF-8
+	if !utf8.Valid(data) {
+		decoded, err := charmap.Windows1251.NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, ErrUnknownFormat
+		}
+		data, head = decoded, decoded
+		if len(head) > 4096 {
+			head = head[:4096]
+		}
+	}
+	if !bytes.Contains(head, []byte("<Файл")) || !bytes.Contains(data, []byte("СвСчФакт")) {
+		return nil, ErrUnknownFormat
+	}
+
+	var file fnsFile
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// Текст уже переведен в UTF-8, объявленную в заголовке кодировку не учитываем
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("edo: %w", err)
+	}
+	return file.document()
+}
+
+// VATGroups - стоимость и НДС по ставкам в порядке первого появления
+func (d *Document) VATGroups() []VATGroup {
+	var groups []VATGroup
+	index := make(map[string]int)
+	for _, item := range d.Items {
+		i, ok := index[item.VATRate]
+		if !ok {
+			i = len(groups)
+			index[item.VATRate] = i
+			groups = append(groups, VATGroup{Rate: item.VATRate})
+		}
+		groups[i].Amount += item.Amount
+		groups[i].VAT += item.VAT
+	}
+	return groups
+}
+
+// Структура файла обмена по приказам ФНС ММВ-7-15/820 (формат 5.01) и ЕД-7-26/970 (5.03).
+// Имена атрибутов номера и даты документа в версиях различаются, поэтому в структурах есть оба.
+
+type fnsFile struct {
+	XMLName  xml.Name    `xml:"Файл"`
+	ID       string      `xml:"ИдФайл,attr"`
+	Document fnsDocument `xml:"Документ"`
+}
+
+type fnsDocument struct {
+	KND      string     `xml:"КНД,attr"`
+	Function string     `xml:"Функция,attr"`
+	Title    string     `xml:"НаимДокОпр,attr"`
+	Transfer string     `xml:"ПоФактХЖ,attr"`
+	Invoice  fnsInvoice `xml:"СвСчФакт"`
+	Table    fnsTable   `xml:"ТаблСчФакт"`
+}
+
+type fnsInvoice struct {
+	Number   string     `xml:"НомерСчФ,attr"`
+	Date     string     `xml:"ДатаСчФ,attr"`
+	DocNum   string     `xml:"НомерДок,attr"`
+	DocDate  string     `xml:"ДатаДок,attr"`
+	Currency string     `xml:"КодОКВ,attr"`
+	Money    fnsMoney   `xml:"ДенИзм"`
+	Sellers  []fnsParty `xml:"СвПрод"`
+	Buyers   []fnsParty `xml:"СвПокуп"`
+}
+
+type fnsMoney struct {
+	Currency string `xml:"КодОКВ,attr"`
+}
+
+type fnsParty struct {
+	Org struct {
+		Name string `xml:"НаимОрг,attr"`
+		INN  string `xml:"ИННЮЛ,attr"`
+		KPP  string `xml:"КПП,attr"`
+	} `xml:"ИдСв>СвЮЛУч"`
+	IP struct {
+		INN string `xml:"ИННФЛ,attr"`
+		FIO struct {
+			Last   string `xml:"Фамилия,attr"`
+			First  string `xml:"Имя,attr"`
+			Middle string `xml:"Отчество,attr"`
+		} `xml:"ФИО"`
+	} `xml:"ИдСв>СвИП"`
+	Foreign struct {
+		Name string `xml:"НаимОрг,attr"`
+	} `xml:"ИдСв>СвИнНеУч"`
+}
+
+func (p fnsParty) party() Party {
+	switch {
+	case p.Org.INN != "" || p.Org.Name != "":
+		return Party{Name: strings.TrimSpace(p.Org.Name), INN: strings.TrimSpace(p.Org.INN), KPP: strings.TrimSpace(p.Org.KPP)}
+	case p.IP.INN != "":
+		name := strings.Join(strings.Fields(p.IP.FIO.Last+" "+p.IP.FIO.First+" "+p.IP.FIO.Middle), " ")
+		return Party{Name: "ИП " + name, INN: strings.TrimSpace(p.IP.INN)}
+	}
+	return Party{Name: strings.TrimSpace(p.Foreign.Name)}
+}
+
+type fnsTable struct {
+	Items []fnsItem `xml:"СведТов"`
+	Total fnsTotal  `xml:"ВсегоОпл"`
+}
+
+type fnsItem struct {
+	Num      string `xml:"НомСтр,attr"`
+	Name     string `xml:"НаимТов,attr"`
+	Unit     string `xml:"НаимЕдИзм,attr"`
+	Quantity string `xml:"КолТов,attr"`
+	Price    string `xml:"ЦенаТов,attr"`
+	Amount   string `xml:"СтТовБезНДС,attr"`
+	Rate     string `xml:"НалСт,attr"`
+	Total    string `xml:"СтТовУчНал,attr"`
+	VAT      fnsVAT `xml:"СумНал"`
+}
+
+type fnsVAT struct {
+	Sum   string `xml:"СумНал"`
+	NoVAT string `xml:"БезНДС"`
+}
+
+type fnsTotal struct {
+	Amount string `xml:"СтТовБезНДСВсего,attr"`
+	Total  string `xml:"СтТовУчНалВсего,attr"`
+	VAT    fnsVAT `xml:"СумНалВсего"`
+}
+
+func (f fnsFile) document() (*Document, error) {
+	src := f.Document
+	doc := &Document{
+		Function: strings.ToUpper(strings.TrimSpace(src.Function)),
+		Title:    strings.TrimSpace(src.Title),
+		FileID:   strings.TrimSpace(f.ID),
+		Number:   strings.TrimSpace(src.Invoice.Number + src.Invoice.DocNum),
+		Currency: currencyCode(src.Invoice.Currency + src.Invoice.Money.Currency),
+	}
+	switch doc.Function {
+	case "СЧФ":
+		doc.Kind = KindInvoice
+	case "ДОП":
+		doc.Kind = KindTransfer
+	default:
+		doc.Kind = KindUPD
+	}
+	if doc.Title == "" {
+		doc.Title = strings.TrimSpace(src.Transfer)
+	}
+	if doc.Number == "" {
+		return nil, ErrUnknownFormat
+	}
+	var err error
+	date := strings.TrimSpace(src.Invoice.Date + src.Invoice.DocDate)
+	if doc.Date, err = time.Parse("02.01.2006", date); err != nil {
+		doc.Warnings = append(doc.Warnings, fmt.Sprintf("Неверная дата документа %q", date))
+	}
+	if len(src.Invoice.Sellers) > 0 {
+		doc.Seller = src.Invoice.Sellers[0].party()
+	}
+	if len(src.Invoice.Buyers) > 0 {
+		doc.Buyer = src.Invoice.Buyers[0].party()
+	}
+
+	for i, item := range src.Table.Items {
+		it := Item{Num: i + 1, Name: strings.TrimSpace(item.Name), Unit: strings.TrimSpace(item.Unit), VATRate: vatRate(item.Rate)}
+		if n, err := strconv.Atoi(strings.TrimSpace(item.Num)); err == nil {
+			it.Num = n
+		}
+		it.Quantity, _ = strconv.ParseFloat(strings.TrimSpace(item.Quantity), 64)
+		values := []struct {
+			name   string
+			value  string
+			target *int64
+		}{
+			{"цена", item.Price, &it.Price}, {"стоимость без НДС", item.Amount, &it.Amount},
+			{"НДС", item.VAT.Sum, &it.VAT}, {"стоимость с НДС", item.Total, &it.Total},
+		}
+		for _, v := range values {
+			amount, ok := parseAmount(v.value)
+			if !ok {
+				doc.Warnings = append(doc.Warnings, fmt.Sprintf("Строка %d: неверная сумма (%s) %q", it.Num, v.name, v.value))
+			}
+			*v.target = amount
+		}
+		if it.Total == 0 {
+			it.Total = it.Amount + it.VAT
+		}
+		if it.Amount == 0 {
+			it.Amount = it.Total - it.VAT
+		}
+		doc.Items = append(doc.Items, it)
+	}
+
+	doc.Amount, _ = parseAmount(src.Table.Total.Amount)
+	doc.VAT, _ = parseAmount(src.Table.Total.VAT.Sum)
+	doc.Total, _ = parseAmount(src.Table.Total.Total)
+	var amount, vat, total int64
+	for _, item := range doc.Items {
+		amount, vat, total = amount+item.Amount, vat+item.VAT, total+item.Total
+	}
+	if doc.Total == 0 {
+		doc.Amount, doc.VAT, doc.Total = amount, vat, total
+	} else if total != doc.Total {
+		doc.Warnings = append(doc.Warnings, fmt.Sprintf("Сумма строк %s не совпадает с итогом документа %s",
+			formatAmount(total), formatAmount(doc.Total)))
+	}
+	if doc.Amount == 0 {
+		doc.Amount = doc.Total - doc.VAT
+	}
+	return doc, nil
+}
+
+// vatRate приводит ставку НДС к виду "20%", "10%", "0%", "20/120" или "без НДС"
+func vatRate(value string) string {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(value) {
+	case "", "без ндс", "безндс":
+		return "без НДС"
+	case "ндс исчисляется налоговым агентом":
+		return value
+	}
+	if strings.Contains(value, "/") || strings.HasSuffix(value, "%") {
+		return value
+	}
+	return value + "%"
+}
+
+// currencyCodes - буквенные коды валют по цифровым кодам ОКВ
+var currencyCodes = map[string]string{"643": "RUB", "840": "USD", "978": "EUR", "156": "CNY", "933": "BYN", "398": "KZT"}
+
+func currencyCode(code string) string {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return "RUB"
+	}
+	if letter, ok := currencyCodes[code]; ok {
+		return letter
+	}
+	return code
+}
+
+// parseAmount разбирает сумму в рублях ("1200.00", "1200,5") в копейки; пустая сумма - 0
+func parseAmount(value string) (int64, bool) {
+	value = strings.ReplaceAll(strings.ReplaceAll(strings.TrimSpace(value), " ", ""), ",", ".")
+	if value == "" {
+		return 0, true
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int64(math.Round(f * 100)), true
+}
+
+func formatAmount(kopecks int64) string {
+	return strconv.FormatFloat(float64(kopecks)/100, 'f', 2, 64)
+}
@@ -0,0 +1,120 @@
+package edo
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// updXML - УПД формата 5.01 с двумя строками по ставкам 20% и 10%
+func updXML(total string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="windows-1251"?>
+<Файл ИдФайл="ON_NSCHFDOPPR_1" ВерсФорм="5.01">
+<Документ КНД="1115131" Функция="СЧФДОП" ПоФактХЖ="Документ об отгрузке товаров (выполнении работ)" НаимДокОпр="Счет-фактура и документ об отгрузке товаров (выполнении работ)">
+<СвСчФакт НомерСчФ="15" ДатаСчФ="10.03.2026" КодОКВ="643">
+<СвПрод><ИдСв><СвЮЛУч НаимОрг="ООО Поставщик" ИННЮЛ="7702000002" КПП="770201001"/></ИдСв></СвПрод>
+<СвПокуп><ИдСв><СвИП ИННФЛ="770100000012"><ФИО Фамилия="Иванов" Имя="Иван" Отчество="Иванович"/></СвИП></ИдСв></СвПокуп>
+</СвСчФакт>
+<ТаблСчФакт>
+<СведТов НомСтр="1" НаимТов="Кофе в зернах" НаимЕдИзм="кг" КолТов="2" ЦенаТов="1000.00" СтТовБезНДС="2000.00" НалСт="20%%" СтТовУчНал="2400.00"><СумНал><СумНал>400.00</СумНал></СумНал></СведТов>
+<СведТов НомСтр="2" НаимТов="Молоко" НаимЕдИзм="л" КолТов="10" ЦенаТов="100.00" СтТовБезНДС="1000.00" НалСт="10%%" СтТовУчНал="1100.00"><СумНал><СумНал>100.00</СумНал></СумНал></СведТов>
+<ВсегоОпл СтТовБезНДСВсего="3000.00" СтТовУчНалВсего="%s"><СумНалВсего><СумНал>500.00</СумНал></СумНалВсего></ВсегоОпл>
+</ТаблСчФакт>
+</Документ>
+</Файл>`, total)
+}
+
+func TestParseUPD(t *testing.T) {
+	tests := []struct {
+		name     string
+		total    string
+		warnings int
+	}{
+		{"итог сходится со строками", "3500.00", 0},
+		{"итог не сходится со строками", "3600.00", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := charmap.Windows1251.NewEncoder().Bytes([]byte(updXML(tt.total)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc, err := Parse(data)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if doc.Kind != KindUPD || doc.Number != "15" || doc.Currency != "RUB" ||
+				!doc.Date.Equal(time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("document = %+v", doc)
+			}
+			if doc.Seller != (Party{Name: "ООО Поставщик", INN: "7702000002", KPP: "770201001"}) ||
+				doc.Buyer != (Party{Name: "ИП Иванов Иван Иванович", INN: "770100000012"}) {
+				t.Errorf("seller %+v, buyer %+v", doc.Seller, doc.Buyer)
+			}
+			if doc.Amount != 3000_00 || doc.VAT != 500_00 || len(doc.Items) != 2 || len(doc.Warnings) != tt.warnings {
+				t.Errorf("amount %d, vat %d, %d items, warnings %q", doc.Amount, doc.VAT, len(doc.Items), doc.Warnings)
+			}
+			groups := doc.VATGroups()
+			want := []VATGroup{{Rate: "20%", Amount: 2000_00, VAT: 400_00}, {Rate: "10%", Amount: 1000_00, VAT: 100_00}}
+			if len(groups) != len(want) || groups[0] != want[0] || groups[1] != want[1] {
+				t.Errorf("VAT groups = %+v", groups)
+			}
+		})
+	}
+}
+
+func TestParseUnknown(t *testing.T) {
+	if _, err := Parse([]byte(`<?xml version="1.0"?><Document><Stmt/></Document>`)); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Parse of non-FNS XML: %v", err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	date := func(day int) time.Time { return time.Date(2026, 3, day, 0, 0, 0, 0, time.UTC) }
+	supplier := Party{Name: "ООО Поставщик", INN: "7702000002"}
+	customer := Party{Name: "ООО Клиент", INN: "7703000003"}
+	docs := []*Document{
+		{Number: "15", Date: date(10), Currency: "RUB", Seller: supplier, Total: 3500_00},
+		{Number: "16", Date: date(12), Currency: "RUB", Seller: supplier, Total: 1000_00},
+		{Number: "7", Date: date(1), Currency: "RUB", Buyer: customer, Total: 5000_00},
+		{Number: "150", Date: date(15), Currency: "RUB", Seller: supplier, Total: 777_00},
+	}
+	payments := []Payment{
+		// Документ 15 оплачен двумя частями с номером в назначении
+		{ID: 1, Date: date(11), Amount: 2000_00, Currency: "RUB", INN: supplier.INN, Purpose: "Оплата по УПД № 15 от 10.03.2026"},
+		{ID: 2, Date: date(20), Amount: 1500_00, Currency: "RUB", INN: supplier.INN, Purpose: "Доплата по сч-ф 15"},
+		// Документ 16 - по точной сумме без номера
+		{ID: 3, Date: date(13), Amount: 1000_00, Currency: "RUB", INN: supplier.INN, Purpose: "Оплата товара"},
+		// Документ 7 - поступление от покупателя, оплачен частично
+		{ID: 4, Date: date(5), Amount: 2000_00, Currency: "RUB", Incoming: true, INN: customer.INN, Purpose: "Аванс по счету 7"},
+		// Другая валюта и другой контрагент не засчитываются
+		{ID: 5, Date: date(16), Amount: 777_00, Currency: "USD", INN: supplier.INN, Purpose: "Invoice 150"},
+		{ID: 6, Date: date(16), Amount: 777_00, Currency: "RUB", INN: "7700000000", Purpose: "Оплата 150"},
+	}
+	tests := []struct {
+		status string
+		role   string
+		paid   int64
+		ids    []int64
+	}{
+		{StatusPaid, RoleBuyer, 3500_00, []int64{1, 2}},
+		{StatusPaid, RoleBuyer, 1000_00, []int64{3}},
+		{StatusPartial, RoleSeller, 2000_00, []int64{4}},
+		{StatusUnpaid, "", 0, nil},
+	}
+	matches := Reconcile(docs, payments)
+	for i, tt := range tests {
+		m := matches[i]
+		var ids []int64
+		for _, p := range m.Payments {
+			ids = append(ids, p.ID)
+		}
+		if m.Status != tt.status || m.Role != tt.role || m.Paid != tt.paid || fmt.Sprint(ids) != fmt.Sprint(tt.ids) {
+			t.Errorf("document %s: %s %s paid %d by %v; want %s %s paid %d by %v",
+				docs[i].Number, m.Status, m.Role, m.Paid, ids, tt.status, tt.role, tt.paid, tt.ids)
+		}
+	}
+}
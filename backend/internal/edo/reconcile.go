@@ -0,0 +1,189 @@
+package edo
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Статусы оплаты документа
+const (
+	StatusPaid    = "paid"
+	StatusPartial = "partial"
+	StatusUnpaid  = "unpaid"
+)
+
+// StatusNames - названия статусов оплаты для пользователя
+var StatusNames = map[string]string{
+	StatusPaid:    "оплачен",
+	StatusPartial: "оплачен частично",
+	StatusUnpaid:  "не оплачен",
+}
+
+// Роль пользователя в документе: покупатель платит продавцу, продавец получает оплату от покупателя
+const (
+	RoleBuyer  = "buyer"
+	RoleSeller = "seller"
+)
+
+// Окно поиска оплаты относительно даты документа: предоплата и отсрочка
+const (
+	paymentDaysBefore = 30
+	paymentDaysAfter  = 90
+)
+
+// Payment - операция по счету, которая может быть оплатой документа. Сумма в копейках, положительная.
+type Payment struct {
+	ID       int64
+	Date     time.Time
+	Amount   int64
+	Currency string
+	Incoming bool // поступление на счет
+	INN      string
+	Purpose  string
+}
+
+// Match - оплата документа по выпискам
+type Match struct {
+	Status   string
+	Role     string // RoleBuyer или RoleSeller; пустая, если оплат не найдено
+	Paid     int64
+	Payments []Payment
+}
+
+// Reconcile сопоставляет документы с операциями по счету. Оплата ищется по ИНН контрагента
+// и направлению: списание продавцу документа или поступление от покупателя, в окне от 30 дней
+// до даты документа до 90 дней после. Сначала учитываются операции, в назначении которых
+// указан номер документа (они могут закрывать документ частями), затем операции на точную
+// сумму документа, ближайшие по дате. Каждая операция засчитывается одному документу.
+func Reconcile(docs []*Document, payments []Payment) []Match {
+	matches := make([]Match, len(docs))
+	used := make(map[int64]bool)
+	order := make([]int, len(docs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return docs[order[a]].Date.Before(docs[order[b]].Date) })
+
+	// Операции с номером документа в назначении
+	for _, i := range order {
+		doc := docs[i]
+		number := numberPattern(doc.Number)
+		if number == nil {
+			continue
+		}
+		candidates := doc.candidates(payments, used)
+		var exact *Payment
+		var numbered []Payment
+		for j, p := range candidates {
+			if !number.MatchString(p.Purpose) {
+				continue
+			}
+			if p.Amount == doc.Total && exact == nil {
+				exact = &candidates[j]
+			}
+			numbered = append(numbered, p)
+		}
+		if exact != nil {
+			numbered = []Payment{*exact}
+		}
+		var paid int64
+		var applied []Payment
+		for _, p := range numbered {
+			if paid >= doc.Total {
+				break
+			}
+			paid += p.Amount
+			applied = append(applied, p)
+		}
+		for _, p := range applied {
+			used[p.ID] = true
+		}
+		matches[i] = newMatch(doc, applied)
+	}
+
+	// Операции на точную сумму документа
+	for _, i := range order {
+		doc := docs[i]
+		if len(matches[i].Payments) > 0 || doc.Total <= 0 {
+			continue
+		}
+		candidates := doc.candidates(payments, used)
+		var best *Payment
+		var bestDistance time.Duration
+		for j, p := range candidates {
+			if p.Amount != doc.Total {
+				continue
+			}
+			distance := p.Date.Sub(doc.Date)
+			if distance < 0 {
+				distance = -distance
+			}
+			if best == nil || distance < bestDistance {
+				best, bestDistance = &candidates[j], distance
+			}
+		}
+		if best != nil {
+			used[best.ID] = true
+			matches[i] = newMatch(doc, []Payment{*best})
+		}
+	}
+	return matches
+}
+
+// candidates - не засчитанные другим документам операции с контрагентом документа в окне дат
+func (d *Document) candidates(payments []Payment, used map[int64]bool) []Payment {
+	from := d.Date.AddDate(0, 0, -paymentDaysBefore)
+	to := d.Date.AddDate(0, 0, paymentDaysAfter)
+	var result []Payment
+	for _, p := range payments {
+		if used[p.ID] || p.Date.Before(from) || p.Date.After(to) || d.role(p) == "" {
+			continue
+		}
+		if p.Currency != "" && d.Currency != "" && p.Currency != d.Currency {
+			continue
+		}
+		result = append(result, p)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Date.Before(result[j].Date) })
+	return result
+}
+
+// role - роль пользователя в документе, если операция может быть его оплатой
+func (d *Document) role(p Payment) string {
+	switch {
+	case p.INN == "":
+		return ""
+	case !p.Incoming && p.INN == d.Seller.INN:
+		return RoleBuyer
+	case p.Incoming && p.INN == d.Buyer.INN:
+		return RoleSeller
+	}
+	return ""
+}
+
+func newMatch(doc *Document, payments []Payment) Match {
+	m := Match{Status: StatusUnpaid, Payments: payments}
+	for _, p := range payments {
+		m.Paid += p.Amount
+	}
+	if len(payments) > 0 {
+		m.Role = doc.role(payments[0])
+		m.Status = StatusPartial
+		if m.Paid >= doc.Total {
+			m.Status = StatusPaid
+		}
+	}
+	return m
+}
+
+// numberPattern - номер документа в назначении платежа отдельным словом: "по УПД № 15 от",
+// "сч-ф 15/2", но не "150" или "А15"; nil для пустого номера
+func numberPattern(number string) *regexp.Regexp {
+	number = strings.TrimSpace(number)
+	if number == "" {
+		return nil
+	}
+	return regexp.MustCompile(`(?i)(^|[^\p{L}\p{N}/-])` + regexp.QuoteMeta(number) + `($|[^\p{L}\p{N}/-])`)
+}
@@ -0,0 +1,239 @@
+// Package marketplace разбирает отчеты маркетплейсов о реализации (Wildberries, Ozon) и считает
+// выплату продавцу, юнит-экономику по артикулам и процент возвратов.
+package marketplace
+
+import (
+	"alfa-hack-backend/internal/xlsx"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Маркетплейсы
+const (
+	Wildberries = "wildberries"
+	Ozon        = "ozon"
+)
+
+// Names - названия маркетплейсов для пользователя
+var Names = map[string]string{
+	Wildberries: "Wildberries",
+	Ozon:        "Ozon",
+}
+
+// Виды строк отчета
+const (
+	KindSale    = "sale"    // продажа товара
+	KindReturn  = "return"  // возврат товара покупателем
+	KindService = "service" // услуги и удержания маркетплейса без продажи: логистика, хранение, штрафы
+)
+
+// ErrUnknownFormat - книга не является отчетом маркетплейса
+var ErrUnknownFormat = errors.New("marketplace: unknown report format")
+
+// Report - разобранный отчет о реализации
+type Report struct {
+	Marketplace string
+	Sheet       string // лист с детализацией
+	DateFrom    time.Time
+	DateTo      time.Time
+	Operations  []Operation
+	Warnings    []string
+}
+
+// Operation - строка отчета. Суммы в копейках со знаком для продавца: у возвратов выручка
+// и комиссия отрицательные. Удержания (комиссия, логистика, штрафы, хранение, прочее)
+// положительные, доплаты маркетплейса уменьшают Other.
+// Payout = Revenue - Commission - Logistics - Penalties - Storage - Other.
+type Operation struct {
+	Date       time.Time // нулевая, если в строке нет даты
+	Kind       string
+	Type       string // вид строки, как в отчете: "Продажа", "Логистика", "Доставка покупателю"
+	SKU        string // артикул маркетплейса: nmID Wildberries, SKU Ozon
+	Article    string // артикул продавца
+	Name       string
+	Quantity   int
+	Revenue    int64 // продажи по цене для покупателя
+	Commission int64 // вознаграждение маркетплейса, эквайринг
+	Logistics  int64
+	Penalties  int64
+	Storage    int64
+	Other      int64 // платная приемка, продвижение, прочие удержания за вычетом доплат
+	Payout     int64 // к перечислению продавцу
+}
+
+// IsReportType - в файлах с таким расширением могут быть отчеты маркетплейсов
+func IsReportType(fileType string) bool {
+	return fileType == "xlsx"
+}
+
+// Parse находит в книге детализацию отчета Wildberries или Ozon и разбирает ее.
+// Если книга не похожа на отчет маркетплейса, возвращает ErrUnknownFormat.
+func Parse(wb *xlsx.Workbook) (*Report, error) {
+	for _, sheet := range wb.Sheets {
+		for i := 0; i < len(sheet.Rows) && i < headerSearchRows; i++ {
+			header := sheet.Rows[i].Cells
+			var report *Report
+			if columns := findColumns(header, wildberriesColumns); isWildberries(columns) {
+				report = parseWildberries(sheet.Rows[i+1:], columns)
+			} else if columns := findColumns(header, ozonColumns); isOzon(columns) {
+				report = parseOzon(sheet.Rows[i+1:], columns)
+			}
+			if report == nil {
+				continue
+			}
+			if len(report.Operations) == 0 {
+				return nil, ErrUnknownFormat
+			}
+			report.Sheet = sheet.Name
+			report.finish()
+			return report, nil
+		}
+	}
+	return nil, ErrUnknownFormat
+}
+
+// headerSearchRows - в скольких первых строках листа искать заголовок таблицы
+const headerSearchRows = 20
+
+// column - поле отчета и варианты заголовка столбца (без учета регистра и лишних пробелов)
+type column struct {
+	field   string
+	headers []string // точное совпадение
+	prefix  []string // начало заголовка
+}
+
+// findColumns сопоставляет столбцы заголовка полям. Одному полю может соответствовать
+// несколько столбцов (например, разные виды логистики Ozon) - они складываются.
+func findColumns(header []string, specs []column) map[string][]int {
+	columns := make(map[string][]int)
+	for i, value := range header {
+		title := normalizeHeader(value)
+		if title == "" {
+			continue
+		}
+		for _, spec := range specs {
+			if matchesColumn(title, spec) {
+				columns[spec.field] = append(columns[spec.field], i)
+				break
+			}
+		}
+	}
+	return columns
+}
+
+func normalizeHeader(value string) string {
+	return strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(value, "ё", "е")), " "))
+}
+
+func matchesColumn(title string, spec column) bool {
+	for _, header := range spec.headers {
+		if title == header {
+			return true
+		}
+	}
+	for _, prefix := range spec.prefix {
+		if strings.HasPrefix(title, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// row - доступ к ячейкам строки по полям
+type row struct {
+	cells   []string
+	columns map[string][]int
+}
+
+func (r row) text(field string) string {
+	for _, i := range r.columns[field] {
+		if i < len(r.cells) && strings.TrimSpace(r.cells[i]) != "" {
+			return strings.TrimSpace(r.cells[i])
+		}
+	}
+	return ""
+}
+
+// amount - сумма полей в копейках; ok=false, если в одной из ячеек не число
+func (r row) amount(field string) (int64, bool) {
+	var total int64
+	for _, i := range r.columns[field] {
+		if i >= len(r.cells) {
+			continue
+		}
+		value, ok := parseRubles(r.cells[i])
+		if !ok {
+			return 0, false
+		}
+		total += value
+	}
+	return total, true
+}
+
+func (r row) quantity(field string) int {
+	value := strings.ReplaceAll(strings.ReplaceAll(r.text(field), " ", ""), ",", ".")
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return int(math.Round(f))
+}
+
+// finish заполняет период отчета по датам строк
+func (r *Report) finish() {
+	for _, op := range r.Operations {
+		if op.Date.IsZero() {
+			continue
+		}
+		if r.DateFrom.IsZero() || op.Date.Before(r.DateFrom) {
+			r.DateFrom = op.Date
+		}
+		if op.Date.After(r.DateTo) {
+			r.DateTo = op.Date
+		}
+	}
+}
+
+// parseRubles разбирает сумму в рублях: число из ячейки Excel ("1234.5600000001") или текст ("1 234,56")
+func parseRubles(value string) (int64, bool) {
+	value = strings.NewReplacer(" ", "", " ", "", "₽", "").Replace(strings.TrimSpace(value))
+	value = strings.ReplaceAll(value, ",", ".")
+	if value == "" || value == "-" {
+		return 0, true
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int64(math.Round(f * 100)), true
+}
+
+// dateLayouts - форматы дат в отчетах, выгруженных как текст
+var dateLayouts = []string{
+	"2006-01-02", "2006-01-02T15:04:05", "2006-01-02 15:04:05", "02.01.2006", "02.01.2006 15:04:05", "02.01.2006 15:04",
+	time.RFC3339,
+}
+
+// parseDate разбирает дату ячейки: число дней Excel (45719) или текст
+func parseDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	if serial, err := strconv.ParseFloat(value, 64); err == nil {
+		// Даты Excel - дни от 30.12.1899; разумный диапазон - 2000-2100 годы
+		if serial < 36526 || serial > 73051 {
+			return time.Time{}, false
+		}
+		return time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(serial)), true
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), true
+		}
+	}
+	return time.Time{}, false
+}
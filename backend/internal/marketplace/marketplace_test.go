@@ -0,0 +1,115 @@
+package marketplace
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"alfa-hack-backend/internal/xlsx"
+)
+
+func workbook(rows ...[]string) *xlsx.Workbook {
+	sheet := xlsx.Sheet{Name: "Детализация"}
+	for i, cells := range rows {
+		sheet.Rows = append(sheet.Rows, xlsx.Row{Num: i + 1, Cells: cells})
+	}
+	return &xlsx.Workbook{Sheets: []xlsx.Sheet{sheet}}
+}
+
+func TestParseWildberries(t *testing.T) {
+	wb := workbook(
+		[]string{"Отчет о реализации № 123"},
+		[]string{"Обоснование для оплаты", "Код номенклатуры", "Артикул поставщика", "Название", "Дата продажи", "Кол-во",
+			"Вайлдберриз реализовал Товар (Пр)", "К перечислению Продавцу за реализованный Товар",
+			"Услуги по доставке товара покупателю", "Общая сумма штрафов", "Хранение"},
+		[]string{"Продажа", "111", "A-1", "Футболка", "2026-03-02", "1", "1000", "800", "0", "0", "0"},
+		[]string{"Продажа", "111", "A-1", "Футболка", "2026-03-03", "1", "1 000,00", "800,00", "", "", ""},
+		[]string{"Логистика", "111", "A-1", "Футболка", "2026-03-03", "0", "0", "0", "75", "0", "0"},
+		[]string{"Возврат", "111", "A-1", "Футболка", "2026-03-05", "1", "1000", "800", "0", "0", "0"},
+		[]string{"Штраф", "111", "A-1", "Футболка", "2026-03-06", "0", "0", "0", "0", "100", "0"},
+		[]string{"Хранение", "", "", "", "2026-03-07", "0", "0", "0", "0", "0", "50"},
+		[]string{"", "", "", "", "", "", "3000", "2400"},
+	)
+	report, err := Parse(wb)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if report.Marketplace != Wildberries || len(report.Operations) != 6 {
+		t.Fatalf("marketplace %s, %d operations", report.Marketplace, len(report.Operations))
+	}
+	if !report.DateFrom.Equal(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)) || !report.DateTo.Equal(time.Date(2026, 3, 7, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("period %s - %s", report.DateFrom, report.DateTo)
+	}
+
+	tests := []struct {
+		kind                          string
+		revenue, commission, payout   int64
+		logistics, penalties, storage int64
+	}{
+		{KindSale, 1000_00, 200_00, 800_00, 0, 0, 0},
+		{KindSale, 1000_00, 200_00, 800_00, 0, 0, 0},
+		{KindService, 0, 0, -75_00, 75_00, 0, 0},
+		{KindReturn, -1000_00, -200_00, -800_00, 0, 0, 0},
+		{KindService, 0, 0, -100_00, 0, 100_00, 0},
+		{KindService, 0, 0, -50_00, 0, 0, 50_00},
+	}
+	for i, tt := range tests {
+		op := report.Operations[i]
+		if op.Kind != tt.kind || op.Revenue != tt.revenue || op.Commission != tt.commission || op.Payout != tt.payout ||
+			op.Logistics != tt.logistics || op.Penalties != tt.penalties || op.Storage != tt.storage {
+			t.Errorf("operation %d = %+v", i, op)
+		}
+	}
+
+	s := Summarize(report.SKUs())
+	if s.Revenue != 1000_00 || s.Payout != 575_00 || s.Sold != 2 || s.Returned != 1 || s.Unallocated != 50_00 {
+		t.Errorf("summary revenue %d, payout %d, sold %d, returned %d, unallocated %d",
+			s.Revenue, s.Payout, s.Sold, s.Returned, s.Unallocated)
+	}
+	if len(s.SKUs) != 1 || s.SKUs[0].Payout != 625_00 || s.SKUs[0].ReturnRate() != 0.5 {
+		t.Errorf("skus = %+v", s.SKUs)
+	}
+}
+
+func TestParseOzon(t *testing.T) {
+	wb := workbook(
+		[]string{"Дата начисления", "Тип начисления", "SKU", "Артикул", "Название товара", "Количество",
+			"Вознаграждение Ozon", "Последняя миля", "Магистраль", "Итого"},
+		[]string{"02.03.2026", "Доставка покупателю", "222", "B-1", "Кружка", "1", "-150", "-30", "-20", "800"},
+		[]string{"04.03.2026", "Получение возврата, отмены и невыкупа от покупателя", "222", "B-1", "Кружка", "1", "150", "0", "0", "-850"},
+		[]string{"05.03.2026", "Услуга размещения товаров на складе", "", "", "", "", "0", "0", "0", "-30"},
+		[]string{"06.03.2026", "Услуга продвижения", "222", "B-1", "Кружка", "", "0", "0", "0", "-40"},
+	)
+	report, err := Parse(wb)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if report.Marketplace != Ozon || len(report.Operations) != 4 {
+		t.Fatalf("marketplace %s, %d operations", report.Marketplace, len(report.Operations))
+	}
+	tests := []struct {
+		kind                        string
+		revenue, commission, payout int64
+		logistics, storage, other   int64
+	}{
+		// Выручка восстанавливается из итога: 800 + 150 + 30 + 20
+		{KindSale, 1000_00, 150_00, 800_00, 50_00, 0, 0},
+		{KindReturn, -1000_00, -150_00, -850_00, 0, 0, 0},
+		{KindService, 0, 0, -30_00, 0, 30_00, 0},
+		{KindService, 0, 0, -40_00, 0, 0, 40_00},
+	}
+	for i, tt := range tests {
+		op := report.Operations[i]
+		if op.Kind != tt.kind || op.Revenue != tt.revenue || op.Commission != tt.commission || op.Payout != tt.payout ||
+			op.Logistics != tt.logistics || op.Storage != tt.storage || op.Other != tt.other {
+			t.Errorf("operation %d = %+v", i, op)
+		}
+	}
+}
+
+func TestParseUnknown(t *testing.T) {
+	wb := workbook([]string{"Дата", "Сумма"}, []string{"2026-03-01", "100"})
+	if _, err := Parse(wb); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Parse of a plain table: %v", err)
+	}
+}
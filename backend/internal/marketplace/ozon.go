@@ -0,0 +1,95 @@
+package marketplace
+
+import (
+	"alfa-hack-backend/internal/xlsx"
+	"fmt"
+	"strings"
+)
+
+// Отчет Ozon по начислениям (детализация "Финансы - Начисления"): строка на начисление
+// с типом ("Доставка покупателю", "Получение возврата, отмены и невыкупа от покупателя",
+// "Услуга продвижения"...), вознаграждением Ozon, услугами логистики отдельными столбцами
+// и итогом. Удержания в отчете отрицательные, итог - сумма для продавца со знаком.
+
+var ozonColumns = []column{
+	{field: "type", headers: []string{"тип начисления", "тип операции"}},
+	{field: "date", headers: []string{"дата начисления", "дата операции"}},
+	{field: "sku", headers: []string{"sku", "ozon sku"}},
+	{field: "article", headers: []string{"артикул", "артикул продавца"}},
+	{field: "name", headers: []string{"название товара", "наименование товара", "товар"}},
+	{field: "quantity", headers: []string{"количество", "кол-во"}},
+	{field: "commission", headers: []string{"вознаграждение ozon", "комиссия за продажу"}},
+	{field: "logistics", headers: []string{
+		"сборка заказа", "магистраль", "последняя миля", "обратная магистраль", "обработка возврата",
+		"логистика", "обратная логистика", "доставка до места выдачи",
+	}, prefix: []string{"обработка отправления", "обработка отмененного", "обработка невыкупленного"}},
+	{field: "total", headers: []string{"итого", "итого, руб.", "сумма итого", "итого руб"}},
+}
+
+func isOzon(columns map[string][]int) bool {
+	_, hasType := columns["type"]
+	_, hasTotal := columns["total"]
+	_, hasSKU := columns["sku"]
+	_, hasArticle := columns["article"]
+	return hasType && hasTotal && (hasSKU || hasArticle)
+}
+
+func parseOzon(rows []xlsx.Row, columns map[string][]int) *Report {
+	report := &Report{Marketplace: Ozon}
+	for _, sheetRow := range rows {
+		r := row{cells: sheetRow.Cells, columns: columns}
+		accrual := r.text("type")
+		if accrual == "" {
+			continue
+		}
+		op := Operation{
+			Kind:     ozonKind(accrual),
+			Type:     accrual,
+			SKU:      r.text("sku"),
+			Article:  r.text("article"),
+			Name:     r.text("name"),
+			Quantity: r.quantity("quantity"),
+		}
+		op.Date, _ = parseDate(r.text("date"))
+
+		total, ok := r.amount("total")
+		if !ok {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("Строка %d: неверная сумма %q", sheetRow.Num, r.text("total")))
+			continue
+		}
+		commission, _ := r.amount("commission")
+		logistics, _ := r.amount("logistics")
+		op.Payout = total
+		op.Commission = -commission
+		op.Logistics = -logistics
+
+		lower := strings.ToLower(accrual)
+		switch {
+		case op.Kind != KindService:
+			// Выручка восстанавливается из итога: итог = цена продавца - вознаграждение - логистика
+			op.Revenue = total + op.Commission + op.Logistics
+		case strings.Contains(lower, "хранен") || strings.Contains(lower, "размещени"):
+			op.Storage = -total - op.Commission - op.Logistics
+		case strings.Contains(lower, "штраф"):
+			op.Penalties = -total - op.Commission - op.Logistics
+		default:
+			op.Other = -total - op.Commission - op.Logistics
+		}
+		report.Operations = append(report.Operations, op)
+	}
+	return report
+}
+
+// ozonKind - вид строки по типу начисления
+func ozonKind(accrual string) string {
+	accrual = strings.ToLower(strings.TrimSpace(accrual))
+	switch {
+	case strings.HasPrefix(accrual, "получение возврата"), strings.HasPrefix(accrual, "возврат выручки"),
+		strings.HasPrefix(accrual, "возврат товара"), strings.Contains(accrual, "отмена начисления"):
+		return KindReturn
+	case strings.HasPrefix(accrual, "доставка покупателю"), strings.HasPrefix(accrual, "выручка"),
+		strings.HasPrefix(accrual, "продажа"):
+		return KindSale
+	}
+	return KindService
+}
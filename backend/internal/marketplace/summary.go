@@ -0,0 +1,191 @@
+package marketplace
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Пороги, после которых по артикулу выдаются предупреждения
+const (
+	highReturnRate     = 0.2  // доля возвратов от продаж
+	highLogisticsShare = 0.25 // доля логистики в выручке
+	highCommission     = 0.3  // доля комиссии в выручке
+	minIssueSales      = 3    // меньше продаж - выводы по артикулу не делаются
+)
+
+// SKU - юнит-экономика артикула за период. Суммы в копейках, как в Operation. Себестоимость
+// товара в отчетах маркетплейсов нет, поэтому выплата - это деньги до вычета закупки.
+// Строка с пустым SKU - удержания без привязки к товару (хранение, продвижение, подписка).
+type SKU struct {
+	Marketplace string
+	SKU         string
+	Article     string
+	Name        string
+	Sold        int
+	Returned    int
+	Revenue     int64
+	Commission  int64
+	Logistics   int64
+	Penalties   int64
+	Storage     int64
+	Other       int64
+	Payout      int64
+}
+
+// Units - продано за вычетом возвратов
+func (s SKU) Units() int {
+	return s.Sold - s.Returned
+}
+
+// PayoutPerUnit - выплата на единицу проданного товара; 0, если продаж за вычетом возвратов нет
+func (s SKU) PayoutPerUnit() int64 {
+	if s.Units() <= 0 {
+		return 0
+	}
+	return s.Payout / int64(s.Units())
+}
+
+// ReturnRate - доля возвратов от продаж
+func (s SKU) ReturnRate() float64 {
+	if s.Sold == 0 {
+		return 0
+	}
+	return float64(s.Returned) / float64(s.Sold)
+}
+
+// Issues - проблемы артикула, на которые стоит обратить внимание
+func (s SKU) Issues() []string {
+	var issues []string
+	if s.Sold < minIssueSales {
+		if s.Sold == 0 && s.Returned > 0 {
+			issues = append(issues, "только возвраты, продаж нет")
+		}
+		return issues
+	}
+	if s.Payout <= 0 {
+		issues = append(issues, "удержания маркетплейса больше выручки, выплата не положительная")
+	}
+	if rate := s.ReturnRate(); rate >= highReturnRate {
+		issues = append(issues, fmt.Sprintf("много возвратов: %.0f%%", rate*100))
+	}
+	if s.Revenue > 0 {
+		if share := float64(s.Logistics) / float64(s.Revenue); share >= highLogisticsShare {
+			issues = append(issues, fmt.Sprintf("логистика %.0f%% выручки", share*100))
+		}
+		if share := float64(s.Commission) / float64(s.Revenue); share >= highCommission {
+			issues = append(issues, fmt.Sprintf("комиссия %.0f%% выручки", share*100))
+		}
+	}
+	return issues
+}
+
+func (s *SKU) add(other SKU) {
+	s.Sold += other.Sold
+	s.Returned += other.Returned
+	s.Revenue += other.Revenue
+	s.Commission += other.Commission
+	s.Logistics += other.Logistics
+	s.Penalties += other.Penalties
+	s.Storage += other.Storage
+	s.Other += other.Other
+	s.Payout += other.Payout
+	if s.Article == "" {
+		s.Article = other.Article
+	}
+	if s.Name == "" {
+		s.Name = other.Name
+	}
+}
+
+// SKUs - строки отчета, сложенные по артикулам, в порядке первого появления
+func (r *Report) SKUs() []SKU {
+	var result []SKU
+	index := make(map[string]int)
+	for _, op := range r.Operations {
+		key := op.SKU
+		if key == "" {
+			key = op.Article
+		}
+		sku := SKU{
+			Marketplace: r.Marketplace, SKU: key, Article: op.Article, Name: op.Name,
+			Revenue: op.Revenue, Commission: op.Commission, Logistics: op.Logistics, Penalties: op.Penalties,
+			Storage: op.Storage, Other: op.Other, Payout: op.Payout,
+		}
+		switch op.Kind {
+		case KindSale:
+			sku.Sold = op.Quantity
+		case KindReturn:
+			sku.Returned = op.Quantity
+		}
+		if i, ok := index[key]; ok {
+			result[i].add(sku)
+			continue
+		}
+		index[key] = len(result)
+		result = append(result, sku)
+	}
+	return result
+}
+
+// Summary - итоги отчетов за период
+type Summary struct {
+	DateFrom     time.Time
+	DateTo       time.Time
+	Marketplaces []string
+	Revenue      int64
+	Commission   int64
+	Logistics    int64
+	Penalties    int64
+	Storage      int64
+	Other        int64
+	Payout       int64 // чистая выплата продавцу
+	Sold         int
+	Returned     int
+	Unallocated  int64 // удержания без привязки к товару
+	SKUs         []SKU // по убыванию выплаты, без строки удержаний без товара
+}
+
+// ReturnRate - доля возвратов от продаж
+func (s Summary) ReturnRate() float64 {
+	if s.Sold == 0 {
+		return 0
+	}
+	return float64(s.Returned) / float64(s.Sold)
+}
+
+// Summarize складывает артикулы одного или нескольких отчетов
+func Summarize(skus []SKU) Summary {
+	var s Summary
+	index := make(map[string]int)
+	marketplaces := make(map[string]bool)
+	for _, sku := range skus {
+		s.Revenue += sku.Revenue
+		s.Commission += sku.Commission
+		s.Logistics += sku.Logistics
+		s.Penalties += sku.Penalties
+		s.Storage += sku.Storage
+		s.Other += sku.Other
+		s.Payout += sku.Payout
+		s.Sold += sku.Sold
+		s.Returned += sku.Returned
+		if !marketplaces[sku.Marketplace] {
+			marketplaces[sku.Marketplace] = true
+			s.Marketplaces = append(s.Marketplaces, sku.Marketplace)
+		}
+		if sku.SKU == "" {
+			s.Unallocated -= sku.Payout
+			continue
+		}
+		key := sku.Marketplace + "|" + sku.SKU
+		if i, ok := index[key]; ok {
+			s.SKUs[i].add(sku)
+			continue
+		}
+		index[key] = len(s.SKUs)
+		s.SKUs = append(s.SKUs, sku)
+	}
+	sort.Strings(s.Marketplaces)
+	sort.SliceStable(s.SKUs, func(i, j int) bool { return s.SKUs[i].Payout > s.SKUs[j].Payout })
+	return s
+}
@@ -0,0 +1,116 @@
+package marketplace
+
+import (
+	"alfa-hack-backend/internal/xlsx"
+	"fmt"
+	"strings"
+)
+
+// Еженедельный детализированный отчет Wildberries о реализации: строка на продажу, возврат,
+// логистику, штраф или удержание. "Обоснование для оплаты" определяет вид строки,
+// "К перечислению продавцу" - сумму за товар после вознаграждения WB и эквайринга,
+// а логистика, штрафы, хранение и удержания вычитаются из нее отдельными столбцами.
+
+var wildberriesColumns = []column{
+	{field: "reason", headers: []string{"обоснование для оплаты"}},
+	{field: "doc_type", headers: []string{"тип документа"}},
+	{field: "sku", headers: []string{"код номенклатуры", "артикул wb", "nm id"}},
+	{field: "article", headers: []string{"артикул поставщика", "артикул продавца"}},
+	{field: "name", headers: []string{"название", "наименование"}},
+	{field: "subject", headers: []string{"предмет"}},
+	{field: "sale_date", headers: []string{"дата продажи"}},
+	{field: "order_date", headers: []string{"дата заказа покупателем", "дата заказа"}},
+	{field: "quantity", headers: []string{"кол-во", "количество"}},
+	{field: "retail", prefix: []string{"вайлдберриз реализовал товар", "wildberries реализовал товар"}},
+	{field: "retail_price", headers: []string{"цена розничная с учетом согласованной скидки"}},
+	{field: "for_pay", prefix: []string{"к перечислению продавцу за реализованный товар", "к перечислению продавцу"}},
+	{field: "delivery", prefix: []string{"услуги по доставке товара покупателю"}},
+	{field: "penalty", headers: []string{"общая сумма штрафов", "штрафы"}},
+	{field: "surcharge", headers: []string{"доплаты"}},
+	{field: "storage", headers: []string{"хранение", "стоимость хранения"}},
+	{field: "deduction", headers: []string{"удержания", "прочие удержания"}},
+	{field: "acceptance", headers: []string{"платная приемка", "стоимость платной приемки"}},
+}
+
+func isWildberries(columns map[string][]int) bool {
+	_, hasReason := columns["reason"]
+	_, hasPay := columns["for_pay"]
+	return hasReason && hasPay
+}
+
+func parseWildberries(rows []xlsx.Row, columns map[string][]int) *Report {
+	report := &Report{Marketplace: Wildberries}
+	for _, sheetRow := range rows {
+		r := row{cells: sheetRow.Cells, columns: columns}
+		reason := r.text("reason")
+		if reason == "" {
+			// Итоговые строки внизу отчета
+			continue
+		}
+		op := Operation{
+			Kind:     wildberriesKind(reason),
+			Type:     reason,
+			SKU:      r.text("sku"),
+			Article:  r.text("article"),
+			Name:     r.text("name"),
+			Quantity: r.quantity("quantity"),
+		}
+		if op.Name == "" {
+			op.Name = r.text("subject")
+		}
+		if date, ok := parseDate(r.text("sale_date")); ok {
+			op.Date = date
+		} else if date, ok := parseDate(r.text("order_date")); ok {
+			op.Date = date
+		}
+
+		amounts := make(map[string]int64)
+		valid := true
+		for _, field := range []string{"retail", "retail_price", "for_pay", "delivery", "penalty", "surcharge", "storage", "deduction", "acceptance"} {
+			value, ok := r.amount(field)
+			if !ok {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("Строка %d: неверная сумма в столбце %q", sheetRow.Num, r.text(field)))
+				valid = false
+				break
+			}
+			amounts[field] = value
+		}
+		if !valid {
+			continue
+		}
+		retail := amounts["retail"]
+		if retail == 0 && op.Kind != KindService {
+			retail = amounts["retail_price"] * int64(op.Quantity)
+		}
+
+		op.Logistics = amounts["delivery"]
+		op.Penalties = amounts["penalty"]
+		op.Storage = amounts["storage"]
+		op.Other = amounts["deduction"] + amounts["acceptance"] - amounts["surcharge"]
+		switch op.Kind {
+		case KindSale:
+			op.Revenue = retail
+			op.Commission = retail - amounts["for_pay"]
+		case KindReturn:
+			op.Revenue = -retail
+			op.Commission = -(retail - amounts["for_pay"])
+		default:
+			// Компенсации и прочие суммы к перечислению без продажи
+			op.Other -= amounts["for_pay"]
+		}
+		op.Payout = op.Revenue - op.Commission - op.Logistics - op.Penalties - op.Storage - op.Other
+		report.Operations = append(report.Operations, op)
+	}
+	return report
+}
+
+// wildberriesKind - вид строки по обоснованию для оплаты
+func wildberriesKind(reason string) string {
+	switch strings.ToLower(strings.TrimSpace(reason)) {
+	case "продажа", "корректная продажа", "сторно возвратов":
+		return KindSale
+	case "возврат", "корректный возврат", "сторно продаж":
+		return KindReturn
+	}
+	return KindService
+}
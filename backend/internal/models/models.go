@@ -15,10 +15,114 @@ type File struct {
 	ID         string    `json:"id"`
 	UserID     string    `json:"user_id"`
 	Filename   string    `json:"filename"`
-	FilePath   string    `json:"file_path"`
+	FilePath   string    `json:"file_path"` // ключ в хранилище файлов (storage.Storage), а не путь на диске
 	FileType   string    `json:"file_type"`
 	FileSize   int64     `json:"file_size"`
 	UploadedAt time.Time `json:"uploaded_at"`
+
+	// Версии: file_path, file_size и sha256 относятся к последней версии
+	SHA256        string `json:"sha256"`
+	Version       int    `json:"version"`
+	PinnedVersion int    `json:"pinned_version"` // 0 - для анализа используется последняя версия
+
+	// Описание файла пользователем; вид документа и период определяются автоматически,
+	// пока пользователь не задаст их сам
+	Folder      string   `json:"folder"` // путь папки через "/", пустая строка - корень
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Period      string   `json:"period"`   // "2024-12", "2024-Q4" или "2024"
+	DocKind     string   `json:"doc_kind"` // sales_report, payroll, contract, bank_statement, invoice, other
+	PeriodAuto  bool     `json:"period_auto"`
+	DocKindAuto bool     `json:"doc_kind_auto"`
+
+	// Обработка последней версии: queued, processing, done или failed
+	Status      string `json:"status"`
+	StatusError string `json:"status_error,omitempty"`
+}
+
+// IngestJob - фоновая обработка версии файла: разбор, нормализация и нарезка на фрагменты для промпта
+type IngestJob struct {
+	FileID        string     `json:"file_id"`
+	Version       int        `json:"version"`
+	Status        string     `json:"status"` // queued, processing, done, failed
+	Error         string     `json:"error,omitempty"`
+	Warnings      []string   `json:"warnings"`
+	TotalChars    int        `json:"total_chars"`
+	IncludedChars int        `json:"included_chars"`
+	Chunks        int        `json:"chunks"`
+	Truncated     bool       `json:"truncated"`
+	Attempts      int        `json:"attempts"`
+	CreatedAt     time.Time  `json:"created_at"`
+	StartedAt     *time.Time `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+}
+
+// Transaction - операция по счету из загруженной банковской выписки
+type Transaction struct {
+	ID                  int64   `json:"id"`
+	FileID              string  `json:"file_id"`
+	Date                string  `json:"date"`   // YYYY-MM-DD
+	Amount              float64 `json:"amount"` // всегда положительная, знак - direction
+	Currency            string  `json:"currency"`
+	Direction           string  `json:"direction"` // in - поступление, out - списание
+	Internal            bool    `json:"internal"`  // перевод между собственными счетами
+	Account             string  `json:"account"`
+	Counterparty        string  `json:"counterparty"`
+	CounterpartyINN     string  `json:"counterparty_inn"`
+	CounterpartyAccount string  `json:"counterparty_account"`
+	Purpose             string  `json:"purpose"`
+	DocNumber           string  `json:"doc_number"`
+	DocType             string  `json:"doc_type"`
+	MCC                 string  `json:"mcc"`
+	Category            string  `json:"category"` // код категории, пустой - не определена
+	CategoryName        string  `json:"category_name"`
+	CategorySource      string  `json:"category_source"` // user, user_rule, rule, internal или llm
+}
+
+// TransactionFilter - отбор операций (пустые поля не учитываются)
+type TransactionFilter struct {
+	From      string `form:"from"`   // YYYY-MM-DD включительно
+	To        string `form:"to"`     // YYYY-MM-DD включительно
+	Period    string `form:"period"` // YYYY-MM, YYYY-Qn или YYYY вместо from/to
+	Direction string `form:"direction"`
+	Currency  string `form:"currency"`
+	Category  string `form:"category"`
+	INN       string `form:"inn"`
+	FileID    string `form:"file_id"`
+	Internal  bool   `form:"internal"` // включать переводы между собственными счетами
+}
+
+// FileFilter - отбор файлов по папке, тегам, виду документа и периоду (пустые поля не учитываются)
+type FileFilter struct {
+	Folder  string   `json:"folder" form:"folder"` // папка вместе с вложенными
+	Tags    []string `json:"tags" form:"tag"`      // файл должен иметь все указанные теги
+	DocKind string   `json:"doc_kind" form:"doc_kind"`
+	Period  string   `json:"period" form:"period"` // период файла должен целиком входить в указанный
+}
+
+// IsEmpty - в фильтре не задано ни одного условия
+func (f FileFilter) IsEmpty() bool {
+	return f.Folder == "" && len(f.Tags) == 0 && f.DocKind == "" && f.Period == ""
+}
+
+// UpdateFileRequest - изменение описания файла; не указанные поля не меняются
+type UpdateFileRequest struct {
+	Folder      *string   `json:"folder"`
+	Description *string   `json:"description"`
+	Tags        *[]string `json:"tags"`
+	Period      *string   `json:"period"`   // пустая строка - определить автоматически
+	DocKind     *string   `json:"doc_kind"` // пустая строка - определить автоматически
+}
+
+// FileVersion - одна из загруженных версий файла
+type FileVersion struct {
+	ID         string    `json:"id"`
+	FileID     string    `json:"file_id"`
+	Version    int       `json:"version"`
+	FilePath   string    `json:"-"`
+	FileSize   int64     `json:"file_size"`
+	SHA256     string    `json:"sha256"`
+	UploadedAt time.Time `json:"uploaded_at"`
 }
 
 type Chat struct {
@@ -37,6 +141,55 @@ type Message struct {
 	Response  string    `json:"response"`
 	Category  string    `json:"category"`
 	CreatedAt time.Time `json:"created_at"`
+
+	// Категория выбрана пользователем (explicit) или определена автоматически
+	CategoryConfidence float64 `json:"category_confidence"`
+	CategoryMethod     string  `json:"category_method"`
+
+	// Метаданные генерации ответа
+	Provider         string   `json:"provider"`
+	Model            string   `json:"model"`
+	PromptTokens     int      `json:"prompt_tokens"`
+	CompletionTokens int      `json:"completion_tokens"`
+	LatencyMs        int64    `json:"latency_ms"`
+	FallbackAttempts int      `json:"fallback_attempts"`
+	IsFallback       bool     `json:"is_fallback"`
+	Source           string   `json:"source"`
+	DegradedReason   string   `json:"degraded_reason"`
+	Sources          []Source `json:"sources"`
+	PromptVersion    string   `json:"prompt_version"`
+
+	// Файлы, которые были в контексте ответа, и как они выбраны: all, chat или message
+	Files     []FileRef `json:"files"`
+	FileScope string    `json:"file_scope"`
+}
+
+// FileRef - файл (и его версия), использованный при ответе
+type FileRef struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	Version  int    `json:"version"`
+}
+
+// Source - место в загруженном файле, на которое сослался AI в ответе
+type Source struct {
+	Tag      string `json:"tag"`
+	FileID   string `json:"file_id"`
+	Filename string `json:"filename"`
+	Sheet    string `json:"sheet"`
+	Page     int    `json:"page"`
+	RowStart int    `json:"row_start"`
+	RowEnd   int    `json:"row_end"`
+}
+
+// UsageStats - суммарное использование AI пользователем
+type UsageStats struct {
+	Messages         int   `json:"messages"`
+	PromptTokens     int   `json:"prompt_tokens"`
+	CompletionTokens int   `json:"completion_tokens"`
+	TotalTokens      int   `json:"total_tokens"`
+	FallbackMessages int   `json:"fallback_messages"`
+	AvgLatencyMs     int64 `json:"avg_latency_ms"`
 }
 
 type RegisterRequest struct {
@@ -46,18 +199,46 @@ type RegisterRequest struct {
 	Specialization string `json:"specialization" binding:"required"`
 }
 
+// UpdateProfileRequest - изменение профиля бизнеса; поля, которых нет в запросе, не меняются
+type UpdateProfileRequest struct {
+	BusinessName    *string  `json:"business_name"`
+	Specialization  *string  `json:"specialization"`
+	TaxRegime       *string  `json:"tax_regime"`       // usn_income, usn_income_expense, psn, npd, osno; пустая строка - не указана
+	LegalForm       *string  `json:"legal_form"`       // ip или org
+	TaxRate         *float64 `json:"tax_rate"`         // ставка региона для УСН и ПСН, %; 0 - общая ставка
+	PatentIncome    *float64 `json:"patent_income"`    // потенциально возможный годовой доход по патенту, рубли
+	PatentMonths    *int     `json:"patent_months"`    // срок патента в месяцах, 0 - весь год
+	Region          *string  `json:"region"`           // двузначный код региона, например 77 - Москва
+	Employees       *int     `json:"employees"`        // число сотрудников; -1 - по спискам сотрудников
+	PayrollSME      *bool    `json:"payroll_sme"`      // субъект МСП: пониженный тариф взносов
+	PayrollPriority *bool    `json:"payroll_priority"` // МСП из приоритетной отрасли (обрабатывающие производства и др.)
+	InjuryRate      *float64 `json:"injury_rate"`      // тариф взносов на травматизм, %
+}
+
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
 type ChatRequest struct {
-	Message  string `json:"message" binding:"required"`
-	Category string `json:"category"`
-	ChatID   string `json:"chat_id"`
+	Message  string   `json:"message" binding:"required"`
+	Category string   `json:"category"`
+	ChatID   string   `json:"chat_id"`
+	FileIDs  []string `json:"file_ids"` // файлы только для этого сообщения; не указано - файлы чата или все
+	// Отбор файлов для этого сообщения по папке, тегам, виду и периоду (если file_ids не указаны)
+	FileFilter *FileFilter `json:"file_filter"`
 }
 
 type CreateChatRequest struct {
-	Title string `json:"title"`
+	Title   string   `json:"title"`
+	FileIDs []string `json:"file_ids"` // файлы, прикрепленные к чату
+}
+
+type ChatFilesRequest struct {
+	FileIDs []string `json:"file_ids"` // пустой список - использовать все файлы
+}
+
+type PinVersionRequest struct {
+	Version int `json:"version"` // 0 - снять закрепление
 }
 
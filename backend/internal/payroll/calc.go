@@ -0,0 +1,243 @@
+package payroll
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Расчет исходит из того, что сотрудник - налоговый резидент РФ без стандартных вычетов по НДФЛ,
+// работает по основному месту работы и получает только оклад: премии, отпускные, больничные
+// и районные коэффициенты не учитываются. Оклад за неполный месяц (прием или увольнение)
+// считается пропорционально календарным дням.
+
+// Bracket - ступень шкалы НДФЛ: ставка для дохода с начала года до Upper (0 - без ограничения)
+type Bracket struct {
+	Upper int64
+	Rate  float64
+}
+
+// Rates - параметры года для расчета. Суммы в копейках.
+type Rates struct {
+	Year int
+	// MROT - федеральный МРОТ на 1 января
+	MROT int64
+	// BaseLimit - предельная база страховых взносов: сверх нее общий тариф 30% снижается до 15,1%
+	BaseLimit int64
+	// SMEThreshold - для МСП выплаты за месяц сверх SMEThreshold МРОТ облагаются по тарифу 15%
+	SMEThreshold float64
+	// SMEPriorityOnly - пониженный тариф только у МСП из приоритетных отраслей (обрабатывающие
+	// производства и другие отрасли из перечня), остальные МСП платят по общему тарифу
+	SMEPriorityOnly bool
+	NDFL            []Bracket
+}
+
+// ratesByYear - параметры по годам. Новый год нужно добавлять сюда: для лет, которых нет в таблице,
+// используются параметры ближайшего года.
+var ratesByYear = map[int]Rates{
+	2024: {
+		Year: 2024, MROT: 19242_00, BaseLimit: 2_225_000_00, SMEThreshold: 1,
+		NDFL: []Bracket{{Upper: 5_000_000_00, Rate: 0.13}, {Rate: 0.15}},
+	},
+	2025: {
+		Year: 2025, MROT: 22440_00, BaseLimit: 2_759_000_00, SMEThreshold: 1.5,
+		NDFL: progressiveNDFL,
+	},
+	2026: {
+		Year: 2026, MROT: 27093_00, BaseLimit: 2_979_000_00, SMEThreshold: 1.5, SMEPriorityOnly: true,
+		NDFL: progressiveNDFL,
+	},
+}
+
+// progressiveNDFL - пятиступенчатая шкала НДФЛ с 2025 года
+var progressiveNDFL = []Bracket{
+	{Upper: 2_400_000_00, Rate: 0.13}, {Upper: 5_000_000_00, Rate: 0.15}, {Upper: 20_000_000_00, Rate: 0.18},
+	{Upper: 50_000_000_00, Rate: 0.20}, {Rate: 0.22},
+}
+
+// Тарифы страховых взносов
+const (
+	generalRate      = 0.30  // единый тариф в пределах базы
+	aboveLimitRate   = 0.151 // сверх предельной базы
+	smeReducedRate   = 0.15  // МСП: часть выплаты сверх порога из МРОТ
+	DefaultInjuryPct = 0.2   // взносы на травматизм для I класса профессионального риска, %
+)
+
+// RatesFor - параметры года; exact=false, если года нет в таблице и взяты параметры ближайшего
+func RatesFor(year int) (rates Rates, exact bool) {
+	if rates, ok := ratesByYear[year]; ok {
+		return rates, true
+	}
+	years := make([]int, 0, len(ratesByYear))
+	for y := range ratesByYear {
+		years = append(years, y)
+	}
+	sort.Ints(years)
+	nearest := years[0]
+	for _, y := range years {
+		if y <= year {
+			nearest = y
+		}
+	}
+	return ratesByYear[nearest], false
+}
+
+// Settings - условия работодателя
+type Settings struct {
+	SME       bool    // субъект МСП: пониженный тариф взносов
+	Priority  bool    // МСП из приоритетной отрасли: пониженный тариф и после его отмены для остальных МСП
+	InjuryPct float64 // тариф взносов на травматизм, %
+}
+
+// DefaultSettings - малый бизнес не из приоритетной отрасли с минимальным тарифом на травматизм
+var DefaultSettings = Settings{SME: true, InjuryPct: DefaultInjuryPct}
+
+// Reduced - применяется ли пониженный тариф МСП в году с параметрами rates
+func (s Settings) Reduced(rates Rates) bool {
+	return s.SME && (!rates.SMEPriorityOnly || s.Priority)
+}
+
+// MonthCost - зарплата сотрудника за месяц. Суммы в копейках.
+type MonthCost struct {
+	Employee      Employee
+	Month         time.Time // первое число месяца
+	Days          int       // оплаченные календарные дни; меньше дней месяца при приеме или увольнении
+	MonthDays     int
+	Gross         int64 // начислено
+	NDFL          int64 // удержано из начисленного
+	Net           int64 // на руки
+	Contributions int64 // страховые взносы по единому тарифу
+	Injury        int64 // взносы на травматизм
+	Cost          int64 // стоимость для работодателя: начислено + взносы
+	YearGross     int64 // начислено с начала года, включая месяц
+}
+
+// accrual - оклад за месяц пропорционально дням работы
+func accrual(e Employee, month time.Time) (gross int64, days, monthDays int) {
+	first := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1)
+	monthDays = last.Day()
+	from, to := first, last
+	if !e.HireDate.IsZero() && e.HireDate.After(from) {
+		from = e.HireDate
+	}
+	if !e.FireDate.IsZero() && e.FireDate.Before(to) {
+		to = e.FireDate
+	}
+	if to.Before(from) {
+		return 0, 0, monthDays
+	}
+	days = int(to.Sub(from).Hours()/24) + 1
+	if days == monthDays {
+		return e.Salary, days, monthDays
+	}
+	return int64(math.Round(float64(e.Salary) * float64(days) / float64(monthDays))), days, monthDays
+}
+
+// Calculate считает зарплату сотрудника за месяц. НДФЛ и предельная база взносов считаются
+// нарастающим итогом с начала года, поэтому учитываются начисления за предыдущие месяцы.
+func Calculate(e Employee, month time.Time, settings Settings) MonthCost {
+	rates, _ := RatesFor(month.Year())
+	var yearGross, yearNDFL, yearBase int64
+	var result MonthCost
+	for m := 1; m <= int(month.Month()); m++ {
+		current := time.Date(month.Year(), time.Month(m), 1, 0, 0, 0, 0, time.UTC)
+		gross, days, monthDays := accrual(e, current)
+		yearGross += gross
+		ndfl := ndflFor(yearGross, rates) - yearNDFL
+		yearNDFL += ndfl
+		contributions := contributionsFor(gross, yearBase, rates, settings)
+		yearBase += gross
+		injury := int64(math.Round(float64(gross) * settings.InjuryPct / 100))
+		result = MonthCost{
+			Employee: e, Month: current, Days: days, MonthDays: monthDays,
+			Gross: gross, NDFL: ndfl, Net: gross - ndfl, Contributions: contributions, Injury: injury,
+			Cost: gross + contributions + injury, YearGross: yearGross,
+		}
+	}
+	return result
+}
+
+// NDFL - НДФЛ с дохода за год по шкале года, в полных рублях. Доходы ИП на общей системе
+// облагаются по той же шкале.
+func NDFL(income int64, year int) int64 {
+	rates, _ := RatesFor(year)
+	return ndflFor(income, rates)
+}
+
+// ndflFor - НДФЛ с дохода с начала года по шкале года, в полных рублях
+func ndflFor(income int64, rates Rates) int64 {
+	var tax float64
+	var lower int64
+	for _, bracket := range rates.NDFL {
+		upper := bracket.Upper
+		if upper == 0 || income < upper {
+			upper = income
+		}
+		if upper > lower {
+			tax += float64(upper-lower) * bracket.Rate
+		}
+		if bracket.Upper == 0 || income <= bracket.Upper {
+			break
+		}
+		lower = bracket.Upper
+	}
+	return int64(math.Round(tax/100)) * 100
+}
+
+// contributionsFor - страховые взносы с выплаты за месяц; before - база с начала года до месяца
+func contributionsFor(gross, before int64, rates Rates, settings Settings) int64 {
+	general := gross
+	var reduced float64
+	if settings.Reduced(rates) {
+		threshold := int64(math.Round(float64(rates.MROT) * rates.SMEThreshold))
+		if gross > threshold {
+			general = threshold
+			reduced = float64(gross-threshold) * smeReducedRate
+		}
+	}
+	// Общий тариф до предельной базы, сверх нее - 15,1%
+	withinLimit := general
+	if remaining := rates.BaseLimit - before; remaining < withinLimit {
+		withinLimit = max(remaining, 0)
+	}
+	total := float64(withinLimit)*generalRate + float64(general-withinLimit)*aboveLimitRate + reduced
+	return int64(math.Round(total))
+}
+
+// Payroll - зарплата сотрудников за месяц
+type Payroll struct {
+	Month         time.Time
+	Rates         Rates
+	ExactRates    bool // параметры месяца известны; иначе взяты параметры ближайшего года
+	Settings      Settings
+	Employees     []MonthCost // работавшие в месяце, по убыванию стоимости
+	Gross         int64
+	NDFL          int64
+	Net           int64
+	Contributions int64
+	Injury        int64
+	Cost          int64
+}
+
+// Month считает зарплату всех сотрудников, работавших в месяце
+func Month(employees []Employee, month time.Time, settings Settings) Payroll {
+	month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	p := Payroll{Month: month, Settings: settings}
+	p.Rates, p.ExactRates = RatesFor(month.Year())
+	for _, e := range employees {
+		cost := Calculate(e, month, settings)
+		if cost.Gross == 0 {
+			continue
+		}
+		p.Employees = append(p.Employees, cost)
+		p.Gross += cost.Gross
+		p.NDFL += cost.NDFL
+		p.Net += cost.Net
+		p.Contributions += cost.Contributions
+		p.Injury += cost.Injury
+		p.Cost += cost.Cost
+	}
+	sort.SliceStable(p.Employees, func(i, j int) bool { return p.Employees[i].Cost > p.Employees[j].Cost })
+	return p
+}
@@ -0,0 +1,120 @@
+package payroll
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestNDFL(t *testing.T) {
+	tests := []struct {
+		income int64 // рубли за год
+		want   int64
+	}{
+		{1_000_000, 130_000},
+		{2_400_000, 312_000},    // граница первой ступени
+		{2_500_000, 327_000},    // 312 000 + 15% с 100 000
+		{5_000_000, 702_000},    // 312 000 + 15% с 2 600 000
+		{20_000_000, 3_402_000}, // 702 000 + 18% с 15 000 000
+	}
+	for _, tt := range tests {
+		if got := NDFL(tt.income*100, 2026); got != tt.want*100 {
+			t.Errorf("NDFL(%d) = %d, want %d", tt.income, got/100, tt.want)
+		}
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name          string
+		employee      Employee
+		month         time.Time
+		settings      Settings
+		gross         int64 // копейки
+		ndfl          int64
+		contributions int64
+		injury        int64
+	}{
+		{
+			name:     "МСП в 2025 году: 30% до 1,5 МРОТ и 15% сверх",
+			employee: Employee{Salary: 100_000_00},
+			month:    date(2025, time.March, 1), settings: DefaultSettings,
+			// 33 660 * 30% + 66 340 * 15%
+			gross: 100_000_00, ndfl: 13_000_00, contributions: 20_049_00, injury: 200_00,
+		},
+		{
+			name:     "МСП не из приоритетной отрасли в 2026 году: общий тариф",
+			employee: Employee{Salary: 100_000_00},
+			month:    date(2026, time.March, 1), settings: DefaultSettings,
+			gross: 100_000_00, ndfl: 13_000_00, contributions: 30_000_00, injury: 200_00,
+		},
+		{
+			name:     "МСП из приоритетной отрасли в 2026 году",
+			employee: Employee{Salary: 120_639_50},
+			month:    date(2026, time.March, 1), settings: Settings{SME: true, Priority: true, InjuryPct: 0.2},
+			// 40 639,50 * 30% + 80 000 * 15%
+			gross: 120_639_50, ndfl: 15_683_00, contributions: 24_191_85, injury: 241_28,
+		},
+		{
+			// Октябрь: доход с начала года 2 500 000, НДФЛ 327 000 минус 292 500 за сентябрь
+			name:     "переход границы 2,4 млн по НДФЛ",
+			employee: Employee{Salary: 250_000_00},
+			month:    date(2026, time.October, 1), settings: Settings{InjuryPct: 0.2},
+			gross: 250_000_00, ndfl: 34_500_00, contributions: 75_000_00, injury: 500_00,
+		},
+		{
+			// Октябрь: до предельной базы 2 979 000 осталось 279 000, сверх нее 15,1%
+			name:     "предельная база взносов",
+			employee: Employee{Salary: 300_000_00},
+			month:    date(2026, time.October, 1), settings: Settings{InjuryPct: 0.2},
+			gross: 300_000_00, ndfl: 45_000_00, contributions: 86_871_00, injury: 600_00,
+		},
+		{
+			// Прием 16 марта: 16 из 31 дня
+			name:     "неполный месяц",
+			employee: Employee{Salary: 31_000_00, HireDate: date(2026, time.March, 16)},
+			month:    date(2026, time.March, 1), settings: DefaultSettings,
+			gross: 16_000_00, ndfl: 2_080_00, contributions: 4_800_00, injury: 32_00,
+		},
+		{
+			name:     "уволен до месяца",
+			employee: Employee{Salary: 50_000_00, FireDate: date(2026, time.February, 28)},
+			month:    date(2026, time.March, 1), settings: DefaultSettings,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Calculate(tt.employee, tt.month, tt.settings)
+			if got.Gross != tt.gross || got.NDFL != tt.ndfl || got.Contributions != tt.contributions || got.Injury != tt.injury {
+				t.Errorf("gross %d, ndfl %d, contributions %d, injury %d; want %d, %d, %d, %d",
+					got.Gross, got.NDFL, got.Contributions, got.Injury, tt.gross, tt.ndfl, tt.contributions, tt.injury)
+			}
+			if got.Net != got.Gross-got.NDFL || got.Cost != got.Gross+got.Contributions+got.Injury {
+				t.Errorf("net %d, cost %d", got.Net, got.Cost)
+			}
+		})
+	}
+}
+
+func TestSettingsReduced(t *testing.T) {
+	rates2025, _ := RatesFor(2025)
+	rates2026, _ := RatesFor(2026)
+	tests := []struct {
+		settings Settings
+		rates    Rates
+		want     bool
+	}{
+		{Settings{SME: true}, rates2025, true},
+		{Settings{SME: true}, rates2026, false},
+		{Settings{SME: true, Priority: true}, rates2026, true},
+		{Settings{Priority: true}, rates2026, false},
+	}
+	for _, tt := range tests {
+		if got := tt.settings.Reduced(tt.rates); got != tt.want {
+			t.Errorf("%+v.Reduced(%d) = %v, want %v", tt.settings, tt.rates.Year, got, tt.want)
+		}
+	}
+}
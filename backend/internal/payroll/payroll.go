@@ -0,0 +1,257 @@
+// Package payroll разбирает списки сотрудников из кадровых файлов (штатное расписание, список
+// персонала в Excel или CSV) и считает по ним зарплату: НДФЛ, страховые взносы и полную стоимость
+// сотрудника для работодателя по месяцам.
+package payroll
+
+import (
+	"alfa-hack-backend/internal/xlsx"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// ErrUnknownFormat - в файле нет таблицы сотрудников
+var ErrUnknownFormat = errors.New("payroll: unknown staff list format")
+
+// Staff - сотрудники из кадрового файла
+type Staff struct {
+	Sheet     string // лист Excel, пустой для CSV
+	Employees []Employee
+	Warnings  []string
+}
+
+// Employee - сотрудник. Оклад в копейках за полный месяц; нулевая дата - не указана.
+type Employee struct {
+	Name     string
+	Position string
+	Salary   int64
+	HireDate time.Time
+	FireDate time.Time
+}
+
+// IsStaffType - в файлах с таким расширением может быть список сотрудников
+func IsStaffType(fileType string) bool {
+	return fileType == "xlsx" || fileType == "csv" || fileType == "txt"
+}
+
+// headerSearchRows - в скольких первых строках искать заголовок таблицы
+const headerSearchRows = 20
+
+// column - поле таблицы и варианты заголовка столбца (без учета регистра и лишних пробелов)
+type column struct {
+	field   string
+	headers []string // точное совпадение
+	prefix  []string // начало заголовка
+}
+
+var staffColumns = []column{
+	{field: "name", headers: []string{"фио", "ф.и.о.", "ф. и. о.", "сотрудник", "работник", "имя", "фамилия имя отчество"},
+		prefix: []string{"фио", "ф.и.о", "фамилия, имя", "фамилия имя"}},
+	{field: "position", headers: []string{"должность", "позиция", "профессия"}, prefix: []string{"должность", "наименование должности"}},
+	{field: "salary", headers: []string{"оклад", "зарплата", "зп", "з/п", "заработная плата", "ставка, руб."},
+		prefix: []string{"оклад", "должностной оклад", "зарплата", "заработная плата", "ежемесячная зарплата", "з/п"}},
+	{field: "hire", headers: []string{"принят", "дата начала работы"}, prefix: []string{"дата приема", "дата трудоустройства", "дата найма"}},
+	{field: "fire", headers: []string{"уволен"}, prefix: []string{"дата увольнения"}},
+}
+
+// ParseWorkbook ищет таблицу сотрудников на листах книги Excel
+func ParseWorkbook(wb *xlsx.Workbook) (*Staff, error) {
+	for _, sheet := range wb.Sheets {
+		rows := make([][]string, len(sheet.Rows))
+		nums := make([]int, len(sheet.Rows))
+		for i, row := range sheet.Rows {
+			rows[i], nums[i] = row.Cells, row.Num
+		}
+		if staff, err := parseRows(rows, nums); err == nil {
+			staff.Sheet = sheet.Name
+			return staff, nil
+		}
+	}
+	return nil, ErrUnknownFormat
+}
+
+// ParseText ищет таблицу сотрудников в CSV или тексте со столбцами через ";", ",", табуляцию или "|"
+// (так выглядят строки таблиц в разобранных файлах). Кодировка - UTF-8 или windows-1251.
+func ParseText(data []byte) (*Staff, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		decoded, err := charmap.Windows1251.NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, ErrUnknownFormat
+		}
+		data = decoded
+	}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	// Разделитель определяется по строке заголовка: над таблицей бывает название документа
+	for start := 0; start < len(lines) && start < headerSearchRows; start++ {
+		for _, delimiter := range []rune{';', '\t', '|', ','} {
+			header := splitLine(lines[start], delimiter)
+			columns := findColumns(header)
+			_, hasName := columns["name"]
+			_, hasSalary := columns["salary"]
+			if len(header) < 2 || !hasName || !hasSalary {
+				continue
+			}
+			var rows [][]string
+			var nums []int
+			for n, line := range lines[start+1:] {
+				rows = append(rows, splitLine(line, delimiter))
+				nums = append(nums, start+n+2)
+			}
+			return readEmployees(rows, nums, columns), nil
+		}
+	}
+	return nil, ErrUnknownFormat
+}
+
+// splitLine делит строку на ячейки; для ";", "," и табуляции учитываются кавычки CSV
+func splitLine(line string, delimiter rune) []string {
+	if delimiter == '|' {
+		return strings.Split(line, "|")
+	}
+	reader := csv.NewReader(strings.NewReader(line))
+	reader.Comma = delimiter
+	reader.LazyQuotes = true
+	record, err := reader.Read()
+	if err != nil {
+		return strings.Split(line, string(delimiter))
+	}
+	return record
+}
+
+// parseRows находит заголовок в первых строках и читает сотрудников. Заголовок должен содержать
+// ФИО и оклад, иначе это не список сотрудников.
+func parseRows(rows [][]string, nums []int) (*Staff, error) {
+	for i := 0; i < len(rows) && i < headerSearchRows; i++ {
+		columns := findColumns(rows[i])
+		_, hasName := columns["name"]
+		_, hasSalary := columns["salary"]
+		if hasName && hasSalary {
+			return readEmployees(rows[i+1:], nums[i+1:], columns), nil
+		}
+	}
+	return nil, ErrUnknownFormat
+}
+
+func findColumns(header []string) map[string]int {
+	columns := make(map[string]int)
+	for i, value := range header {
+		title := strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(strings.Trim(value, "\ufeff \""), "ё", "е")), " "))
+		if title == "" {
+			continue
+		}
+		for _, spec := range staffColumns {
+			if _, taken := columns[spec.field]; !taken && matchesColumn(title, spec) {
+				columns[spec.field] = i
+				break
+			}
+		}
+	}
+	return columns
+}
+
+func matchesColumn(title string, spec column) bool {
+	for _, header := range spec.headers {
+		if title == header {
+			return true
+		}
+	}
+	for _, prefix := range spec.prefix {
+		if strings.HasPrefix(title, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func readEmployees(rows [][]string, nums []int, columns map[string]int) *Staff {
+	staff := &Staff{}
+	seen := make(map[string]int)
+	cell := func(row []string, field string) string {
+		if i, ok := columns[field]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	for n, row := range rows {
+		name := strings.Join(strings.Fields(cell(row, "name")), " ")
+		lower := strings.ToLower(name)
+		if name == "" || strings.HasPrefix(lower, "итого") || strings.HasPrefix(lower, "всего") {
+			continue
+		}
+		e := Employee{Name: name, Position: cell(row, "position")}
+		salary, ok := parseRubles(cell(row, "salary"))
+		if !ok || salary <= 0 {
+			staff.Warnings = append(staff.Warnings, fmt.Sprintf("Строка %d: не указан оклад сотрудника %s (%q)", nums[n], name, cell(row, "salary")))
+			continue
+		}
+		e.Salary = salary
+		dates := []struct {
+			field  string
+			target *time.Time
+		}{{"hire", &e.HireDate}, {"fire", &e.FireDate}}
+		for _, d := range dates {
+			value := cell(row, d.field)
+			if value == "" {
+				continue
+			}
+			date, ok := parseDate(value)
+			if !ok {
+				staff.Warnings = append(staff.Warnings, fmt.Sprintf("Строка %d: неверная дата %q", nums[n], value))
+				continue
+			}
+			*d.target = date
+		}
+		// Один сотрудник в списке дважды - берем последнюю строку
+		key := strings.ToLower(e.Name)
+		if i, ok := seen[key]; ok {
+			staff.Employees[i] = e
+			continue
+		}
+		seen[key] = len(staff.Employees)
+		staff.Employees = append(staff.Employees, e)
+	}
+	return staff
+}
+
+// parseRubles разбирает сумму в рублях: число из ячейки Excel или текст ("55 000,00 ₽", "55000 руб.")
+func parseRubles(value string) (int64, bool) {
+	value = strings.NewReplacer(" ", "", " ", "", "₽", "", "руб.", "", "руб", "", "р.", "").Replace(strings.ToLower(value))
+	value = strings.ReplaceAll(value, ",", ".")
+	if value == "" {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int64(math.Round(f * 100)), true
+}
+
+// dateLayouts - форматы дат в кадровых файлах
+var dateLayouts = []string{"02.01.2006", "2.1.2006", "2006-01-02", "02.01.06", "02/01/2006"}
+
+// parseDate разбирает дату ячейки: число дней Excel (45719) или текст
+func parseDate(value string) (time.Time, bool) {
+	if serial, err := strconv.ParseFloat(value, 64); err == nil {
+		// Даты Excel - дни от 30.12.1899; разумный диапазон - 1950-2100 годы
+		if serial < 18264 || serial > 73051 {
+			return time.Time{}, false
+		}
+		return time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(serial)), true
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,61 @@
+package payroll
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+const staffCSV = "Список сотрудников ООО Ромашка\r\n" +
+	"ФИО;Должность;Оклад, руб.;Дата приема;Дата увольнения\r\n" +
+	"Иванов Иван Иванович;Бариста;50 000,00;01.02.2024;\r\n" +
+	"Петрова Анна;Управляющая;120000;15.10.2026;\r\n" +
+	"Сидоров Петр;Повар;60000 руб.;10.01.2025;05.10.2026\r\n" +
+	"Козлов;Уборщик;abc;;\r\n" +
+	"Итого;;230000;;\r\n"
+
+func TestParseText(t *testing.T) {
+	cp1251, err := charmap.Windows1251.NewEncoder().Bytes([]byte(staffCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"utf-8", []byte(staffCSV)},
+		{"windows-1251", cp1251},
+	}
+	want := []Employee{
+		{Name: "Иванов Иван Иванович", Position: "Бариста", Salary: 50_000_00, HireDate: date(2024, 2, 1)},
+		{Name: "Петрова Анна", Position: "Управляющая", Salary: 120_000_00, HireDate: date(2026, 10, 15)},
+		{Name: "Сидоров Петр", Position: "Повар", Salary: 60_000_00, HireDate: date(2025, 1, 10), FireDate: date(2026, 10, 5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			staff, err := ParseText(tt.data)
+			if err != nil {
+				t.Fatalf("ParseText: %v", err)
+			}
+			if len(staff.Employees) != len(want) {
+				t.Fatalf("employees = %+v", staff.Employees)
+			}
+			for i, e := range staff.Employees {
+				if e != want[i] {
+					t.Errorf("employee %d = %+v, want %+v", i, e, want[i])
+				}
+			}
+			// Сотрудник без оклада пропускается с предупреждением, строка "Итого" - без
+			if len(staff.Warnings) != 1 {
+				t.Errorf("warnings = %q", staff.Warnings)
+			}
+		})
+	}
+}
+
+func TestParseTextUnknown(t *testing.T) {
+	if _, err := ParseText([]byte("Дата;Сумма\n01.01.2026;100\n")); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("ParseText without name and salary columns: %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package receipts
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// CSV-выгрузки ОФД бывают двух видов: строка на чек (дата, ФН, ФД, сумма, наличные, безналичные)
+// и строка на позицию чека (те же поля плюс наименование, цена, количество, сумма позиции).
+// Столбцы определяются по заголовку; позиции одного чека собираются по ФН и ФД, а если их нет -
+// по соседним строкам с одинаковыми датой, временем и суммой чека.
+
+// csvColumn - поле выгрузки и варианты заголовка столбца (сравниваются без учета регистра)
+type csvColumn struct {
+	field   string
+	headers []string // точное совпадение
+	prefix  []string // начало заголовка
+}
+
+var csvColumns = []csvColumn{
+	{field: "datetime", headers: []string{"дата/время", "дата и время", "дата время", "дата и время чека", "дата/время чека", "дата чека", "datetime"}},
+	{field: "date", headers: []string{"дата", "date"}},
+	{field: "time", headers: []string{"время", "время чека", "time"}},
+	{field: "drive", headers: []string{"фн", "номер фн", "№ фн", "заводской номер фн"}, prefix: []string{"фискальный накопитель", "номер фискального накопителя"}},
+	{field: "document", headers: []string{"фд", "номер фд", "№ фд", "номер чека", "№ чека", "чек"}, prefix: []string{"фискальный документ", "номер фискального документа"}},
+	{field: "operation", headers: []string{"тип операции", "вид операции", "тип чека", "вид чека", "операция"}, prefix: []string{"признак расчета"}},
+	{field: "total", headers: []string{"сумма чека", "итог", "итого", "сумма по чеку", "сумма итого"}},
+	{field: "cash", prefix: []string{"наличн", "в т.ч. наличн"}},
+	{field: "card", prefix: []string{"безналичн", "электрон", "картой", "карта", "в т.ч. безналичн"}},
+	{field: "name", headers: []string{"наименование", "товар", "позиция", "номенклатура"}, prefix: []string{"наименование", "предмет расчета"}},
+	{field: "quantity", headers: []string{"количество", "кол-во", "кол."}},
+	{field: "price", headers: []string{"цена", "цена за единицу"}},
+	{field: "amount", headers: []string{"сумма позиции", "стоимость", "сумма по позиции", "сумма товара"}},
+	{field: "sum", headers: []string{"сумма", "сумма, руб.", "сумма (руб.)"}},
+}
+
+func parseCSV(text string) (*Export, error) {
+	rows, err := readCSV(text)
+	if err != nil {
+		return nil, ErrUnknownFormat
+	}
+	header, columns := -1, map[string]int(nil)
+	for i := 0; i < len(rows) && i < 10; i++ {
+		if found := csvHeader(rows[i]); found != nil {
+			header, columns = i, found
+			break
+		}
+	}
+	if header < 0 {
+		return nil, ErrUnknownFormat
+	}
+
+	// Одна "Сумма" - это сумма чека, если нет позиций, иначе сумма позиции
+	if sum, ok := columns["sum"]; ok {
+		if _, hasName := columns["name"]; hasName {
+			if _, ok := columns["amount"]; !ok {
+				columns["amount"] = sum
+			}
+		} else if _, ok := columns["total"]; !ok {
+			columns["total"] = sum
+		}
+	}
+	_, hasItems := columns["name"]
+	_, hasTotal := columns["total"]
+	if !hasTotal && !hasItems {
+		return nil, ErrUnknownFormat
+	}
+
+	export := &Export{Format: FormatCSV}
+	cell := func(row []string, field string) string {
+		if i, ok := columns[field]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	current, currentKey := -1, ""
+	for n, row := range rows[header+1:] {
+		line := header + n + 2
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+		dateText := cell(row, "datetime")
+		if dateText == "" {
+			dateText = strings.TrimSpace(cell(row, "date") + " " + cell(row, "time"))
+		}
+		// Итоговые строки в конце таблицы без даты пропускаются
+		if dateText == "" {
+			continue
+		}
+		dateTime, ok := parseDateTime(dateText)
+		if !ok {
+			export.Warnings = append(export.Warnings, fmt.Sprintf("Строка %d: неверная дата %q", line, dateText))
+			continue
+		}
+		op, ok := operation(cell(row, "operation"))
+		if !ok {
+			continue
+		}
+		total, totalOK := parseRubles(cell(row, "total"))
+		if !totalOK {
+			export.Warnings = append(export.Warnings, fmt.Sprintf("Строка %d: неверная сумма %q", line, cell(row, "total")))
+			continue
+		}
+		// Возвраты иногда выгружаются с минусом
+		if total < 0 {
+			total, op = -total, OperationRefund
+		}
+
+		drive, document := cell(row, "drive"), cell(row, "document")
+		key := drive + "|" + document
+		if document == "" {
+			key = dateText + "|" + cell(row, "total") + "|" + op
+		}
+		if current < 0 || key != currentKey || !hasItems {
+			r := Receipt{DateTime: dateTime, Operation: op, FiscalDrive: drive, FiscalDocument: document, Total: total}
+			r.Cash, _ = parseRubles(cell(row, "cash"))
+			r.Card, _ = parseRubles(cell(row, "card"))
+			export.Receipts = append(export.Receipts, r)
+			current, currentKey = len(export.Receipts)-1, key
+		}
+
+		if hasItems {
+			item := Item{Name: cell(row, "name")}
+			item.Quantity, _ = parseQuantity(cell(row, "quantity"))
+			item.Price, _ = parseRubles(cell(row, "price"))
+			item.Amount, _ = parseRubles(cell(row, "amount"))
+			if item.Amount < 0 {
+				item.Amount = -item.Amount
+			}
+			if item.Amount == 0 {
+				item.Amount = int64(math.Round(float64(item.Price) * item.Quantity))
+			}
+			if item.Name != "" || item.Amount != 0 {
+				export.Receipts[current].Items = append(export.Receipts[current].Items, item)
+			}
+		}
+	}
+
+	for i := range export.Receipts {
+		r := &export.Receipts[i]
+		if !hasTotal {
+			for _, item := range r.Items {
+				r.Total += item.Amount
+			}
+		}
+		if r.Cash < 0 {
+			r.Cash = -r.Cash
+		}
+		if r.Card < 0 {
+			r.Card = -r.Card
+		}
+		if r.Cash == 0 && r.Card == 0 {
+			r.Card = r.Total
+		}
+	}
+	if len(export.Receipts) == 0 {
+		return nil, ErrUnknownFormat
+	}
+	return export, nil
+}
+
+// readCSV читает таблицу с разделителем ";", "," или табуляцией - тем, что чаще встречается в первой строке
+func readCSV(text string) ([][]string, error) {
+	first := text
+	if i := strings.IndexByte(first, '\n'); i >= 0 {
+		first = first[:i]
+	}
+	delimiter := ';'
+	best := strings.Count(first, ";")
+	for _, candidate := range []rune{',', '\t'} {
+		if count := strings.Count(first, string(candidate)); count > best {
+			delimiter, best = candidate, count
+		}
+	}
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	return reader.ReadAll()
+}
+
+// csvHeader находит столбцы выгрузки чеков в строке заголовка. Заголовок должен содержать дату
+// и хотя бы одно поле, характерное для чеков, иначе это обычная таблица, а не выгрузка ОФД.
+func csvHeader(row []string) map[string]int {
+	columns := make(map[string]int)
+	for i, value := range row {
+		title := strings.ToLower(strings.Join(strings.Fields(strings.Trim(value, "\ufeff \"")), " "))
+		if title == "" {
+			continue
+		}
+		for _, column := range csvColumns {
+			if _, taken := columns[column.field]; taken {
+				continue
+			}
+			if matchesHeader(title, column) {
+				columns[column.field] = i
+				break
+			}
+		}
+	}
+	_, hasDateTime := columns["datetime"]
+	_, hasDate := columns["date"]
+	if !hasDateTime && !hasDate {
+		return nil
+	}
+	for _, field := range []string{"drive", "document", "operation", "cash", "card"} {
+		if _, ok := columns[field]; ok {
+			return columns
+		}
+	}
+	return nil
+}
+
+func matchesHeader(title string, column csvColumn) bool {
+	for _, header := range column.headers {
+		if title == header {
+			return true
+		}
+	}
+	for _, prefix := range column.prefix {
+		if strings.HasPrefix(title, prefix) {
+			return true
+		}
+	}
+	return false
+}
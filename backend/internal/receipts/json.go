@@ -0,0 +1,214 @@
+package receipts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// JSON-выгрузки ОФД и приложения ФНС "Проверка чеков" строятся на тегах ФФД, но по-разному
+// вложены: массив чеков, {"receipts": [...]}, [{"ticket": {"document": {"receipt": {...}}}}],
+// {"Data": [...]}. Поэтому чеки ищутся по всему документу: чек - объект со списком позиций
+// и итоговой суммой. Имена полей сравниваются без учета регистра и подчеркиваний.
+//
+// Единица сумм определяется один раз для всего файла: если хотя бы одна сумма дробная
+// ("350.00", 350.5), все суммы в рублях; иначе суммы в копейках, если чеки с тегами ФФД
+// (totalSum), и в рублях для остальных выгрузок ("total": 350).
+
+var (
+	jsonDateKeys      = []string{"datetime", "docdatetime", "receiptdatetime", "date"}
+	jsonTotalKeys     = []string{"totalsum", "totalsumm", "total", "sum"}
+	jsonCashKeys      = []string{"cashtotalsum", "cashsumm", "cashsum", "cash"}
+	jsonCardKeys      = []string{"ecashtotalsum", "ecashsumm", "ecashsum", "electronicsum", "card", "ecash"}
+	jsonOperationKeys = []string{"operationtype", "operation", "type"}
+	jsonDriveKeys     = []string{"fiscaldrivenumber", "fnnumber", "fn", "fiscaldrive"}
+	jsonDocumentKeys  = []string{"fiscaldocumentnumber", "fdnumber", "fd", "documentnumber", "docnumber"}
+	jsonItemsKeys     = []string{"items", "positions", "goods"}
+	jsonNameKeys      = []string{"name", "productname", "title"}
+	jsonPriceKeys     = []string{"price"}
+	jsonQuantityKeys  = []string{"quantity", "count", "qty"}
+	jsonAmountKeys    = []string{"sum", "total", "totalsum", "amount"}
+)
+
+func parseJSON(data []byte) (*Export, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var root interface{}
+	if err := decoder.Decode(&root); err != nil {
+		return nil, ErrUnknownFormat
+	}
+
+	var found []map[string]interface{}
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case map[string]interface{}:
+			fields := normalizeKeys(v)
+			if isJSONReceipt(fields) {
+				found = append(found, fields)
+				return
+			}
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	walk(root)
+
+	if len(found) == 0 {
+		return nil, ErrUnknownFormat
+	}
+	export := &Export{Format: FormatJSON}
+	kopecks := jsonKopecks(found)
+	for i, fields := range found {
+		receipt, err := jsonReceipt(fields, kopecks)
+		if err != nil {
+			export.Warnings = append(export.Warnings, fmt.Sprintf("Чек %d: %v", i+1, err))
+		} else if receipt != nil {
+			export.Receipts = append(export.Receipts, *receipt)
+		}
+	}
+	return export, nil
+}
+
+// jsonKopecks определяет единицу сумм файла: true - копейки, false - рубли
+func jsonKopecks(receipts []map[string]interface{}) bool {
+	ffd := false
+	for _, fields := range receipts {
+		if _, ok := fields["totalsum"]; ok {
+			ffd = true
+		}
+		amounts := []interface{}{lookup(fields, jsonTotalKeys), lookup(fields, jsonCashKeys), lookup(fields, jsonCardKeys)}
+		items, _ := lookup(fields, jsonItemsKeys).([]interface{})
+		for _, value := range items {
+			if object, ok := value.(map[string]interface{}); ok {
+				itemFields := normalizeKeys(object)
+				amounts = append(amounts, lookup(itemFields, jsonPriceKeys), lookup(itemFields, jsonAmountKeys))
+			}
+		}
+		for _, amount := range amounts {
+			if jsonFractional(amount) {
+				return false
+			}
+		}
+	}
+	return ffd
+}
+
+// jsonFractional - сумма записана с дробной частью: 350.5, "350.00", "350,00"
+func jsonFractional(value interface{}) bool {
+	switch v := value.(type) {
+	case json.Number:
+		return strings.ContainsAny(v.String(), ".eE")
+	case string:
+		return strings.ContainsAny(v, ".,")
+	}
+	return false
+}
+
+func normalizeKeys(object map[string]interface{}) map[string]interface{} {
+	fields := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		fields[strings.ReplaceAll(strings.ToLower(key), "_", "")] = value
+	}
+	return fields
+}
+
+func isJSONReceipt(fields map[string]interface{}) bool {
+	_, hasItems := lookup(fields, jsonItemsKeys).([]interface{})
+	return hasItems && lookup(fields, jsonTotalKeys) != nil
+}
+
+func lookup(fields map[string]interface{}, keys []string) interface{} {
+	for _, key := range keys {
+		if value, ok := fields[key]; ok && value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+// jsonReceipt разбирает чек с суммами в копейках (kopecks) или рублях; nil без ошибки - чек расхода,
+// к выручке не относится
+func jsonReceipt(fields map[string]interface{}, kopecks bool) (*Receipt, error) {
+	r := &Receipt{
+		FiscalDrive:    jsonString(lookup(fields, jsonDriveKeys)),
+		FiscalDocument: jsonString(lookup(fields, jsonDocumentKeys)),
+	}
+	var ok bool
+	if r.Operation, ok = operation(jsonString(lookup(fields, jsonOperationKeys))); !ok {
+		return nil, nil
+	}
+	date := jsonString(lookup(fields, jsonDateKeys))
+	if r.DateTime, ok = parseDateTime(date); !ok {
+		return nil, fmt.Errorf("неверная дата %q", date)
+	}
+	if r.Total, ok = jsonAmount(lookup(fields, jsonTotalKeys), kopecks); !ok {
+		return nil, fmt.Errorf("неверная сумма %q", jsonString(lookup(fields, jsonTotalKeys)))
+	}
+	r.Cash, _ = jsonAmount(lookup(fields, jsonCashKeys), kopecks)
+	r.Card, _ = jsonAmount(lookup(fields, jsonCardKeys), kopecks)
+	if r.Cash == 0 && r.Card == 0 {
+		r.Card = r.Total
+	}
+
+	items, _ := lookup(fields, jsonItemsKeys).([]interface{})
+	for _, value := range items {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		itemFields := normalizeKeys(object)
+		item := Item{Name: strings.TrimSpace(jsonString(lookup(itemFields, jsonNameKeys))), Quantity: 1}
+		item.Price, _ = jsonAmount(lookup(itemFields, jsonPriceKeys), kopecks)
+		if quantity, ok := lookup(itemFields, jsonQuantityKeys).(json.Number); ok {
+			if f, err := quantity.Float64(); err == nil {
+				item.Quantity = f
+			}
+		}
+		if amount, ok := jsonAmount(lookup(itemFields, jsonAmountKeys), kopecks); ok && amount != 0 {
+			item.Amount = amount
+		} else {
+			item.Amount = int64(math.Round(float64(item.Price) * item.Quantity))
+		}
+		r.Items = append(r.Items, item)
+	}
+	return r, nil
+}
+
+func jsonString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// jsonAmount - сумма в копейках из значения в копейках (kopecks) или в рублях
+func jsonAmount(value interface{}, kopecks bool) (int64, bool) {
+	var text string
+	switch v := value.(type) {
+	case json.Number:
+		text = v.String()
+	case string:
+		text = strings.TrimSpace(v)
+	default:
+		return 0, false
+	}
+	if !kopecks {
+		return parseRubles(text)
+	}
+	n, err := strconv.ParseInt(strings.NewReplacer(" ", "", "\u00a0", "").Replace(text), 10, 64)
+	return n, err == nil
+}
@@ -0,0 +1,60 @@
+package receipts
+
+import "testing"
+
+// Единица сумм определяется для всего файла, а не для каждого значения
+func TestParseJSONAmountUnit(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		total int64
+		price int64
+		cash  int64
+	}{
+		{
+			name: "ФФД, целые суммы в копейках",
+			data: `[{"ticket": {"document": {"receipt": {"dateTime": "2026-03-01T12:30:00", "operationType": 1,
+				"totalSum": 35000, "cashTotalSum": 0, "ecashTotalSum": 35000,
+				"items": [{"name": "Кофе", "price": 17500, "quantity": 2, "sum": 35000}]}}}}]`,
+			total: 35000, price: 17500,
+		},
+		{
+			name: "ФФД с дробными суммами - рубли, целые тоже",
+			data: `[{"dateTime": "2026-03-01T12:30:00", "totalSum": 350.5, "cashTotalSum": 350, "ecashTotalSum": 0.5,
+				"items": [{"name": "Кофе", "price": 175.25, "quantity": 2, "sum": 350.5}]},
+				{"dateTime": "2026-03-01T13:00:00", "totalSum": 200, "cashTotalSum": 200,
+				"items": [{"name": "Чай", "price": 200, "quantity": 1, "sum": 200}]}]`,
+			total: 35050, price: 17525, cash: 35000,
+		},
+		{
+			name: "без тегов ФФД, целые суммы в рублях",
+			data: `{"receipts": [{"date": "01.03.2026 12:30", "total": 350, "cash": 350,
+				"items": [{"name": "Кофе", "price": 175, "quantity": 2}]}]}`,
+			total: 35000, price: 17500, cash: 35000,
+		},
+		{
+			name: "строки с разделителем - рубли",
+			data: `[{"dateTime": "2026-03-01T12:30:00", "totalSum": "350,00",
+				"items": [{"name": "Кофе", "price": "175", "quantity": 2, "sum": "350"}]}]`,
+			total: 35000, price: 17500,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			export, err := Parse([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(export.Receipts) == 0 {
+				t.Fatalf("no receipts, warnings: %q", export.Warnings)
+			}
+			r := export.Receipts[0]
+			if r.Total != tt.total || r.Items[0].Price != tt.price || r.Cash != tt.cash {
+				t.Errorf("total %d, price %d, cash %d; want %d, %d, %d", r.Total, r.Items[0].Price, r.Cash, tt.total, tt.price, tt.cash)
+			}
+			if r.Items[0].Amount != 2*tt.price {
+				t.Errorf("item amount %d, want %d", r.Items[0].Amount, 2*tt.price)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+// Package receipts разбирает выгрузки кассовых чеков из ОФД (JSON и CSV по фискальному накопителю).
+package receipts
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Признак расчета чека
+const (
+	OperationSale   = "sale"   // приход
+	OperationRefund = "refund" // возврат прихода
+)
+
+// Форматы выгрузок
+const (
+	FormatJSON = "json" // чеки в формате ФФД (как в выгрузках ОФД и приложения "Проверка чеков")
+	FormatCSV  = "csv"  // таблица чеков или позиций чеков
+)
+
+// FormatNames - названия форматов для пользователя
+var FormatNames = map[string]string{
+	FormatJSON: "JSON (ФФД)",
+	FormatCSV:  "CSV",
+}
+
+// ErrUnknownFormat - файл не является выгрузкой чеков
+var ErrUnknownFormat = errors.New("receipts: unknown receipts export format")
+
+// Export - разобранная выгрузка чеков
+type Export struct {
+	Format       string
+	DateFrom     time.Time
+	DateTo       time.Time
+	FiscalDrives []string // номера фискальных накопителей
+	Receipts     []Receipt
+	Warnings     []string // чеки, которые не удалось разобрать
+}
+
+// Receipt - кассовый чек. Суммы в копейках.
+type Receipt struct {
+	DateTime       time.Time
+	Operation      string
+	FiscalDrive    string // номер ФН
+	FiscalDocument string // номер ФД
+	Total          int64
+	Cash           int64
+	Card           int64 // безналичными
+	Items          []Item
+}
+
+// Item - позиция чека
+type Item struct {
+	Name     string
+	Price    int64
+	Quantity float64
+	Amount   int64
+}
+
+// IsExportType - в файлах с таким расширением могут быть выгрузки чеков
+func IsExportType(fileType string) bool {
+	return fileType == "json" || fileType == "csv"
+}
+
+// Parse определяет формат выгрузки и разбирает ее. Если файл не похож на выгрузку чеков,
+// возвращает ErrUnknownFormat.
+func Parse(data []byte) (*Export, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	var export *Export
+	var err error
+	switch {
+	case len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '['):
+		export, err = parseJSON(trimmed)
+	default:
+		text := string(data)
+		if !utf8.Valid(data) {
+			decoded, decodeErr := charmap.Windows1251.NewDecoder().Bytes(data)
+			if decodeErr != nil {
+				return nil, ErrUnknownFormat
+			}
+			text = string(decoded)
+		}
+		export, err = parseCSV(text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	export.finish()
+	return export, nil
+}
+
+// finish убирает повторы одного чека, сортирует чеки по времени и заполняет период
+func (e *Export) finish() {
+	seen := make(map[string]bool)
+	drives := make(map[string]bool)
+	unique := e.Receipts[:0]
+	for _, r := range e.Receipts {
+		if r.FiscalDrive != "" && r.FiscalDocument != "" {
+			key := r.FiscalDrive + "|" + r.FiscalDocument
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		if r.FiscalDrive != "" && !drives[r.FiscalDrive] {
+			drives[r.FiscalDrive] = true
+			e.FiscalDrives = append(e.FiscalDrives, r.FiscalDrive)
+		}
+		unique = append(unique, r)
+	}
+	e.Receipts = unique
+	sort.Strings(e.FiscalDrives)
+	sort.SliceStable(e.Receipts, func(i, j int) bool { return e.Receipts[i].DateTime.Before(e.Receipts[j].DateTime) })
+	if len(e.Receipts) > 0 {
+		e.DateFrom = e.Receipts[0].DateTime
+		e.DateTo = e.Receipts[len(e.Receipts)-1].DateTime
+	}
+}
+
+// Signed - сумма чека со знаком: возвраты уменьшают выручку
+func (r Receipt) Signed() int64 {
+	if r.Operation == OperationRefund {
+		return -r.Total
+	}
+	return r.Total
+}
+
+// operation - признак расчета по коду ФФД (1 - приход, 2 - возврат прихода) или названию.
+// Расход и возврат расхода (3, 4) к выручке не относятся: ok=false.
+func operation(value string) (op string, ok bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "", "1", "приход", "продажа", "income", "sale", "sell":
+		return OperationSale, true
+	case "2", "возврат прихода", "возврат", "возврат продажи", "refund", "income_return", "incomereturn", "sell_refund":
+		return OperationRefund, true
+	}
+	return "", false
+}
+
+// dateLayouts - форматы даты и времени чека в выгрузках
+var dateLayouts = []string{
+	time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04",
+	"02.01.2006 15:04:05", "02.01.2006 15:04", "02.01.2006T15:04", "02.01.06 15:04", "2006-01-02", "02.01.2006",
+}
+
+// parseDateTime разбирает дату и время чека. Время кассы - местное, поэтому часовой пояс
+// отбрасывается: выручка по часам считается по времени на чеке.
+func parseDateTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds > 1e9 {
+		return time.Unix(seconds, 0).UTC(), true
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseRubles разбирает сумму в рублях: "1 234,56", "1234.56"
+func parseRubles(value string) (int64, bool) {
+	value = strings.NewReplacer(" ", "", " ", "", "₽", "", "руб.", "", "р.", "").Replace(strings.TrimSpace(value))
+	value = strings.ReplaceAll(value, ",", ".")
+	if value == "" {
+		return 0, true
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	if f < 0 {
+		return -int64(-f*100 + 0.5), true
+	}
+	return int64(f*100 + 0.5), true
+}
+
+// parseQuantity разбирает количество: "2", "0,350"
+func parseQuantity(value string) (float64, bool) {
+	value = strings.ReplaceAll(strings.ReplaceAll(strings.TrimSpace(value), " ", ""), ",", ".")
+	if value == "" {
+		return 1, true
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	return f, err == nil
+}
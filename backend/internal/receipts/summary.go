@@ -0,0 +1,142 @@
+package receipts
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Summary - показатели продаж по чекам. Выручка - приход за вычетом возвратов;
+// средний чек и позиции в чеке считаются только по чекам прихода.
+type Summary struct {
+	DateFrom      time.Time
+	DateTo        time.Time
+	Revenue       int64
+	Sales         int64 // сумма чеков прихода
+	Refunds       int64 // сумма возвратов
+	Checks        int   // чеков прихода
+	RefundChecks  int
+	Days          int   // дней с продажами
+	AverageCheck  int64 // средний чек
+	ItemsPerCheck float64
+	Cash          int64   // выручка наличными
+	Card          int64   // выручка безналичными
+	ByHour        []Group // по часам 0-23, только часы с чеками
+	ByDay         []Group // по датам "2025-03-01"
+	ByWeekday     []Group // "1" - понедельник ... "7" - воскресенье
+	ByItem        []Group // по наименованию, по убыванию выручки
+}
+
+// Group - выручка и число чеков в группе. Для позиций Checks - в скольких чеках была позиция,
+// Quantity - сколько продано.
+type Group struct {
+	Key      string
+	Revenue  int64
+	Checks   int
+	Quantity float64
+}
+
+// Summarize считает показатели продаж по чекам
+func Summarize(receipts []Receipt) Summary {
+	var s Summary
+	hours := make(map[string]*Group)
+	days := make(map[string]*Group)
+	weekdays := make(map[string]*Group)
+	items := make(map[string]*Group)
+	var itemNames []string
+	positions := 0
+
+	add := func(groups map[string]*Group, key string, amount int64, check int) {
+		group := groups[key]
+		if group == nil {
+			group = &Group{Key: key}
+			groups[key] = group
+		}
+		group.Revenue += amount
+		group.Checks += check
+	}
+
+	for _, r := range receipts {
+		if s.DateFrom.IsZero() || r.DateTime.Before(s.DateFrom) {
+			s.DateFrom = r.DateTime
+		}
+		if r.DateTime.After(s.DateTo) {
+			s.DateTo = r.DateTime
+		}
+		signed, check := r.Signed(), 1
+		if r.Operation == OperationRefund {
+			s.Refunds += r.Total
+			s.RefundChecks++
+			check = 0
+		} else {
+			s.Sales += r.Total
+			s.Checks++
+			positions += len(r.Items)
+		}
+		s.Revenue += signed
+		cash, card := r.Cash, r.Card
+		if r.Operation == OperationRefund {
+			cash, card = -cash, -card
+		}
+		s.Cash += cash
+		s.Card += card
+
+		add(hours, fmt.Sprintf("%02d", r.DateTime.Hour()), signed, check)
+		add(days, r.DateTime.Format("2006-01-02"), signed, check)
+		weekday := int(r.DateTime.Weekday())
+		if weekday == 0 {
+			weekday = 7
+		}
+		add(weekdays, strconv.Itoa(weekday), signed, check)
+
+		seen := make(map[string]bool)
+		for _, item := range r.Items {
+			name := strings.Join(strings.Fields(item.Name), " ")
+			if name == "" {
+				continue
+			}
+			key := strings.ToLower(name)
+			group := items[key]
+			if group == nil {
+				group = &Group{Key: name}
+				items[key] = group
+				itemNames = append(itemNames, key)
+			}
+			amount, quantity := item.Amount, item.Quantity
+			if r.Operation == OperationRefund {
+				amount, quantity = -amount, -quantity
+			}
+			group.Revenue += amount
+			group.Quantity += quantity
+			if !seen[key] && r.Operation != OperationRefund {
+				group.Checks++
+				seen[key] = true
+			}
+		}
+	}
+
+	s.Days = len(days)
+	if s.Checks > 0 {
+		s.AverageCheck = s.Sales / int64(s.Checks)
+		s.ItemsPerCheck = float64(positions) / float64(s.Checks)
+	}
+	s.ByHour = sortedGroups(hours)
+	s.ByDay = sortedGroups(days)
+	s.ByWeekday = sortedGroups(weekdays)
+	for _, key := range itemNames {
+		s.ByItem = append(s.ByItem, *items[key])
+	}
+	sort.SliceStable(s.ByItem, func(i, j int) bool { return s.ByItem[i].Revenue > s.ByItem[j].Revenue })
+	return s
+}
+
+func sortedGroups(groups map[string]*Group) []Group {
+	result := make([]Group, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"alfa-hack-backend/internal/storage/s3fake"
+)
+
+func TestS3AgainstFake(t *testing.T) {
+	server := s3fake.New().Start()
+	defer server.Close()
+
+	s, err := NewS3(S3Config{Endpoint: server.URL, Bucket: "uploads", AccessKey: "key", SecretKey: "secret"})
+	if err != nil {
+		t.Fatalf("NewS3: %v", err)
+	}
+	testStorage(t, s)
+}
+
+func TestLocal(t *testing.T) {
+	l, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	testStorage(t, l)
+}
+
+// testStorage проверяет Put/Get/List/Delete одинаково для всех реализаций Storage
+func testStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+	files := map[string]string{
+		"u1/f1.txt":    "первый файл",
+		"u1/f1.v2.txt": "вторая версия",
+		"u2/f2.csv":    "a;b\n1;2\n",
+	}
+	for key, data := range files {
+		if err := s.Put(ctx, key, strings.NewReader(data), int64(len(data)), "text/plain"); err != nil {
+			t.Fatalf("Put(%q): %v", key, err)
+		}
+	}
+
+	for key, want := range files {
+		got, err := ReadAll(ctx, s, key)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", key, err)
+		}
+		if string(got) != want {
+			t.Errorf("Get(%q) = %q, want %q", key, got, want)
+		}
+	}
+	if _, err := s.Get(ctx, "u1/missing.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of missing key: %v, want ErrNotFound", err)
+	}
+
+	objects, err := s.List(ctx, "u1/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	keys := make(map[string]int64)
+	for _, o := range objects {
+		keys[o.Key] = o.Size
+	}
+	if len(keys) != 2 || keys["u1/f1.txt"] != int64(len(files["u1/f1.txt"])) || keys["u1/f1.v2.txt"] == 0 {
+		t.Errorf("List(u1/) = %+v", objects)
+	}
+
+	if err := s.Delete(ctx, "u1/f1.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(ctx, "u1/f1.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, "u1/f1.txt"); err != nil {
+		t.Errorf("Delete of missing key: %v", err)
+	}
+	objects, err = s.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(objects) != 2 {
+		t.Errorf("List after Delete = %+v, want 2 objects", objects)
+	}
+
+	if err := s.Put(ctx, "../escape.txt", strings.NewReader("x"), 1, ""); err == nil {
+		t.Error("Put accepted key outside storage")
+	}
+}
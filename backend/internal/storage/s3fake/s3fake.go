@@ -0,0 +1,109 @@
+// Package s3fake - минимальный S3-совместимый сервер в памяти для локальной разработки и проверки
+// storage.S3 без MinIO. Поддерживает PUT/GET/DELETE объектов и ListObjectsV2; подписи не проверяет.
+package s3fake
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type object struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+// Server хранит объекты в памяти: ключ "<bucket>/<key>"
+type Server struct {
+	mu      sync.Mutex
+	objects map[string]object
+}
+
+func New() *Server {
+	return &Server{objects: make(map[string]object)}
+}
+
+// Start запускает сервер на случайном локальном порту; URL можно передать в S3Config.Endpoint
+func (s *Server) Start() *httptest.Server {
+	return httptest.NewServer(s)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Адреса в path-style: /<bucket>/<key>
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key, _ := strings.Cut(path, "/")
+	if bucket == "" {
+		http.Error(w, "bucket is required", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		s.list(w, bucket, r.URL.Query().Get("prefix"))
+	case r.Method == http.MethodPut && key != "":
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.objects[bucket+"/"+key] = object{data: data, contentType: r.Header.Get("Content-Type"), modTime: time.Now().UTC()}
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet && key != "":
+		s.mu.Lock()
+		obj, ok := s.objects[bucket+"/"+key]
+		s.mu.Unlock()
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		if obj.contentType != "" {
+			w.Header().Set("Content-Type", obj.contentType)
+		}
+		w.Write(obj.data)
+	case r.Method == http.MethodDelete && key != "":
+		s.mu.Lock()
+		delete(s.objects, bucket+"/"+key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+func (s *Server) list(w http.ResponseWriter, bucket, prefix string) {
+	type content struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	}
+	type listResult struct {
+		XMLName     xml.Name  `xml:"ListBucketResult"`
+		Name        string    `xml:"Name"`
+		Prefix      string    `xml:"Prefix"`
+		IsTruncated bool      `xml:"IsTruncated"`
+		Contents    []content `xml:"Contents"`
+	}
+
+	result := listResult{Name: bucket, Prefix: prefix}
+	s.mu.Lock()
+	for fullKey, obj := range s.objects {
+		key, ok := strings.CutPrefix(fullKey, bucket+"/")
+		if ok && strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, content{Key: key, Size: int64(len(obj.data)), LastModified: obj.modTime})
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotFound возвращается, если объекта с таким ключом нет
+var ErrNotFound = errors.New("storage: object not found")
+
+// Storage - хранилище загруженных файлов.
+// Ключ - непрозрачная строка вида "<userID>/<fileID>.<ext>" (для версий "<userID>/<fileID>.v<N>.<ext>"),
+// которая сохраняется в files.file_path и file_versions.file_path.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]Object, error)
+}
+
+// Object - описание объекта в хранилище
+type Object struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// TempLister - хранилище, в котором после сбоя во время записи могут остаться временные файлы.
+// Ключи временных файлов можно передать в Delete.
+type TempLister interface {
+	ListTemp(ctx context.Context) ([]Object, error)
+}
+
+// NewFromEnv создает хранилище по переменным окружения.
+// STORAGE_BACKEND=local (по умолчанию) - файлы в UPLOADS_DIR;
+// STORAGE_BACKEND=s3 - S3-совместимое хранилище (S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY, S3_SECRET_KEY, S3_REGION).
+func NewFromEnv() (Storage, error) {
+	switch strings.ToLower(os.Getenv("STORAGE_BACKEND")) {
+	case "", "local":
+		return NewLocal(LocalDirFromEnv())
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Region:    os.Getenv("S3_REGION"),
+			// MinIO и большинство S3-совместимых хранилищ по умолчанию работают с path-style адресами
+			VirtualHostStyle: strings.ToLower(os.Getenv("S3_VIRTUAL_HOST_STYLE")) == "true",
+		})
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", os.Getenv("STORAGE_BACKEND"))
+	}
+}
+
+// LocalDirFromEnv возвращает каталог для локального хранилища
+func LocalDirFromEnv() string {
+	dir := os.Getenv("UPLOADS_DIR")
+	if dir == "" {
+		// Для локального запуска используем относительный путь
+		dir = filepath.Join("..", "uploads")
+	}
+	return dir
+}
+
+// ReadAll читает объект целиком
+func ReadAll(ctx context.Context, s Storage, key string) ([]byte, error) {
+	rc, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// validKey проверяет, что ключ не выходит за пределы хранилища
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("storage: invalid key %q", key)
+		}
+	}
+	return nil
+}
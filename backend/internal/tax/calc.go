@@ -0,0 +1,518 @@
+package tax
+
+import (
+	"alfa-hack-backend/internal/bank"
+	"alfa-hack-backend/internal/payroll"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Расчет упрощает учет: доходы и расходы признаются в месяце поступления и оплаты, убытки прошлых лет,
+// торговый сбор, пособия по больничным и налоговые каникулы не учитываются. НДС на общей системе
+// оценивается по оборотам: все доходы и расходы считаются облагаемыми по общей ставке.
+
+// Period - отчетный период. Для УСН и ОСНО суммы нарастающим итогом с начала года, для НПД - за месяц,
+// для патента - за срок патента. Суммы в копейках.
+type Period struct {
+	Name      string
+	Months    int  // месяцев с начала года (для НПД - номер месяца)
+	Partial   bool // в данных не все месяцы периода
+	Revenue   int64
+	Expenses  int64 // расходы, уменьшающие базу, включая взносы
+	Base      int64 // налоговая база
+	Accrued   int64 // налог до вычетов
+	Deduction int64 // вычеты, уменьшающие налог
+	Tax       int64 // налог после вычетов
+	Due       int64 // к уплате за период: налог минус платежи за прошлые периоды
+	DueDate   time.Time
+}
+
+// Deduction - вычет или расход, учтенный в расчете за последний период
+type Deduction struct {
+	Name   string
+	Amount int64
+}
+
+// Payment - платеж со сроком уплаты
+type Payment struct {
+	Code   string // вид платежа, одна из констант Payment*
+	Name   string
+	Amount int64
+	Due    time.Time
+}
+
+// Contributions - страховые взносы ИП за себя
+type Contributions struct {
+	Fixed      int64
+	Additional int64 // 1% с дохода сверх 300 000 ₽
+	Income     int64 // доход для расчета 1%
+}
+
+// VAT - оценка НДС на общей системе
+type VAT struct {
+	Rate   float64
+	Output int64 // НДС в доходах
+	Input  int64 // НДС в расходах, принимаемый к вычету
+	Tax    int64
+}
+
+// Result - расчет налогов за год по данным с начала года
+type Result struct {
+	Year          int
+	Regime        string
+	Form          string
+	Rate          float64 // ставка, %; 0 - у системы нет единой ставки
+	Params        Params
+	ExactParams   bool // параметры года известны; иначе взяты параметры ближайшего года
+	Months        int  // сколько месяцев года в данных
+	Revenue       int64
+	Expenses      int64
+	Periods       []Period
+	Tax           int64          // налог по системе с начала года после вычетов
+	Contributions *Contributions // взносы ИП за себя; nil для организаций и самозанятых
+	VAT           *VAT           // nil, если НДС не считается
+	Deductions    []Deduction
+	Allowed       []string // какие вычеты и расходы разрешены на системе
+	Payments      []Payment
+	Warnings      []string
+	Notes         []string
+}
+
+// quarterNames - отчетные периоды по числу месяцев с начала года
+var quarterNames = map[int]string{3: "I квартал", 6: "полугодие", 9: "9 месяцев", 12: "год"}
+
+var monthNames = []string{"январь", "февраль", "март", "апрель", "май", "июнь", "июль", "август", "сентябрь",
+	"октябрь", "ноябрь", "декабрь"}
+
+// Calculate считает налоги по системе налогообложения профиля за месяцы года из input
+func Calculate(profile Profile, input Input) (*Result, error) {
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	through := input.Through
+	if through <= 0 || through > 12 {
+		through = 12
+	}
+	params, exact := ParamsFor(input.Year)
+	r := &Result{
+		Year: input.Year, Regime: profile.Regime, Form: profile.Form, Rate: profile.rate(),
+		Params: params, ExactParams: exact, Months: through,
+	}
+	total := cumulative(input, through)
+	r.Revenue, r.Expenses = total.Revenue, total.Expenses
+
+	switch profile.Regime {
+	case RegimeUSNIncome:
+		r.usnIncome(input, through)
+	case RegimeUSNProfit:
+		r.usnProfit(input, through)
+	case RegimePSN:
+		r.patent(profile, input, through)
+	case RegimeNPD:
+		r.npd(input, through)
+	case RegimeOSNO:
+		if profile.Form == FormIP {
+			r.osnoIP(input, through)
+		} else {
+			r.osnoOrg(input, through)
+		}
+		r.vat(input, through)
+	}
+
+	if through < 12 {
+		r.Notes = append(r.Notes, fmt.Sprintf("Расчет по данным за %d мес. %d года: сумма за год будет больше", through, input.Year))
+	}
+	if !exact {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("Параметры %d года неизвестны, использованы параметры %d года", input.Year, params.Year))
+	}
+	sort.SliceStable(r.Payments, func(i, j int) bool { return r.Payments[i].Due.Before(r.Payments[j].Due) })
+	return r, nil
+}
+
+// cumulative - сумма данных за первые months месяцев года
+func cumulative(input Input, months int) Month {
+	var total Month
+	for _, m := range input.Months[:months] {
+		total.Revenue += m.Revenue
+		total.Expenses += m.Expenses
+		total.RevenueLegal += m.RevenueLegal
+		total.Contributions += m.Contributions
+	}
+	return total
+}
+
+// periodEnds - отчетные периоды (месяцев с начала года), в которые попадают данные
+func periodEnds(through int) []int {
+	var ends []int
+	for end := 3; end <= 12; end += 3 {
+		ends = append(ends, end)
+		if end >= through {
+			break
+		}
+	}
+	return ends
+}
+
+// percentOf - rate процентов от суммы в копейках
+func percentOf(amount int64, rate float64) float64 {
+	return float64(amount) * rate / 100
+}
+
+// roundRubles округляет сумму в копейках до полных рублей: налоги платятся в рублях
+func roundRubles(kopecks float64) int64 {
+	return int64(math.Round(kopecks/100)) * 100
+}
+
+// ipContributions считает взносы ИП за себя с дохода income и добавляет их платежи
+func (r *Result) ipContributions(income int64) {
+	income = max(income, 0)
+	additional := int64(math.Round(percentOf(max(income-ipAdditionalThreshold, 0), ipAdditionalRate)))
+	r.Contributions = &Contributions{
+		Fixed: r.Params.IPFixed, Additional: min(additional, r.Params.IPAdditionalCap), Income: income,
+	}
+	r.Payments = append(r.Payments, Payment{Code: PaymentIPFixed, Name: "Фиксированные взносы ИП за себя", Amount: r.Contributions.Fixed,
+		Due: Deadline(r.Year, time.December, 28)})
+	if r.Contributions.Additional > 0 {
+		r.Payments = append(r.Payments, Payment{Code: PaymentIPAdditional, Name: "Взнос ИП 1% с дохода сверх 300 000 ₽", Amount: r.Contributions.Additional,
+			Due: Deadline(r.Year+1, time.July, 1)})
+	}
+}
+
+// ipContributionsFor - взносы ИП за себя, которые можно учесть в периоде: фиксированные - с I квартала,
+// 1% - в расчете за год
+func (r *Result) ipContributionsFor(end int) int64 {
+	if r.Contributions == nil {
+		return 0
+	}
+	if end == 12 {
+		return r.Contributions.Fixed + r.Contributions.Additional
+	}
+	return r.Contributions.Fixed
+}
+
+// annualDeadline - срок уплаты налога за год
+func (r *Result) annualDeadline() time.Time {
+	switch {
+	case r.Regime == RegimeOSNO && r.Form == FormIP:
+		return Deadline(r.Year+1, time.July, 15)
+	case r.Form == FormOrg:
+		return Deadline(r.Year+1, time.March, 28)
+	}
+	return Deadline(r.Year+1, time.April, 28)
+}
+
+// addPeriod добавляет отчетный период: к уплате - налог с начала года минус платежи за прошлые периоды
+func (r *Result) addPeriod(p Period, code, taxName string) {
+	var paid int64
+	for _, prev := range r.Periods {
+		paid += prev.Due
+	}
+	p.Due = max(p.Tax-paid, 0)
+	if p.Months == 12 {
+		p.DueDate = r.annualDeadline()
+	} else {
+		p.DueDate = Deadline(r.Year, time.Month(p.Months+1), 28)
+	}
+	p.Name = quarterNames[p.Months]
+	r.Periods = append(r.Periods, p)
+	r.Tax = p.Tax
+	if p.Due == 0 {
+		return
+	}
+	name := taxName + ": авансовый платеж за " + p.Name
+	if p.Months == 12 {
+		name = taxName + " за год"
+	}
+	r.Payments = append(r.Payments, Payment{Code: code, Name: name, Amount: p.Due, Due: p.DueDate})
+}
+
+// contributionLimit - на сколько процентов налога его уменьшают взносы: ИП без сотрудников - на весь налог,
+// организации и ИП с сотрудниками - не более чем наполовину
+func contributionLimit(form string, employees bool) float64 {
+	if form == FormIP && !employees {
+		return 100
+	}
+	return 50
+}
+
+// reduceByContributions уменьшает налог на взносы с учетом ограничения; результат в полных рублях
+func reduceByContributions(accrued, contributions int64, limit float64) (deduction, tax int64) {
+	deduction = min(contributions, int64(percentOf(accrued, limit)))
+	tax = max(roundRubles(float64(accrued-deduction)), 0)
+	return accrued - tax, tax
+}
+
+func (r *Result) usnIncome(input Input, through int) {
+	if r.Form == FormIP {
+		r.ipContributions(r.Revenue)
+	}
+	limit := contributionLimit(r.Form, input.Employees)
+	var last Month
+	for _, end := range periodEnds(through) {
+		data := cumulative(input, min(end, through))
+		accrued := roundRubles(percentOf(data.Revenue, r.Rate))
+		deduction, tax := reduceByContributions(accrued, data.Contributions+r.ipContributionsFor(end), limit)
+		r.addPeriod(Period{
+			Months: end, Partial: end > through, Revenue: data.Revenue, Expenses: data.Expenses, Base: data.Revenue,
+			Accrued: accrued, Deduction: deduction, Tax: tax,
+		}, PaymentUSN, "УСН")
+		last = data
+	}
+	r.contributionDeductions(last, limit)
+	r.usnWarnings()
+	r.Allowed = []string{
+		"страховые взносы ИП за себя: фиксированные и 1% с дохода сверх 300 000 ₽",
+		"страховые взносы за сотрудников и на травматизм, больничные за первые 3 дня за счет работодателя",
+		"при наличии сотрудников взносы уменьшают налог не более чем на 50%, ИП без сотрудников - без ограничения",
+		"торговый сбор (в Москве)",
+	}
+}
+
+func (r *Result) usnProfit(input Input, through int) {
+	if r.Form == FormIP {
+		// 1% для УСН "доходы минус расходы" считается с разницы доходов и расходов
+		total := cumulative(input, through)
+		r.ipContributions(total.Revenue - total.Expenses - total.Contributions)
+	}
+	var last Month
+	for _, end := range periodEnds(through) {
+		data := cumulative(input, min(end, through))
+		expenses := data.Expenses + data.Contributions + r.ipContributionsFor(end)
+		base := max(data.Revenue-expenses, 0)
+		tax := roundRubles(percentOf(base, r.Rate))
+		period := Period{
+			Months: end, Partial: end > through, Revenue: data.Revenue, Expenses: expenses, Base: base,
+			Accrued: tax, Tax: tax,
+		}
+		if end == 12 {
+			if minimal := roundRubles(percentOf(data.Revenue, usnMinimalRate)); minimal > tax {
+				period.Tax = minimal
+				r.Notes = append(r.Notes, fmt.Sprintf("Налог за год меньше минимального (1%% от доходов), поэтому платится минимальный налог %s",
+					bank.FormatAmount(minimal, "RUB")))
+			}
+		}
+		r.addPeriod(period, PaymentUSN, "УСН")
+		last = data
+	}
+	r.Deductions = append(r.Deductions, Deduction{Name: "Расходы", Amount: last.Expenses})
+	if last.Contributions > 0 {
+		r.Deductions = append(r.Deductions, Deduction{Name: "Взносы за сотрудников (в расходах)", Amount: last.Contributions})
+	}
+	if r.Contributions != nil {
+		r.Deductions = append(r.Deductions, Deduction{Name: "Взносы ИП за себя (в расходах)",
+			Amount: r.ipContributionsFor(r.Periods[len(r.Periods)-1].Months)})
+	}
+	r.usnWarnings()
+	r.Allowed = []string{
+		"оплаченные и подтвержденные документами расходы из перечня статьи 346.16 НК РФ",
+		"страховые взносы ИП за себя и за сотрудников - в составе расходов",
+		"убытки прошлых лет",
+		"если налог за год меньше 1% доходов, платится минимальный налог 1%",
+	}
+}
+
+// contributionDeductions описывает взносы, уменьшившие налог за последний период
+func (r *Result) contributionDeductions(last Month, limit float64) {
+	if len(r.Periods) == 0 {
+		return
+	}
+	period := r.Periods[len(r.Periods)-1]
+	if last.Contributions > 0 {
+		r.Deductions = append(r.Deductions, Deduction{Name: "Взносы за сотрудников и на травматизм", Amount: last.Contributions})
+	}
+	if r.Contributions != nil {
+		r.Deductions = append(r.Deductions, Deduction{Name: "Взносы ИП за себя", Amount: r.ipContributionsFor(period.Months)})
+	}
+	if available := last.Contributions + r.ipContributionsFor(period.Months); available > period.Deduction && limit < 100 {
+		r.Notes = append(r.Notes, fmt.Sprintf("Взносы уменьшили налог только на %s: при наличии сотрудников не более чем на 50%%",
+			bank.FormatAmount(period.Deduction, "RUB")))
+	}
+}
+
+func (r *Result) usnWarnings() {
+	if r.Params.USNLimit > 0 && r.Revenue > r.Params.USNLimit {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("Доходы с начала года превысили лимит УСН %s: право на упрощенку теряется с начала квартала превышения",
+			bank.FormatAmount(r.Params.USNLimit, "RUB")))
+	}
+	if r.Params.USNVATThreshold > 0 && r.Revenue > r.Params.USNVATThreshold {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("Доходы с начала года превысили %s: с месяца после превышения нужно платить НДС - 5%% или 7%% без вычетов либо %g%% с вычетами",
+			bank.FormatAmount(r.Params.USNVATThreshold, "RUB"), r.Params.VATRate))
+	}
+}
+
+func (r *Result) patent(profile Profile, input Input, through int) {
+	months := profile.PatentMonths
+	if months == 0 {
+		months = 12
+	}
+	r.Allowed = []string{
+		"страховые взносы ИП за себя и за сотрудников, занятых в деятельности на патенте",
+		"при наличии сотрудников взносы уменьшают стоимость патента не более чем на 50%, ИП без сотрудников - без ограничения",
+	}
+	if r.Revenue > psnLimit {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("Доходы с начала года превысили %s: право на патент теряется",
+			bank.FormatAmount(psnLimit, "RUB")))
+	}
+	if profile.PatentIncome == 0 {
+		r.Warnings = append(r.Warnings, "Не указан потенциально возможный годовой доход по патенту: стоимость патента не рассчитана")
+		return
+	}
+	base := profile.PatentIncome * int64(months) / 12
+	r.ipContributions(base)
+	limit := contributionLimit(r.Form, input.Employees)
+	data := cumulative(input, min(months, through))
+	accrued := roundRubles(percentOf(base, r.Rate))
+	deduction, tax := reduceByContributions(accrued, data.Contributions+r.ipContributionsFor(12), limit)
+
+	start := time.Date(r.Year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, months, -1)
+	r.Periods = append(r.Periods, Period{
+		Name: fmt.Sprintf("патент на %d мес.", months), Months: months, Revenue: r.Revenue, Base: base,
+		Accrued: accrued, Deduction: deduction, Tax: tax, Due: tax, DueDate: workday(end),
+	})
+	r.Tax = tax
+	// Патент до 6 месяцев оплачивается целиком до окончания срока, дольше - треть в первые 90 дней
+	// и остаток до окончания срока
+	if months <= 6 {
+		r.Payments = append(r.Payments, Payment{Code: PaymentPatent, Name: "Стоимость патента", Amount: tax, Due: workday(end)})
+	} else {
+		first := roundRubles(float64(tax) / 3)
+		r.Payments = append(r.Payments,
+			Payment{Code: PaymentPatent, Name: "Патент: треть стоимости", Amount: first, Due: workday(start.AddDate(0, 0, 89))},
+			Payment{Code: PaymentPatent, Name: "Патент: остаток стоимости", Amount: tax - first, Due: workday(end)},
+		)
+	}
+	r.contributionDeductions(data, limit)
+	r.Notes = append(r.Notes, "Патент считается выданным с 1 января на весь срок")
+}
+
+func (r *Result) npd(input Input, through int) {
+	remaining := int64(npdDeduction)
+	for m := 0; m < through; m++ {
+		month := input.Months[m]
+		legal := min(month.RevenueLegal, month.Revenue)
+		individuals := month.Revenue - legal
+		accrued := int64(math.Round(percentOf(individuals, npdRateIndividuals) + percentOf(legal, npdRateLegal)))
+		deduction := min(remaining, int64(math.Round(percentOf(individuals, npdDeductionIndividual)+percentOf(legal, npdDeductionLegal))))
+		remaining -= deduction
+		period := Period{
+			Name: monthNames[m], Months: m + 1, Revenue: month.Revenue, Base: month.Revenue,
+			Accrued: accrued, Deduction: deduction, Tax: accrued - deduction, Due: accrued - deduction,
+			DueDate: Deadline(r.Year, time.Month(m+2), 28),
+		}
+		r.Periods = append(r.Periods, period)
+		r.Tax += period.Tax
+		if period.Due > 0 {
+			r.Payments = append(r.Payments, Payment{Code: PaymentNPD, Name: "НПД за " + period.Name, Amount: period.Due, Due: period.DueDate})
+		}
+	}
+	if used := npdDeduction - remaining; used > 0 {
+		r.Deductions = append(r.Deductions, Deduction{Name: "Налоговый вычет 10 000 ₽", Amount: used})
+	}
+	if r.Revenue > npdLimit {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("Доходы с начала года превысили %s: право на НПД теряется, нужно перейти на другую систему в течение 20 дней",
+			bank.FormatAmount(npdLimit, "RUB")))
+	}
+	r.Allowed = []string{
+		"налоговый вычет 10 000 ₽ один раз: ставка снижается до 3% с доходов от физлиц и до 4% от организаций и ИП, пока вычет не израсходован",
+		"расходы не уменьшают налог, страховые взносы платить не обязательно",
+	}
+	r.Notes = append(r.Notes, "Считается, что вычет 10 000 ₽ не израсходован в прошлые годы")
+}
+
+func (r *Result) osnoIP(input Input, through int) {
+	total := cumulative(input, through)
+	r.ipContributions(total.Revenue - total.Expenses - total.Contributions)
+	standard := false
+	for _, end := range periodEnds(through) {
+		data := cumulative(input, min(end, through))
+		// Профессиональный вычет - расходы по документам или 20% доходов, если это больше
+		expenses := data.Expenses + data.Contributions + r.ipContributionsFor(end)
+		deduction := int64(percentOf(data.Revenue, osnoStandardDeduction))
+		standard = deduction > expenses
+		if !standard {
+			deduction = expenses
+		}
+		base := max(data.Revenue-deduction, 0)
+		tax := payroll.NDFL(base, r.Year)
+		r.addPeriod(Period{
+			Months: end, Partial: end > through, Revenue: data.Revenue, Expenses: deduction, Base: base,
+			Accrued: tax, Tax: tax,
+		}, PaymentNDFL, "НДФЛ ИП")
+	}
+	if len(r.Periods) > 0 {
+		name := "Профессиональный вычет: расходы по документам, включая взносы"
+		if standard {
+			name = "Профессиональный вычет: 20% доходов (больше расходов по документам)"
+		}
+		r.Deductions = append(r.Deductions, Deduction{Name: name, Amount: r.Periods[len(r.Periods)-1].Expenses})
+	}
+	r.Allowed = []string{
+		"профессиональный вычет: подтвержденные документами расходы, включая взносы, или 20% доходов",
+		"стандартные, социальные и имущественные вычеты по НДФЛ",
+		"вычет входящего НДС по счетам-фактурам поставщиков",
+	}
+	r.Notes = append(r.Notes, "НДФЛ ИП по прогрессивной шкале с доходов за вычетом профессионального вычета")
+}
+
+func (r *Result) osnoOrg(input Input, through int) {
+	var last Month
+	for _, end := range periodEnds(through) {
+		data := cumulative(input, min(end, through))
+		expenses := data.Expenses + data.Contributions
+		base := max(data.Revenue-expenses, 0)
+		tax := roundRubles(percentOf(base, r.Params.ProfitRate))
+		r.addPeriod(Period{
+			Months: end, Partial: end > through, Revenue: data.Revenue, Expenses: expenses, Base: base,
+			Accrued: tax, Tax: tax,
+		}, PaymentProfit, "Налог на прибыль")
+		last = data
+	}
+	r.Rate = r.Params.ProfitRate
+	r.Deductions = append(r.Deductions, Deduction{Name: "Расходы, включая взносы за сотрудников", Amount: last.Expenses + last.Contributions})
+	r.Allowed = []string{
+		"обоснованные и подтвержденные документами расходы по главе 25 НК РФ",
+		"перенос убытков прошлых лет (не более 50% базы)",
+		"вычет входящего НДС по счетам-фактурам поставщиков",
+	}
+	r.Notes = append(r.Notes, "Авансовые платежи по налогу на прибыль - поквартальные по фактической прибыли")
+}
+
+// vat оценивает НДС по кварталам: налог в доходах минус налог в расходах, уплата тремя равными частями
+// до 28 числа каждого из трех месяцев после квартала
+func (r *Result) vat(input Input, through int) {
+	rate := r.Params.VATRate
+	share := rate / (100 + rate)
+	vat := &VAT{Rate: rate}
+	quarterNames := []string{"I", "II", "III", "IV"}
+	for q := 0; q*3 < through; q++ {
+		var output, deductible float64
+		for m := q * 3; m < min(q*3+3, through); m++ {
+			output += float64(input.Months[m].Revenue) * share
+			deductible += float64(input.Months[m].Expenses) * share
+		}
+		tax := max(roundRubles(output-deductible), 0)
+		vat.Output += int64(math.Round(output))
+		vat.Input += int64(math.Round(deductible))
+		vat.Tax += tax
+		if tax == 0 {
+			continue
+		}
+		part := roundRubles(float64(tax) / 3)
+		for i := 0; i < 3; i++ {
+			amount := part
+			if i == 2 {
+				amount = tax - 2*part
+			}
+			r.Payments = append(r.Payments, Payment{
+				Code:   PaymentVAT,
+				Name:   fmt.Sprintf("НДС за %s квартал (%d/3)", quarterNames[q], i+1),
+				Amount: amount, Due: Deadline(r.Year, time.Month(q*3+4+i), 28),
+			})
+		}
+	}
+	r.VAT = vat
+	r.Notes = append(r.Notes, fmt.Sprintf("НДС %g%% оценен по оборотам: все доходы и расходы считаются облагаемыми, точная сумма - по счетам-фактурам", rate))
+}
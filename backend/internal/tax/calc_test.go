@@ -0,0 +1,284 @@
+package tax
+
+import (
+	"testing"
+	"time"
+)
+
+// monthly - одинаковые доходы, расходы и взносы за сотрудников во всех месяцах года, рубли
+func monthly(year int, revenue, expenses, contributions int64) Input {
+	input := Input{Year: year, Employees: contributions > 0}
+	for i := range input.Months {
+		input.Months[i] = Month{Revenue: revenue * 100, Expenses: expenses * 100, Contributions: contributions * 100}
+	}
+	return input
+}
+
+// Параметры 2026 года: фиксированные взносы ИП 57 390 ₽, предельный взнос 1% - 321 818 ₽
+func TestUSNIncome(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		input   Input
+		due     []int64 // к уплате по периодам, рубли
+		tax     int64
+	}{
+		{
+			// 6% с 1,2 млн = 72 000, взносы 57 390 + 1% с 900 000 = 66 390 уменьшают налог полностью
+			name:    "ИП без сотрудников",
+			profile: Profile{Regime: RegimeUSNIncome, Form: FormIP},
+			input:   monthly(2026, 100_000, 0, 0),
+			due:     []int64{0, 0, 0, 5_610},
+			tax:     5_610,
+		},
+		{
+			// Взносы за сотрудников 30 000 в месяц больше половины налога: налог уменьшается на 50%
+			name:    "ИП с сотрудниками, ограничение 50%",
+			profile: Profile{Regime: RegimeUSNIncome, Form: FormIP},
+			input:   monthly(2026, 100_000, 0, 30_000),
+			due:     []int64{9_000, 9_000, 9_000, 9_000},
+			tax:     36_000,
+		},
+		{
+			// Ставка региона 1%: 12 000 налога меньше фиксированных взносов
+			name:    "ИП с льготной ставкой",
+			profile: Profile{Regime: RegimeUSNIncome, Form: FormIP, Rate: 1},
+			input:   monthly(2026, 100_000, 0, 0),
+			due:     []int64{0, 0, 0, 0},
+			tax:     0,
+		},
+		{
+			name:    "организация с сотрудниками",
+			profile: Profile{Regime: RegimeUSNIncome, Form: FormOrg},
+			input:   monthly(2026, 100_000, 0, 5_000),
+			due:     []int64{9_000, 9_000, 9_000, 9_000},
+			tax:     36_000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Calculate(tt.profile, tt.input)
+			if err != nil {
+				t.Fatalf("Calculate: %v", err)
+			}
+			checkPeriods(t, r, tt.due, tt.tax)
+		})
+	}
+}
+
+func checkPeriods(t *testing.T, r *Result, due []int64, tax int64) {
+	t.Helper()
+	if len(r.Periods) != len(due) {
+		t.Fatalf("%d periods, want %d", len(r.Periods), len(due))
+	}
+	for i, p := range r.Periods {
+		if p.Due != due[i]*100 {
+			t.Errorf("period %s: due %d, want %d", p.Name, p.Due/100, due[i])
+		}
+	}
+	if r.Tax != tax*100 {
+		t.Errorf("tax %d, want %d", r.Tax/100, tax)
+	}
+}
+
+func TestIPAdditionalContributionCap(t *testing.T) {
+	tests := []struct {
+		revenue    int64 // рубли за год
+		additional int64
+	}{
+		{300_000, 0},
+		{1_300_000, 10_000},
+		{32_481_800, 321_818},
+		{50_000_000, 321_818}, // 1% = 497 000, но не больше предельной суммы
+	}
+	for _, tt := range tests {
+		input := Input{Year: 2026}
+		input.Months[0].Revenue = tt.revenue * 100
+		r, err := Calculate(Profile{Regime: RegimeUSNIncome, Form: FormIP}, input)
+		if err != nil {
+			t.Fatalf("Calculate: %v", err)
+		}
+		if r.Contributions.Fixed != 57_390_00 || r.Contributions.Additional != tt.additional*100 {
+			t.Errorf("revenue %d: contributions %+v, want additional %d", tt.revenue, r.Contributions, tt.additional)
+		}
+	}
+}
+
+func TestUSNProfitMinimalTax(t *testing.T) {
+	tests := []struct {
+		name     string
+		revenue  int64
+		expenses int64
+		tax      int64
+	}{
+		// База 1 000 000 - 990 000 - 57 390 < 0, минимальный налог 1% с доходов
+		{"минимальный налог", 1_000_000, 990_000, 10_000},
+		// 15% с 1 000 000 - 500 000 - 57 390 - 2 000 (1% с 500 000 сверх 300 000) = 440 610 -> 66 092
+		{"налог больше минимального", 1_000_000, 500_000, 66_092},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := Input{Year: 2026}
+			input.Months[0] = Month{Revenue: tt.revenue * 100, Expenses: tt.expenses * 100}
+			r, err := Calculate(Profile{Regime: RegimeUSNProfit, Form: FormIP}, input)
+			if err != nil {
+				t.Fatalf("Calculate: %v", err)
+			}
+			if r.Tax != tt.tax*100 {
+				t.Errorf("tax %d, want %d", r.Tax/100, tt.tax)
+			}
+			if last := r.Periods[len(r.Periods)-1]; !last.DueDate.Equal(time.Date(2027, 4, 28, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("annual due date %s", last.DueDate.Format("2006-01-02"))
+			}
+		})
+	}
+}
+
+func TestPatent(t *testing.T) {
+	tests := []struct {
+		name      string
+		profile   Profile
+		employees bool
+		payments  []int64
+		dates     []string
+	}{
+		{
+			// 6% с 1 200 000 = 72 000 минус взносы 66 390; треть - в первые 90 дней
+			name:     "на год, оплата частями",
+			profile:  Profile{Regime: RegimePSN, Form: FormIP, PatentIncome: 1_200_000_00},
+			payments: []int64{1_870, 3_740},
+			dates:    []string{"2026-03-31", "2026-12-31"},
+		},
+		{
+			// 6% с 1 800 000 * 6 / 12 = 54 000, с сотрудником взносы уменьшают не более чем на 50%
+			name:      "на 6 месяцев одним платежом",
+			profile:   Profile{Regime: RegimePSN, Form: FormIP, PatentIncome: 1_800_000_00, PatentMonths: 6},
+			employees: true,
+			payments:  []int64{27_000},
+			dates:     []string{"2026-06-30"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Calculate(tt.profile, Input{Year: 2026, Employees: tt.employees})
+			if err != nil {
+				t.Fatalf("Calculate: %v", err)
+			}
+			var patent []Payment
+			for _, p := range r.Payments {
+				if p.Code == PaymentPatent {
+					patent = append(patent, p)
+				}
+			}
+			if len(patent) != len(tt.payments) {
+				t.Fatalf("%d patent payments, want %d", len(patent), len(tt.payments))
+			}
+			for i, p := range patent {
+				if p.Amount != tt.payments[i]*100 || p.Due.Format("2006-01-02") != tt.dates[i] {
+					t.Errorf("payment %d: %d due %s, want %d due %s", i, p.Amount/100, p.Due.Format("2006-01-02"), tt.payments[i], tt.dates[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNPDDeduction(t *testing.T) {
+	tests := []struct {
+		name      string
+		revenue   int64 // рубли в месяц
+		legal     int64 // из них от организаций и ИП
+		tax       int64 // за год
+		deduction int64
+	}{
+		// 4% - 1% вычета: 3 000 в месяц, пока вычет 10 000 не израсходован (10 месяцев), затем 4 000
+		{"доходы от физлиц", 100_000, 0, 38_000, 10_000},
+		// 6% - 2% вычета: 4 000 в месяц 5 месяцев, затем 6 000
+		{"доходы от организаций", 100_000, 100_000, 62_000, 10_000},
+		// Вычет 1% с 10 000 - 100 в месяц, за год 1 200 из 10 000
+		{"небольшие доходы", 10_000, 0, 3_600, 1_200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := Input{Year: 2026}
+			for i := range input.Months {
+				input.Months[i] = Month{Revenue: tt.revenue * 100, RevenueLegal: tt.legal * 100}
+			}
+			r, err := Calculate(Profile{Regime: RegimeNPD, Form: FormIP}, input)
+			if err != nil {
+				t.Fatalf("Calculate: %v", err)
+			}
+			if r.Tax != tt.tax*100 {
+				t.Errorf("tax %d, want %d", r.Tax/100, tt.tax)
+			}
+			if len(r.Deductions) != 1 || r.Deductions[0].Amount != tt.deduction*100 {
+				t.Errorf("deductions %+v, want %d", r.Deductions, tt.deduction)
+			}
+		})
+	}
+}
+
+// НДФЛ ИП на общей системе: 13% до 2,4 млн базы, 15% сверх
+func TestOSNOIPProgressiveNDFL(t *testing.T) {
+	tests := []struct {
+		revenue int64 // рубли, профессиональный вычет 20%
+		tax     int64
+	}{
+		{3_000_000, 312_000}, // база ровно 2 400 000
+		{3_125_000, 327_000}, // база 2 500 000: 312 000 + 15% с 100 000
+		{1_000_000, 104_000},
+	}
+	for _, tt := range tests {
+		input := Input{Year: 2026}
+		input.Months[0].Revenue = tt.revenue * 100
+		r, err := Calculate(Profile{Regime: RegimeOSNO, Form: FormIP}, input)
+		if err != nil {
+			t.Fatalf("Calculate: %v", err)
+		}
+		if r.Tax != tt.tax*100 {
+			t.Errorf("revenue %d: tax %d, want %d", tt.revenue, r.Tax/100, tt.tax)
+		}
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	tests := []struct {
+		year  int
+		month time.Month
+		day   int
+		want  string
+	}{
+		{2026, time.April, 28, "2026-04-28"},    // вторник
+		{2026, time.March, 28, "2026-03-30"},    // суббота
+		{2027, time.March, 28, "2027-03-29"},    // воскресенье
+		{2026, time.February, 23, "2026-02-24"}, // праздник
+		{2026, time.March, 8, "2026-03-10"},     // праздник в воскресенье переносится на понедельник
+		{2026, time.May, 9, "2026-05-12"},       // праздник в субботу переносится на понедельник
+		{2026, time.June, 12, "2026-06-15"},     // праздник в пятницу
+		{2027, time.November, 4, "2027-11-05"},
+		{2027, time.January, 1, "2027-01-11"}, // новогодние каникулы
+	}
+	for _, tt := range tests {
+		if got := Deadline(tt.year, tt.month, tt.day).Format("2006-01-02"); got != tt.want {
+			t.Errorf("Deadline(%d, %s, %d) = %s, want %s", tt.year, tt.month, tt.day, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		profile Profile
+		valid   bool
+	}{
+		{Profile{Regime: RegimeUSNIncome, Form: FormIP}, true},
+		{Profile{Regime: RegimeUSNProfit, Form: FormOrg, Rate: 5}, true},
+		{Profile{Regime: RegimeUSNIncome, Form: FormIP, Rate: 7}, false},
+		{Profile{Regime: RegimeNPD, Form: FormOrg}, false},
+		{Profile{Regime: RegimePSN, Form: FormIP, PatentMonths: 13}, false},
+		{Profile{Regime: "eshn", Form: FormIP}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.profile.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%+v) = %v, want valid %v", tt.profile, err, tt.valid)
+		}
+	}
+}
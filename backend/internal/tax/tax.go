@@ -0,0 +1,259 @@
+// Package tax считает налоги малого бизнеса по системе налогообложения: УСН "доходы" и "доходы минус
+// расходы", патент, налог на профессиональный доход и общую систему. По доходам и расходам за месяцы
+// года считаются налоговая база, авансовые платежи по отчетным периодам, фиксированные взносы ИП
+// и вычеты, которые уменьшают налог. Расчет детерминированный и не зависит от модели.
+package tax
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Системы налогообложения
+const (
+	RegimeUSNIncome = "usn_income"         // УСН "доходы"
+	RegimeUSNProfit = "usn_income_expense" // УСН "доходы минус расходы"
+	RegimePSN       = "psn"                // патент
+	RegimeNPD       = "npd"                // налог на профессиональный доход (самозанятые)
+	RegimeOSNO      = "osno"               // общая система
+)
+
+// RegimeOrder - системы налогообложения в порядке показа
+var RegimeOrder = []string{RegimeUSNIncome, RegimeUSNProfit, RegimePSN, RegimeNPD, RegimeOSNO}
+
+// RegimeNames - названия систем налогообложения для пользователя и промпта
+var RegimeNames = map[string]string{
+	RegimeUSNIncome: "УСН \"доходы\"",
+	RegimeUSNProfit: "УСН \"доходы минус расходы\"",
+	RegimePSN:       "Патентная система (ПСН)",
+	RegimeNPD:       "Налог на профессиональный доход (НПД)",
+	RegimeOSNO:      "Общая система (ОСНО)",
+}
+
+// Виды платежей: по ним календарь сроков находит сумму рассчитанного платежа
+const (
+	PaymentUSN          = "usn"           // налог и авансовые платежи по УСН
+	PaymentPatent       = "patent"        // стоимость патента
+	PaymentNPD          = "npd"           // налог на профессиональный доход
+	PaymentNDFL         = "ndfl_ip"       // НДФЛ ИП на общей системе
+	PaymentProfit       = "profit"        // налог на прибыль
+	PaymentVAT          = "vat"           // НДС
+	PaymentIPFixed      = "ip_fixed"      // фиксированные взносы ИП за себя
+	PaymentIPAdditional = "ip_additional" // взнос ИП 1% с дохода сверх 300 000 ₽
+)
+
+// Организационно-правовые формы
+const (
+	FormIP  = "ip"  // индивидуальный предприниматель
+	FormOrg = "org" // организация (ООО)
+)
+
+// FormNames - названия форм для пользователя
+var FormNames = map[string]string{
+	FormIP:  "ИП",
+	FormOrg: "Организация",
+}
+
+// Params - параметры года. Суммы в копейках, ставки в процентах.
+type Params struct {
+	Year int
+	// IPFixed - фиксированные страховые взносы ИП за себя за полный год
+	IPFixed int64
+	// IPAdditionalCap - предельная сумма взноса 1% с дохода сверх 300 000 ₽
+	IPAdditionalCap int64
+	// USNLimit - доход с начала года, при превышении которого теряется право на УСН
+	USNLimit int64
+	// USNVATThreshold - доход, сверх которого плательщик УСН платит НДС; 0 - НДС на УСН не платится
+	USNVATThreshold int64
+	// VATRate - общая ставка НДС
+	VATRate float64
+	// ProfitRate - ставка налога на прибыль организаций
+	ProfitRate float64
+}
+
+// paramsByYear - параметры по годам. Новый год нужно добавлять сюда: для лет, которых нет в таблице,
+// используются параметры ближайшего предыдущего года.
+var paramsByYear = map[int]Params{
+	2024: {
+		Year: 2024, IPFixed: 49_500_00, IPAdditionalCap: 277_571_00, USNLimit: 265_800_000_00,
+		VATRate: 20, ProfitRate: 20,
+	},
+	2025: {
+		Year: 2025, IPFixed: 53_658_00, IPAdditionalCap: 300_888_00, USNLimit: 450_000_000_00,
+		USNVATThreshold: 60_000_000_00, VATRate: 20, ProfitRate: 25,
+	},
+	2026: {
+		Year: 2026, IPFixed: 57_390_00, IPAdditionalCap: 321_818_00, USNLimit: 490_500_000_00,
+		USNVATThreshold: 20_000_000_00, VATRate: 22, ProfitRate: 25,
+	},
+}
+
+// Постоянные параметры
+const (
+	ipAdditionalThreshold = 300_000_00    // доход ИП, сверх которого платится взнос 1%
+	ipAdditionalRate      = 1.0           // взнос с дохода сверх порога, %
+	usnMinimalRate        = 1.0           // минимальный налог на УСН "доходы минус расходы", % от доходов
+	npdLimit              = 2_400_000_00  // предельный доход самозанятого за год
+	npdDeduction          = 10_000_00     // налоговый вычет самозанятого
+	psnLimit              = 60_000_000_00 // предельный доход на патенте за год
+	osnoStandardDeduction = 20.0          // профессиональный вычет ИП без документов, % доходов
+)
+
+// Ставки НПД, %: обычные и с учетом налогового вычета
+const (
+	npdRateIndividuals     = 4.0
+	npdRateLegal           = 6.0
+	npdDeductionIndividual = 1.0 // вычет уменьшает ставку 4% до 3%
+	npdDeductionLegal      = 2.0 // и ставку 6% до 4%
+)
+
+// ParamsFor - параметры года; exact=false, если года нет в таблице и взяты параметры ближайшего
+func ParamsFor(year int) (params Params, exact bool) {
+	if params, ok := paramsByYear[year]; ok {
+		return params, true
+	}
+	years := make([]int, 0, len(paramsByYear))
+	for y := range paramsByYear {
+		years = append(years, y)
+	}
+	sort.Ints(years)
+	nearest := years[0]
+	for _, y := range years {
+		if y <= year {
+			nearest = y
+		}
+	}
+	return paramsByYear[nearest], false
+}
+
+// Profile - налоговые настройки бизнеса
+type Profile struct {
+	Regime string
+	Form   string
+	// Rate - ставка региона в процентах для УСН и ПСН; 0 - общая ставка (6% или 15%)
+	Rate float64
+	// PatentIncome - потенциально возможный годовой доход по патенту, копейки
+	PatentIncome int64
+	// PatentMonths - срок патента в месяцах с начала года; 0 - весь год
+	PatentMonths int
+}
+
+// DefaultRate - общая ставка системы налогообложения, %; 0 - у системы нет единой ставки
+func DefaultRate(regime string) float64 {
+	switch regime {
+	case RegimeUSNIncome, RegimePSN:
+		return 6
+	case RegimeUSNProfit:
+		return 15
+	}
+	return 0
+}
+
+// Validate проверяет налоговые настройки
+func (p Profile) Validate() error {
+	if _, ok := RegimeNames[p.Regime]; !ok {
+		return fmt.Errorf("unknown tax regime %q", p.Regime)
+	}
+	if _, ok := FormNames[p.Form]; !ok {
+		return fmt.Errorf("unknown legal form %q", p.Form)
+	}
+	if p.Form == FormOrg && (p.Regime == RegimePSN || p.Regime == RegimeNPD) {
+		return errors.New("patent and professional income tax are available only to individual entrepreneurs")
+	}
+	if p.Rate < 0 || (p.Rate > 0 && p.Rate > DefaultRate(p.Regime)) {
+		return fmt.Errorf("tax rate %.2f is not allowed for regime %s", p.Rate, p.Regime)
+	}
+	if p.PatentIncome < 0 {
+		return errors.New("patent income must not be negative")
+	}
+	if p.PatentMonths < 0 || p.PatentMonths > 12 {
+		return errors.New("patent term must be from 1 to 12 months")
+	}
+	return nil
+}
+
+// rate - ставка профиля или общая ставка системы
+func (p Profile) rate() float64 {
+	if p.Rate > 0 {
+		return p.Rate
+	}
+	return DefaultRate(p.Regime)
+}
+
+// Month - данные месяца для расчета. Суммы в копейках.
+type Month struct {
+	Revenue  int64 // доходы
+	Expenses int64 // расходы без налогов и взносов
+	// RevenueLegal - часть доходов от организаций и ИП (для НПД ставка 6% вместо 4%)
+	RevenueLegal int64
+	// Contributions - страховые взносы за сотрудников и на травматизм, начисленные за месяц
+	Contributions int64
+}
+
+// Input - доходы и расходы года по месяцам
+type Input struct {
+	Year   int
+	Months [12]Month
+	// Through - сколько месяцев с начала года есть в данных; 0 - весь год
+	Through int
+	// Employees - у бизнеса есть сотрудники (ИП с сотрудниками уменьшает налог на взносы не более чем на 50%)
+	Employees bool
+}
+
+// Deadline - срок уплаты: если день выпадает на выходной или нерабочий праздничный день,
+// срок переносится на следующий рабочий день (п. 7 ст. 6.1 НК РФ)
+func Deadline(year int, month time.Month, day int) time.Time {
+	return workday(time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
+}
+
+// workday переносит дату на ближайший рабочий день
+func workday(date time.Time) time.Time {
+	for !IsWorkday(date) {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date
+}
+
+// holidays - нерабочие праздничные дни по ст. 112 ТК РФ, кроме новогодних каникул и Рождества (1-8 января)
+var holidays = []struct {
+	month time.Month
+	day   int
+}{
+	{time.February, 23}, {time.March, 8}, {time.May, 1}, {time.May, 9}, {time.June, 12}, {time.November, 4},
+}
+
+// IsWorkday - рабочий день: не суббота, не воскресенье и не праздник. Праздник, совпавший с выходным,
+// переносит выходной на следующий рабочий день (кроме 1-8 января). Переносы выходных, которые
+// правительство устанавливает постановлением на каждый год (например, на 31 декабря), не учитываются.
+func IsWorkday(date time.Time) bool {
+	if weekend(date) || (date.Month() == time.January && date.Day() <= 8) {
+		return false
+	}
+	for _, h := range holidays {
+		holiday := time.Date(date.Year(), h.month, h.day, 0, 0, 0, 0, time.UTC)
+		if sameDay(date, holiday) {
+			return false
+		}
+		// Праздник в субботу или воскресенье переносит выходной на следующий рабочий день
+		if weekend(holiday) {
+			transferred := holiday.AddDate(0, 0, 1)
+			for weekend(transferred) {
+				transferred = transferred.AddDate(0, 0, 1)
+			}
+			if sameDay(date, transferred) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func weekend(date time.Time) bool {
+	return date.Weekday() == time.Saturday || date.Weekday() == time.Sunday
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.Month() == b.Month() && a.Day() == b.Day()
+}
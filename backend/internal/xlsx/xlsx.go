@@ -0,0 +1,262 @@
+// Package xlsx читает листы книг Excel (.xlsx) в виде таблиц строк и ячеек.
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Workbook - листы книги в порядке их следования
+type Workbook struct {
+	Sheets   []Sheet
+	Warnings []string // листы и части книги, которые не удалось прочитать
+}
+
+// Sheet - лист книги; пустые строки пропускаются
+type Sheet struct {
+	Name string
+	Rows []Row
+}
+
+// Row - строка листа. Cells[i] - ячейка в столбце i (A = 0), пустые ячейки - "".
+type Row struct {
+	Num   int // номер строки в листе (с 1)
+	Cells []string
+}
+
+// Read разбирает книгу .xlsx
+func Read(data []byte) (*Workbook, error) {
+	// .xlsx это ZIP архив, открываем его
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия Excel файла как ZIP: %v", err)
+	}
+
+	entries := make(map[string]*zip.File)
+	for _, f := range r.File {
+		entries[f.Name] = f
+	}
+
+	wb := &Workbook{}
+
+	// Общие строки, на которые ссылаются ячейки с t="s"
+	var sharedStrings []string
+	if f, ok := entries["xl/sharedStrings.xml"]; ok {
+		content, err := readZipEntry(f)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения sharedStrings.xml: %v", err)
+		}
+		if sharedStrings, err = parseSharedStrings(content); err != nil {
+			wb.Warnings = append(wb.Warnings, fmt.Sprintf("Не удалось прочитать общие строки книги, текстовые ячейки показаны номерами: %v", err))
+		}
+	}
+
+	for _, sheet := range listSheets(entries) {
+		f, ok := entries[sheet.path]
+		if !ok {
+			wb.Warnings = append(wb.Warnings, fmt.Sprintf("Лист \"%s\" не найден в файле", sheet.name))
+			continue
+		}
+		content, err := readZipEntry(f)
+		if err != nil {
+			wb.Warnings = append(wb.Warnings, fmt.Sprintf("Лист \"%s\" не прочитан: %v", sheet.name, err))
+			continue
+		}
+		rows, err := parseSheetRows(content, sharedStrings)
+		if err != nil {
+			wb.Warnings = append(wb.Warnings, fmt.Sprintf("Лист \"%s\" не разобран: %v", sheet.name, err))
+			continue
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		wb.Sheets = append(wb.Sheets, Sheet{Name: sheet.name, Rows: rows})
+	}
+
+	return wb, nil
+}
+
+type sheetRef struct {
+	name string
+	path string
+}
+
+// listSheets возвращает листы книги в порядке их следования с путями к XML внутри архива
+func listSheets(entries map[string]*zip.File) []sheetRef {
+	type workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	type relationships struct {
+		Items []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+
+	var wb workbook
+	var rels relationships
+	if f, ok := entries["xl/workbook.xml"]; ok {
+		if content, err := readZipEntry(f); err == nil {
+			xml.Unmarshal(content, &wb)
+		}
+	}
+	if f, ok := entries["xl/_rels/workbook.xml.rels"]; ok {
+		if content, err := readZipEntry(f); err == nil {
+			xml.Unmarshal(content, &rels)
+		}
+	}
+
+	targets := make(map[string]string)
+	for _, rel := range rels.Items {
+		target := strings.TrimPrefix(rel.Target, "/")
+		if !strings.HasPrefix(target, "xl/") {
+			target = path.Join("xl", target)
+		}
+		targets[rel.ID] = target
+	}
+
+	var sheets []sheetRef
+	for _, s := range wb.Sheets {
+		if target, ok := targets[s.RID]; ok {
+			sheets = append(sheets, sheetRef{name: s.Name, path: target})
+		}
+	}
+	if len(sheets) > 0 {
+		return sheets
+	}
+
+	// Книга без workbook.xml/rels - берем листы по именам файлов
+	var names []string
+	for name := range entries {
+		if strings.HasPrefix(name, "xl/worksheets/sheet") && strings.HasSuffix(name, ".xml") {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return sheetIndex(names[i]) < sheetIndex(names[j]) })
+	for _, name := range names {
+		sheets = append(sheets, sheetRef{name: fmt.Sprintf("Лист%d", sheetIndex(name)), path: name})
+	}
+	return sheets
+}
+
+func sheetIndex(name string) int {
+	n, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "xl/worksheets/sheet"), ".xml"))
+	return n
+}
+
+func parseSharedStrings(content []byte) ([]string, error) {
+	type sst struct {
+		Items []struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	var table sst
+	if err := xml.Unmarshal(content, &table); err != nil {
+		return nil, err
+	}
+	result := make([]string, len(table.Items))
+	for i, item := range table.Items {
+		text := item.Text
+		for _, run := range item.Runs {
+			text += run.Text
+		}
+		result[i] = text
+	}
+	return result, nil
+}
+
+// parseSheetRows извлекает непустые строки листа. Столбец ячейки берется из ее адреса ("C5"),
+// а без адреса - по порядку ячеек в строке.
+func parseSheetRows(content []byte, sharedStrings []string) ([]Row, error) {
+	type worksheet struct {
+		Rows []struct {
+			Num   int `xml:"r,attr"`
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	var ws worksheet
+	if err := xml.Unmarshal(content, &ws); err != nil {
+		return nil, err
+	}
+
+	var rows []Row
+	for i, row := range ws.Rows {
+		var cells []string
+		for j, cell := range row.Cells {
+			value := cell.Value
+			switch cell.Type {
+			case "s":
+				if idx, err := strconv.Atoi(value); err == nil && idx >= 0 && idx < len(sharedStrings) {
+					value = sharedStrings[idx]
+				}
+			case "inlineStr":
+				value = cell.Inline
+			}
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			column := columnIndex(cell.Ref)
+			if column < 0 {
+				column = j
+			}
+			for len(cells) <= column {
+				cells = append(cells, "")
+			}
+			cells[column] = value
+		}
+		if len(cells) == 0 {
+			continue
+		}
+		num := row.Num
+		if num == 0 {
+			num = i + 1
+		}
+		rows = append(rows, Row{Num: num, Cells: cells})
+	}
+	return rows, nil
+}
+
+// columnIndex - номер столбца по адресу ячейки ("A1" - 0, "AB12" - 27); -1, если адреса нет
+func columnIndex(ref string) int {
+	column := 0
+	letters := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A') + 1
+		letters++
+	}
+	if letters == 0 || letters > 3 {
+		return -1
+	}
+	return column - 1
+}
+
+func readZipEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
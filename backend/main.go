@@ -1,8 +1,11 @@
 package main
 
 import (
+	"alfa-hack-backend/internal/ai"
 	"alfa-hack-backend/internal/api"
+	"alfa-hack-backend/internal/calendar"
 	"alfa-hack-backend/internal/database"
+	"alfa-hack-backend/internal/storage"
 	"log"
 	"os"
 	"path/filepath"
@@ -40,6 +43,23 @@ func main() {
 		log.Fatalf("Failed to create tables: %v", err)
 	}
 
+	// Хранилище загруженных файлов (локальный диск или S3-совместимое)
+	store, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize file storage: %v", err)
+	}
+	ai.SetStorage(store)
+
+	// Инициализация API handlers
+	apiHandler := api.NewHandler(db, store)
+
+	// Служебные команды вместо запуска сервера
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		code := runReconcile(apiHandler, os.Args[2:])
+		db.Close()
+		os.Exit(code)
+	}
+
 	// Инициализация роутера
 	router := gin.Default()
 
@@ -60,13 +80,23 @@ func main() {
 		}
 		return false
 	}
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
 	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
 	config.AllowCredentials = true
 	router.Use(cors.New(config))
 
-	// Инициализация API handlers
-	apiHandler := api.NewHandler(db)
+	// Фоновая обработка загруженных файлов; разобранные документы кешируются в базе
+	ai.SetDocumentCache(apiHandler)
+	apiHandler.PruneParseCache()
+	apiHandler.StartIngestion()
+	// Периодическая сверка хранилища с базой (go run . reconcile - вручную)
+	apiHandler.StartReconciler()
+	// Напоминания о налоговых и отчетных сроках
+	notifier, err := calendar.NotifierFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize reminder notifier: %v", err)
+	}
+	apiHandler.StartReminders(notifier)
 
 	// API routes
 	apiRoutes := router.Group("/api")
@@ -81,20 +111,67 @@ func main() {
 		{
 			// Пользователь
 			protected.GET("/user", apiHandler.GetUser)
+			protected.GET("/user/profile", apiHandler.GetProfile)
+			protected.PUT("/user/profile", apiHandler.UpdateProfile)
 
 			// Файлы
 			protected.POST("/files/upload", apiHandler.UploadFile)
 			protected.GET("/files", apiHandler.GetFiles)
+			protected.GET("/files/folders", apiHandler.GetFolders)
+			protected.GET("/files/tags", apiHandler.GetTags)
+			protected.GET("/files/kinds", apiHandler.GetDocKinds)
+			protected.PATCH("/files/:id", apiHandler.UpdateFile)
 			protected.DELETE("/files/:id", apiHandler.DeleteFile)
+			protected.GET("/files/:id/download", apiHandler.DownloadFile)
+			protected.GET("/files/:id/text", apiHandler.GetFileText)
+			protected.GET("/files/:id/status", apiHandler.GetFileStatus)
+			protected.POST("/files/:id/reprocess", apiHandler.ReprocessFile)
+			protected.GET("/files/:id/versions", apiHandler.GetFileVersions)
+			protected.GET("/files/:id/versions/diff", apiHandler.DiffFileVersions)
+			protected.POST("/files/:id/versions/:version/restore", apiHandler.RestoreFileVersion)
+			protected.PUT("/files/:id/pin", apiHandler.PinFileVersion)
 
 			// Чаты
 			protected.POST("/chats", apiHandler.CreateChat)
 			protected.GET("/chats", apiHandler.GetChats)
 			protected.DELETE("/chats/:id", apiHandler.DeleteChat)
+			protected.GET("/chats/:id/files", apiHandler.GetChatFiles)
+			protected.PUT("/chats/:id/files", apiHandler.SetChatFiles)
 
 			// Сообщения
 			protected.POST("/chat", apiHandler.SendMessage)
 			protected.GET("/chat/:chatId/history", apiHandler.GetChatHistory)
+
+			// Операции из банковских выписок
+			protected.GET("/transactions", apiHandler.GetTransactions)
+			protected.GET("/transactions/summary", apiHandler.GetTransactionsSummary)
+			protected.GET("/transactions/statements", apiHandler.GetBankStatements)
+			protected.GET("/transactions/categories", apiHandler.GetTransactionCategories)
+			protected.POST("/transactions/categorize", apiHandler.CategorizeTransactions)
+			protected.GET("/transactions/rules", apiHandler.GetCategoryRules)
+			protected.POST("/transactions/rules", apiHandler.CreateCategoryRule)
+			protected.DELETE("/transactions/rules/:id", apiHandler.DeleteCategoryRule)
+			protected.PATCH("/transactions/:id", apiHandler.UpdateTransactionCategory)
+			protected.GET("/cashflow", apiHandler.GetCashFlow)
+			protected.GET("/cashflow/forecast", apiHandler.GetCashFlowForecast)
+			protected.GET("/receipts", apiHandler.GetReceipts)
+			protected.GET("/receipts/summary", apiHandler.GetReceiptsSummary)
+			protected.GET("/marketplace/reports", apiHandler.GetMarketplaceReports)
+			protected.GET("/marketplace/skus", apiHandler.GetMarketplaceSKUs)
+			protected.GET("/edo/documents", apiHandler.GetEDODocuments)
+			protected.GET("/edo/documents/:id", apiHandler.GetEDODocument)
+			protected.GET("/payroll", apiHandler.GetPayroll)
+			protected.GET("/payroll/employees", apiHandler.GetEmployees)
+			protected.GET("/tax", apiHandler.GetTax)
+			protected.POST("/tax/calculate", apiHandler.CalculateTax)
+			protected.GET("/calendar", apiHandler.GetCalendar)
+			protected.GET("/calendar.ics", apiHandler.GetCalendarICS)
+
+			// Промпты
+			protected.POST("/prompt/preview", apiHandler.PreviewPrompt)
+
+			// Метрики
+			protected.GET("/metrics/parse-cache", apiHandler.GetParseCacheStats)
 		}
 	}
 
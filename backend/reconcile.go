@@ -0,0 +1,112 @@
+package main
+
+import (
+	"alfa-hack-backend/internal/api"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+// runReconcile - команда "reconcile": сверка хранилища файлов с базой.
+// Код выхода: 0 - расхождений нет (или все исправлены), 1 - ошибка, 2 - найдены расхождения.
+//
+//	go run . reconcile           # только отчет
+//	go run . reconcile -repair   # удалить лишние объекты и записи
+//	go run . reconcile -json     # отчет в JSON
+func runReconcile(h *api.Handler, args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	repair := flags.Bool("repair", false, "delete orphaned objects and rows, drop versions whose content is missing")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	flags.Parse(args)
+
+	report, err := h.Reconcile(context.Background(), *repair)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Reconciliation failed: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		printReconcileReport(report)
+	}
+
+	switch {
+	case len(report.Errors) > 0:
+		return 1
+	case report.HasProblems() && !*repair:
+		return 2
+	}
+	return 0
+}
+
+func printReconcileReport(r *api.ReconcileReport) {
+	fmt.Println(r.Summary())
+
+	if len(r.OrphanBlobs) > 0 {
+		fmt.Println("\nOrphaned objects (no file version refers to them):")
+		for _, o := range r.OrphanBlobs {
+			fmt.Printf("  %s\t%d bytes\t%s\n", o.Key, o.Size, o.ModTime.Format("2006-01-02 15:04"))
+		}
+	}
+	if len(r.StaleTemp) > 0 {
+		fmt.Println("\nStale temporary files:")
+		for _, o := range r.StaleTemp {
+			fmt.Printf("  %s\t%d bytes\n", o.Key, o.Size)
+		}
+	}
+	if len(r.MissingBlobs) > 0 {
+		fmt.Println("\nFile versions with missing content:")
+		for _, m := range r.MissingBlobs {
+			current := ""
+			if m.Current {
+				current = " (current)"
+			}
+			fmt.Printf("  %s %q version %d%s: %s\n", m.FileID, m.Filename, m.Version, current, m.Key)
+		}
+	}
+	if len(r.SizeMismatches) > 0 {
+		fmt.Println("\nSize mismatches:")
+		for _, m := range r.SizeMismatches {
+			fmt.Printf("  %s version %d: database %d bytes, storage %d bytes\n", m.FileID, m.Version, m.DBSize, m.StorageSize)
+		}
+	}
+	if len(r.DanglingRows) > 0 {
+		fmt.Println("\nRows referring to deleted files:")
+		tables := make([]string, 0, len(r.DanglingRows))
+		for table := range r.DanglingRows {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+		for _, table := range tables {
+			fmt.Printf("  %s: %d\n", table, r.DanglingRows[table])
+		}
+	}
+	if len(r.Errors) > 0 {
+		fmt.Println("\nErrors:")
+		for _, e := range r.Errors {
+			fmt.Printf("  %s\n", e)
+		}
+	}
+
+	if len(r.Users) > 0 {
+		fmt.Println("\nStorage usage by user:")
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "  USER\tID\tFILES\tVERSIONS\tDATABASE\tSTORAGE\tORPHANED")
+		for _, u := range r.Users {
+			username := u.Username
+			if username == "" {
+				username = "(unknown)"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%d\t%d\t%d\t%d\t%d\n",
+				username, u.UserID, u.Files, u.Versions, u.DBBytes, u.StorageBytes, u.OrphanBytes)
+		}
+		w.Flush()
+	}
+}
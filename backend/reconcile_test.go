@@ -0,0 +1,93 @@
+package main
+
+import (
+	"alfa-hack-backend/internal/api"
+	"alfa-hack-backend/internal/database"
+	"alfa-hack-backend/internal/storage"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runReconcileJSON запускает "reconcile -json" и возвращает код выхода и отчет
+func runReconcileJSON(t *testing.T, h *api.Handler, args ...string) (int, api.ReconcileReport) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	code := runReconcile(h, append(args, "-json"))
+	os.Stdout = stdout
+	w.Close()
+
+	var report api.ReconcileReport
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	return code, report
+}
+
+// Код выхода: 2 - найдены расхождения, 0 - расхождения исправлены или их нет
+func TestRunReconcile(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	dir := t.TempDir()
+	db, err := database.InitDB(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := database.CreateTables(db); err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.NewLocal(filepath.Join(dir, "uploads"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := api.NewHandler(db, store)
+
+	// Здоровый файл, файл без объекта в хранилище и старый объект без записи в базе
+	for _, f := range []struct{ id, key string }{{"healthy", "u1/healthy.txt"}, {"lost", "u1/lost.txt"}} {
+		_, err := db.Exec("INSERT INTO files (id, user_id, filename, file_path, file_type, file_size) VALUES (?, 'u1', ?, ?, 'txt', 4)", f.id, f.id+".txt", f.key)
+		if err == nil {
+			_, err = db.Exec("INSERT INTO file_versions (id, file_id, version, file_path, file_size) VALUES (?, ?, 1, ?, 4)", f.id+"-v1", f.id, f.key)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, key := range []string{"u1/healthy.txt", "u1/orphan.txt"} {
+		if err := store.Put(context.Background(), key, strings.NewReader("data"), 4, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(filepath.Join(store.Root(), "u1", "orphan.txt"), past, past)
+
+	code, report := runReconcileJSON(t, h)
+	if code != 2 || len(report.OrphanBlobs) != 1 || len(report.MissingBlobs) != 1 || report.MissingBlobs[0].FileID != "lost" {
+		t.Fatalf("report: code %d, orphans %+v, missing %+v", code, report.OrphanBlobs, report.MissingBlobs)
+	}
+
+	code, report = runReconcileJSON(t, h, "-repair")
+	if code != 0 || report.Repaired.OrphanBlobsDeleted != 1 || report.Repaired.FilesRemoved != 1 {
+		t.Fatalf("repair: code %d, repaired %+v, errors %v", code, report.Repaired, report.Errors)
+	}
+	var files int
+	db.QueryRow("SELECT COUNT(*) FROM files WHERE id = 'healthy'").Scan(&files)
+	if _, err := storage.ReadAll(context.Background(), store, "u1/healthy.txt"); err != nil || files != 1 {
+		t.Errorf("healthy file: %d rows, content error %v", files, err)
+	}
+
+	if code, report = runReconcileJSON(t, h); code != 0 || report.HasProblems() {
+		t.Errorf("after repair: code %d, %s", code, report.Summary())
+	}
+}
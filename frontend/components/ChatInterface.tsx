@@ -26,6 +26,7 @@ interface Message {
   category?: string
   created_at: string
   chat_id?: string
+  files?: { id: string; filename: string; version: number }[]
 }
 
 interface ChatInterfaceProps {
@@ -176,6 +177,7 @@ export default function ChatInterface({ chatId, onChatCreated }: ChatInterfacePr
                 category: response.category,
                 created_at: response.created_at,
                 chat_id: response.chat_id,
+                files: response.files,
               }
             : msg
         )
@@ -255,6 +257,11 @@ export default function ChatInterface({ chatId, onChatCreated }: ChatInterfacePr
                   <div className="flex justify-start">
                     <div className="bg-gray-100 dark:bg-zinc-800 text-gray-900 dark:text-gray-100 rounded-2xl rounded-tl-sm px-3 py-2.5 sm:px-4 sm:py-3 max-w-[90%] sm:max-w-[85%] md:max-w-[70%] shadow-sm break-words overflow-wrap-anywhere">
                       <p className="text-xs sm:text-sm leading-relaxed whitespace-pre-wrap break-words overflow-wrap-anywhere word-break-break-word">{msg.response}</p>
+                      {msg.files && msg.files.length > 0 && (
+                        <p className="mt-2 text-xs text-gray-500 dark:text-gray-400">
+                          Файлы: {msg.files.map((f) => f.filename).join(', ')}
+                        </p>
+                      )}
                     </div>
                   </div>
                 )}
@@ -9,18 +9,45 @@ interface File {
   file_type: string
   file_size: number
   uploaded_at: string
+  version: number
+  pinned_version: number
+  folder: string
+  description: string
+  tags: string[]
+  period: string
+  doc_kind: string
+  status: string
+  status_error?: string
+}
+
+interface DocKind {
+  kind: string
+  name: string
+}
+
+interface Folder {
+  path: string
+  file_count: number
 }
 
 export default function FileList() {
   const [files, setFiles] = useState<File[]>([])
   const [loading, setLoading] = useState(true)
   const [deleting, setDeleting] = useState<string | null>(null)
+  const [folders, setFolders] = useState<Folder[]>([])
+  const [kinds, setKinds] = useState<DocKind[]>([])
+  const [folderFilter, setFolderFilter] = useState('')
+  const [kindFilter, setKindFilter] = useState('')
 
-  const loadFiles = async () => {
+  const loadFiles = async (silent = false) => {
     try {
-      setLoading(true)
-      const response = await filesAPI.getAll()
+      if (!silent) setLoading(true)
+      const [response, foldersResponse] = await Promise.all([
+        filesAPI.getAll({ folder: folderFilter, doc_kind: kindFilter }),
+        filesAPI.getFolders(),
+      ])
       setFiles(response.files || [])
+      setFolders(foldersResponse.folders || [])
     } catch (error) {
       console.error('Failed to load files:', error)
       setFiles([])
@@ -29,6 +56,13 @@ export default function FileList() {
     }
   }
 
+  useEffect(() => {
+    filesAPI
+      .getKinds()
+      .then((response) => setKinds(response.doc_kinds || []))
+      .catch(() => setKinds([]))
+  }, [])
+
   useEffect(() => {
     loadFiles()
 
@@ -38,7 +72,7 @@ export default function FileList() {
     }
     window.addEventListener('files-updated', handleFilesUpdated)
     return () => window.removeEventListener('files-updated', handleFilesUpdated)
-  }, [])
+  }, [folderFilter, kindFilter])
 
   const handleDelete = async (id: string) => {
     if (!confirm('Вы уверены, что хотите удалить этот файл?')) return
@@ -54,6 +88,47 @@ export default function FileList() {
     }
   }
 
+  const handleDownload = async (file: File) => {
+    try {
+      const blob = await filesAPI.download(file.id)
+      const url = URL.createObjectURL(blob)
+      const link = document.createElement('a')
+      link.href = url
+      link.download = file.filename
+      link.click()
+      URL.revokeObjectURL(url)
+    } catch (error: any) {
+      alert('Ошибка при скачивании файла')
+    }
+  }
+
+  const handleEdit = async (file: File) => {
+    const folder = prompt('Папка (например, Отчеты/2024):', file.folder)
+    if (folder === null) return
+    const tags = prompt('Теги через запятую:', file.tags.join(', '))
+    if (tags === null) return
+    const period = prompt('Период (2024-12, 2024-Q4 или 2024; пусто - определить автоматически):', file.period)
+    if (period === null) return
+
+    try {
+      await filesAPI.update(file.id, { folder, tags: tags.split(','), period })
+      // Обновит список вместе с папками
+      window.dispatchEvent(new Event('files-updated'))
+    } catch (error: any) {
+      alert(error.response?.data?.error || 'Ошибка при сохранении')
+    }
+  }
+
+  // Пока файлы обрабатываются, периодически обновляем список
+  const processing = files.some((f) => f.status === 'queued' || f.status === 'processing')
+  useEffect(() => {
+    if (!processing) return
+    const timer = setTimeout(() => loadFiles(true), 2000)
+    return () => clearTimeout(timer)
+  }, [files, processing])
+
+  const kindName = (kind: string) => kinds.find((k) => k.kind === kind)?.name || kind
+
   const formatDate = (dateString: string) => {
     const date = new Date(dateString)
     return date.toLocaleString('ru-RU')
@@ -71,6 +146,33 @@ export default function FileList() {
         📁 Загруженные файлы
       </h2>
 
+      <div className="flex flex-col sm:flex-row gap-2 mb-4">
+        <select
+          value={folderFilter}
+          onChange={(e) => setFolderFilter(e.target.value)}
+          className="px-3 py-2 border border-gray-200 dark:border-zinc-700 rounded-lg bg-white dark:bg-zinc-900 text-sm text-gray-700 dark:text-gray-300"
+        >
+          <option value="">Все папки</option>
+          {folders.map((folder) => (
+            <option key={folder.path} value={folder.path}>
+              {folder.path} ({folder.file_count})
+            </option>
+          ))}
+        </select>
+        <select
+          value={kindFilter}
+          onChange={(e) => setKindFilter(e.target.value)}
+          className="px-3 py-2 border border-gray-200 dark:border-zinc-700 rounded-lg bg-white dark:bg-zinc-900 text-sm text-gray-700 dark:text-gray-300"
+        >
+          <option value="">Все виды документов</option>
+          {kinds.map((kind) => (
+            <option key={kind.kind} value={kind.kind}>
+              {kind.name}
+            </option>
+          ))}
+        </select>
+      </div>
+
       {loading ? (
         <div className="text-center py-8 text-gray-500 dark:text-gray-400">Загрузка...</div>
       ) : files.length === 0 ? (
@@ -104,10 +206,42 @@ export default function FileList() {
                     <p className="font-medium text-gray-900 dark:text-gray-100 truncate">{file.filename}</p>
                     <p className="text-sm text-gray-500 dark:text-gray-400">
                       {formatSize(file.file_size)} • {formatDate(file.uploaded_at)}
+                      {file.version > 1 && ` • версия ${file.version}`}
+                      {file.pinned_version > 0 && ` (для анализа закреплена версия ${file.pinned_version})`}
+                      {(file.status === 'queued' || file.status === 'processing') && ' • ⏳ обрабатывается'}
                     </p>
+                    {file.status === 'failed' && (
+                      <p className="text-xs text-red-600 dark:text-red-400 mt-1">
+                        Не удалось обработать файл: {file.status_error}
+                      </p>
+                    )}
+                    {(file.folder || file.doc_kind || file.period || file.tags?.length > 0) && (
+                      <p className="text-xs text-gray-500 dark:text-gray-400 mt-1">
+                        {[
+                          file.folder && `📂 ${file.folder}`,
+                          file.doc_kind && kindName(file.doc_kind),
+                          file.period && `период ${file.period}`,
+                          file.tags?.map((tag) => `#${tag}`).join(' '),
+                        ]
+                          .filter(Boolean)
+                          .join(' • ')}
+                      </p>
+                    )}
                   </div>
                 </div>
               </div>
+              <button
+                onClick={() => handleEdit(file)}
+                className="w-full sm:w-auto px-4 py-2 text-gray-700 dark:text-gray-300 hover:bg-gray-100 dark:hover:bg-zinc-800 rounded-lg transition-colors text-sm font-medium"
+              >
+                Изменить
+              </button>
+              <button
+                onClick={() => handleDownload(file)}
+                className="w-full sm:w-auto px-4 py-2 text-gray-700 dark:text-gray-300 hover:bg-gray-100 dark:hover:bg-zinc-800 rounded-lg transition-colors text-sm font-medium"
+              >
+                Скачать
+              </button>
               <button
                 onClick={() => handleDelete(file.id)}
                 disabled={deleting === file.id}
@@ -1,33 +1,45 @@
 'use client'
 
 import { useState } from 'react'
-import { filesAPI } from '@/lib/api'
+import { filesAPI, BulkUploadResponse } from '@/lib/api'
+
+const isArchive = (file: File) => file.name.toLowerCase().endsWith('.zip')
 
 export default function FileUpload() {
-  const [file, setFile] = useState<File | null>(null)
+  const [files, setFiles] = useState<File[]>([])
   const [loading, setLoading] = useState(false)
   const [success, setSuccess] = useState(false)
   const [error, setError] = useState('')
+  const [bulkResult, setBulkResult] = useState<BulkUploadResponse | null>(null)
 
   const handleFileChange = (e: React.ChangeEvent<HTMLInputElement>) => {
-    if (e.target.files && e.target.files[0]) {
-      setFile(e.target.files[0])
+    if (e.target.files && e.target.files.length > 0) {
+      setFiles(Array.from(e.target.files))
       setSuccess(false)
       setError('')
+      setBulkResult(null)
     }
   }
 
   const handleUpload = async () => {
-    if (!file) return
+    if (files.length === 0) return
 
     setLoading(true)
     setError('')
     setSuccess(false)
+    setBulkResult(null)
 
     try {
-      await filesAPI.upload(file)
-      setSuccess(true)
-      setFile(null)
+      // Один обычный файл - прежняя загрузка, иначе результат по каждому файлу
+      if (files.length === 1 && !isArchive(files[0])) {
+        await filesAPI.upload(files[0])
+        setSuccess(true)
+      } else {
+        const result = await filesAPI.uploadMany(files)
+        setBulkResult(result)
+        setSuccess(result.failed === 0)
+      }
+      setFiles([])
       // Сброс input
       const fileInput = document.getElementById('file-input') as HTMLInputElement
       if (fileInput) fileInput.value = ''
@@ -44,29 +56,31 @@ export default function FileUpload() {
   return (
     <div className="bg-white dark:bg-[#1a1a1a] rounded-xl shadow-sm border border-gray-200 dark:border-zinc-800 p-6">
       <h2 className="text-xl font-semibold text-gray-900 dark:text-gray-100 mb-4">
-        📤 Загрузить файл
+        📤 Загрузить файлы
       </h2>
       <div className="space-y-4">
         <div>
           <label className="block text-sm font-medium text-gray-700 dark:text-gray-300 mb-2">
-            Выберите файл
+            Выберите файлы или ZIP-архив
           </label>
           <input
             id="file-input"
             type="file"
+            multiple
+            accept=".docx,.xlsx,.txt,.csv,.md,.xml,.json,.sta,.mt940,.zip"
             onChange={handleFileChange}
             className="block w-full text-sm text-gray-500 dark:text-gray-400 file:mr-4 file:py-2 file:px-4 file:rounded-xl file:border-0 file:text-sm file:font-semibold file:bg-gradient-to-r file:from-alfa-red file:to-red-600 file:text-white hover:file:from-red-600 hover:file:to-red-700 file:cursor-pointer cursor-pointer"
           />
         </div>
 
-        {file && (
-          <div className="bg-gray-50 dark:bg-zinc-900 rounded-xl p-4 border border-gray-200 dark:border-zinc-700">
-            <p className="text-sm text-gray-700 dark:text-gray-300">
-              <span className="font-medium">Файл:</span> {file.name}
-            </p>
-            <p className="text-sm text-gray-500 dark:text-gray-400 mt-1">
-              Размер: {(file.size / 1024).toFixed(2)} KB
-            </p>
+        {files.length > 0 && (
+          <div className="bg-gray-50 dark:bg-zinc-900 rounded-xl p-4 border border-gray-200 dark:border-zinc-700 space-y-1">
+            {files.map((file) => (
+              <p key={file.name} className="text-sm text-gray-700 dark:text-gray-300">
+                <span className="font-medium">{file.name}</span>{' '}
+                <span className="text-gray-500 dark:text-gray-400">{(file.size / 1024).toFixed(2)} KB</span>
+              </p>
+            ))}
           </div>
         )}
 
@@ -78,13 +92,33 @@ export default function FileUpload() {
 
         {success && (
           <div className="bg-green-50 dark:bg-green-900/20 border border-green-200 dark:border-green-800 text-green-800 dark:text-green-200 px-4 py-3 rounded-xl text-sm">
-            Файл успешно загружен!
+            {bulkResult ? 'Все файлы успешно загружены!' : 'Файл успешно загружен!'}
+          </div>
+        )}
+
+        {bulkResult && (
+          <div className="bg-gray-50 dark:bg-zinc-900 rounded-xl p-4 border border-gray-200 dark:border-zinc-700 text-sm">
+            <p className="text-gray-700 dark:text-gray-300 mb-2">
+              Загружено: {bulkResult.uploaded}, уже были загружены: {bulkResult.duplicates}, ошибок: {bulkResult.failed}
+            </p>
+            <ul className="space-y-1 max-h-48 overflow-y-auto">
+              {bulkResult.results.map((result, index) => (
+                <li
+                  key={index}
+                  className={result.ok ? 'text-gray-600 dark:text-gray-400' : 'text-red-700 dark:text-red-300'}
+                >
+                  {result.ok ? '✓' : '✗'} {result.archive ? `${result.archive}: ` : ''}
+                  {result.filename}
+                  {result.error && ` — ${result.error}`}
+                </li>
+              ))}
+            </ul>
           </div>
         )}
 
         <button
           onClick={handleUpload}
-          disabled={!file || loading}
+          disabled={files.length === 0 || loading}
           className="w-full bg-gradient-to-r from-alfa-red to-red-600 text-white py-3 rounded-xl font-semibold hover:from-red-600 hover:to-red-700 transition-all disabled:opacity-50 disabled:cursor-not-allowed shadow-sm"
         >
           {loading ? (
@@ -93,7 +127,7 @@ export default function FileUpload() {
               Загрузка...
             </span>
           ) : (
-            'Загрузить файл'
+            files.length > 1 ? 'Загрузить файлы' : 'Загрузить файл'
           )}
         </button>
       </div>
@@ -34,6 +34,41 @@ export interface ChatMessage {
   message: string
   category?: string
   chat_id?: string
+  file_ids?: string[]
+  file_filter?: FileFilter
+}
+
+export interface FileFilter {
+  folder?: string
+  tags?: string[]
+  doc_kind?: string
+  period?: string
+}
+
+export interface FileMetaUpdate {
+  folder?: string
+  description?: string
+  tags?: string[]
+  period?: string
+  doc_kind?: string
+}
+
+// Результат загрузки одного файла при загрузке нескольких файлов или ZIP-архива
+export interface BulkUploadResult {
+  filename: string
+  archive?: string
+  ok: boolean
+  status: number
+  code?: string
+  error?: string
+  file?: { id: string; filename: string; folder?: string; duplicate?: boolean }
+}
+
+export interface BulkUploadResponse {
+  results: BulkUploadResult[]
+  uploaded: number
+  duplicates: number
+  failed: number
 }
 
 export const authAPI = {
@@ -58,14 +93,62 @@ export const filesAPI = {
     })
     return response.data
   },
-  getAll: async () => {
-    const response = await api.get('/files')
+  // Несколько файлов и ZIP-архивы: ответ содержит результат по каждому файлу
+  uploadMany: async (files: File[]): Promise<BulkUploadResponse> => {
+    const formData = new FormData()
+    files.forEach((file) => formData.append('files', file))
+    const response = await api.post('/files/upload', formData, {
+      headers: {
+        'Content-Type': 'multipart/form-data',
+      },
+    })
+    return response.data
+  },
+  getAll: async (filter: FileFilter = {}) => {
+    const params = new URLSearchParams()
+    if (filter.folder) params.append('folder', filter.folder)
+    filter.tags?.forEach((tag) => params.append('tag', tag))
+    if (filter.doc_kind) params.append('doc_kind', filter.doc_kind)
+    if (filter.period) params.append('period', filter.period)
+    const response = await api.get('/files', { params })
+    return response.data
+  },
+  update: async (id: string, data: FileMetaUpdate) => {
+    const response = await api.patch(`/files/${id}`, data)
+    return response.data
+  },
+  getFolders: async () => {
+    const response = await api.get('/files/folders')
+    return response.data
+  },
+  getTags: async () => {
+    const response = await api.get('/files/tags')
+    return response.data
+  },
+  getKinds: async () => {
+    const response = await api.get('/files/kinds')
     return response.data
   },
   delete: async (id: string) => {
     const response = await api.delete(`/files/${id}`)
     return response.data
   },
+  download: async (id: string) => {
+    const response = await api.get(`/files/${id}/download`, { responseType: 'blob' })
+    return response.data as Blob
+  },
+  getText: async (id: string) => {
+    const response = await api.get(`/files/${id}/text`)
+    return response.data
+  },
+  getStatus: async (id: string) => {
+    const response = await api.get(`/files/${id}/status`)
+    return response.data
+  },
+  reprocess: async (id: string) => {
+    const response = await api.post(`/files/${id}/reprocess`)
+    return response.data
+  },
 }
 
 export interface Chat {
@@ -99,6 +182,14 @@ export const chatsAPI = {
     const response = await api.delete(`/chats/${id}`)
     return response.data
   },
+  getFiles: async (id: string) => {
+    const response = await api.get(`/chats/${id}/files`)
+    return response.data
+  },
+  setFiles: async (id: string, fileIds: string[]) => {
+    const response = await api.put(`/chats/${id}/files`, { file_ids: fileIds })
+    return response.data
+  },
 }
 
 export const apiUser = {